@@ -0,0 +1,127 @@
+package dbratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// AdaptiveConfig configures client-side adaptive throttling, modeled on the
+// AWS SDK "adaptive" retry mode: the send rate is cut on every throttle or
+// saturation error (see ErrorClassifier) and grows back along a CUBIC curve
+// while calls succeed.
+type AdaptiveConfig struct {
+	// Min and Max bound the learned limit. Max defaults to the limit the
+	// wrapper was created with, Min to 0.5 calls per second.
+	Min rate.Limit
+	Max rate.Limit
+	// Beta is the multiplicative decrease on throttling, 0.7 by default.
+	Beta float64
+	// Scale is the CUBIC scaling constant, 0.4 by default.
+	Scale float64
+}
+
+// WithAdaptive lets the wrapper learn a safe rate from database pushback.
+// The configured limit is left alone until the first throttle signal.
+func WithAdaptive(c AdaptiveConfig) Option {
+	return func(o *options) {
+		o.adaptive = &c
+	}
+}
+
+const (
+	adaptiveSmooth = 0.8
+	adaptiveBucket = 0.5 // seconds
+)
+
+type adaptiveLimiter struct {
+	cfg     AdaptiveConfig
+	limiter *rate.Limiter
+	set     func(rate.Limit) // changes the limit, see RateLimitedDB.SetLimit
+
+	mu           sync.Mutex
+	enabled      bool
+	lastMaxRate  float64
+	lastThrottle float64 // seconds since epoch
+	timeWindow   float64
+	measuredRate float64
+	lastBucket   float64
+	requests     int
+}
+
+func newAdaptiveLimiter(c AdaptiveConfig, l *rate.Limiter, set func(rate.Limit)) *adaptiveLimiter {
+	if c.Max <= 0 {
+		c.Max = l.Limit()
+	}
+	if c.Min <= 0 {
+		c.Min = 0.5
+	}
+	if c.Beta <= 0 || c.Beta >= 1 {
+		c.Beta = 0.7
+	}
+	if c.Scale <= 0 {
+		c.Scale = 0.4
+	}
+	now := seconds(time.Now())
+	return &adaptiveLimiter{
+		cfg:          c,
+		limiter:      l,
+		set:          set,
+		lastThrottle: now,
+		lastBucket:   math.Floor(now/adaptiveBucket) * adaptiveBucket,
+	}
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// observe feeds one call outcome into the controller
+func (a *adaptiveLimiter) observe(throttled bool, t time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := seconds(t)
+	a.updateMeasuredRate(now)
+	var calculated float64
+	if throttled {
+		rateToUse := a.measuredRate
+		if a.enabled {
+			rateToUse = math.Min(rateToUse, float64(a.limiter.Limit()))
+		}
+		a.lastMaxRate = rateToUse
+		a.updateTimeWindow()
+		a.lastThrottle = now
+		calculated = rateToUse * a.cfg.Beta
+		a.enabled = true
+	} else {
+		if !a.enabled {
+			return
+		}
+		a.updateTimeWindow()
+		dt := now - a.lastThrottle
+		calculated = a.cfg.Scale*math.Pow(dt-a.timeWindow, 3) + a.lastMaxRate
+	}
+
+	newRate := math.Min(calculated, 2*a.measuredRate)
+	newRate = math.Max(newRate, float64(a.cfg.Min))
+	newRate = math.Min(newRate, float64(a.cfg.Max))
+	a.set(rate.Limit(newRate))
+}
+
+func (a *adaptiveLimiter) updateMeasuredRate(now float64) {
+	bucket := math.Floor(now/adaptiveBucket) * adaptiveBucket
+	a.requests++
+	if bucket > a.lastBucket {
+		current := float64(a.requests) / (bucket - a.lastBucket)
+		a.measuredRate = current*adaptiveSmooth + a.measuredRate*(1-adaptiveSmooth)
+		a.requests = 0
+		a.lastBucket = bucket
+	}
+}
+
+func (a *adaptiveLimiter) updateTimeWindow() {
+	a.timeWindow = math.Cbrt(a.lastMaxRate * (1 - a.cfg.Beta) / a.cfg.Scale)
+}
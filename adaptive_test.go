@@ -0,0 +1,71 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestAdaptiveLimiter 测试限流信号降低速率，成功后按 CUBIC 曲线恢复
+func TestAdaptiveLimiter(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Limit(100), 10)
+	a := newAdaptiveLimiter(AdaptiveConfig{}, limiter, limiter.SetLimit)
+
+	now := time.Now()
+	// 未出现限流前不调整速率
+	for i := 0; i < 50; i++ {
+		now = now.Add(20 * time.Millisecond)
+		a.observe(false, now)
+	}
+	if limiter.Limit() != 100 {
+		t.Fatalf("Expected limit untouched before throttling, got %v", limiter.Limit())
+	}
+
+	now = now.Add(20 * time.Millisecond)
+	a.observe(true, now)
+	throttled := limiter.Limit()
+	if throttled >= 100 || throttled < 0.5 {
+		t.Fatalf("Expected reduced limit after throttle, got %v", throttled)
+	}
+
+	// 持续成功后速率回升，但不超过 Max
+	for i := 0; i < 500; i++ {
+		now = now.Add(20 * time.Millisecond)
+		a.observe(false, now)
+	}
+	if limiter.Limit() <= throttled {
+		t.Errorf("Expected limit to recover above %v, got %v", throttled, limiter.Limit())
+	}
+	if limiter.Limit() > 100 {
+		t.Errorf("Limit exceeded Max: %v", limiter.Limit())
+	}
+
+	// 反复限流降到 Min
+	for i := 0; i < 50; i++ {
+		now = now.Add(time.Second)
+		a.observe(true, now)
+	}
+	if limiter.Limit() != 0.5 {
+		t.Errorf("Expected limit clamped to Min 0.5, got %v", limiter.Limit())
+	}
+}
+
+// TestWithAdaptive 测试分类为 throttle 的数据库错误会降低速率
+func TestWithAdaptive(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	throttleAll := ErrorClassifierFunc(func(error) ErrorClass { return ClassThrottle })
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10,
+		WithAdaptive(AdaptiveConfig{Min: 1}), WithErrorClassifier(throttleAll))
+	defer rateLimitedDB.Close()
+
+	if _, err := rateLimitedDB.ExecContext(context.Background(), "NOT SQL"); err == nil {
+		t.Fatal("Expected syntax error")
+	}
+	if got := rateLimitedDB.Limiter().Limit(); got >= 100 {
+		t.Errorf("Expected limit to drop after throttle error, got %v", got)
+	}
+}
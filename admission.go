@@ -0,0 +1,110 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"plugin"
+)
+
+// ErrAdmissionDenied is returned for calls refused by the admission policy
+// set with WithAdmissionPolicy.
+var ErrAdmissionDenied error = newError(CodeDenied, "dbratelimit: denied by admission policy")
+
+// AdmissionRequest describes a call to an AdmissionPolicy.
+type AdmissionRequest struct {
+	Query       string
+	Fingerprint string // see Fingerprint
+	Verb        Verb
+	Policy      Policy // policy of the call so far, see PolicyFrom
+}
+
+// AdmissionDecision is what an AdmissionPolicy decides for a call.
+type AdmissionDecision struct {
+	Deny   bool   // refuse the call with ErrAdmissionDenied
+	Reason string // added to the error of denied calls
+	// Policy is merged into the call's policy like WithPolicy, so it may
+	// e.g. set a cost, lower the priority or exempt the call.
+	Policy Policy
+}
+
+// AdmissionPolicy decides on calls before they wait for admission, letting
+// platform teams keep policy outside the services using it.
+type AdmissionPolicy interface {
+	Admit(ctx context.Context, req AdmissionRequest) (AdmissionDecision, error)
+}
+
+// AdmissionPolicyFunc adapts a function to AdmissionPolicy.
+type AdmissionPolicyFunc func(ctx context.Context, req AdmissionRequest) (AdmissionDecision, error)
+
+func (f AdmissionPolicyFunc) Admit(ctx context.Context, req AdmissionRequest) (AdmissionDecision, error) {
+	return f(ctx, req)
+}
+
+// WithAdmissionPolicy consults p for every call, after the defaults of
+// views and comment directives are applied. A policy that fails or panics
+// admits the call under its own policy, logging the error, so that a broken
+// policy does not take the database down with it.
+func WithAdmissionPolicy(p AdmissionPolicy) Option {
+	return func(o *options) {
+		o.admission = p
+	}
+}
+
+// LoadAdmissionPlugin loads an AdmissionPolicy from a Go plugin built with
+// -buildmode=plugin against the same version of this package. The plugin
+// exports it as a variable named AdmissionPolicy, either of type
+// AdmissionPolicy or a function with the signature of AdmissionPolicyFunc.
+// Go plugins cannot be unloaded, so updated policies should be built to a
+// new path.
+func LoadAdmissionPlugin(path string) (AdmissionPolicy, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("dbratelimit: loading admission plugin: %w", err)
+	}
+	sym, err := p.Lookup("AdmissionPolicy")
+	if err != nil {
+		return nil, fmt.Errorf("dbratelimit: loading admission plugin: %w", err)
+	}
+	switch v := sym.(type) {
+	case *AdmissionPolicy:
+		if *v != nil {
+			return *v, nil
+		}
+	case func(context.Context, AdmissionRequest) (AdmissionDecision, error):
+		return AdmissionPolicyFunc(v), nil
+	case *func(context.Context, AdmissionRequest) (AdmissionDecision, error):
+		if *v != nil {
+			return AdmissionPolicyFunc(*v), nil
+		}
+	}
+	return nil, fmt.Errorf("dbratelimit: admission plugin %s: AdmissionPolicy has unsupported type %T", path, sym)
+}
+
+// admissionPolicy applies the decision of the admission policy to ctx
+func (r *RateLimitedDB) admissionPolicy(ctx context.Context, query string, verb Verb) (context.Context, error) {
+	p := r.opts.admission
+	if p == nil {
+		return ctx, nil
+	}
+	req := AdmissionRequest{Query: query, Fingerprint: Fingerprint(query), Verb: verb, Policy: PolicyFrom(ctx)}
+	var d AdmissionDecision
+	var err error
+	if !r.safely("admission policy", func() { d, err = p.Admit(ctx, req) }) {
+		return ctx, nil
+	}
+	if err != nil {
+		log.Printf("dbratelimit: admission policy failed, admitting %q: %v", req.Fingerprint, err)
+		return ctx, nil
+	}
+	if d.Deny {
+		if d.Reason != "" {
+			return ctx, fmt.Errorf("%w: %s", ErrAdmissionDenied, d.Reason)
+		}
+		return ctx, ErrAdmissionDenied
+	}
+	if d.Policy == (Policy{}) {
+		return ctx, nil
+	}
+	return WithPolicy(ctx, d.Policy), nil
+}
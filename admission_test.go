@@ -0,0 +1,80 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestAdmissionPolicy 测试准入策略可以拒绝调用、调整成本，失败时放行
+func TestAdmissionPolicy(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var seen []AdmissionRequest
+	policy := AdmissionPolicyFunc(func(ctx context.Context, req AdmissionRequest) (AdmissionDecision, error) {
+		seen = append(seen, req)
+		switch {
+		case req.Verb == VerbDelete:
+			return AdmissionDecision{Deny: true, Reason: "no deletes"}, nil
+		case req.Policy.Tag == "broken":
+			return AdmissionDecision{}, errors.New("bundle not loaded")
+		case req.Policy.Tag == "panic":
+			panic("policy bug")
+		}
+		return AdmissionDecision{Policy: Policy{Cost: 3}}, nil
+	})
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithAdmissionPolicy(policy))
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	_, err := rateLimitedDB.ExecContext(ctx, "DELETE FROM users WHERE id = 1")
+	if !errors.Is(err, ErrAdmissionDenied) || !strings.Contains(err.Error(), "no deletes") {
+		t.Errorf("delete: err = %v, want ErrAdmissionDenied with the reason", err)
+	}
+
+	before := rateLimitedDB.Limiter().Tokens()
+	if _, err := rateLimitedDB.ExecContext(WithTag(ctx, "api"), "UPDATE users SET name = ? WHERE id = 1", "Bob"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := before - rateLimitedDB.Limiter().Tokens(); got < 2.9 || got > 3.1 {
+		t.Errorf("charged %.2f tokens, want the policy's cost of 3", got)
+	}
+	if req := seen[1]; req.Fingerprint != "update users set name = ? where id = ?" || req.Policy.Tag != "api" {
+		t.Errorf("request = %+v", req)
+	}
+
+	for _, tag := range []string{"broken", "panic"} {
+		if _, err := rateLimitedDB.ExecContext(WithTag(ctx, tag), "UPDATE users SET name = ? WHERE id = 1", "Bob"); err != nil {
+			t.Errorf("%s policy: %v, want the call admitted", tag, err)
+		}
+	}
+}
+
+// TestLoadAdmissionPlugin 测试加载不存在的插件时返回错误
+func TestLoadAdmissionPlugin(t *testing.T) {
+	if _, err := LoadAdmissionPlugin(t.TempDir() + "/missing.so"); err == nil {
+		t.Error("want an error for a missing plugin")
+	}
+}
+
+// TestAdmissionDeniedQueryRow 测试被拒绝的 QueryRowContext 不会到达驱动
+func TestAdmissionDeniedQueryRow(t *testing.T) {
+	db, f := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithAdmissionPolicy(AdmissionPolicyFunc(
+		func(context.Context, AdmissionRequest) (AdmissionDecision, error) {
+			return AdmissionDecision{Deny: true, Reason: "no"}, nil
+		})))
+	defer rateLimitedDB.Close()
+
+	var n int
+	if err := rateLimitedDB.QueryRowContext(context.Background(), "SELECT n FROM t").Scan(&n); !errors.Is(err, ErrAdmissionDenied) {
+		t.Fatalf("want ErrAdmissionDenied, got %v", err)
+	}
+	if calls := f.Methods(); len(calls) != 0 {
+		t.Errorf("driver calls = %v, want none", calls)
+	}
+}
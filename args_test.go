@@ -0,0 +1,124 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// intRange stands for driver-specific argument types such as pgtype
+// ranges: not a driver.Value, and accepted only by the driver's checker
+type intRange struct{ Lo, Hi int }
+
+// stmtOnly is accepted only by the checker of prepared statements
+type stmtOnly struct{}
+
+// argsDriver accepts sql.Out and intRange arguments through
+// driver.NamedValueChecker, like the MSSQL and Oracle drivers and pgx
+type argsDriver struct{}
+
+func (argsDriver) Open(string) (driver.Conn, error) { return argsConn{}, nil }
+
+type argsConn struct{}
+
+func (argsConn) Prepare(string) (driver.Stmt, error) { return argsStmt{}, nil }
+func (argsConn) Close() error                        { return nil }
+func (argsConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (argsConn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch nv.Value.(type) {
+	case sql.Out, intRange:
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (argsConn) ExecContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Result, error) {
+	return argsExec(args)
+}
+
+type argsStmt struct{}
+
+func (argsStmt) Close() error                               { return nil }
+func (argsStmt) NumInput() int                              { return -1 }
+func (argsStmt) Exec([]driver.Value) (driver.Result, error) { return nil, errors.New("not supported") }
+func (argsStmt) Query([]driver.Value) (driver.Rows, error)  { return nil, errors.New("not supported") }
+
+func (argsStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	switch nv.Value.(type) {
+	case sql.Out, intRange, stmtOnly:
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (argsStmt) ExecContext(_ context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return argsExec(args)
+}
+
+// argsExec sets output parameters to 42 and reports the arguments it got
+func argsExec(args []driver.NamedValue) (driver.Result, error) {
+	for _, arg := range args {
+		switch v := arg.Value.(type) {
+		case sql.Out:
+			*v.Dest.(*int) = 42
+		case intRange, stmtOnly, int64:
+		default:
+			return nil, fmt.Errorf("unexpected argument %T", v)
+		}
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+func init() {
+	sql.Register("dbratelimit-args", argsDriver{})
+}
+
+// TestDriverSpecificArgs 测试 sql.Out 和驱动特有的参数类型原样传给驱动
+func TestDriverSpecificArgs(t *testing.T) {
+	ctx := context.Background()
+	for _, opts := range [][]Option{nil, {WithStmtCache(4)}} {
+		db, err := sql.Open("dbratelimit-args", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rateLimitedDB := Wrap(db, rate.Limit(100), 10, opts...)
+		var out int
+		res, err := rateLimitedDB.ExecContext(ctx, "EXEC get_total ?, ?, ?", intRange{1, 5}, 7, sql.Out{Dest: &out})
+		if err != nil {
+			t.Errorf("exec: %v", err)
+		} else if n, _ := res.RowsAffected(); n != 3 || out != 42 {
+			t.Errorf("exec passed %d arguments and set out to %d, want 3 and 42", n, out)
+		}
+		rateLimitedDB.Close()
+	}
+}
+
+// TestDriverNameArgs 测试 DriverName 包装的预处理语句保留驱动的参数检查
+func TestDriverNameArgs(t *testing.T) {
+	db, err := sql.Open(DriverName, "dbratelimit-args:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	var out int
+	if _, err := db.ExecContext(ctx, "EXEC get_total ?, ?", intRange{1, 5}, sql.Out{Dest: &out}); err != nil || out != 42 {
+		t.Errorf("exec: out = %d, %v", out, err)
+	}
+	stmt, err := db.PrepareContext(ctx, "EXEC get_total ?, ?, ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	out = 0
+	if _, err := stmt.ExecContext(ctx, stmtOnly{}, intRange{1, 5}, sql.Out{Dest: &out}); err != nil || out != 42 {
+		t.Errorf("prepared exec: out = %d, %v", out, err)
+	}
+}
@@ -0,0 +1,234 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditKind is why a call was audited.
+type AuditKind int
+
+const (
+	AuditRejected AuditKind = iota // the call failed admission
+	AuditExempt                    // the call bypassed limiting, see WithExempt
+	AuditRaw                       // Raw was called
+	AuditBoost                     // a boost set with WithBoost was first used
+)
+
+func (k AuditKind) String() string {
+	switch k {
+	case AuditRejected:
+		return "rejected"
+	case AuditExempt:
+		return "exempt"
+	case AuditRaw:
+		return "raw"
+	case AuditBoost:
+		return "boost"
+	}
+	return "unknown"
+}
+
+func (k AuditKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *AuditKind) UnmarshalText(b []byte) error {
+	for _, kind := range []AuditKind{AuditRejected, AuditExempt, AuditRaw, AuditBoost} {
+		if string(b) == kind.String() {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("dbratelimit: unknown audit kind %q", b)
+}
+
+// AuditRecord describes a call that was rejected or circumvented the
+// limiter.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Kind   AuditKind `json:"kind"`
+	Query  string    `json:"query,omitempty"`
+	Tag    string    `json:"tag,omitempty"`
+	Key    string    `json:"key,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Detail string    `json:"detail,omitempty"` // e.g. the factor and expiry of a boost
+	Caller string    `json:"caller,omitempty"` // file:line of the application code making the call
+}
+
+// AuditSink persists audit records. Audit is called synchronously on the
+// calling goroutine, so slow sinks should buffer.
+type AuditSink interface {
+	Audit(AuditRecord) error
+}
+
+// WithAuditSink records every rejected call, every exempt call, every use
+// of Raw and the first use of every boost to sink. Failures to record are
+// counted by AuditErrors.
+func WithAuditSink(sink AuditSink) Option {
+	return func(o *options) {
+		o.audit = sink
+	}
+}
+
+// AuditErrors returns the number of records the audit sink failed to take.
+func (r *RateLimitedDB) AuditErrors() uint64 {
+	return atomic.LoadUint64(&r.auditErrors)
+}
+
+// auditCall records a call made with ctx, if auditing is enabled
+func (r *RateLimitedDB) auditCall(ctx context.Context, kind AuditKind, query string, err error) {
+	r.auditDetail(ctx, kind, query, err, "")
+}
+
+func (r *RateLimitedDB) auditDetail(ctx context.Context, kind AuditKind, query string, err error, detail string) {
+	if r.opts.audit == nil {
+		return
+	}
+	rec := AuditRecord{
+		Time:   time.Now(),
+		Kind:   kind,
+		Query:  query,
+		Tag:    TagFrom(ctx),
+		Key:    KeyFrom(ctx),
+		Detail: detail,
+		Caller: caller(),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	var failed error
+	if !r.safely("audit sink", func() { failed = r.opts.audit.Audit(rec) }) || failed != nil {
+		atomic.AddUint64(&r.auditErrors, 1)
+	}
+}
+
+// caller returns the first frame outside this package, database/sql and GORM
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		f, more := frames.Next()
+		internal := strings.HasPrefix(f.Function, "github.com/nickxudotme/dbratelimit.") && !strings.HasSuffix(f.File, "_test.go") ||
+			strings.HasPrefix(f.Function, "database/sql.") ||
+			strings.HasPrefix(f.Function, "gorm.io/")
+		if !internal {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// NewJSONAuditSink returns a sink writing one JSON object per line to w,
+// e.g. an *os.File opened for appending.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{w: w}
+}
+
+type jsonAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *jsonAuditSink) Audit(rec AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// errAuditBufferFull is returned by WebhookAuditSink when records arrive
+// faster than they can be posted
+var errAuditBufferFull = errors.New("dbratelimit: audit buffer full")
+
+// WebhookAuditSink posts records as JSON to a URL from a background
+// goroutine, so calls are not delayed by the webhook.
+type WebhookAuditSink struct {
+	url     string
+	client  *http.Client
+	records chan AuditRecord
+	done    chan struct{}
+	failed  uint64 // posts that failed, accessed atomically
+}
+
+// NewWebhookAuditSink returns a sink posting each record to url, buffering
+// up to buffer records. A nil client uses one with a 5s timeout.
+func NewWebhookAuditSink(url string, client *http.Client, buffer int) *WebhookAuditSink {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if buffer <= 0 {
+		buffer = 1024
+	}
+	s := &WebhookAuditSink{
+		url:     url,
+		client:  client,
+		records: make(chan AuditRecord, buffer),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *WebhookAuditSink) Audit(rec AuditRecord) error {
+	select {
+	case s.records <- rec:
+		return nil
+	default:
+		return errAuditBufferFull
+	}
+}
+
+// Failed returns the number of records the webhook did not accept.
+func (s *WebhookAuditSink) Failed() uint64 {
+	return atomic.LoadUint64(&s.failed)
+}
+
+// Close posts the buffered records and stops the sink. Audit must not be
+// called after Close.
+func (s *WebhookAuditSink) Close() error {
+	close(s.records)
+	<-s.done
+	return nil
+}
+
+func (s *WebhookAuditSink) run() {
+	defer close(s.done)
+	for rec := range s.records {
+		if err := s.post(rec); err != nil {
+			atomic.AddUint64(&s.failed, 1)
+		}
+	}
+}
+
+func (s *WebhookAuditSink) post(rec AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("dbratelimit: audit webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestAuditSink 测试拒绝、豁免和 Raw 调用被记录，并带有调用位置
+func TestAuditSink(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1,
+		WithAuditSink(NewJSONAuditSink(&buf)),
+		WithOverflowPolicy(OverflowPolicy{Mode: OverflowReject}))
+	defer rateLimitedDB.Close()
+
+	ctx := WithTag(context.Background(), "report")
+	rateLimitedDB.ExecContext(ctx, "SELECT 1")
+	rateLimitedDB.ExecContext(ctx, "SELECT 2")
+	rateLimitedDB.ExecContext(WithExempt(ctx), "SELECT 3")
+	rateLimitedDB.Raw()
+
+	var records []AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Invalid record %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"kind":"rejected"`) {
+		t.Errorf("Expected kinds encoded as text, got %s", buf.String())
+	}
+	want := []struct {
+		kind  AuditKind
+		query string
+	}{{AuditRejected, "SELECT 2"}, {AuditExempt, "SELECT 3"}, {AuditRaw, ""}}
+	for i, w := range want {
+		rec := records[i]
+		if rec.Kind != w.kind || rec.Query != w.query {
+			t.Errorf("Record %d = %+v, want %v %q", i, rec, w.kind, w.query)
+		}
+		if !strings.Contains(rec.Caller, "audit_test.go") {
+			t.Errorf("Record %d: expected caller in audit_test.go, got %q", i, rec.Caller)
+		}
+	}
+	if records[0].Tag != "report" || records[0].Error == "" {
+		t.Errorf("Expected tag and error on rejection, got %+v", records[0])
+	}
+}
+
+// TestWebhookAuditSink 测试 webhook sink 在后台投递记录
+func TestWebhookAuditSink(t *testing.T) {
+	var mu sync.Mutex
+	var got []AuditRecord
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var rec AuditRecord
+		if err := json.NewDecoder(req.Body).Decode(&rec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		got = append(got, rec)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	sink := NewWebhookAuditSink(server.URL, nil, 0)
+	for _, q := range []string{"SELECT 1", "SELECT 2"} {
+		if err := sink.Audit(AuditRecord{Kind: AuditExempt, Query: q}); err != nil {
+			t.Fatalf("Audit failed: %v", err)
+		}
+	}
+	sink.Close()
+	if len(got) != 2 || got[1].Query != "SELECT 2" || sink.Failed() != 0 {
+		t.Errorf("Expected 2 records delivered, got %+v (%d failed)", got, sink.Failed())
+	}
+}
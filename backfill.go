@@ -0,0 +1,154 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backfill describes a keyset-paginated UPDATE or DELETE over a table, in
+// the style of gh-ost and pt-online-schema-change.
+type Backfill struct {
+	// Table and Key name the table and its unique, ordered key column.
+	Table string
+	Key   string
+	// Statement is run once per chunk with the chunk's key range (lo, hi]
+	// as its two arguments, e.g.
+	// "UPDATE users SET flag = 1 WHERE id > ? AND id <= ?", or $1 and $2
+	// with BindDollar, which the generated boundary queries follow too.
+	// Without Start, the first lo is the smallest key minus one, which
+	// requires a numeric key.
+	Statement string
+	// Start resumes after this key (exclusive). Nil starts at the beginning.
+	Start any
+
+	// ChunkSize is the initial number of keys per chunk (default 1000). It is
+	// halved when a chunk runs longer than TargetLatency and doubled when it
+	// runs in under half of it, staying within [MinChunk, MaxChunk].
+	ChunkSize     int
+	MinChunk      int
+	MaxChunk      int
+	TargetLatency time.Duration // default 500ms
+
+	// OnChunk is called after every chunk; persist p.LastKey to resume
+	// later. Returning an error stops the backfill.
+	OnChunk func(ctx context.Context, p BackfillProgress) error
+}
+
+// BackfillProgress is reported after each chunk.
+type BackfillProgress struct {
+	LastKey   any // checkpoint: pass as Start to resume
+	Chunks    int
+	Rows      int64 // rows affected so far
+	ChunkSize int   // size used for the next chunk
+	Latency   time.Duration
+}
+
+func (b Backfill) withDefaults() Backfill {
+	if b.ChunkSize <= 0 {
+		b.ChunkSize = 1000
+	}
+	if b.MinChunk <= 0 {
+		b.MinChunk = 1
+	}
+	if b.MaxChunk <= 0 {
+		b.MaxChunk = 100 * b.ChunkSize
+	}
+	if b.TargetLatency <= 0 {
+		b.TargetLatency = 500 * time.Millisecond
+	}
+	return b
+}
+
+// Backfill runs b to completion through the limiter. Both the boundary
+// lookups and the chunk statements are rate limited. The returned progress
+// is the last one reported, also on error.
+func (r *RateLimitedDB) Backfill(ctx context.Context, b Backfill) (BackfillProgress, error) {
+	if b.Table == "" || b.Key == "" || b.Statement == "" {
+		return BackfillProgress{}, errors.New("dbratelimit: backfill needs Table, Key and Statement")
+	}
+	b = b.withDefaults()
+	p := BackfillProgress{LastKey: b.Start, ChunkSize: b.ChunkSize}
+	for {
+		hi, ok, err := r.chunkUpperBound(ctx, b, p.LastKey, p.ChunkSize)
+		if err != nil {
+			return p, err
+		}
+		if !ok {
+			return p, nil
+		}
+
+		lo := p.LastKey
+		if lo == nil {
+			// open range below: use a bound that includes the first key
+			lo, err = r.firstKeyBelow(ctx, b)
+			if err != nil {
+				return p, err
+			}
+		}
+		res, latency, err := r.exec(ctx, b.Statement, lo, hi)
+		if err != nil {
+			return p, fmt.Errorf("dbratelimit: backfill chunk after %v: %w", p.LastKey, err)
+		}
+		n, _ := res.RowsAffected()
+
+		p.LastKey = hi
+		p.Chunks++
+		p.Rows += n
+		p.Latency = latency
+		p.ChunkSize = b.tune(p.ChunkSize, latency)
+		if b.OnChunk != nil {
+			if err := b.OnChunk(ctx, p); err != nil {
+				return p, err
+			}
+		}
+	}
+}
+
+// tune adjusts the chunk size based on the last chunk's latency
+func (b Backfill) tune(size int, latency time.Duration) int {
+	switch {
+	case latency > b.TargetLatency:
+		size /= 2
+	case latency < b.TargetLatency/2:
+		size *= 2
+	}
+	if size < b.MinChunk {
+		size = b.MinChunk
+	}
+	if size > b.MaxChunk {
+		size = b.MaxChunk
+	}
+	return size
+}
+
+// chunkUpperBound returns the key closing the next chunk of size keys after
+// last. ok is false when no keys remain.
+func (r *RateLimitedDB) chunkUpperBound(ctx context.Context, b Backfill, last any, size int) (any, bool, error) {
+	where, args := "", []any{}
+	if last != nil {
+		where = fmt.Sprintf(" WHERE %s > %s", b.Key, bindVar(r.opts.bindStyle, 1))
+		args = append(args, last)
+	}
+	query := fmt.Sprintf("SELECT MAX(%s) FROM (SELECT %s FROM %s%s ORDER BY %s LIMIT %d) chunk",
+		b.Key, b.Key, b.Table, where, b.Key, size)
+
+	var hi any
+	if err := r.QueryRowLazy(ctx, query, args...).Scan(&hi); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return hi, hi != nil, nil
+}
+
+// firstKeyBelow returns a lower bound strictly below the smallest key
+func (r *RateLimitedDB) firstKeyBelow(ctx context.Context, b Backfill) (any, error) {
+	var lo any
+	query := fmt.Sprintf("SELECT MIN(%s) - 1 FROM %s", b.Key, b.Table)
+	err := r.QueryRowLazy(ctx, query).Scan(&lo)
+	return lo, err
+}
@@ -0,0 +1,163 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// seedUsers 插入 n 个额外用户
+func seedUsers(t *testing.T, r *RateLimitedDB, n int) {
+	rows := make([][]any, 0, n)
+	for i := 0; i < n; i++ {
+		rows = append(rows, []any{fmt.Sprintf("User%d", i), "old"})
+	}
+	if _, err := r.ExecChunked(context.Background(), "INSERT INTO users (name, email) VALUES", rows, 100); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+}
+
+// TestBackfill 测试分块回填、chunk 大小调整和检查点
+func TestBackfill(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100)
+	defer rateLimitedDB.Close()
+	seedUsers(t, rateLimitedDB, 99)
+
+	var checkpoints []BackfillProgress
+	p, err := rateLimitedDB.Backfill(context.Background(), Backfill{
+		Table:         "users",
+		Key:           "id",
+		Statement:     "UPDATE users SET email = 'new' WHERE id > ? AND id <= ?",
+		ChunkSize:     10,
+		MaxChunk:      40,
+		TargetLatency: time.Hour,
+		OnChunk: func(_ context.Context, p BackfillProgress) error {
+			checkpoints = append(checkpoints, p)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+	if p.Rows != 100 {
+		t.Errorf("Expected 100 rows updated, got %d", p.Rows)
+	}
+	// chunk 很快，大小按 10, 20, 40, 40 增长
+	if p.Chunks != 4 || checkpoints[0].ChunkSize != 20 || checkpoints[2].ChunkSize != 40 {
+		t.Errorf("Unexpected chunking: %+v", checkpoints)
+	}
+
+	var left int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email != 'new'").Scan(&left); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if left != 0 {
+		t.Errorf("Expected all rows backfilled, %d left", left)
+	}
+}
+
+// TestBackfillResume 测试从检查点恢复
+func TestBackfillResume(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100)
+	defer rateLimitedDB.Close()
+	seedUsers(t, rateLimitedDB, 29)
+
+	stop := errors.New("stop")
+	b := Backfill{
+		Table:     "users",
+		Key:       "id",
+		Statement: "DELETE FROM users WHERE id > ? AND id <= ?",
+		ChunkSize: 10,
+		MinChunk:  10,
+		MaxChunk:  10,
+		OnChunk: func(_ context.Context, p BackfillProgress) error {
+			if p.Chunks == 1 {
+				return stop
+			}
+			return nil
+		},
+	}
+	p, err := rateLimitedDB.Backfill(context.Background(), b)
+	if !errors.Is(err, stop) {
+		t.Fatalf("Expected stop error, got %v", err)
+	}
+
+	b.Start = p.LastKey
+	b.OnChunk = nil
+	p, err = rateLimitedDB.Backfill(context.Background(), b)
+	if err != nil {
+		t.Fatalf("Resumed backfill failed: %v", err)
+	}
+	if p.Chunks != 2 || p.Rows != 20 {
+		t.Errorf("Expected 2 more chunks deleting 20 rows, got %+v", p)
+	}
+
+	if _, err := rateLimitedDB.Backfill(context.Background(), Backfill{}); err == nil {
+		t.Error("Expected error for empty backfill")
+	}
+}
+
+// TestBackfillBoundaryDenied 测试边界查询被拒绝时回填停止并返回错误，而不是绕过限流执行
+func TestBackfillBoundaryDenied(t *testing.T) {
+	db, f := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithAdmissionPolicy(AdmissionPolicyFunc(
+		func(_ context.Context, req AdmissionRequest) (AdmissionDecision, error) {
+			return AdmissionDecision{Deny: req.Verb == VerbSelect}, nil
+		})))
+	defer rateLimitedDB.Close()
+
+	_, err := rateLimitedDB.Backfill(context.Background(), Backfill{
+		Table:     "users",
+		Key:       "id",
+		Statement: "UPDATE users SET email = 'new' WHERE id > ? AND id <= ?",
+	})
+	if !errors.Is(err, ErrAdmissionDenied) {
+		t.Fatalf("Expected ErrAdmissionDenied, got %v", err)
+	}
+	if calls := f.Methods(); len(calls) != 0 {
+		t.Errorf("driver calls = %v, want none", calls)
+	}
+}
+
+// TestBackfillBindDollar 测试边界查询按绑定风格生成占位符
+func TestBackfillBindDollar(t *testing.T) {
+	db, f := setupFakeDB(t)
+	// 假驱动总是返回同一行，第一次边界查询后就让回填停下
+	stop := errors.New("stop")
+	f.handle = func(_ context.Context, method, _ string) error {
+		if method == "Query" {
+			return stop
+		}
+		return nil
+	}
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithBindStyle(BindDollar))
+	defer rateLimitedDB.Close()
+
+	_, err := rateLimitedDB.Backfill(context.Background(), Backfill{
+		Table:     "users",
+		Key:       "id",
+		Statement: "UPDATE users SET email = 'new' WHERE id > $1 AND id <= $2",
+		Start:     10,
+		ChunkSize: 5,
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("Expected the boundary query's error, got %v", err)
+	}
+	calls := f.Calls()
+	if len(calls) == 0 {
+		t.Fatal("Expected a boundary query")
+	}
+	if want := "SELECT MAX(id) FROM (SELECT id FROM users WHERE id > $1 ORDER BY id LIMIT 5) chunk"; calls[0].Query != want {
+		t.Errorf("Boundary query = %q, want %q", calls[0].Query, want)
+	}
+}
@@ -0,0 +1,75 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// boost is the temporary increase carried by a context from WithBoost
+type boost struct {
+	factor float64
+	until  time.Time
+
+	mu       sync.Mutex
+	limiters map[*dbState]*rate.Limiter // shared by views
+}
+
+// WithBoost raises the limit by factor for calls made with ctx until d from
+// now, e.g. for a controlled backfill window, without changing the limits
+// of other calls or the configuration. Boosted calls first draw on a bucket
+// of their own holding the extra (factor-1) times the main limit and burst
+// in effect when the boost is first used, and wait for the main limiter
+// like other calls once it is empty. The boost expires by itself; its
+// first use on each RateLimitedDB is audited with AuditBoost. A factor of
+// at most 1 or a non-positive d returns ctx unchanged.
+func WithBoost(ctx context.Context, factor float64, d time.Duration) context.Context {
+	if !(factor > 1) || d <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, boostKey, &boost{
+		factor:   factor,
+		until:    time.Now().Add(d),
+		limiters: make(map[*dbState]*rate.Limiter),
+	})
+}
+
+// BoostFrom returns the factor and expiry of the boost carried by ctx, if
+// any, expired or not.
+func BoostFrom(ctx context.Context) (factor float64, until time.Time, ok bool) {
+	b, ok := ctx.Value(boostKey).(*boost)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	return b.factor, b.until, true
+}
+
+// boosted takes n tokens from the bucket of ctx's boost if it is still in
+// effect and has them available
+func (r *RateLimitedDB) boosted(ctx context.Context, n int, h *holds) bool {
+	b, ok := ctx.Value(boostKey).(*boost)
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if !now.Before(b.until) || r.limiter.Limit() == rate.Inf {
+		return false
+	}
+	b.mu.Lock()
+	l, ok := b.limiters[r.dbState]
+	if !ok {
+		extra := b.factor - 1
+		l = rate.NewLimiter(r.limiter.Limit()*rate.Limit(extra), max(1, int(float64(r.limiter.Burst())*extra)))
+		b.limiters[r.dbState] = l
+	}
+	b.mu.Unlock()
+	if !ok {
+		query, _ := ctx.Value(queryKey).(string)
+		r.auditDetail(ctx, AuditBoost, query, nil,
+			fmt.Sprintf("factor %g until %s", b.factor, b.until.Format(time.RFC3339)))
+	}
+	return allowN(l, now, n, h)
+}
@@ -0,0 +1,78 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestBoost 测试临时提升只作用于携带它的上下文，并被审计
+func TestBoost(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1,
+		WithAuditSink(NewJSONAuditSink(&buf)),
+		WithOverflowPolicy(OverflowPolicy{Mode: OverflowReject}))
+	defer rateLimitedDB.Close()
+
+	boosted := WithBoost(WithTag(context.Background(), "backfill"), 3, time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := rateLimitedDB.ExecContext(boosted, "SELECT 1"); err != nil {
+			t.Fatalf("boosted call %d: %v", i, err)
+		}
+	}
+	if _, err := rateLimitedDB.ExecContext(boosted, "SELECT 1"); err == nil {
+		t.Error("expected the boost and the main budget to be used up")
+	}
+	if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err == nil {
+		t.Error("expected calls without the boost to be limited")
+	}
+
+	var boosts []AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Invalid record %q: %v", line, err)
+		}
+		if rec.Kind == AuditBoost {
+			boosts = append(boosts, rec)
+		}
+	}
+	if len(boosts) != 1 || boosts[0].Tag != "backfill" || !strings.Contains(boosts[0].Detail, "factor 3") {
+		t.Errorf("boost records = %+v, want one for the backfill", boosts)
+	}
+}
+
+// TestBoostExpires 测试提升到期后自动失效
+func TestBoostExpires(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1, WithOverflowPolicy(OverflowPolicy{Mode: OverflowReject}))
+	defer rateLimitedDB.Close()
+
+	boosted := WithBoost(context.Background(), 10, 10*time.Millisecond)
+	if factor, _, ok := BoostFrom(boosted); !ok || factor != 10 {
+		t.Fatalf("BoostFrom = %v, %v", factor, ok)
+	}
+	if _, err := rateLimitedDB.ExecContext(boosted, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := rateLimitedDB.ExecContext(boosted, "SELECT 1"); err != nil {
+		t.Fatalf("expected the main budget to admit the call: %v", err)
+	}
+	if _, err := rateLimitedDB.ExecContext(boosted, "SELECT 1"); err == nil {
+		t.Error("expected the expired boost to add nothing")
+	}
+	if WithBoost(context.Background(), 1, time.Minute) != context.Background() {
+		t.Error("expected a factor of 1 to leave ctx unchanged")
+	}
+}
@@ -0,0 +1,170 @@
+package dbratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// BudgetAlert reports that the calls of a key, or all calls for a quota,
+// used a given fraction of their budget in the current window.
+type BudgetAlert struct {
+	Key       string        // tenant set with WithKey; "" for quotas, which all calls share
+	Source    string        // "keyed" for WithKeyedLimit, "quota" for WithQuotas
+	Window    time.Duration // length of the window
+	Start     time.Time     // start of the window
+	Budget    float64       // tokens available in the window
+	Used      float64       // tokens used so far
+	Threshold float64       // fraction of Budget reached, e.g. 0.8
+}
+
+// BudgetNotifier receives budget alerts, e.g. to warn a tenant before it is
+// throttled. Notify is called from a single goroutine, in the order the
+// thresholds were crossed; alerts arriving while 64 are pending are dropped
+// rather than slowing calls down.
+type BudgetNotifier interface {
+	Notify(BudgetAlert)
+}
+
+// BudgetNotifierFunc adapts a function to BudgetNotifier.
+type BudgetNotifierFunc func(BudgetAlert)
+
+func (f BudgetNotifierFunc) Notify(a BudgetAlert) {
+	f(a)
+}
+
+// BudgetAlerts configures WithBudgetAlerts.
+type BudgetAlerts struct {
+	Notifier BudgetNotifier
+	// Thresholds are the fractions of the budget that are alerted on, each
+	// at most once per window. Default 0.8 and 1.
+	Thresholds []float64
+	// Window is the budget period for keyed limits, whose budget is the
+	// limit times Window plus the burst. Default one minute. Quotas use
+	// their own Count per Per.
+	Window time.Duration
+}
+
+// WithBudgetAlerts tracks the tokens used per key against the keyed limit,
+// and by all calls against each quota, in fixed windows, and notifies
+// a.Notifier when a threshold is crossed. It has no effect without
+// WithKeyedLimit or WithQuotas.
+func WithBudgetAlerts(a BudgetAlerts) Option {
+	return func(o *options) {
+		if len(a.Thresholds) == 0 {
+			a.Thresholds = []float64{0.8, 1}
+		}
+		a.Thresholds = append([]float64(nil), a.Thresholds...)
+		sort.Float64s(a.Thresholds)
+		if a.Window <= 0 {
+			a.Window = time.Minute
+		}
+		o.budgetAlerts = &a
+	}
+}
+
+type budgetKey struct {
+	source string
+	index  int // quota index
+	key    string
+}
+
+type budgetTracker struct {
+	cfg       BudgetAlerts
+	mu        sync.Mutex
+	windows   map[budgetKey]*budgetWindow
+	lastSweep time.Time
+	alerts    chan BudgetAlert
+}
+
+type budgetWindow struct {
+	start time.Time
+	end   time.Time
+	used  float64
+	fired int // thresholds already alerted on in this window
+}
+
+func newBudgetTracker(cfg BudgetAlerts) *budgetTracker {
+	return &budgetTracker{
+		cfg:     cfg,
+		windows: make(map[budgetKey]*budgetWindow),
+		alerts:  make(chan BudgetAlert, 64),
+	}
+}
+
+// budgetLoop hands alerts to the notifier until Close
+func (r *RateLimitedDB) budgetLoop() {
+	t := r.budgets
+	for {
+		select {
+		case a := <-t.alerts:
+			r.safely("budget notifier", func() { t.cfg.Notifier.Notify(a) })
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// chargeBudgets records n tokens used by a call with the given key
+func (r *RateLimitedDB) chargeBudgets(key string, n int, now time.Time) {
+	t := r.budgets
+	if r.keyed != nil && key != "" {
+		l := r.keyed.limit
+		if b := r.keyed.lookup(key); b != nil {
+			l = LimitConfig{Limit: b.limiter.Limit(), Burst: b.limiter.Burst()}
+		}
+		budget := float64(l.Limit)*t.cfg.Window.Seconds() + float64(l.Burst)
+		r.chargeBudget(budgetKey{source: "keyed", key: key}, t.cfg.Window, budget, n, now)
+	}
+	for i, q := range r.opts.quotas {
+		if q.Count > 0 && q.Per > 0 {
+			r.chargeBudget(budgetKey{source: "quota", index: i}, q.Per, float64(q.Count), n, now)
+		}
+	}
+}
+
+func (r *RateLimitedDB) chargeBudget(k budgetKey, window time.Duration, budget float64, n int, now time.Time) {
+	t := r.budgets
+	start := now.Truncate(window)
+	t.mu.Lock()
+	t.sweep(now)
+	w := t.windows[k]
+	if w == nil || !w.start.Equal(start) {
+		w = &budgetWindow{start: start, end: start.Add(window)}
+		t.windows[k] = w
+	}
+	w.used += float64(n)
+	for w.fired < len(t.cfg.Thresholds) && budget > 0 && w.used >= t.cfg.Thresholds[w.fired]*budget {
+		a := BudgetAlert{
+			Key:       k.key,
+			Source:    k.source,
+			Window:    window,
+			Start:     start,
+			Budget:    budget,
+			Used:      w.used,
+			Threshold: t.cfg.Thresholds[w.fired],
+		}
+		w.fired++
+		// queued under the lock to keep the alerts of a window in order
+		select {
+		case t.alerts <- a:
+		default:
+		}
+	}
+	t.mu.Unlock()
+}
+
+// sweep drops the windows that are over, so that keys no longer used, such
+// as the IDs of past users, do not hold memory. It scans at most once per
+// keyed window; t.mu must be held.
+func (t *budgetTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.cfg.Window {
+		return
+	}
+	t.lastSweep = now
+	for k, w := range t.windows {
+		if !now.Before(w.end) {
+			delete(t.windows, k)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestBudgetAlerts 测试租户用到窗口预算的 80% 和 100% 时各通知一次
+func TestBudgetAlerts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	alerts := make(chan BudgetAlert, 10)
+	rateLimitedDB := Wrap(db, rate.Inf, 1,
+		WithKeyedLimit(0, 10),
+		WithBudgetAlerts(BudgetAlerts{
+			Notifier: BudgetNotifierFunc(func(a BudgetAlert) { alerts <- a }),
+			Window:   24 * time.Hour,
+		}))
+	defer rateLimitedDB.Close()
+
+	acme := WithKey(context.Background(), "acme")
+	for _, cost := range []int{4, 4, 1, 1} {
+		if _, err := rateLimitedDB.ExecContext(WithCost(acme, cost), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rateLimitedDB.ExecContext(WithKey(context.Background(), "globex"), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []float64{0.8, 1} {
+		select {
+		case a := <-alerts:
+			if a.Key != "acme" || a.Source != "keyed" || a.Threshold != want || a.Budget != 10 {
+				t.Errorf("alert = %+v, want acme reaching %v of 10 keyed tokens", a, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no alert for threshold %v", want)
+		}
+	}
+	select {
+	case a := <-alerts:
+		t.Errorf("unexpected alert %+v", a)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestBudgetAlertsQuota 测试配额按所有调用共享的预算告警
+func TestBudgetAlertsQuota(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	alerts := make(chan BudgetAlert, 10)
+	rateLimitedDB := Wrap(db, rate.Inf, 1,
+		WithQuotas(Quota{Count: 5, Per: 24 * time.Hour}),
+		WithBudgetAlerts(BudgetAlerts{
+			Notifier:   BudgetNotifierFunc(func(a BudgetAlert) { alerts <- a }),
+			Thresholds: []float64{0.5},
+		}))
+	defer rateLimitedDB.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case a := <-alerts:
+		if a.Source != "quota" || a.Key != "" || a.Used != 3 || a.Window != 24*time.Hour {
+			t.Errorf("alert = %+v, want the shared quota at 3 of 5", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no quota alert")
+	}
+}
+
+// TestBudgetWindowsSwept 测试过期窗口会被清理，预算按 key 桶实际的限额计算
+func TestBudgetWindowsSwept(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	alerts := make(chan BudgetAlert, 10)
+	r := Wrap(db, rate.Inf, 1,
+		WithKeyedLimit(0, 10),
+		WithBudgetAlerts(BudgetAlerts{
+			Notifier:   BudgetNotifierFunc(func(a BudgetAlert) { alerts <- a }),
+			Thresholds: []float64{1},
+			Window:     time.Minute,
+		}))
+	defer r.Close()
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		r.chargeBudgets(fmt.Sprintf("user-%d", i), 1, now)
+	}
+	r.chargeBudgets("acme", 1, now.Add(2*time.Minute))
+	r.budgets.mu.Lock()
+	if got := len(r.budgets.windows); got != 1 {
+		t.Errorf("Expected the windows that are over to be dropped, %d left", got)
+	}
+	r.budgets.mu.Unlock()
+
+	// 单个 key 的桶调整过限额时按它的预算告警
+	r.keyed.get("acme").limiter.SetBurst(2)
+	r.chargeBudgets("acme", 1, now.Add(2*time.Minute))
+	select {
+	case a := <-alerts:
+		if a.Key != "acme" || a.Budget != 2 {
+			t.Errorf("alert = %+v, want acme reaching its budget of 2", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert for the bucket's own budget")
+	}
+}
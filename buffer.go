@@ -0,0 +1,144 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ErrWriteBufferFull is returned for writes that cannot be buffered during
+// a write freeze because the buffer is full.
+var ErrWriteBufferFull error = newError(CodeRejected, "dbratelimit: write buffer full")
+
+// ErrWriteBuffered is returned by the Result of a buffered write, which has
+// not been executed yet.
+var ErrWriteBuffered error = newError(CodeBypassed, "dbratelimit: write buffered, result unknown")
+
+// WriteBuffer configures WithWriteBuffer.
+type WriteBuffer struct {
+	// Size is the number of writes held at most. Default 100.
+	Size int
+	// OnFlush is called with the outcome of every buffered write once it
+	// has been executed, or with ErrClosed if r was closed first.
+	OnFlush func(w BufferedWrite, err error)
+}
+
+// BufferedWrite is a write held during a freeze.
+type BufferedWrite struct {
+	Query    string
+	Args     []any
+	Buffered time.Time
+
+	policy ctxPolicy
+}
+
+// WithWriteBuffer makes ExecContext hold INSERT and UPDATE statements
+// while writes are frozen instead of failing or blocking them, up to
+// b.Size statements; beyond that they fail with ErrWriteBufferFull. A held
+// write returns at once with a placeholder Result, not the database's,
+// whose methods report ErrWriteBuffered; its real outcome only reaches
+// OnFlush. Held writes are executed through the limiter after ThawWrites,
+// in the order they were accepted, with a copy of their args slice, so the
+// caller may reuse the slice but not change the values it points to.
+// Writes issued while the buffer is being flushed wait until it is empty,
+// so they cannot overtake buffered ones. Other frozen writes follow the
+// FreezeMode.
+func WithWriteBuffer(b WriteBuffer) Option {
+	if b.Size <= 0 {
+		b.Size = 100
+	}
+	return func(o *options) {
+		o.writeBuffer = &b
+	}
+}
+
+type bufferedResult struct{}
+
+func (bufferedResult) LastInsertId() (int64, error) { return 0, ErrWriteBuffered }
+func (bufferedResult) RowsAffected() (int64, error) { return 0, ErrWriteBuffered }
+
+// bufferWrite holds query if writes are frozen and it can be buffered,
+// reporting whether it took the call. The Result it returns for a held
+// write is a bufferedResult, not the database's.
+func (r *RateLimitedDB) bufferWrite(ctx context.Context, query string, args []any) (sql.Result, bool, error) {
+	b := r.opts.writeBuffer
+	if b == nil || ctx.Value(flushKey) != nil {
+		return nil, false, nil
+	}
+	if v := r.verbOf(query); v != VerbInsert && v != VerbUpdate {
+		return nil, false, nil
+	}
+	r.freeze.mu.Lock()
+	defer r.freeze.mu.Unlock()
+	if r.freeze.thawed == nil {
+		return nil, false, nil
+	}
+	select {
+	case <-r.stop:
+		// Close already reported the buffer
+		return nil, true, ErrClosed
+	default:
+	}
+	if len(r.freeze.buffered) >= b.Size {
+		return nil, true, ErrWriteBufferFull
+	}
+	r.freeze.buffered = append(r.freeze.buffered, BufferedWrite{
+		Query:    query,
+		Args:     append([]any(nil), args...),
+		Buffered: time.Now(),
+		policy:   policyOf(r.policyContext(ctx)),
+	})
+	return bufferedResult{}, true, nil
+}
+
+// flush executes the buffered writes in order until the buffer is empty or
+// writes are frozen again, then closes drained
+func (r *RateLimitedDB) flush(drained chan struct{}) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), flushKey, true))
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-drained:
+		}
+	}()
+
+	for {
+		r.freeze.mu.Lock()
+		if r.freeze.thawed != nil || len(r.freeze.buffered) == 0 {
+			r.freeze.drained = nil
+			r.freeze.mu.Unlock()
+			close(drained)
+			return
+		}
+		w := r.freeze.buffered[0]
+		r.freeze.buffered = r.freeze.buffered[1:]
+		r.freeze.mu.Unlock()
+
+		err := ErrClosed
+		if ctx.Err() == nil {
+			_, _, err = r.exec(context.WithValue(ctx, policyKey, w.policy), w.Query, w.Args...)
+		}
+		if h := r.opts.writeBuffer.OnFlush; h != nil {
+			r.safely("OnFlush hook", func() { h(w, err) })
+		}
+	}
+}
+
+// dropBuffered reports ErrClosed to OnFlush for the writes a freeze kept in
+// the buffer until r was closed
+func (r *RateLimitedDB) dropBuffered() {
+	r.freeze.mu.Lock()
+	dropped := r.freeze.buffered
+	r.freeze.buffered = nil
+	r.freeze.mu.Unlock()
+
+	h := r.opts.writeBuffer.OnFlush
+	if h == nil {
+		return
+	}
+	for _, w := range dropped {
+		r.safely("OnFlush hook", func() { h(w, ErrClosed) })
+	}
+}
@@ -0,0 +1,121 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestWriteBuffer 测试冻结期间缓冲写入并在解冻后按顺序执行
+func TestWriteBuffer(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var (
+		mu      sync.Mutex
+		flushed []string
+		done    = make(chan struct{})
+	)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithWriteBuffer(WriteBuffer{
+		Size: 2,
+		OnFlush: func(w BufferedWrite, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				t.Errorf("Flush of %q failed: %v", w.Query, err)
+			}
+			flushed = append(flushed, w.Args[0].(string))
+			if len(flushed) == 2 {
+				close(done)
+			}
+		},
+	}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	rateLimitedDB.FreezeWrites()
+	// 两次写入复用同一个参数切片，缓冲的写入不应看到后来的值
+	args := make([]any, 1)
+	for _, name := range []string{"Bob", "Carol"} {
+		args[0] = name
+		res, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, 'x')", args...)
+		if err != nil {
+			t.Fatalf("Expected write to be buffered, got %v", err)
+		}
+		if _, err := res.RowsAffected(); !errors.Is(err, ErrWriteBuffered) {
+			t.Errorf("Expected ErrWriteBuffered from the result, got %v", err)
+		}
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = ?", "Dave"); !errors.Is(err, ErrWriteBufferFull) {
+		t.Errorf("Expected ErrWriteBufferFull, got %v", err)
+	}
+	// DELETE 不缓冲，按冻结模式处理
+	if _, err := rateLimitedDB.ExecContext(ctx, "DELETE FROM users"); !errors.Is(err, ErrWritesFrozen) {
+		t.Errorf("Expected ErrWritesFrozen for DELETE, got %v", err)
+	}
+
+	rateLimitedDB.ThawWrites()
+	// 解冻后的新写入排在缓冲写入之后
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET email = 'y' WHERE name = 'Carol'"); err != nil {
+		t.Fatalf("Write after thaw failed: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Buffered writes were not flushed")
+	}
+	mu.Lock()
+	if flushed[0] != "Bob" || flushed[1] != "Carol" {
+		t.Errorf("Expected writes in order, got %v", flushed)
+	}
+	mu.Unlock()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = 'y'").Scan(&n); err != nil || n != 1 {
+		t.Errorf("Expected the later write to see the buffered insert, got %d %v", n, err)
+	}
+}
+
+// TestWriteBufferClosedWhileFrozen 测试冻结期间关闭时缓冲的写入以 ErrClosed 回调
+func TestWriteBufferClosedWhileFrozen(t *testing.T) {
+	db, rec := setupFakeDB(t)
+
+	var (
+		mu      sync.Mutex
+		flushed = map[string]error{}
+	)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithWriteBuffer(WriteBuffer{
+		OnFlush: func(w BufferedWrite, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			flushed[w.Args[0].(string)] = err
+		},
+	}))
+
+	ctx := context.Background()
+	rateLimitedDB.FreezeWrites()
+	for _, name := range []string{"Bob", "Carol"} {
+		if _, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name) VALUES (?)", name); err != nil {
+			t.Fatalf("Expected write to be buffered, got %v", err)
+		}
+	}
+	rateLimitedDB.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"Bob", "Carol"} {
+		if err, ok := flushed[name]; !ok || !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected OnFlush with ErrClosed for %s, got %v (called %v)", name, err, ok)
+		}
+	}
+	if calls := rec.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no buffered write to run, got %v", calls)
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name) VALUES (?)", "Dave"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed for a write buffered after Close, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChunkedResult aggregates the results of ExecChunked.
+type ChunkedResult struct {
+	Chunks       int   // chunks executed successfully
+	Rows         int   // input rows written by those chunks
+	rowsAffected int64 // sum over chunks
+	lastInsertID int64 // from the last successful chunk
+	lastIDErr    error
+}
+
+var _ sql.Result = (*ChunkedResult)(nil)
+
+func (c *ChunkedResult) RowsAffected() (int64, error) {
+	return c.rowsAffected, nil
+}
+
+func (c *ChunkedResult) LastInsertId() (int64, error) {
+	return c.lastInsertID, c.lastIDErr
+}
+
+// ExecChunked executes a multi-row insert in chunks of chunkSize rows. query
+// is the statement up to and including VALUES, e.g.
+// "INSERT INTO users (name, email) VALUES"; a "(?, ?)" group, or "($1, $2)"
+// with BindDollar (see WithBindStyle), is appended for every row. Each
+// chunk is a separate rate-limited ExecContext call, so large loads are
+// paced instead of being charged as one statement.
+//
+// On failure the returned result covers the chunks that succeeded.
+func (r *RateLimitedDB) ExecChunked(ctx context.Context, query string, rows [][]any, chunkSize int) (*ChunkedResult, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("dbratelimit: chunk size must be positive")
+	}
+	res := &ChunkedResult{}
+	for start := 0; start < len(rows); start += chunkSize {
+		end := start + chunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		stmt, args, err := buildInsert(r.opts.bindStyle, query, rows[start:end])
+		if err != nil {
+			return res, err
+		}
+		out, err := r.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return res, fmt.Errorf("dbratelimit: chunk %d (rows %d-%d): %w", res.Chunks, start, end-1, err)
+		}
+		n, err := out.RowsAffected()
+		if err != nil {
+			return res, err
+		}
+		res.Chunks++
+		res.Rows += end - start
+		res.rowsAffected += n
+		res.lastInsertID, res.lastIDErr = out.LastInsertId()
+	}
+	return res, nil
+}
+
+// buildInsert appends one placeholder group per row to query, in the
+// given bind style
+func buildInsert(style BindStyle, query string, rows [][]any) (string, []any, error) {
+	width := len(rows[0])
+	if width == 0 {
+		return "", nil, errors.New("dbratelimit: rows must not be empty")
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(query))
+	args := make([]any, 0, width*len(rows))
+	for i, row := range rows {
+		if len(row) != width {
+			return "", nil, fmt.Errorf("dbratelimit: row has %d values, expected %d", len(row), width)
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(" (")
+		for j := range row {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(bindVar(style, len(args)+j+1))
+		}
+		b.WriteString(")")
+		args = append(args, row...)
+	}
+	return b.String(), args, nil
+}
@@ -0,0 +1,94 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestExecChunked 测试批量插入按 chunk 拆分并汇总结果
+func TestExecChunked(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var calls int
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 10, WithHooks(Hooks{
+		AfterQuery: func(context.Context, QueryInfo) { calls++ },
+	}))
+	defer rateLimitedDB.Close()
+
+	rows := make([][]any, 0, 25)
+	for i := 0; i < 25; i++ {
+		rows = append(rows, []any{fmt.Sprintf("User%d", i), fmt.Sprintf("user%d@example.com", i)})
+	}
+
+	ctx := context.Background()
+	res, err := rateLimitedDB.ExecChunked(ctx, "INSERT INTO users (name, email) VALUES", rows, 10)
+	if err != nil {
+		t.Fatalf("ExecChunked failed: %v", err)
+	}
+	if res.Chunks != 3 || calls != 3 {
+		t.Errorf("Expected 3 chunks, got %d (%d calls)", res.Chunks, calls)
+	}
+	if n, _ := res.RowsAffected(); n != 25 {
+		t.Errorf("Expected 25 rows affected, got %d", n)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 26 {
+		t.Errorf("Expected 26 users, got %d", count)
+	}
+}
+
+// TestExecChunkedErrors 测试参数错误和中途失败
+func TestExecChunkedErrors(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 10)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecChunked(ctx, "INSERT INTO users (name, email) VALUES", nil, 0); err == nil {
+		t.Error("Expected error for zero chunk size")
+	}
+
+	rows := [][]any{{"A", "a@example.com"}, {"B"}}
+	res, err := rateLimitedDB.ExecChunked(ctx, "INSERT INTO users (name, email) VALUES", rows, 1)
+	if err == nil {
+		t.Fatal("Expected error for ragged rows")
+	}
+	if res.Chunks != 1 || res.Rows != 1 {
+		t.Errorf("Expected partial result of 1 chunk, got %+v", res)
+	}
+}
+
+// TestExecChunkedBindDollar 测试按绑定风格生成占位符
+func TestExecChunkedBindDollar(t *testing.T) {
+	db, rec := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 10, WithBindStyle(BindDollar))
+	defer rateLimitedDB.Close()
+
+	rows := [][]any{{"A", "a@example.com"}, {"B", "b@example.com"}, {"C", "c@example.com"}}
+	if _, err := rateLimitedDB.ExecChunked(context.Background(), "INSERT INTO users (name, email) VALUES", rows, 2); err != nil {
+		t.Fatalf("ExecChunked failed: %v", err)
+	}
+	want := []string{
+		"INSERT INTO users (name, email) VALUES ($1, $2), ($3, $4)",
+		"INSERT INTO users (name, email) VALUES ($1, $2)",
+	}
+	calls := rec.Calls()
+	if len(calls) != len(want) {
+		t.Fatalf("Expected %d statements, got %v", len(want), calls)
+	}
+	for i, c := range calls {
+		if c.Query != want[i] {
+			t.Errorf("Statement %d = %q, want %q", i, c.Query, want[i])
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package dbratelimit
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures a ResultCache.
+type CacheConfig struct {
+	// TTL is how long a result stays fresh.
+	TTL time.Duration
+	// Jitter spreads each entry's TTL uniformly by up to this fraction
+	// either way, so that entries loaded together do not expire together
+	// and send their reloads to the limiter in one burst. Default 0.1;
+	// negative disables it.
+	Jitter float64
+	// StaleWhileRevalidate keeps serving an expired result for up to this
+	// long while a single background call reloads it, so callers never
+	// wait on the limiter for a result that was just fresh. Zero reloads
+	// on the calling goroutine.
+	StaleWhileRevalidate time.Duration
+	// Store shares results between processes, e.g. through Redis: a miss
+	// in the process is looked up there before loading, and loaded
+	// results are written there. Store errors fall back to loading.
+	Store CacheStore
+	// Codec encodes the results kept in Store. Default GobCodec.
+	Codec Codec
+	// Rand is the source of the TTL jitter, see WithRand. Default the
+	// package-level functions of math/rand/v2.
+	Rand rand.Source
+	// LoadTimeout bounds a load. Loads are shared, so they do not stop when
+	// the caller that started them gives up; each caller only stops
+	// waiting. Default 30s.
+	LoadTimeout time.Duration
+}
+
+// CacheStore holds encoded results for a ResultCache. The ttl passed to
+// Set covers the stale period; the freshness is kept in the data.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (data []byte, ok bool, err error)
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// storedResult is what a ResultCache writes to its store
+type storedResult[T any] struct {
+	Expires time.Time
+	Value   T
+}
+
+// ResultCache caches query results by key in front of a RateLimitedDB, so
+// repeated reads take no tokens. Concurrent misses for a key share one
+// load rather than stampeding the database. Entries are kept until
+// replaced or deleted, so keys should come from a bounded set.
+//
+//	users := dbratelimit.NewResultCache[[]User](dbratelimit.CacheConfig{TTL: time.Minute})
+//	all, err := users.Get(ctx, "active", func(ctx context.Context) ([]User, error) {
+//		return dbratelimit.QueryAll(ctx, db, scanUser, "SELECT id, name FROM users WHERE active")
+//	})
+type ResultCache[T any] struct {
+	cfg     CacheConfig
+	rand    *lockedRand
+	mu      sync.Mutex
+	entries map[string]*cacheEntry[T]
+}
+
+type cacheEntry[T any] struct {
+	value   T
+	err     error
+	expires time.Time     // end of freshness
+	ready   chan struct{} // closed once the first load finished
+	done    bool          // ready is closed
+	loading bool          // a background reload is running
+}
+
+// NewResultCache returns an empty cache.
+func NewResultCache[T any](c CacheConfig) *ResultCache[T] {
+	if c.Jitter == 0 {
+		c.Jitter = 0.1
+	}
+	if c.Codec == nil {
+		c.Codec = GobCodec
+	}
+	if c.LoadTimeout <= 0 {
+		c.LoadTimeout = 30 * time.Second
+	}
+	return &ResultCache[T]{cfg: c, rand: newLockedRand(c.Rand), entries: make(map[string]*cacheEntry[T])}
+}
+
+// Get returns the result cached under key, calling load to fill or refresh
+// it. Errors are returned to the callers sharing the load and not cached.
+// load gets the values of ctx but not its cancellation, see LoadTimeout.
+func (c *ResultCache[T]) Get(ctx context.Context, key string, load func(context.Context) (T, error)) (T, error) {
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && e.done && now.After(e.expires.Add(c.cfg.StaleWhileRevalidate)) {
+		// too stale to serve
+		ok = false
+	}
+	if !ok {
+		e = &cacheEntry[T]{ready: make(chan struct{})}
+		c.entries[key] = e
+		c.mu.Unlock()
+		go c.fill(ctx, key, e, load)
+	} else if !e.done {
+		c.mu.Unlock()
+	} else {
+		if now.After(e.expires) && !e.loading {
+			e.loading = true
+			go c.reload(ctx, key, e, load)
+		}
+		v := e.value
+		c.mu.Unlock()
+		return v, nil
+	}
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return e.value, e.err
+}
+
+// Delete drops the result cached under key, from the store too.
+func (c *ResultCache[T]) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	if c.cfg.Store == nil {
+		return nil
+	}
+	return c.cfg.Store.Delete(ctx, key)
+}
+
+// detach returns the context of a shared load, which keeps the values of
+// ctx but ends only after LoadTimeout
+func (c *ResultCache[T]) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), c.cfg.LoadTimeout)
+}
+
+// fill runs the first load of e, from the store if it has the result
+func (c *ResultCache[T]) fill(ctx context.Context, key string, e *cacheEntry[T], load func(context.Context) (T, error)) {
+	ctx, cancel := c.detach(ctx)
+	defer cancel()
+	if stored, ok := c.fetch(ctx, key); ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		e.value, e.expires = stored.Value, stored.Expires
+		e.done = true
+		close(e.ready)
+		if time.Now().After(e.expires) {
+			e.loading = true
+			go c.reload(ctx, key, e, load)
+		}
+		return
+	}
+	v, err := load(ctx)
+	var expires time.Time
+	if err == nil {
+		expires = time.Now().Add(c.ttl())
+		c.save(ctx, key, v, expires)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.value, e.err, e.expires = v, err, expires
+	if err != nil && c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	e.done = true
+	close(e.ready)
+}
+
+// fetch returns the result stored under key if it can still be served
+func (c *ResultCache[T]) fetch(ctx context.Context, key string) (storedResult[T], bool) {
+	var stored storedResult[T]
+	if c.cfg.Store == nil {
+		return stored, false
+	}
+	data, ok, err := c.cfg.Store.Get(ctx, key)
+	if err != nil || !ok || c.cfg.Codec.Unmarshal(data, &stored) != nil {
+		return stored, false
+	}
+	return stored, !time.Now().After(stored.Expires.Add(c.cfg.StaleWhileRevalidate))
+}
+
+// save writes a loaded result to the store; failures only cost sharing
+func (c *ResultCache[T]) save(ctx context.Context, key string, v T, expires time.Time) {
+	if c.cfg.Store == nil {
+		return
+	}
+	data, err := c.cfg.Codec.Marshal(storedResult[T]{Expires: expires, Value: v})
+	if err != nil {
+		return
+	}
+	_ = c.cfg.Store.Set(ctx, key, data, time.Until(expires)+c.cfg.StaleWhileRevalidate)
+}
+
+// reload refreshes a stale e in the background, keeping it on failure
+func (c *ResultCache[T]) reload(ctx context.Context, key string, e *cacheEntry[T], load func(context.Context) (T, error)) {
+	ctx, cancel := c.detach(ctx)
+	defer cancel()
+	v, err := load(ctx)
+	expires := time.Now().Add(c.ttl())
+	if err == nil {
+		c.save(ctx, key, v, expires)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.loading = false
+	if err != nil || c.entries[key] != e {
+		return
+	}
+	e.value, e.expires = v, expires
+}
+
+// ttl returns the jittered TTL of a new entry
+func (c *ResultCache[T]) ttl() time.Duration {
+	if c.cfg.Jitter <= 0 {
+		return c.cfg.TTL
+	}
+	f := 1 + c.cfg.Jitter*(2*c.rand.float64()-1)
+	return time.Duration(float64(c.cfg.TTL) * f)
+}
@@ -0,0 +1,194 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestResultCacheSharedLoad 测试并发未命中只触发一次加载
+func TestResultCacheSharedLoad(t *testing.T) {
+	c := NewResultCache[int](CacheConfig{TTL: time.Minute})
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get(context.Background(), "k", load); v != 42 || err != nil {
+				t.Errorf("Get = %d, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
+
+// TestResultCacheLoaderCanceled 测试发起加载的调用放弃后，共享加载继续为其他调用完成
+func TestResultCacheLoaderCanceled(t *testing.T) {
+	c := NewResultCache[int](CacheConfig{TTL: time.Minute})
+	started, release := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	first, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.Get(first, "k", load)
+		errs <- err
+	}()
+	<-started
+
+	second := make(chan int, 1)
+	go func() {
+		v, err := c.Get(context.Background(), "k", load)
+		if err != nil {
+			t.Errorf("Get of the second caller failed: %v", err)
+		}
+		second <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected the first caller to stop with its own error, got %v", err)
+	}
+	close(release)
+	if v := <-second; v != 42 {
+		t.Errorf("Expected the shared load to finish for the second caller, got %d", v)
+	}
+}
+
+// TestResultCacheStaleWhileRevalidate 测试过期结果在后台刷新期间继续返回
+func TestResultCacheStaleWhileRevalidate(t *testing.T) {
+	c := NewResultCache[int](CacheConfig{TTL: 10 * time.Millisecond, Jitter: -1, StaleWhileRevalidate: time.Minute})
+	var loads atomic.Int32
+	refreshed := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		n := loads.Add(1)
+		if n == 2 {
+			defer close(refreshed)
+		}
+		return int(n), nil
+	}
+
+	ctx := context.Background()
+	if v, _ := c.Get(ctx, "k", load); v != 1 {
+		t.Fatalf("first Get = %d, want 1", v)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if v, _ := c.Get(ctx, "k", load); v != 1 {
+			t.Errorf("stale Get = %d, want 1 while reloading", v)
+		}
+	}
+	<-refreshed
+	time.Sleep(5 * time.Millisecond)
+	if v, _ := c.Get(ctx, "k", load); v != 2 {
+		t.Errorf("Get after reload = %d, want 2", v)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Errorf("loads = %d, want one background reload", n)
+	}
+}
+
+// TestResultCacheJitter 测试 TTL 在抖动范围内分散
+func TestResultCacheJitter(t *testing.T) {
+	c := NewResultCache[int](CacheConfig{TTL: time.Second, Jitter: 0.2})
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		d := c.ttl()
+		if d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("ttl = %v, want within 20%% of 1s", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 50 {
+		t.Errorf("only %d distinct TTLs, want them spread", len(seen))
+	}
+}
+
+// memoryCacheStore 是测试用的共享存储
+type memoryCacheStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memoryCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.data[key]
+	return d, ok, nil
+}
+
+func (s *memoryCacheStore) Set(_ context.Context, key string, data []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = data
+	return nil
+}
+
+func (s *memoryCacheStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+// TestResultCacheStore 测试多个进程通过共享存储和编解码器共用缓存结果
+func TestResultCacheStore(t *testing.T) {
+	type report struct {
+		Name  string
+		Total int
+	}
+	for name, codec := range map[string]Codec{"gob": GobCodec, "json": JSONCodec} {
+		t.Run(name, func(t *testing.T) {
+			store := &memoryCacheStore{data: map[string][]byte{}}
+			cfg := CacheConfig{TTL: time.Minute, Store: store, Codec: codec}
+			a, b := NewResultCache[[]report](cfg), NewResultCache[[]report](cfg)
+
+			var loads atomic.Int32
+			load := func(context.Context) ([]report, error) {
+				loads.Add(1)
+				return []report{{"daily", 3}}, nil
+			}
+			ctx := context.Background()
+			if _, err := a.Get(ctx, "reports", load); err != nil {
+				t.Fatal(err)
+			}
+			got, err := b.Get(ctx, "reports", load)
+			if err != nil || len(got) != 1 || got[0] != (report{"daily", 3}) {
+				t.Fatalf("shared Get = %+v, %v", got, err)
+			}
+			if n := loads.Load(); n != 1 {
+				t.Errorf("loads = %d, want the second process served from the store", n)
+			}
+
+			if err := a.Delete(ctx, "reports"); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, _ := store.Get(ctx, "reports"); ok {
+				t.Error("expected Delete to remove the stored result")
+			}
+		})
+	}
+}
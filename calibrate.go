@@ -0,0 +1,154 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Calibration expresses the limit as a fraction of the database's capacity.
+type Calibration struct {
+	// Fraction of capacity to allow, e.g. 0.4 for "at most 40% of the DB".
+	Fraction float64
+	// Capacity in queries per second. If zero it is measured by running
+	// Probe as fast as possible for Window.
+	Capacity float64
+	// Probe is the query used for measuring, "SELECT 1" by default.
+	Probe string
+	// Window is how long each probe runs, one second by default.
+	Window time.Duration
+	// Concurrency is the number of parallel probe workers, 4 by default.
+	Concurrency int
+	// Every re-runs calibration periodically when used with WithCalibration.
+	Every time.Duration
+}
+
+func (c Calibration) withDefaults() Calibration {
+	if c.Probe == "" {
+		c.Probe = "SELECT 1"
+	}
+	if c.Window <= 0 {
+		c.Window = time.Second
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+	return c
+}
+
+// WithCalibration calibrates the limit in the background right after Wrap
+// and then every c.Every. The limit passed to Wrap applies until the first
+// calibration finishes.
+func WithCalibration(c Calibration) Option {
+	return func(o *options) {
+		o.calibration = &c
+	}
+}
+
+// Capacity returns the capacity found by the last calibration, or 0.
+func (r *RateLimitedDB) Capacity() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&r.capacity))
+}
+
+// Calibrate measures capacity (unless c.Capacity is set) and sets the limit
+// to c.Fraction of it. Probe queries bypass the limiter.
+func (r *RateLimitedDB) Calibrate(ctx context.Context, c Calibration) (float64, error) {
+	if c.Fraction <= 0 || c.Fraction > 1 {
+		return 0, errors.New("dbratelimit: calibration fraction must be in (0, 1]")
+	}
+	c = c.withDefaults()
+	capacity := c.Capacity
+	if capacity <= 0 {
+		var err error
+		if capacity, err = r.probe(ctx, c); err != nil {
+			return 0, err
+		}
+	}
+	atomic.StoreUint64(&r.capacity, math.Float64bits(capacity))
+	limit := capacity * c.Fraction
+	atomic.StoreUint64(&r.calibrated, math.Float64bits(limit))
+	r.SetLimit(rate.Limit(limit))
+	return capacity, nil
+}
+
+// calibratedBase is the main limiter settings r was created with, with the
+// limit found by the last calibration, if any
+func (r *RateLimitedDB) calibratedBase() LimitConfig {
+	b := r.base
+	if bits := atomic.LoadUint64(&r.calibrated); bits != 0 {
+		b.Limit = rate.Limit(math.Float64frombits(bits))
+	}
+	return b
+}
+
+// probe runs c.Probe from c.Concurrency workers for c.Window and returns
+// the achieved queries per second
+func (r *RateLimitedDB) probe(ctx context.Context, c Calibration) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Window)
+	defer cancel()
+
+	var (
+		count    int64
+		firstErr error
+		errOnce  sync.Once
+		wg       sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < c.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				rows, err := r.db.QueryContext(ctx, c.Probe)
+				if err != nil {
+					if ctx.Err() == nil {
+						errOnce.Do(func() { firstErr = err })
+						cancel()
+					}
+					return
+				}
+				rows.Close()
+				atomic.AddInt64(&count, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	elapsed := time.Since(start).Seconds()
+	if count == 0 || elapsed <= 0 {
+		return 0, errors.New("dbratelimit: calibration probe completed no queries")
+	}
+	return float64(count) / elapsed, nil
+}
+
+// calibrateLoop runs calibration until r is closed
+func (r *RateLimitedDB) calibrateLoop(c Calibration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-r.stop
+		cancel()
+	}()
+
+	_, _ = r.Calibrate(ctx, c)
+	if c.Every <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.Every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = r.Calibrate(ctx, c)
+		}
+	}
+}
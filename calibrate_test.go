@@ -0,0 +1,90 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestCalibrateWithCapacity 测试使用已知容量时按比例设置速率
+func TestCalibrateWithCapacity(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1)
+	defer rateLimitedDB.Close()
+
+	capacity, err := rateLimitedDB.Calibrate(context.Background(), Calibration{Fraction: 0.4, Capacity: 200})
+	if err != nil {
+		t.Fatalf("Calibrate failed: %v", err)
+	}
+	if capacity != 200 || rateLimitedDB.Capacity() != 200 {
+		t.Errorf("Expected capacity 200, got %v", capacity)
+	}
+	if got := rateLimitedDB.Limiter().Limit(); got != rate.Limit(80) {
+		t.Errorf("Expected limit 80, got %v", got)
+	}
+
+	if _, err := rateLimitedDB.Calibrate(context.Background(), Calibration{Fraction: 1.5}); err == nil {
+		t.Error("Expected error for invalid fraction")
+	}
+}
+
+// TestCalibrateProbe 测试通过探测查询测量容量
+func TestCalibrateProbe(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1)
+	defer rateLimitedDB.Close()
+
+	capacity, err := rateLimitedDB.Calibrate(context.Background(), Calibration{
+		Fraction: 0.5,
+		Window:   100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Calibrate failed: %v", err)
+	}
+	if capacity <= 0 {
+		t.Fatalf("Expected positive capacity, got %v", capacity)
+	}
+	if got := float64(rateLimitedDB.Limiter().Limit()); got != capacity*0.5 {
+		t.Errorf("Expected limit %v, got %v", capacity*0.5, got)
+	}
+	t.Logf("Measured capacity: %.0f qps", capacity)
+
+	// 探测查询失败时返回错误
+	if _, err := rateLimitedDB.Calibrate(context.Background(), Calibration{
+		Fraction: 0.5,
+		Probe:    "NOT SQL",
+		Window:   50 * time.Millisecond,
+	}); err == nil {
+		t.Error("Expected error for failing probe")
+	}
+}
+
+// TestWithCalibration 测试后台定期校准，并在 Close 时停止
+func TestWithCalibration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1, WithCalibration(Calibration{
+		Fraction: 0.5,
+		Capacity: 100,
+		Every:    10 * time.Millisecond,
+	}))
+
+	deadline := time.Now().Add(time.Second)
+	for rateLimitedDB.Limiter().Limit() != rate.Limit(50) {
+		if time.Now().After(deadline) {
+			t.Fatal("Background calibration did not run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := rateLimitedDB.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package dbratelimit
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// WithCaller identifies the code issuing calls made with ctx, e.g. a
+// worker or a request handler, for WithCallerFairness.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Caller = caller })
+}
+
+// CallerFrom returns the caller stored in ctx by WithCaller, or "".
+func CallerFrom(ctx context.Context) string {
+	return policyOf(ctx).Caller
+}
+
+// CallerLabel identifies callers by the pprof label with the given key,
+// as set by pprof.Do, for WithCallerFairness. Goroutines started by code
+// running under pprof.Do inherit its labels, so one label covers a worker
+// and everything it spawns.
+func CallerLabel(key string) func(context.Context) string {
+	return func(ctx context.Context) string {
+		v, _ := pprof.Label(ctx, key)
+		return v
+	}
+}
+
+// WithCallerFairness admits waiting calls taking turns between callers,
+// so that one caller issuing calls in a tight loop, e.g. retrying
+// without backoff, cannot take every token while the rest of the process
+// waits. id names the caller of a call; nil uses CallerFrom, and
+// CallerLabel uses a pprof label. Calls whose caller is "" share one turn.
+//
+// Unless WithQueue sets another Queue, calls wait in NewCallerQueue; a
+// custom Queue can read the caller from Waiter.Caller. Fairness only
+// orders calls that wait, so it takes effect once the limit is reached.
+func WithCallerFairness(id func(context.Context) string) Option {
+	return func(o *options) {
+		o.callerFairness = true
+		o.callerID = id
+	}
+}
+
+// callerOf returns the caller of a call made with ctx
+func (r *RateLimitedDB) callerOf(ctx context.Context) string {
+	if !r.opts.callerFairness {
+		return ""
+	}
+	if id := r.opts.callerID; id != nil {
+		caller := ""
+		r.safely("caller func", func() { caller = id(ctx) })
+		return caller
+	}
+	return CallerFrom(ctx)
+}
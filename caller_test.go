@@ -0,0 +1,63 @@
+package dbratelimit
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestCallerQueue 测试在调用方之间轮流放行
+func TestCallerQueue(t *testing.T) {
+	q := NewCallerQueue()
+	for i := range 6 {
+		q.Push(&Waiter{Tag: "hot", Caller: "loop", Cost: 1, seq: uint64(i + 1)})
+	}
+	q.Push(&Waiter{Tag: "a", Caller: "worker", Cost: 1, seq: 7})
+	q.Push(&Waiter{Tag: "b", Caller: "worker", Cost: 1, seq: 8})
+
+	want := []string{"hot", "a", "hot", "b", "hot", "hot", "hot", "hot"}
+	if got := popAll(q); !equalStrings(got, want) {
+		t.Errorf("Pop order = %v, want %v", got, want)
+	}
+}
+
+// TestCallerFairness 测试紧密循环的调用方不会饿死其他调用方
+func TestCallerFairness(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 1, WithCallerFairness(CallerLabel("worker")))
+	defer rateLimitedDB.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	pprof.Do(ctx, pprof.Labels("worker", "retry-loop"), func(ctx context.Context) {
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					rateLimitedDB.ExecContext(ctx, "SELECT 1")
+				}
+			}()
+		}
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	pprof.Do(context.Background(), pprof.Labels("worker", "report"), func(ctx context.Context) {
+		for range 5 {
+			if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+				t.Errorf("ExecContext: %v", err)
+			}
+		}
+	})
+	// 轮流放行时每次调用只需等待约两个令牌，而不是排在 20 个调用之后
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("5 calls took %v behind the retry loop", elapsed)
+	}
+	cancel()
+	wg.Wait()
+}
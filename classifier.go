@@ -0,0 +1,283 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorClass is the coarse category of a database error. Retry, circuit
+// breaking and adaptive limiting all decide based on this instead of
+// inspecting error strings themselves.
+type ErrorClass int
+
+const (
+	// ClassUnknown means the classifier does not recognize the error.
+	ClassUnknown ErrorClass = iota
+	// ClassNone is returned for a nil error.
+	ClassNone
+	// ClassPermanent errors will fail again if retried (syntax, constraint).
+	ClassPermanent
+	// ClassTransient errors may succeed on retry (deadlock, lost connection).
+	ClassTransient
+	// ClassSaturation errors mean the database is out of resources.
+	ClassSaturation
+	// ClassThrottle errors mean the server explicitly asked us to slow down.
+	ClassThrottle
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassNone:
+		return "none"
+	case ClassPermanent:
+		return "permanent"
+	case ClassTransient:
+		return "transient"
+	case ClassSaturation:
+		return "saturation"
+	case ClassThrottle:
+		return "throttle"
+	}
+	return "unknown"
+}
+
+// Retryable reports whether an error of this class is worth retrying.
+func (c ErrorClass) Retryable() bool {
+	return c == ClassTransient || c == ClassSaturation || c == ClassThrottle
+}
+
+// Overload reports whether the class signals pushback from the database.
+func (c ErrorClass) Overload() bool {
+	return c == ClassSaturation || c == ClassThrottle
+}
+
+// ErrorClassifier maps an error to an ErrorClass.
+type ErrorClassifier interface {
+	Classify(err error) ErrorClass
+}
+
+// ErrorClassifierFunc adapts a function to ErrorClassifier.
+type ErrorClassifierFunc func(err error) ErrorClass
+
+func (f ErrorClassifierFunc) Classify(err error) ErrorClass {
+	return f(err)
+}
+
+// ChainClassifiers returns a classifier that asks each of cs in turn and
+// returns the first answer other than ClassUnknown.
+func ChainClassifiers(cs ...ErrorClassifier) ErrorClassifier {
+	return ErrorClassifierFunc(func(err error) ErrorClass {
+		if err == nil {
+			return ClassNone
+		}
+		for _, c := range cs {
+			if class := c.Classify(err); class != ClassUnknown {
+				return class
+			}
+		}
+		return ClassUnknown
+	})
+}
+
+// WithErrorClassifier replaces the default classifier.
+func WithErrorClassifier(c ErrorClassifier) Option {
+	return func(o *options) {
+		o.classifier = c
+	}
+}
+
+// Classify returns the class of err using the configured classifier.
+// A ProxyError keeps its own class. Errors nobody recognizes are reported as
+// ClassPermanent.
+func (r *RateLimitedDB) Classify(err error) ErrorClass {
+	if err == nil {
+		return ClassNone
+	}
+	var pe *ProxyError
+	if errors.As(err, &pe) {
+		return pe.Class
+	}
+	class := ClassUnknown
+	r.safely("error classifier", func() { class = r.opts.classifier.Classify(err) })
+	if class == ClassUnknown {
+		return ClassPermanent
+	}
+	return class
+}
+
+// DefaultClassifier understands generic driver errors plus MySQL, Postgres,
+// SQLite, SQL Server, Oracle and ClickHouse, as well as Vitess and ProxySQL
+// in front of MySQL.
+var DefaultClassifier = ChainClassifiers(
+	ErrorClassifierFunc(classifyGeneric),
+	ProxyClassifier,
+	MySQLClassifier,
+	PostgresClassifier,
+	SQLiteClassifier,
+	MSSQLClassifier,
+	OracleClassifier,
+	ClickHouseClassifier,
+)
+
+func classifyGeneric(err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ClassNone
+	case errors.Is(err, driver.ErrBadConn):
+		return ClassTransient
+	case errors.Is(err, context.Canceled):
+		return ClassPermanent
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTransient
+	}
+	return ClassUnknown
+}
+
+var mysqlErrorRe = regexp.MustCompile(`^Error (\d+)`)
+
+// MySQLClassifier recognizes go-sql-driver/mysql errors by their server
+// error number.
+var MySQLClassifier ErrorClassifier = ErrorClassifierFunc(func(err error) ErrorClass {
+	msg := err.Error()
+	if msg == "invalid connection" || strings.Contains(msg, "bad connection") {
+		return ClassTransient
+	}
+	m := mysqlErrorRe.FindStringSubmatch(msg)
+	if m == nil {
+		return ClassUnknown
+	}
+	code, _ := strconv.Atoi(m[1])
+	switch code {
+	case 1205, 1213, 2006, 2013:
+		// lock wait timeout, deadlock, server gone away, lost connection
+		return ClassTransient
+	case 1040, 1203, 3024:
+		// too many connections, max_user_connections, max_execution_time
+		return ClassSaturation
+	case 1226:
+		// user resource limit exceeded
+		return ClassThrottle
+	}
+	return ClassPermanent
+})
+
+var sqlStateRe = regexp.MustCompile(`SQLSTATE ([0-9A-Z]{5})`)
+
+// PostgresClassifier recognizes Postgres errors by SQLSTATE, either through
+// a SQLState() method (pgx, lib/pq) or from the error message.
+var PostgresClassifier ErrorClassifier = ErrorClassifierFunc(func(err error) ErrorClass {
+	var state string
+	var se interface{ SQLState() string }
+	if errors.As(err, &se) {
+		state = se.SQLState()
+	} else if m := sqlStateRe.FindStringSubmatch(err.Error()); m != nil {
+		state = m[1]
+	}
+	if len(state) != 5 {
+		return ClassUnknown
+	}
+	switch {
+	case state == "40001", state == "40P01", state == "55P03":
+		// serialization failure, deadlock, lock not available
+		return ClassTransient
+	case state == "57014":
+		// statement timeout / query canceled
+		return ClassSaturation
+	case strings.HasPrefix(state, "08"), strings.HasPrefix(state, "57P"):
+		// connection exceptions, server shutting down
+		return ClassTransient
+	case strings.HasPrefix(state, "53"):
+		// insufficient resources, including too_many_connections
+		return ClassSaturation
+	}
+	return ClassPermanent
+})
+
+// SQLiteClassifier recognizes SQLite busy/locked errors.
+var SQLiteClassifier ErrorClassifier = ErrorClassifierFunc(func(err error) ErrorClass {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "database is locked"),
+		strings.Contains(msg, "database table is locked"),
+		strings.Contains(msg, "SQLITE_BUSY"),
+		strings.Contains(msg, "SQLITE_LOCKED"):
+		return ClassTransient
+	}
+	return ClassUnknown
+})
+
+// MSSQLClassifier recognizes SQL Server errors (go-mssqldb) by their error
+// number, including the Azure SQL resource governance codes.
+var MSSQLClassifier ErrorClassifier = ErrorClassifierFunc(func(err error) ErrorClass {
+	var se interface{ SQLErrorNumber() int32 }
+	if !errors.As(err, &se) {
+		return ClassUnknown
+	}
+	switch se.SQLErrorNumber() {
+	case 1205, 1222, 40197, 40613, 4060, 233:
+		// deadlock victim, lock request timeout, service errors and database
+		// unavailable during failover, connection closed
+		return ClassTransient
+	case 10928, 10929, 40501, 49918, 49919, 49920:
+		// resource limits reached, service busy, too many requests
+		return ClassThrottle
+	case 701, 8645, 17809:
+		// out of memory, memory grant timeout, connection limit reached
+		return ClassSaturation
+	}
+	return ClassPermanent
+})
+
+var oracleErrorRe = regexp.MustCompile(`ORA-(\d{5})`)
+
+// OracleClassifier recognizes Oracle errors (godror, go-ora) by the ORA-
+// code in their message.
+var OracleClassifier ErrorClassifier = ErrorClassifierFunc(func(err error) ErrorClass {
+	m := oracleErrorRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ClassUnknown
+	}
+	code, _ := strconv.Atoi(m[1])
+	switch code {
+	case 54, 60, 8177, 3113, 3114, 3135, 12541, 12543:
+		// resource busy, deadlock, serialization failure, lost connection,
+		// no listener
+		return ClassTransient
+	case 18, 20, 4036, 12516, 12519, 12520:
+		// sessions or processes exceeded, PGA exhausted, no handler
+		// available
+		return ClassSaturation
+	case 2391, 2395:
+		// per-user session and I/O limits from the resource profile
+		return ClassThrottle
+	}
+	return ClassPermanent
+})
+
+var clickhouseErrorRe = regexp.MustCompile(`code: (\d+), message:`)
+
+// ClickHouseClassifier recognizes clickhouse-go server exceptions by the
+// code in their message.
+var ClickHouseClassifier ErrorClassifier = ErrorClassifierFunc(func(err error) ErrorClass {
+	m := clickhouseErrorRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ClassUnknown
+	}
+	code, _ := strconv.Atoi(m[1])
+	switch code {
+	case 209, 210, 279:
+		// socket timeout, network error, all connection tries failed
+		return ClassTransient
+	case 202, 241, 159:
+		// too many simultaneous queries, memory limit exceeded, timeout
+		return ClassSaturation
+	case 252, 201:
+		// too many parts (inserts outpacing merges), quota exceeded
+		return ClassThrottle
+	}
+	return ClassPermanent
+})
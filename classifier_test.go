@@ -0,0 +1,90 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// pgError 模拟带 SQLState() 方法的 Postgres 驱动错误
+type pgError struct{ code string }
+
+func (e *pgError) Error() string    { return "pg error " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+// mssqlError 模拟 go-mssqldb 的错误
+type mssqlError struct{ number int32 }
+
+func (e mssqlError) Error() string         { return fmt.Sprintf("mssql: error %d", e.number) }
+func (e mssqlError) SQLErrorNumber() int32 { return e.number }
+
+// TestDefaultClassifier 测试内置错误分类
+func TestDefaultClassifier(t *testing.T) {
+	cases := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{nil, ClassNone},
+		{driver.ErrBadConn, ClassTransient},
+		{context.DeadlineExceeded, ClassTransient},
+		{errors.New("Error 1213 (40001): Deadlock found when trying to get lock"), ClassTransient},
+		{errors.New("Error 1040: Too many connections"), ClassSaturation},
+		{errors.New("Error 1226 (42000): User 'app' has exceeded the 'max_questions' resource"), ClassThrottle},
+		{errors.New("Error 1064 (42000): You have an error in your SQL syntax"), ClassPermanent},
+		{&pgError{"40P01"}, ClassTransient},
+		{fmt.Errorf("query: %w", &pgError{"53300"}), ClassSaturation},
+		{errors.New("ERROR: canceling statement due to statement timeout (SQLSTATE 57014)"), ClassSaturation},
+		{&pgError{"23505"}, ClassPermanent},
+		{errors.New("database is locked"), ClassTransient},
+		{mssqlError{10928}, ClassThrottle},
+		{fmt.Errorf("exec: %w", mssqlError{10929}), ClassThrottle},
+		{mssqlError{1205}, ClassTransient},
+		{mssqlError{2627}, ClassPermanent},
+		{errors.New("ORA-00020: maximum number of processes (300) exceeded"), ClassSaturation},
+		{errors.New("dpiStmt_execute: ORA-00060: deadlock detected while waiting for resource"), ClassTransient},
+		{errors.New("ORA-02391: exceeded simultaneous SESSIONS_PER_USER limit"), ClassThrottle},
+		{errors.New("ORA-00942: table or view does not exist"), ClassPermanent},
+		{errors.New("code: 202, message: Too many simultaneous queries. Maximum: 100"), ClassSaturation},
+		{errors.New("clickhouse [execute]:: code: 252, message: Too many parts (300)"), ClassThrottle},
+		{errors.New("code: 62, message: Syntax error"), ClassPermanent},
+	}
+
+	for _, c := range cases {
+		if got := DefaultClassifier.Classify(c.err); got != c.want {
+			t.Errorf("Classify(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+// TestWithErrorClassifier 测试自定义分类器以及未知错误默认视为 permanent
+func TestWithErrorClassifier(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	custom := ErrorClassifierFunc(func(err error) ErrorClass {
+		if err.Error() == "slow down" {
+			return ClassThrottle
+		}
+		return ClassUnknown
+	})
+	rateLimitedDB := Wrap(db, rate.Limit(10), 5, WithErrorClassifier(custom))
+	defer rateLimitedDB.Close()
+
+	if got := rateLimitedDB.Classify(errors.New("slow down")); got != ClassThrottle {
+		t.Errorf("Expected throttle, got %v", got)
+	}
+	if got := rateLimitedDB.Classify(errors.New("boom")); got != ClassPermanent {
+		t.Errorf("Expected permanent for unknown error, got %v", got)
+	}
+
+	// SQLite 语法错误经默认分类器视为 permanent
+	defaultDB := Wrap(db, rate.Limit(10), 5)
+	_, err := defaultDB.ExecContext(context.Background(), "NOT SQL")
+	if got := defaultDB.Classify(err); got != ClassPermanent {
+		t.Errorf("Expected permanent for syntax error, got %v (%v)", got, err)
+	}
+}
@@ -0,0 +1,56 @@
+package dbratelimit
+
+// ClickHouseConfig configures ClickHouseModeWith.
+type ClickHouseConfig struct {
+	// InsertCost is the number of tokens charged per INSERT. With ClickHouse
+	// each INSERT is usually a batch that creates a new part to merge, so it
+	// costs far more than a point query. Default 10.
+	InsertCost int
+	// MaxSelects caps how many SELECTs may run at once, since analytical
+	// queries run long and the server rejects queries beyond
+	// max_concurrent_queries. Default 8; negative means no cap. Read with
+	// QueryRows or QueryIter so that the cap covers streaming the rows.
+	MaxSelects int64
+	// Adaptive tunes the limit learned from "Too many simultaneous queries"
+	// and similar errors. Defaults to the AdaptiveConfig defaults.
+	Adaptive *AdaptiveConfig
+}
+
+// ClickHouseMode is ClickHouseModeWith using the defaults.
+func ClickHouseMode() Option {
+	return ClickHouseModeWith(ClickHouseConfig{})
+}
+
+// ClickHouseModeWith bundles the options for ClickHouse over database/sql:
+// INSERT batches cost c.InsertCost tokens, SELECTs are capped at
+// c.MaxSelects concurrent calls and overload errors recognized by
+// ClickHouseClassifier feed adaptive limiting. A cost func set before this
+// option still prices the other statements.
+func ClickHouseModeWith(c ClickHouseConfig) Option {
+	if c.InsertCost <= 0 {
+		c.InsertCost = 10
+	}
+	if c.MaxSelects == 0 {
+		c.MaxSelects = 8
+	}
+	adaptive := AdaptiveConfig{}
+	if c.Adaptive != nil {
+		adaptive = *c.Adaptive
+	}
+	selects := WithVerbConcurrency(c.MaxSelects, VerbSelect)
+
+	return func(o *options) {
+		prev := o.costFunc
+		o.costFunc = func(query string) int {
+			if ParseVerb(query) == VerbInsert {
+				return c.InsertCost
+			}
+			if prev != nil {
+				return prev(query)
+			}
+			return 1
+		}
+		selects(o)
+		WithAdaptive(adaptive)(o)
+	}
+}
@@ -0,0 +1,37 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestClickHouseMode 测试 ClickHouse 模式下 INSERT 的 cost、SELECT 并发上限和自适应限流
+func TestClickHouseMode(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100,
+		WithCostFunc(func(string) int { return 2 }),
+		ClickHouseModeWith(ClickHouseConfig{InsertCost: 20, MaxSelects: 3}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if got := rateLimitedDB.cost(ctx, "INSERT INTO users (name, email) VALUES (?, ?)"); got != 20 {
+		t.Errorf("Expected INSERT cost 20, got %d", got)
+	}
+	// 之前设置的 cost func 仍作用于其他语句
+	if got := rateLimitedDB.cost(ctx, "SELECT * FROM users"); got != 2 {
+		t.Errorf("Expected SELECT cost 2, got %d", got)
+	}
+	if rateLimitedDB.opts.verbConcurrency[VerbSelect] == nil {
+		t.Error("Expected SELECT concurrency to be capped")
+	}
+	if rateLimitedDB.adaptive == nil {
+		t.Error("Expected adaptive limiting to be enabled")
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name, email) VALUES ('Bob', 'bob@example.com')"); err != nil {
+		t.Errorf("INSERT failed: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package dbratelimit
+
+import (
+	"errors"
+	"time"
+)
+
+// Code is the category of an error that comes from the wrapper rather than
+// the database, so that applications can switch on a stable taxonomy
+// instead of matching each sentinel. Get it with CodeOf.
+type Code int
+
+const (
+	// CodeUnknown is the code of errors not originating from the wrapper,
+	// such as database errors, and of nil.
+	CodeUnknown Code = iota
+	// CodeThrottled calls ran out of time waiting for admission:
+	// ErrWaitBudgetExceeded, or a LatencyError of a call never executed.
+	CodeThrottled
+	// CodeRejected calls were turned away by a limit or policy: ErrRejected,
+	// ErrCostExceedsBurst, ErrWritesFrozen, ErrWriteBufferFull,
+	// ErrTooManyRows and ErrClosed.
+	CodeRejected
+	// CodeCircuitOpen calls failed fast because a dependency of admission
+	// is down: ErrBackendUnavailable.
+	CodeCircuitOpen
+	// CodeOverloaded calls were shed to relieve an overloaded system: calls
+	// shed for WithMaxQueueDelaySLO, which also match ErrRejected, and
+	// ProxyError for a proxy shedding load (ErrProxyOverloaded).
+	CodeOverloaded
+	// CodeDenied calls were refused by policy: ErrAdmissionDenied and
+	// ErrRawDisabled.
+	CodeDenied
+	// CodeBypassed calls were accepted without being executed:
+	// ErrWriteBuffered.
+	CodeBypassed
+	// CodeInvalid reports invalid settings: ConfigError and
+	// ErrUnknownProfile.
+	CodeInvalid
+)
+
+func (c Code) String() string {
+	switch c {
+	case CodeThrottled:
+		return "throttled"
+	case CodeRejected:
+		return "rejected"
+	case CodeCircuitOpen:
+		return "circuit_open"
+	case CodeOverloaded:
+		return "overloaded"
+	case CodeDenied:
+		return "denied"
+	case CodeBypassed:
+		return "bypassed"
+	case CodeInvalid:
+		return "invalid"
+	}
+	return "unknown"
+}
+
+// Error is the type of the wrapper's sentinel errors, such as ErrRejected,
+// and of errors derived from them. Use errors.As to get at its Code, or
+// CodeOf, which also knows the codes of LatencyError, ProxyError and
+// ConfigError.
+type Error struct {
+	Code Code
+	// RetryAfter is how long until a retry may be admitted, if known, see
+	// RetryAfterOf.
+	RetryAfter time.Duration
+	msg        string
+	err        error // sentinel wrapped by a derived error
+}
+
+func newError(code Code, msg string) *Error {
+	return &Error{Code: code, msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// CodeOf returns the code of the first wrapper error in err's chain.
+func CodeOf(err error) Code {
+	var e *Error
+	var latency *LatencyError
+	var proxy *ProxyError
+	var config *ConfigError
+	switch {
+	case err == nil:
+		return CodeUnknown
+	case errors.As(err, &e):
+		return e.Code
+	case errors.As(err, &latency):
+		if latency.Exec == 0 {
+			return CodeThrottled
+		}
+	case errors.As(err, &proxy):
+		if proxy.Class.Overload() {
+			return CodeOverloaded
+		}
+	case errors.As(err, &config):
+		return CodeInvalid
+	}
+	return CodeUnknown
+}
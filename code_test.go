@@ -0,0 +1,63 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestCodeOf 测试包装器产生的错误带有稳定的错误码
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Code
+	}{
+		{nil, CodeUnknown},
+		{errors.New("no such table"), CodeUnknown},
+		{fmt.Errorf("%w: no tokens available", ErrRejected), CodeRejected},
+		{fmt.Errorf("%w: timeout", ErrBackendUnavailable), CodeCircuitOpen},
+		{fmt.Errorf("%w: no deletes", ErrAdmissionDenied), CodeDenied},
+		{ErrWriteBuffered, CodeBypassed},
+		{&LatencyError{Err: context.DeadlineExceeded, Wait: time.Second}, CodeThrottled},
+		{&LatencyError{Err: context.DeadlineExceeded, Wait: time.Second, Exec: time.Second}, CodeUnknown},
+		{&ProxyError{Proxy: "vitess", Class: ClassThrottle, Err: errors.New("transaction throttled")}, CodeOverloaded},
+		{errors.Join(&ConfigError{Field: "Burst", Problem: "-1 is negative"}), CodeInvalid},
+	}
+	for _, tt := range tests {
+		if got := CodeOf(tt.err); got != tt.want {
+			t.Errorf("CodeOf(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	var e *Error
+	if err := fmt.Errorf("query: %w", ErrWritesFrozen); !errors.As(err, &e) || e.Code != CodeRejected {
+		t.Errorf("errors.As = %v, want an *Error with CodeRejected", e)
+	}
+}
+
+// TestCodeOfCalls 测试实际调用返回的错误码
+func TestCodeOfCalls(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.01), 1,
+		WithOverflowPolicy(OverflowPolicy{Mode: OverflowReject}), WithPriorityOverflow(PriorityLow, OverflowPolicy{}))
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = 'Bob'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = 'Bob'"); CodeOf(err) != CodeRejected {
+		t.Errorf("rejected call: CodeOf(%v) = %v", err, CodeOf(err))
+	}
+	short, cancel := context.WithTimeout(WithPriority(ctx, PriorityLow), 10*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "UPDATE users SET name = 'Bob'"); CodeOf(err) != CodeThrottled {
+		t.Errorf("timed out call: CodeOf(%v) = %v", err, CodeOf(err))
+	}
+}
@@ -0,0 +1,47 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec encodes values for storage outside the process, such as the
+// shared store of a ResultCache. Implement it to use another format, e.g.
+// msgpack.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// GobCodec encodes with encoding/gob, which keeps Go types exactly but is
+// only readable from Go.
+var GobCodec Codec = gobCodec{}
+
+// JSONCodec encodes with encoding/json, readable from other languages and
+// tools.
+var JSONCodec Codec = jsonCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,114 @@
+package dbratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// CoDel configures NewCoDelQueue.
+type CoDel struct {
+	// Target is the queueing delay tolerated. Default 5ms.
+	Target time.Duration
+	// Interval is how long the delay must stay above Target before calls
+	// are dropped; it should be around the time a call takes when the
+	// database is healthy. Default 100ms.
+	Interval time.Duration
+	// Queue orders the calls that are not dropped. Default NewFIFOQueue.
+	Queue Queue
+}
+
+// NewCoDelQueue returns a Queue applying controlled delay (CoDel) to c.Queue:
+// when the time calls spend waiting stays above c.Target for c.Interval, it
+// rejects calls at the head of the queue, at a rate rising with the square
+// root of the number of drops, until the delay falls below the target
+// again. Overload then shows up as fast ErrRejected failures rather than
+// ever-growing latencies.
+func NewCoDelQueue(c CoDel) Queue {
+	if c.Target <= 0 {
+		c.Target = 5 * time.Millisecond
+	}
+	if c.Interval <= 0 {
+		c.Interval = 100 * time.Millisecond
+	}
+	if c.Queue == nil {
+		c.Queue = NewFIFOQueue()
+	}
+	return &codelQueue{CoDel: c}
+}
+
+type codelQueue struct {
+	CoDel
+
+	firstAbove time.Time // when the delay is known to have stayed above target
+	dropping   bool
+	dropNext   time.Time
+	count      int // drops since dropping started
+	lastCount  int
+}
+
+func (q *codelQueue) Push(w *Waiter) {
+	q.Queue.Push(w)
+}
+
+func (q *codelQueue) Remove(w *Waiter) {
+	q.Queue.Remove(w)
+}
+
+func (q *codelQueue) Len() int {
+	return q.Queue.Len()
+}
+
+func (q *codelQueue) Pop(now time.Time) (*Waiter, bool) {
+	w, drop := q.Queue.Pop(now)
+	if w == nil {
+		q.dropping = false
+		return nil, false
+	}
+	if drop {
+		return w, true
+	}
+	okToDrop := q.aboveTarget(w, now)
+	if q.dropping {
+		if !okToDrop {
+			q.dropping = false
+		} else if !now.Before(q.dropNext) {
+			q.count++
+			q.dropNext = q.controlLaw(q.dropNext)
+			return w, true
+		}
+		return w, false
+	}
+	if okToDrop {
+		// resume near the previous drop rate if dropping stopped only
+		// recently
+		q.dropping = true
+		delta := q.count - q.lastCount
+		if delta > 1 && now.Sub(q.dropNext) < 16*q.Interval {
+			q.count = delta
+		} else {
+			q.count = 1
+		}
+		q.lastCount = q.count
+		q.dropNext = q.controlLaw(now)
+		return w, true
+	}
+	return w, false
+}
+
+// aboveTarget reports whether the delay has stayed above Target for at
+// least Interval, judging by w, the call at the head of the queue
+func (q *codelQueue) aboveTarget(w *Waiter, now time.Time) bool {
+	if now.Sub(w.Enqueued) < q.Target || q.Queue.Len() == 0 {
+		q.firstAbove = time.Time{}
+		return false
+	}
+	if q.firstAbove.IsZero() {
+		q.firstAbove = now.Add(q.Interval)
+		return false
+	}
+	return !now.Before(q.firstAbove)
+}
+
+func (q *codelQueue) controlLaw(t time.Time) time.Time {
+	return t.Add(time.Duration(float64(q.Interval) / math.Sqrt(float64(q.count))))
+}
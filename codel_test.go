@@ -0,0 +1,61 @@
+package dbratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCoDelQueue 测试排队延迟持续超过目标后开始丢弃，恢复后停止
+func TestCoDelQueue(t *testing.T) {
+	q := NewCoDelQueue(CoDel{Target: 10 * time.Millisecond, Interval: 100 * time.Millisecond})
+	start := time.Now()
+	seq := uint64(0)
+	push := func(enqueued time.Time) {
+		seq++
+		q.Push(&Waiter{Cost: 1, Enqueued: enqueued, seq: seq})
+	}
+
+	// 延迟低于目标时不丢弃
+	push(start)
+	push(start)
+	if _, drop := q.Pop(start.Add(time.Millisecond)); drop {
+		t.Error("Expected no drop below target")
+	}
+	q.Pop(start.Add(time.Millisecond))
+
+	// 延迟持续高于目标：第一次只记录，超过 Interval 后丢弃
+	for i := 0; i < 20; i++ {
+		push(start)
+	}
+	now := start.Add(50 * time.Millisecond)
+	if _, drop := q.Pop(now); drop {
+		t.Error("Expected no drop before the delay has stayed above target for an interval")
+	}
+	now = now.Add(100 * time.Millisecond)
+	if _, drop := q.Pop(now); !drop {
+		t.Error("Expected drop once the delay stayed above target for an interval")
+	}
+	if _, drop := q.Pop(now); drop {
+		t.Error("Expected next drop to be spaced by the control law")
+	}
+	drops := 0
+	for i := 0; i < 10; i++ {
+		now = now.Add(40 * time.Millisecond)
+		if _, drop := q.Pop(now); drop {
+			drops++
+		}
+	}
+	if drops == 0 || drops == 10 {
+		t.Errorf("Expected some but not all calls dropped while overloaded, got %d", drops)
+	}
+
+	// 延迟恢复后停止丢弃
+	for q.Len() > 0 {
+		q.Pop(now)
+	}
+	push(now)
+	push(now)
+	if _, drop := q.Pop(now.Add(time.Millisecond)); drop {
+		t.Error("Expected dropping to stop once the delay is below target")
+	}
+}
@@ -0,0 +1,79 @@
+package dbratelimit
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// WithMaxConcurrency limits how many calls may run against the database at
+// once. Each call holds as many slots as its cost (see WithCostFunc), capped
+// at n, so heavy queries count for more in both the rate and the
+// concurrency dimension. For QueryContext the slots are released when the
+// call returns, not when the rows are closed.
+func WithMaxConcurrency(n int64) Option {
+	return func(o *options) {
+		o.maxConcurrency = n
+	}
+}
+
+// WithVerbConcurrency limits how many statements of the given verbs may run
+// at once, e.g. long-running SELECTs, in addition to WithMaxConcurrency.
+// Each statement holds one slot, critical calls bypass the limit. Queries
+// through QueryRows or QueryIter hold it until their rows are closed, other
+// query calls until they return, since a plain *sql.Rows does not report
+// being closed.
+func WithVerbConcurrency(n int64, verbs ...Verb) Option {
+	return func(o *options) {
+		if o.verbConcurrency == nil {
+			o.verbConcurrency = make(map[Verb]*semaphore.Weighted)
+		}
+		sem := semaphoreFor(n)
+		for _, v := range verbs {
+			o.verbConcurrency[v] = sem
+		}
+	}
+}
+
+// acquireVerbSlot takes the verb's concurrency slot, if it has a limit, and
+// returns the semaphore to release afterwards
+func (r *RateLimitedDB) acquireVerbSlot(ctx context.Context, verb Verb) (*semaphore.Weighted, error) {
+	sem := r.opts.verbConcurrency[verb]
+	if sem == nil {
+		return nil, nil
+	}
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return sem, nil
+}
+
+// acquireSlots takes the concurrency slots for a call of the given cost and
+// returns the weight to release afterwards
+func (r *RateLimitedDB) acquireSlots(ctx context.Context, cost int) (int64, error) {
+	if r.sem == nil {
+		return 0, nil
+	}
+	w := int64(cost)
+	if w > r.opts.maxConcurrency {
+		w = r.opts.maxConcurrency
+	}
+	if err := r.sem.Acquire(ctx, w); err != nil {
+		return 0, err
+	}
+	return w, nil
+}
+
+func (r *RateLimitedDB) releaseSlots(w int64) {
+	if w > 0 {
+		r.sem.Release(w)
+	}
+}
+
+// semaphoreFor returns the weighted semaphore for n slots, or nil if n <= 0
+func semaphoreFor(n int64) *semaphore.Weighted {
+	if n <= 0 {
+		return nil
+	}
+	return semaphore.NewWeighted(n)
+}
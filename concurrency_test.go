@@ -0,0 +1,157 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestMaxConcurrency 测试重查询按 cost 占用多个并发槽位
+func TestMaxConcurrency(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100,
+		WithMaxConcurrency(4), WithCostFunc(heavyCost))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	// SELECT 的 cost 为 5，被限制为最多占用全部 4 个槽位
+	heavy, err := rateLimitedDB.wait(ctx, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if heavy.slots != 4 {
+		t.Errorf("Expected heavy call to hold 4 slots, got %d", heavy.slots)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "UPDATE users SET name = name"); err == nil {
+		t.Error("Expected light call to wait for slots held by heavy call")
+	}
+
+	// critical 调用不受并发限制
+	if _, err := rateLimitedDB.ExecContext(WithPriority(ctx, PriorityCritical), "UPDATE users SET name = name"); err != nil {
+		t.Errorf("Critical call failed: %v", err)
+	}
+
+	heavy.done(nil)
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = name"); err != nil {
+		t.Errorf("Light call failed after slots released: %v", err)
+	}
+}
+
+// TestVerbConcurrency 测试按语句类型限制并发
+func TestVerbConcurrency(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithVerbConcurrency(1, VerbSelect))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	held, err := rateLimitedDB.wait(ctx, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err == nil {
+		t.Error("Expected second SELECT to wait for the held slot")
+	}
+	// 其他语句不受影响
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = name"); err != nil {
+		t.Errorf("UPDATE should not be limited: %v", err)
+	}
+
+	held.done(nil)
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Errorf("SELECT failed after slot released: %v", err)
+	}
+}
+
+// TestVerbConcurrencyOpenRows 测试 QueryRows 的语句类型槽位一直占用到 rows 关闭
+func TestVerbConcurrencyOpenRows(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithVerbConcurrency(2, VerbSelect))
+	defer rateLimitedDB.Close()
+
+	// 普通的 *sql.Rows 无法得知何时关闭，返回时即释放槽位
+	plain, err := rateLimitedDB.QueryContext(context.Background(), "SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("QueryContext failed: %v", err)
+	}
+	defer plain.Close()
+
+	parent, cancelParent := context.WithCancel(context.Background())
+	defer cancelParent()
+	rows, err := rateLimitedDB.QueryRows(context.Background(), "SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("QueryRows failed: %v", err)
+	}
+	limited, err := rateLimitedDB.QueryRows(parent, "SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("QueryRows failed: %v", err)
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.QueryContext(short, "SELECT 1"); err == nil {
+		t.Fatal("Expected the third SELECT to wait while both rows are open")
+	}
+
+	rows.Close()
+	third, err := rateLimitedDB.QueryRows(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatalf("SELECT failed after rows were closed: %v", err)
+	}
+	// 读完后 rows 自动关闭，同样释放槽位
+	for third.Next() {
+	}
+
+	// 取消查询的 context 也会关闭 rows 并释放槽位
+	cancelParent()
+	for i := 0; i < 2; i++ {
+		wait, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		rows, err := rateLimitedDB.QueryRows(wait, "SELECT 1")
+		if err != nil {
+			t.Fatalf("SELECT %d failed after the query context was canceled: %v", i, err)
+		}
+		defer rows.Close()
+	}
+	limited.Close()
+}
+
+// TestVerbConcurrencyRefund 测试 SELECT 并发上限拒绝调用时归还已经预留的令牌
+func TestVerbConcurrencyRefund(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	r := Wrap(db, rate.Limit(0.1), 1,
+		WithVerbLimit(rate.Limit(0.1), 1, VerbSelect),
+		WithVerbConcurrency(1, VerbSelect))
+	defer r.Close()
+
+	sem := r.opts.verbConcurrency[VerbSelect]
+	if err := sem.Acquire(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer sem.Release(1)
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.QueryContext(short, "SELECT 1"); err == nil {
+		t.Fatal("Expected the query to time out waiting for its verb slot")
+	}
+
+	now := time.Now()
+	for name, l := range map[string]*rate.Limiter{"main": r.Limiter(), "verb": r.opts.verbLimits[VerbSelect]} {
+		if tokens := l.TokensAt(now); tokens < 0.99 {
+			t.Errorf("Expected the %s limiter to get its token back, has %.2f", name, tokens)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package dbratelimit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/time/rate"
+)
+
+// ConfigError is one problem found while validating a Config or the
+// options passed to a constructor.
+type ConfigError struct {
+	Field   string // e.g. "Burst" or "TagLimits[reports].Limit"
+	Problem string
+}
+
+func (e *ConfigError) Error() string {
+	return "dbratelimit: invalid " + e.Field + ": " + e.Problem
+}
+
+// configErrors collects the problems found by a validation
+type configErrors []error
+
+func (errs *configErrors) add(field, format string, args ...any) {
+	*errs = append(*errs, &ConfigError{Field: field, Problem: fmt.Sprintf(format, args...)})
+}
+
+func (errs *configErrors) limit(field string, l LimitConfig) {
+	if field != "" {
+		field += "."
+	}
+	if math.IsNaN(float64(l.Limit)) || l.Limit < 0 {
+		errs.add(field+"Limit", "%v is not a rate; use 0 to block or rate.Inf for no limit", l.Limit)
+	}
+	if l.Burst < 0 {
+		errs.add(field+"Burst", "%d is negative", l.Burst)
+	}
+}
+
+// bucket is limit for a bucket that is used as is, where a zero burst
+// admits nothing
+func (errs *configErrors) bucket(field string, l LimitConfig) {
+	errs.limit(field, l)
+	errs.burst(field+".Burst", l)
+}
+
+func (errs *configErrors) burst(field string, l LimitConfig) {
+	if l.Burst == 0 && l.Limit > 0 && l.Limit != rate.Inf {
+		errs.add(field, "0 admits no call at a limit of %v", l.Limit)
+	}
+}
+
+func (errs *configErrors) overflow(field string, p OverflowPolicy) {
+	switch p.Mode {
+	case OverflowQueue, OverflowReject:
+	case OverflowShedOldest:
+		if p.MaxQueue <= 0 {
+			errs.add(field+".MaxQueue", "OverflowShedOldest needs a positive MaxQueue, got %d", p.MaxQueue)
+		}
+	default:
+		errs.add(field+".Mode", "unknown mode %d", p.Mode)
+	}
+	if p.MaxWait < 0 {
+		errs.add(field+".MaxWait", "%v is negative", p.MaxWait)
+	}
+	if p.MaxQueue < 0 {
+		errs.add(field+".MaxQueue", "%d is negative", p.MaxQueue)
+	}
+}
+
+func (errs *configErrors) adaptive(field string, c AdaptiveConfig) {
+	for _, l := range []struct {
+		name  string
+		limit rate.Limit
+	}{{"Min", c.Min}, {"Max", c.Max}} {
+		if math.IsNaN(float64(l.limit)) || l.limit < 0 {
+			errs.add(field+"."+l.name, "%v is negative", l.limit)
+		}
+	}
+	if c.Max > 0 && c.Min > c.Max {
+		errs.add(field+".Min", "%v is above Max %v", c.Min, c.Max)
+	}
+	if math.IsNaN(c.Beta) || c.Beta < 0 || c.Beta >= 1 {
+		errs.add(field+".Beta", "%v is outside [0, 1)", c.Beta)
+	}
+	if math.IsNaN(c.Scale) || c.Scale < 0 {
+		errs.add(field+".Scale", "%v is negative", c.Scale)
+	}
+}
+
+// sortedKeys returns the keys of m in order, so problems are reported in
+// the same order every time
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate reports every problem with c at once, each as a *ConfigError
+// joined with errors.Join, or nil if there is none.
+func (c Config) Validate() error {
+	var errs configErrors
+	c.check(&errs)
+	return errors.Join(errs...)
+}
+
+func (c Config) check(errs *configErrors) {
+	errs.limit("", LimitConfig{Limit: c.Limit, Burst: c.Burst})
+	for _, tag := range sortedKeys(c.TagLimits) {
+		errs.limit("TagLimits["+tag+"]", c.TagLimits[tag])
+	}
+	if c.MaxConcurrency < 0 {
+		errs.add("MaxConcurrency", "%d is negative", c.MaxConcurrency)
+	}
+	errs.overflow("Overflow", c.Overflow)
+	if c.Adaptive != nil {
+		errs.adaptive("Adaptive", *c.Adaptive)
+	}
+}
+
+// check reports problems with settings made by options
+func (o *options) check(errs *configErrors) {
+	for _, tag := range sortedKeys(o.tagLimits) {
+		errs.bucket("WithTagLimits["+tag+"]", o.tagLimits[tag])
+	}
+	for _, key := range sortedKeys(o.reservations) {
+		errs.bucket("WithReservation["+key+"]", o.reservations[key])
+	}
+	if o.keyed != nil {
+		errs.bucket("WithKeyedLimit", *o.keyed)
+	}
+	if o.migration != nil {
+		errs.bucket("WithMigrationLimit", *o.migration)
+	}
+	if o.connLimit != nil {
+		errs.bucket("WithConnLimit", *o.connLimit)
+	}
+	if l := o.limitPerConn; math.IsNaN(float64(l)) || l < 0 {
+		errs.add("WithLimitPerConn", "%v is negative", l)
+	}
+	if o.stmtCache < 0 {
+		errs.add("WithStmtCache", "size %d is negative", o.stmtCache)
+	}
+	if o.maxConcurrency < 0 {
+		errs.add("WithMaxConcurrency", "%d is negative", o.maxConcurrency)
+	}
+	errs.overflow("WithOverflowPolicy", o.overflow)
+	for _, tag := range sortedKeys(o.tagOverflow) {
+		errs.overflow("WithTagOverflow["+tag+"]", o.tagOverflow[tag])
+	}
+	for p := PriorityLow; p <= PriorityCritical; p++ {
+		if policy, ok := o.priorityOverflow[p]; ok {
+			errs.overflow(fmt.Sprintf("WithPriorityOverflow[%d]", p), policy)
+		}
+	}
+	if o.adaptive != nil {
+		errs.adaptive("WithAdaptive", *o.adaptive)
+	}
+	for i, q := range o.quotas {
+		if q.Count <= 0 || q.Per <= 0 {
+			errs.add(fmt.Sprintf("WithQuotas[%d]", i), "%d per %v allows nothing", q.Count, q.Per)
+		}
+	}
+	if o.profiles != nil && !o.hasProfile(o.profiles.initial) {
+		errs.add("WithProfiles", "initial profile %q is not configured", o.profiles.initial)
+	}
+	if p := o.startupProbe; p != nil && (math.IsNaN(p.Fraction) || p.Fraction > 1) {
+		errs.add("WithStartupProbe.Fraction", "%v is above 1", p.Fraction)
+	}
+	if a := o.budgetAlerts; a != nil {
+		for _, t := range a.Thresholds {
+			if !(t > 0) {
+				errs.add("WithBudgetAlerts.Thresholds", "%v is not positive", t)
+			}
+		}
+	}
+}
+
+// New wraps db with the limits of c, which are validated together with
+// opts. Options take precedence over the fields of c they overlap with.
+// Unlike Wrap, New returns the problems it finds instead of panicking.
+func New(db *sql.DB, c Config, opts ...Option) (*RateLimitedDB, error) {
+	var base []Option
+	if len(c.TagLimits) > 0 {
+		base = append(base, WithTagLimits(c.TagLimits))
+	}
+	if c.MaxConcurrency > 0 {
+		base = append(base, WithMaxConcurrency(c.MaxConcurrency))
+	}
+	if c.Overflow != (OverflowPolicy{}) {
+		base = append(base, WithOverflowPolicy(c.Overflow))
+	}
+	if c.Adaptive != nil {
+		base = append(base, WithAdaptive(*c.Adaptive))
+	}
+	return wrap(db, rate.NewLimiter(c.Limit, c.Burst), c, append(base, opts...))
+}
+
+func (o *options) hasProfile(name string) bool {
+	if o.profiles == nil {
+		return false
+	}
+	_, ok := o.profiles.profiles[name]
+	return ok
+}
@@ -0,0 +1,88 @@
+package dbratelimit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestConfigValidate 测试 Validate 一次报告所有问题
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{Limit: 100, Burst: 10, MaxConcurrency: 4}).Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	err := Config{
+		Limit:          -1,
+		Burst:          -2,
+		MaxConcurrency: -3,
+		Overflow:       OverflowPolicy{Mode: OverflowShedOldest},
+		Adaptive:       &AdaptiveConfig{Min: 10, Max: 5, Beta: 1.5},
+		TagLimits:      map[string]LimitConfig{"reports": {Limit: -1}},
+	}.Validate()
+	var fields []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var ce *ConfigError
+		if !errors.As(e, &ce) {
+			t.Fatalf("%v is not a *ConfigError", e)
+		}
+		fields = append(fields, ce.Field)
+	}
+	want := "Limit Burst TagLimits[reports].Limit MaxConcurrency Overflow.MaxQueue Adaptive.Min Adaptive.Beta"
+	if got := strings.Join(fields, " "); got != want {
+		t.Errorf("fields = %s, want %s", got, want)
+	}
+}
+
+// TestNewRejectsInvalidOptions 测试构造函数在启动时拒绝无效配置
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := New(db, Config{Limit: 10},
+		WithQuotas(Quota{Count: 5}),
+		WithProfiles("missing", map[string]Profile{"normal": {}}))
+	for _, field := range []string{"Burst", "WithQuotas[0]", "WithProfiles"} {
+		if err == nil || !strings.Contains(err.Error(), "invalid "+field+":") {
+			t.Errorf("error %v does not report %s", err, field)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Wrap did not panic on a negative concurrency limit")
+		}
+	}()
+	Wrap(db, rate.Inf, 1, WithMaxConcurrency(-1))
+}
+
+// TestNew 测试 New 应用配置中的限额与并发设置
+func TestNew(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB, err := New(db, Config{
+		Limit:          rate.Limit(50),
+		Burst:          5,
+		MaxConcurrency: 2,
+		Overflow:       OverflowPolicy{Mode: OverflowQueue, MaxWait: time.Second},
+		Profile:        "degraded",
+	}, WithProfiles("normal", map[string]Profile{"normal": {}, "degraded": {Limit: 5}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rateLimitedDB.Close()
+
+	if got := rateLimitedDB.Profile(); got != "degraded" {
+		t.Errorf("profile = %q, want degraded", got)
+	}
+	if got := rateLimitedDB.limiter.Limit(); got != 5 {
+		t.Errorf("limit = %v, want 5 from the degraded profile", got)
+	}
+	if rateLimitedDB.opts.maxConcurrency != 2 || rateLimitedDB.opts.overflow.MaxWait != time.Second {
+		t.Errorf("options = %+v, want the concurrency and overflow of the config", rateLimitedDB.opts)
+	}
+}
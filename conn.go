@@ -0,0 +1,190 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"golang.org/x/time/rate"
+)
+
+// WithConnLimit limits calls to Conn, separately from query limiting, since
+// connection churn can overload a database as much as query rate. Use
+// OpenLimited or LimitConnector to also limit the connections the pool opens
+// on its own.
+func WithConnLimit(limit rate.Limit, burst int) Option {
+	return func(o *options) {
+		o.connLimit = &LimitConfig{Limit: limit, Burst: burst}
+	}
+}
+
+// LimitConnector returns a connector that waits for l before each new
+// connection opened by c. Pass it to sql.OpenDB to limit every connection
+// the pool opens, including implicit ones.
+func LimitConnector(c driver.Connector, l *rate.Limiter) driver.Connector {
+	return &limitedConnector{Connector: c, limiter: l}
+}
+
+// OpenLimited is sql.Open with connection opening limited by l, see
+// LimitConnector.
+func OpenLimited(driverName, dsn string, l *rate.Limiter) (*sql.DB, error) {
+	c, err := connectorFor(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(LimitConnector(c, l)), nil
+}
+
+// connectorFor returns the connector sql.Open would use
+func connectorFor(driverName, dsn string) (driver.Connector, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	if dc, ok := drv.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return dsnConnector{dsn: dsn, driver: drv}, nil
+}
+
+type limitedConnector struct {
+	driver.Connector
+	limiter *rate.Limiter
+}
+
+func (c *limitedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return c.Connector.Connect(ctx)
+}
+
+// dsnConnector is the connector sql.Open uses for drivers without
+// driver.DriverContext
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// UnwrapConn returns the driver's own connection behind a connection
+// wrapped by this package, as DriverName and LifetimeConnector do, for use
+// in sql.Conn.Raw, which otherwise sees the wrapper:
+//
+//	conn.Raw(func(dc any) error {
+//		pc := dbratelimit.UnwrapConn(dc).(*pq.Conn)
+//		...
+//	})
+//
+// Other values are returned as they are.
+func UnwrapConn(driverConn any) any {
+	for {
+		w, ok := driverConn.(interface{ Unwrap() driver.Conn })
+		if !ok {
+			return driverConn
+		}
+		driverConn = w.Unwrap()
+	}
+}
+
+// wrappedConn passes the optional driver interfaces through to Conn, or
+// reports driver.ErrSkip so database/sql falls back as it would without
+// them. Wrappers embed it and override what they change.
+type wrappedConn struct {
+	driver.Conn
+}
+
+// Unwrap returns the wrapped connection, see UnwrapConn
+func (c wrappedConn) Unwrap() driver.Conn {
+	return c.Conn
+}
+
+var (
+	_ driver.Validator          = wrappedConn{}
+	_ driver.SessionResetter    = wrappedConn{}
+	_ driver.ExecerContext      = wrappedConn{}
+	_ driver.QueryerContext     = wrappedConn{}
+	_ driver.ConnPrepareContext = wrappedConn{}
+	_ driver.ConnBeginTx        = wrappedConn{}
+	_ driver.Pinger             = wrappedConn{}
+	_ driver.NamedValueChecker  = wrappedConn{}
+)
+
+func (c wrappedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c wrappedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	// what database/sql does for drivers offering only Begin
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	tx, err := c.Conn.Begin() // deprecated, but all the driver offers
+	if err == nil && ctx.Err() != nil {
+		tx.Rollback()
+		return nil, ctx.Err()
+	}
+	return tx, err
+}
+
+func (c wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
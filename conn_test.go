@@ -0,0 +1,118 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestConnLimit 测试 Conn 调用单独限流
+func TestConnLimit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1, WithConnLimit(rate.Limit(0.1), 1))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	conn, err := rateLimitedDB.Conn(ctx)
+	if err != nil {
+		t.Fatalf("First Conn failed: %v", err)
+	}
+	conn.Close()
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.Conn(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected second Conn to be limited, got %v", err)
+	}
+	// 查询不受连接限流影响
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err != nil {
+		t.Errorf("Expected queries unaffected, got %v", err)
+	}
+}
+
+// TestOpenLimited 测试连接池自行建立的连接也受限
+func TestOpenLimited(t *testing.T) {
+	db, err := OpenLimited("sqlite3", "file:"+t.Name()+"?mode=memory", rate.NewLimiter(rate.Limit(0.1), 1))
+	if err != nil {
+		t.Fatalf("OpenLimited failed: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("First connection failed: %v", err)
+	}
+	defer conn.Close()
+
+	// 第一个连接被占用，第二个需要新建连接
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := db.PingContext(short); err == nil {
+		t.Error("Expected opening a second connection to be limited")
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		t.Errorf("Expected existing connection to work, got %v", err)
+	}
+}
+
+// beginOnlyConn 是只支持 Begin 的驱动连接
+type beginOnlyConn struct{ c *fakeConn }
+
+func (b beginOnlyConn) Prepare(query string) (driver.Stmt, error) { return b.c.Prepare(query) }
+func (b beginOnlyConn) Close() error                              { return nil }
+func (b beginOnlyConn) Begin() (driver.Tx, error)                 { return b.c.Begin() }
+
+// TestWrappedConnBeginTx 测试驱动只支持 Begin 时拒绝非默认隔离级别和只读事务
+func TestWrappedConnBeginTx(t *testing.T) {
+	_, f := setupFakeDB(t)
+	c := wrappedConn{beginOnlyConn{&fakeConn{f: f}}}
+	ctx := context.Background()
+
+	if _, err := c.BeginTx(ctx, driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable)}); err == nil {
+		t.Error("Expected an error for a non-default isolation level")
+	}
+	if _, err := c.BeginTx(ctx, driver.TxOptions{ReadOnly: true}); err == nil {
+		t.Error("Expected an error for a read-only transaction")
+	}
+	if methods := f.Methods(); len(methods) != 0 {
+		t.Errorf("Expected no transaction to be started, got %v", methods)
+	}
+	tx, err := c.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Default transaction failed: %v", err)
+	}
+	tx.Rollback()
+}
+
+// TestUnwrapConn 测试 sql.Conn.Raw 可以拿到驱动自己的连接
+func TestUnwrapConn(t *testing.T) {
+	_, _ = setupFakeDB(t)
+	db, err := sql.Open(DriverName, "dbratelimit-fake:"+t.Name()+"?dbrl_limit=inf")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Conn failed: %v", err)
+	}
+	defer conn.Close()
+	err = conn.Raw(func(dc any) error {
+		if _, ok := UnwrapConn(dc).(*fakeConn); !ok {
+			t.Errorf("Expected the driver's connection, got %T", UnwrapConn(dc))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Raw failed: %v", err)
+	}
+}
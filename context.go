@@ -0,0 +1,303 @@
+package dbratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// ctxKey is the type of the keys under which the controls below are
+// stored. Being unexported, no other package can make a key equal to one of
+// them: use the With and From helpers, or WithPolicy and PolicyFrom, to set
+// and read the controls.
+type ctxKey int
+
+const (
+	policyKey   ctxKey = iota
+	queryKey           // statement being admitted, for queue inspection
+	flushKey           // write being flushed from the write buffer
+	preparedKey        // statement prepared for a call that was already admitted
+	boostKey
+)
+
+// queryContext carries the statement being admitted under queryKey. It is
+// embedded in the call rather than made with context.WithValue so that
+// admission does not allocate.
+type queryContext struct {
+	context.Context
+	query string
+}
+
+func (c *queryContext) Value(key any) any {
+	if key == queryKey {
+		return c.query
+	}
+	return c.Context.Value(key)
+}
+
+// Priority orders calls competing for the same limiter.
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+	// PriorityCritical calls never wait: they take their tokens immediately,
+	// putting the limiter into debt that later calls pay back, and bypass
+	// the concurrency limit. Use it for
+	// statements that must not stall once started, such as the commit phase
+	// of an operation spanning several databases.
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// Policy holds the per-call overrides carried by a context. The individual
+// helpers such as WithPriority and WithTag each set one field of it.
+//
+// A call's effective policy is resolved field by field, the first of these
+// to set a field winning:
+//
+//  1. comment directives in the statement, see WithCommentDirectives
+//  2. the policy carried by the call's context
+//  3. the defaults of the view the call is made on, see
+//     RateLimitedDB.WithPolicy
+//
+// Settings chosen by the resolved fields come next: an overflow policy set
+// for the call's tag with WithTagOverflow wins over one set for its
+// priority, and both over the wrapper's defaults. An admission policy, see
+// WithAdmissionPolicy, may change the result last. EffectivePolicy reports
+// the outcome for a call.
+type Policy struct {
+	Priority  Priority
+	Cost      int  // tokens charged per call; 0 leaves the cost to WithCostFunc
+	Exempt    bool // see WithExempt
+	LongPoll  bool // see WithLongPoll
+	Migration bool // see WithMigration
+
+	Idempotency    Idempotency // see WithIdempotency
+	IdempotencyKey string      // see WithIdempotencyKey
+	Tag            string      // see WithTag
+	Key            string      // see WithKey
+	Caller         string      // see WithCaller
+	IntendedStart  time.Time   // see WithIntendedStart
+}
+
+type ctxPolicy struct {
+	Policy
+	costSet bool // set by WithCost, which may set 0
+}
+
+func policyOf(ctx context.Context) ctxPolicy {
+	p, _ := ctx.Value(policyKey).(ctxPolicy)
+	return p
+}
+
+// WithPolicy merges p into the policy carried by ctx: non-zero fields of p
+// replace those set earlier, by WithPolicy or the individual helpers, and
+// zero fields keep them. Use the individual helpers to reset a field to its
+// zero value, e.g. WithPriority(ctx, PriorityNormal).
+func WithPolicy(ctx context.Context, p Policy) context.Context {
+	return context.WithValue(ctx, policyKey, overlay(policyOf(ctx), setFields(p)))
+}
+
+// setFields treats the non-zero fields of p as set
+func setFields(p Policy) ctxPolicy {
+	return ctxPolicy{Policy: p, costSet: p.Cost != 0}
+}
+
+// overlay returns p with the fields set in q replacing its own
+func overlay(p, q ctxPolicy) ctxPolicy {
+	if q.Priority != PriorityNormal {
+		p.Priority = q.Priority
+	}
+	if q.costSet {
+		p.Cost, p.costSet = q.Cost, true
+	}
+	p.Exempt = p.Exempt || q.Exempt
+	p.LongPoll = p.LongPoll || q.LongPoll
+	p.Migration = p.Migration || q.Migration
+	if q.Idempotency != IdempotencyUnknown {
+		p.Idempotency = q.Idempotency
+	}
+	if q.IdempotencyKey != "" {
+		p.IdempotencyKey = q.IdempotencyKey
+	}
+	if q.Tag != "" {
+		p.Tag = q.Tag
+	}
+	if q.Key != "" {
+		p.Key = q.Key
+	}
+	if q.Caller != "" {
+		p.Caller = q.Caller
+	}
+	if !q.IntendedStart.IsZero() {
+		p.IntendedStart = q.IntendedStart
+	}
+	return p
+}
+
+// PolicyFrom returns the policy carried by ctx.
+func PolicyFrom(ctx context.Context) Policy {
+	return policyOf(ctx).Policy
+}
+
+// update stores the policy carried by ctx after applying fn to it
+func update(ctx context.Context, fn func(*ctxPolicy)) context.Context {
+	p := policyOf(ctx)
+	fn(&p)
+	return context.WithValue(ctx, policyKey, p)
+}
+
+// WithExempt marks calls made with ctx as exempt from rate limiting. Unlike
+// PriorityCritical, exempt calls do not consume tokens at all.
+func WithExempt(ctx context.Context) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Exempt = true })
+}
+
+// IsExempt reports whether ctx was marked with WithExempt.
+func IsExempt(ctx context.Context) bool {
+	return policyOf(ctx).Exempt
+}
+
+// WithLongPoll marks calls made with ctx as long-lived, like statements
+// detected by IsLongPollStatement: they take no tokens or concurrency slots,
+// get no statement timeout and are left out of statistics, the queue delay
+// SLO, adaptive control and latency tracking, which their duration would
+// distort. Observers and the AfterQuery hook see them with QueryInfo.LongPoll
+// set.
+func WithLongPoll(ctx context.Context) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.LongPoll = true })
+}
+
+// IsLongPoll reports whether ctx was marked with WithLongPoll.
+func IsLongPoll(ctx context.Context) bool {
+	return policyOf(ctx).LongPoll
+}
+
+// WithIntendedStart records when a call made with ctx was meant to start,
+// e.g. its slot in a loop issuing calls at a fixed rate or the arrival of
+// the request it serves, so that QueryInfo.Scheduled and
+// Stats.ScheduledLatency measure from then. Otherwise time a caller spends
+// behind an earlier throttled call never shows up in the latencies, which
+// then understate what users see (coordinated omission). Times after the
+// call starts are ignored.
+func WithIntendedStart(ctx context.Context, t time.Time) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.IntendedStart = t })
+}
+
+// IntendedStartFrom returns the time set by WithIntendedStart, if any.
+func IntendedStartFrom(ctx context.Context) (time.Time, bool) {
+	t := policyOf(ctx).IntendedStart
+	return t, !t.IsZero()
+}
+
+// Idempotency tells RunInTx whether repeating a transaction is safe.
+type Idempotency int
+
+const (
+	// IdempotencyUnknown retries transactions that are known not to have
+	// committed, and those that failed while committing only if they did
+	// not write, since a failed COMMIT, e.g. on a lost connection, may
+	// still have taken effect.
+	IdempotencyUnknown Idempotency = iota
+	// Idempotent transactions can be repeated safely even if they may
+	// have committed, typically because their writes carry an idempotency
+	// key.
+	Idempotent
+	// NotIdempotent transactions are never repeated once they have run.
+	NotIdempotent
+)
+
+// WithIdempotency sets whether transactions run by RunInTx with ctx may be
+// repeated.
+func WithIdempotency(ctx context.Context, i Idempotency) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Idempotency = i })
+}
+
+// WithIdempotencyKey marks work done with ctx as Idempotent on the strength
+// of key, which the statements are expected to use, e.g. in a unique
+// column, so that a repeated insert finds the row already there. Get it
+// back with IdempotencyKeyFrom.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Idempotency, p.IdempotencyKey = Idempotent, key })
+}
+
+// IdempotencyFrom returns the idempotency set on ctx.
+func IdempotencyFrom(ctx context.Context) Idempotency {
+	return policyOf(ctx).Idempotency
+}
+
+// IdempotencyKeyFrom returns the key set by WithIdempotencyKey, or "".
+func IdempotencyKeyFrom(ctx context.Context) string {
+	return policyOf(ctx).IdempotencyKey
+}
+
+// WithPriority sets the priority of calls made with ctx.
+func WithPriority(ctx context.Context, pr Priority) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Priority = pr })
+}
+
+// PriorityFrom returns the priority stored in ctx, or PriorityNormal.
+func PriorityFrom(ctx context.Context) Priority {
+	return policyOf(ctx).Priority
+}
+
+// WithKey sets the key (typically a tenant) whose bucket calls made with ctx
+// are charged to when keyed limits are enabled.
+func WithKey(ctx context.Context, key string) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Key = key })
+}
+
+// KeyFrom returns the key stored in ctx, or "".
+func KeyFrom(ctx context.Context) string {
+	return policyOf(ctx).Key
+}
+
+// WithCost charges calls made with ctx n tokens each, taking precedence over
+// WithCostFunc. Use it for calls known to be expensive, such as exports.
+func WithCost(ctx context.Context, n int) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Cost, p.costSet = n, true })
+}
+
+// CostFrom returns the cost stored in ctx by WithCost.
+func CostFrom(ctx context.Context) (int, bool) {
+	p := policyOf(ctx)
+	return p.Cost, p.costSet
+}
+
+// WithTag labels calls made with ctx, e.g. with the feature issuing them, so
+// their footprint shows up separately in Stats.
+func WithTag(ctx context.Context, tag string) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Tag = tag })
+}
+
+// TagFrom returns the tag stored in ctx, or "".
+func TagFrom(ctx context.Context) string {
+	return policyOf(ctx).Tag
+}
+
+// WithMigration marks calls made with ctx as part of a schema migration, so
+// they use the migration limiter set by WithMigrationLimit, if any, instead
+// of the application's budget. DDL statements are treated as migration
+// calls regardless of ctx.
+func WithMigration(ctx context.Context) context.Context {
+	return update(ctx, func(p *ctxPolicy) { p.Migration = true })
+}
+
+// IsMigration reports whether ctx was marked with WithMigration.
+func IsMigration(ctx context.Context) bool {
+	return policyOf(ctx).Migration
+}
@@ -0,0 +1,106 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestSharedLimiterPriority 测试共享 limiter 时第二阶段语句可以豁免或优先执行
+func TestSharedLimiterPriority(t *testing.T) {
+	db1 := setupTestDB(t)
+	defer db1.Close()
+	db2, err := sql.Open("sqlite3", "file:"+t.Name()+"_2?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db2.Close()
+
+	limiter := rate.NewLimiter(rate.Limit(0.01), 1)
+	first := WrapLimiter(db1, limiter)
+	second := WrapLimiter(db2, limiter)
+	if first.Limiter() != second.Limiter() {
+		t.Fatal("Expected both wrappers to share the limiter")
+	}
+
+	ctx := context.Background()
+	if _, err := first.ExecContext(ctx, "UPDATE users SET name = 'Bob'"); err != nil {
+		t.Fatalf("First phase failed: %v", err)
+	}
+
+	// 共享的 token 已耗尽，普通语句在超时前拿不到 token
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := second.ExecContext(short, "SELECT 1"); err == nil {
+		t.Fatal("Expected normal call to be throttled")
+	}
+
+	start := time.Now()
+	if _, err := second.ExecContext(WithPriority(ctx, PriorityCritical), "SELECT 1"); err != nil {
+		t.Fatalf("Critical call failed: %v", err)
+	}
+	tokensAfterCritical := limiter.Tokens()
+	if _, err := second.ExecContext(WithExempt(ctx), "SELECT 1"); err != nil {
+		t.Fatalf("Exempt call failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Critical and exempt calls should not wait, took %v", elapsed)
+	}
+
+	// critical 调用让 limiter 进入负债，exempt 调用不消耗 token
+	if tokensAfterCritical > -0.5 {
+		t.Errorf("Expected limiter in debt after critical call, got %v tokens", tokensAfterCritical)
+	}
+	if limiter.Tokens() < tokensAfterCritical-0.1 {
+		t.Errorf("Exempt call should not consume tokens")
+	}
+}
+
+// TestPriorityFrom 测试默认优先级
+func TestPriorityFrom(t *testing.T) {
+	ctx := context.Background()
+	if PriorityFrom(ctx) != PriorityNormal {
+		t.Error("Expected PriorityNormal by default")
+	}
+	if IsExempt(ctx) {
+		t.Error("Expected not exempt by default")
+	}
+	if PriorityFrom(WithPriority(ctx, PriorityLow)) != PriorityLow {
+		t.Error("Expected PriorityLow")
+	}
+}
+
+// TestWithPolicy 测试 Policy 的合并语义及与单项 helper 的互通
+func TestWithPolicy(t *testing.T) {
+	ctx := WithTag(context.Background(), "report")
+	ctx = WithPolicy(ctx, Policy{Priority: PriorityHigh, Cost: 5, Key: "tenant-a"})
+	want := Policy{Priority: PriorityHigh, Cost: 5, Tag: "report", Key: "tenant-a"}
+	if got := PolicyFrom(ctx); got != want {
+		t.Errorf("PolicyFrom = %+v, want %+v", got, want)
+	}
+	if n, ok := CostFrom(ctx); !ok || n != 5 {
+		t.Errorf("CostFrom = %d, %v", n, ok)
+	}
+
+	// 零值字段保留原有设置
+	merged := WithPolicy(ctx, Policy{Exempt: true, Key: "tenant-b"})
+	want = Policy{Priority: PriorityHigh, Cost: 5, Exempt: true, Tag: "report", Key: "tenant-b"}
+	if got := PolicyFrom(merged); got != want {
+		t.Errorf("Merged PolicyFrom = %+v, want %+v", got, want)
+	}
+	if !IsExempt(merged) || KeyFrom(merged) != "tenant-b" || TagFrom(merged) != "report" {
+		t.Error("Expected helpers to read the merged policy")
+	}
+
+	// 单项 helper 可以重置为零值，且不影响父 context
+	reset := WithPriority(merged, PriorityNormal)
+	if PriorityFrom(reset) != PriorityNormal || PriorityFrom(merged) != PriorityHigh {
+		t.Error("Expected WithPriority to reset the priority of the derived context only")
+	}
+	if _, ok := CostFrom(context.Background()); ok {
+		t.Error("Expected no cost by default")
+	}
+}
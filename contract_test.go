@@ -0,0 +1,130 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type contractKey struct{}
+
+// TestContractExec 测试 ExecContext 把语句、参数和调用方的上下文原样传给驱动
+func TestContractExec(t *testing.T) {
+	db, f := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithStatementTimeout(time.Second))
+	defer rateLimitedDB.Close()
+
+	ctx := context.WithValue(context.Background(), contractKey{}, "caller")
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE t SET a = ?", 7); err != nil {
+		t.Fatal(err)
+	}
+	calls := f.Calls()
+	if len(calls) != 1 || calls[0].Method != "Exec" || calls[0].Query != "UPDATE t SET a = ?" {
+		t.Fatalf("driver calls = %v, want one Exec", f.Methods())
+	}
+	c := calls[0]
+	if len(c.Args) != 1 || c.Args[0].Value != int64(7) {
+		t.Errorf("args = %+v", c.Args)
+	}
+	if c.Ctx.Value(contractKey{}) != "caller" {
+		t.Error("driver context lost the caller's values")
+	}
+	if deadline, ok := c.Ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("driver context deadline %v, %t, want the statement timeout", deadline, ok)
+	}
+}
+
+// TestContractQuery 测试查询和预处理语句调用的驱动方法
+func TestContractQuery(t *testing.T) {
+	db, f := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10)
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	var n int
+	if err := rateLimitedDB.QueryRowContext(ctx, "SELECT n FROM t").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("scan: %d, %v", n, err)
+	}
+	stmt, err := rateLimitedDB.PrepareContext(ctx, "DELETE FROM t WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.ExecContext(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+
+	want := []string{"Query", "Prepare", "StmtExec"}
+	if got := f.Methods(); !equalStrings(got, want) {
+		t.Errorf("driver calls = %v, want %v", got, want)
+	}
+}
+
+// TestContractTx 测试事务内的调用和提交都到达驱动
+func TestContractTx(t *testing.T) {
+	db, f := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10)
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	tx, err := rateLimitedDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Begin", "Exec", "Commit"}
+	if got := f.Methods(); !equalStrings(got, want) {
+		t.Errorf("driver calls = %v, want %v", got, want)
+	}
+}
+
+// TestContractRejected 测试被拒绝的调用不会到达驱动，豁免的调用会
+func TestContractRejected(t *testing.T) {
+	db, f := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 1, WithOverflowPolicy(OverflowPolicy{Mode: OverflowReject}))
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE t SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE t SET a = 2"); !errors.Is(err, ErrRejected) {
+		t.Fatalf("want ErrRejected, got %v", err)
+	}
+	if _, err := rateLimitedDB.ExecContext(WithExempt(ctx), "UPDATE t SET a = 3"); err != nil {
+		t.Fatal(err)
+	}
+	calls := f.Calls()
+	if len(calls) != 2 || calls[0].Query != "UPDATE t SET a = 1" || calls[1].Query != "UPDATE t SET a = 3" {
+		t.Errorf("driver calls = %+v, want the first and the exempt one", calls)
+	}
+}
+
+// TestContractCancel 测试取消调用方的上下文会取消驱动中的调用
+func TestContractCancel(t *testing.T) {
+	db, f := setupFakeDB(t)
+	f.handle = func(ctx context.Context, method, query string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10)
+	defer rateLimitedDB.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE t SET a = 1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+	calls := f.Calls()
+	if len(calls) != 1 || calls[0].Ctx.Err() == nil {
+		t.Errorf("driver calls = %v, want one canceled Exec", f.Methods())
+	}
+}
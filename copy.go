@@ -0,0 +1,97 @@
+package dbratelimit
+
+import (
+	"context"
+	"io"
+)
+
+// CopySource has the same method set as pgx.CopyFromSource, so values of
+// this type can be passed straight to pgx's CopyFrom.
+type CopySource interface {
+	Next() bool
+	Values() ([]any, error)
+	Err() error
+}
+
+// ThrottleCopySource wraps src so that one token is acquired for every
+// rowsPerToken rows. Bulk loads through COPY are then paced by the limiter
+// instead of counting as a single call. If waiting fails, Next returns false
+// and Err reports the limiter error.
+func (r *RateLimitedDB) ThrottleCopySource(ctx context.Context, src CopySource, rowsPerToken int) CopySource {
+	if rowsPerToken <= 0 {
+		rowsPerToken = 1
+	}
+	return &throttledSource{r: r, ctx: ctx, src: src, per: rowsPerToken}
+}
+
+type throttledSource struct {
+	r    *RateLimitedDB
+	ctx  context.Context
+	src  CopySource
+	per  int
+	rows int
+	err  error
+}
+
+func (s *throttledSource) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.rows%s.per == 0 {
+		if s.err = s.r.acquire(s.ctx, 1); s.err != nil {
+			return false
+		}
+	}
+	if !s.src.Next() {
+		return false
+	}
+	s.rows++
+	return true
+}
+
+func (s *throttledSource) Values() ([]any, error) {
+	return s.src.Values()
+}
+
+func (s *throttledSource) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.src.Err()
+}
+
+// ThrottleReader wraps rd so that one token is acquired for every
+// bytesPerToken bytes read. Use it with MySQL's LOAD DATA LOCAL INFILE
+// (mysql.RegisterReaderHandler) or any other streaming load.
+func (r *RateLimitedDB) ThrottleReader(ctx context.Context, rd io.Reader, bytesPerToken int) io.Reader {
+	if bytesPerToken <= 0 {
+		bytesPerToken = 1
+	}
+	return &throttledReader{r: r, ctx: ctx, rd: rd, per: bytesPerToken}
+}
+
+type throttledReader struct {
+	r    *RateLimitedDB
+	ctx  context.Context
+	rd   io.Reader
+	per  int
+	left int // bytes remaining before the next token is needed
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if t.left == 0 {
+		if err := t.r.acquire(t.ctx, 1); err != nil {
+			return 0, err
+		}
+		t.left = t.per
+	}
+	if len(p) > t.left {
+		p = p[:t.left]
+	}
+	n, err := t.rd.Read(p)
+	t.left -= n
+	return n, err
+}
@@ -0,0 +1,89 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// sliceSource 是一个基于切片的 CopySource
+type sliceSource struct {
+	rows [][]any
+	i    int
+}
+
+func (s *sliceSource) Next() bool {
+	if s.i >= len(s.rows) {
+		return false
+	}
+	s.i++
+	return true
+}
+
+func (s *sliceSource) Values() ([]any, error) { return s.rows[s.i-1], nil }
+func (s *sliceSource) Err() error             { return nil }
+
+// TestThrottleCopySource 测试 COPY 数据源每 N 行获取一次 token
+func TestThrottleCopySource(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.01), 3)
+	defer rateLimitedDB.Close()
+
+	src := &sliceSource{}
+	for i := 0; i < 100; i++ {
+		src.rows = append(src.rows, []any{i})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	throttled := rateLimitedDB.ThrottleCopySource(ctx, src, 25)
+
+	n := 0
+	for throttled.Next() {
+		if _, err := throttled.Values(); err != nil {
+			t.Fatalf("Values failed: %v", err)
+		}
+		n++
+	}
+	// 3 个 token 对应 75 行，第 4 个 token 等待超时
+	if n != 75 {
+		t.Errorf("Expected 75 rows before throttling, got %d", n)
+	}
+	if throttled.Err() == nil {
+		t.Error("Expected limiter error from Err()")
+	}
+}
+
+// TestThrottleReader 测试 LOAD DATA 读取器每 N 字节获取一次 token
+func TestThrottleReader(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.01), 2)
+	defer rateLimitedDB.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rd := rateLimitedDB.ThrottleReader(ctx, bytes.NewReader(make([]byte, 1000)), 100)
+
+	data, err := io.ReadAll(rd)
+	if err == nil {
+		t.Fatal("Expected limiter error")
+	}
+	if len(data) != 200 {
+		t.Errorf("Expected 200 bytes before throttling, got %d", len(data))
+	}
+
+	// 速率足够时可以读完全部数据
+	fast := Wrap(db, rate.Limit(1000), 10)
+	data, err = io.ReadAll(fast.ThrottleReader(context.Background(), bytes.NewReader(make([]byte, 1000)), 100))
+	if err != nil || len(data) != 1000 {
+		t.Errorf("Expected full read, got %d bytes, err %v", len(data), err)
+	}
+}
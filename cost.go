@@ -0,0 +1,195 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrCostExceedsBurst is returned when a query costs more tokens than the
+// limiter's burst and the BurstPolicy is BurstPolicyError.
+var ErrCostExceedsBurst error = newError(CodeRejected, "dbratelimit: query cost exceeds limiter burst")
+
+// CostFunc returns how many tokens a query consumes. Values below 1 are
+// treated as 1.
+type CostFunc func(query string) int
+
+// BurstPolicy decides what happens when a query costs more than the burst.
+type BurstPolicy int
+
+const (
+	// BurstPolicyError fails the call with ErrCostExceedsBurst.
+	BurstPolicyError BurstPolicy = iota
+	// BurstPolicyClamp charges at most burst tokens.
+	BurstPolicyClamp
+	// BurstPolicySplit acquires the cost in several burst-sized chunks.
+	BurstPolicySplit
+)
+
+// WithCostFunc charges each query the number of tokens returned by fn
+// instead of a single token.
+func WithCostFunc(fn CostFunc) Option {
+	return func(o *options) {
+		o.costFunc = fn
+	}
+}
+
+// WithBurstPolicy sets how costs greater than the burst are handled.
+func WithBurstPolicy(p BurstPolicy) Option {
+	return func(o *options) {
+		o.burstPolicy = p
+	}
+}
+
+// cost returns the number of tokens charged for query
+func (r *RateLimitedDB) cost(ctx context.Context, query string) int {
+	if n, ok := CostFrom(ctx); ok {
+		if n < 1 {
+			return 1
+		}
+		return n
+	}
+	if r.opts.procedures != nil {
+		if p, ok := r.procedure(query); ok && p.Cost > 0 {
+			return p.Cost
+		}
+	}
+	fn := r.opts.costFunc
+	if fn == nil {
+		return 1
+	}
+	n := 1
+	r.safely("cost func", func() { n = fn(query) })
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// waitN acquires n tokens from the main limiter
+func (r *RateLimitedDB) waitN(ctx context.Context, n int, h *holds) error {
+	return r.waitQueued(ctx, n, h)
+}
+
+// waitLimiter acquires n tokens from l, applying the burst policy when
+// n > burst. The reservations are added to h, which may be nil.
+func (r *RateLimitedDB) waitLimiter(ctx context.Context, l *rate.Limiter, n int, h *holds) error {
+	burst := l.Burst()
+	if n <= burst || l.Limit() == rate.Inf {
+		return waitTokens(ctx, l, n, h)
+	}
+
+	switch r.opts.burstPolicy {
+	case BurstPolicyClamp:
+		return waitTokens(ctx, l, burst, h)
+	case BurstPolicySplit:
+		if burst <= 0 {
+			break
+		}
+		// finished chunks are given back if ctx is canceled part way through
+		var chunks holds
+		for n > 0 {
+			chunk := n
+			if chunk > burst {
+				chunk = burst
+			}
+			if err := waitTokens(ctx, l, chunk, &chunks); err != nil {
+				chunks.cancel(time.Now())
+				return err
+			}
+			n -= chunk
+		}
+		h.merge(&chunks)
+		return nil
+	}
+	return fmt.Errorf("%w: cost %d, burst %d", ErrCostExceedsBurst, n, burst)
+}
+
+// takeN consumes n tokens (at most burst) without waiting
+func takeN(l *rate.Limiter, n int) {
+	if burst := l.Burst(); n > burst {
+		n = burst
+	}
+	l.ReserveN(time.Now(), n)
+}
+
+// hold is a reservation taken by one admission stage
+type hold struct {
+	res rate.Reservation
+	l   *rate.Limiter // the limiter res was taken from
+	n   int
+}
+
+// holds collects the reservations of the admission stages a call has
+// passed, so that they can be given back if a later stage fails. The first
+// few are kept inline to spare the common case an allocation.
+type holds struct {
+	n     int
+	first [4]hold
+	more  []hold
+}
+
+// add records res of n tokens, taken from l; a nil h records nothing
+func (h *holds) add(l *rate.Limiter, res *rate.Reservation, n int) {
+	if h == nil {
+		return
+	}
+	if h.n < len(h.first) {
+		h.first[h.n] = hold{*res, l, n}
+		h.n++
+		return
+	}
+	h.more = append(h.more, hold{*res, l, n})
+}
+
+// cancel returns the tokens of every reservation in h to its limiter
+func (h *holds) cancel(now time.Time) {
+	for i := len(h.more) - 1; i >= 0; i-- {
+		h.more[i].cancel(now)
+	}
+	for i := h.n - 1; i >= 0; i-- {
+		h.first[i].cancel(now)
+	}
+}
+
+// cancel gives the tokens of the reservation back at now. One not yet
+// due is canceled as usual. Canceling one already granted does nothing,
+// and canceling it at an earlier time would credit the limiter again for
+// refill it has counted since, so its tokens are refunded with a negative
+// reservation instead. That moves the limiter's last event to now, so it
+// is skipped while the limiter is in debt and owes later reservations.
+func (hd *hold) cancel(now time.Time) {
+	if hd.res.DelayFrom(now) > 0 {
+		hd.res.CancelAt(now)
+		return
+	}
+	if hd.n > 0 && hd.l.TokensAt(now) >= 0 {
+		hd.l.ReserveN(now, -hd.n)
+	}
+}
+
+// merge adds the reservations of o to h
+func (h *holds) merge(o *holds) {
+	for i := 0; i < o.n; i++ {
+		h.add(o.first[i].l, &o.first[i].res, o.first[i].n)
+	}
+	for i := range o.more {
+		h.add(o.more[i].l, &o.more[i].res, o.more[i].n)
+	}
+}
+
+// allowN is l.AllowN, adding the tokens taken to h
+func allowN(l *rate.Limiter, now time.Time, n int, h *holds) bool {
+	res := l.ReserveN(now, n)
+	if !res.OK() {
+		return false
+	}
+	if res.DelayFrom(now) > 0 {
+		res.CancelAt(now)
+		return false
+	}
+	h.add(l, res, n)
+	return true
+}
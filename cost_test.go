@@ -0,0 +1,127 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// heavyCost 给 SELECT 语句计 5 个 token，其他语句计 1 个
+func heavyCost(query string) int {
+	if strings.HasPrefix(query, "SELECT") {
+		return 5
+	}
+	return 1
+}
+
+// TestCostFunc 测试自定义 cost 函数会消耗对应数量的 token
+func TestCostFunc(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 5, WithCostFunc(heavyCost))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	rows, err := rateLimitedDB.QueryContext(ctx, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("QueryContext failed: %v", err)
+	}
+	rows.Close()
+
+	// 5 个 token 已全部用完
+	if tokens := rateLimitedDB.limiter.Tokens(); tokens >= 1 {
+		t.Errorf("Expected burst to be drained, got %v tokens", tokens)
+	}
+}
+
+// TestBurstPolicyError 测试 cost 超过 burst 时返回 ErrCostExceedsBurst
+func TestBurstPolicyError(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 2, WithCostFunc(heavyCost))
+	defer rateLimitedDB.Close()
+
+	_, err := rateLimitedDB.QueryContext(context.Background(), "SELECT * FROM users")
+	if !errors.Is(err, ErrCostExceedsBurst) {
+		t.Fatalf("Expected ErrCostExceedsBurst, got %v", err)
+	}
+
+	// 低 cost 的语句不受影响
+	if _, err := rateLimitedDB.ExecContext(context.Background(), "UPDATE users SET name = name"); err != nil {
+		t.Fatalf("ExecContext failed: %v", err)
+	}
+}
+
+// TestBurstPolicyClamp 测试 clamp 策略最多只消耗 burst 个 token
+func TestBurstPolicyClamp(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 2,
+		WithCostFunc(heavyCost), WithBurstPolicy(BurstPolicyClamp))
+	defer rateLimitedDB.Close()
+
+	rows, err := rateLimitedDB.QueryContext(context.Background(), "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("QueryContext failed: %v", err)
+	}
+	rows.Close()
+}
+
+// TestBurstPolicySplit 测试 split 策略分多次获取 token
+func TestBurstPolicySplit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 2,
+		WithCostFunc(heavyCost), WithBurstPolicy(BurstPolicySplit))
+	defer rateLimitedDB.Close()
+
+	rows, err := rateLimitedDB.QueryContext(context.Background(), "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("QueryContext failed: %v", err)
+	}
+	rows.Close()
+
+	// 速率很低时，split 策略在上下文超时后返回错误而不是永远等待
+	slowDB := Wrap(db, rate.Limit(0.001), 2,
+		WithCostFunc(heavyCost), WithBurstPolicy(BurstPolicySplit))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := slowDB.QueryContext(ctx, "SELECT * FROM users"); err == nil {
+		t.Error("Expected error when tokens cannot be acquired before deadline")
+	}
+}
+
+// TestWithCost 测试上下文中的 cost 优先于 cost 函数
+func TestWithCost(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 10, WithCostFunc(heavyCost))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if got := rateLimitedDB.cost(ctx, "SELECT 1"); got != 5 {
+		t.Errorf("Expected cost func to apply, got %d", got)
+	}
+	if got := rateLimitedDB.cost(WithCost(ctx, 8), "SELECT 1"); got != 8 {
+		t.Errorf("Expected context cost 8, got %d", got)
+	}
+	if got := rateLimitedDB.cost(WithCost(ctx, 0), "SELECT 1"); got != 1 {
+		t.Errorf("Expected context cost clamped to 1, got %d", got)
+	}
+
+	if _, err := rateLimitedDB.ExecContext(WithCost(ctx, 10), "UPDATE users SET name = name"); err != nil {
+		t.Fatalf("ExecContext failed: %v", err)
+	}
+	if tokens := rateLimitedDB.limiter.Tokens(); tokens >= 1 {
+		t.Errorf("Expected 10 tokens to be charged, %v left", tokens)
+	}
+}
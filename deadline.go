@@ -0,0 +1,155 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrWaitBudgetExceeded is returned when a call could not be admitted within
+// its share of the context deadline, see WithWaitBudgetFraction.
+var ErrWaitBudgetExceeded error = newError(CodeThrottled, "dbratelimit: wait budget exceeded")
+
+// LatencyError wraps a deadline error with how the call's time was spent,
+// telling apart a slow database from throttling by the limiter.
+type LatencyError struct {
+	Err  error
+	Wait time.Duration // waiting for admission
+	Exec time.Duration // running the statement; zero if never admitted
+}
+
+func (e *LatencyError) Error() string {
+	return fmt.Sprintf("%v after %v (%v waiting for the limiter, %v executing)",
+		e.Err, e.Wait+e.Exec, e.Wait, e.Exec)
+}
+
+func (e *LatencyError) Unwrap() error {
+	return e.Err
+}
+
+// WithStatementTimeout bounds how long each underlying database call may
+// run once admitted. Time spent waiting for the limiter does not count.
+func WithStatementTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.statementTimeout = d
+	}
+}
+
+// WithDefaultTimeout gives calls whose context has no deadline one of d,
+// covering both waiting for admission and running the statement, so that
+// work started with context.Background() cannot queue behind the limiter
+// forever. The rows of QueryRows cancel the deadline when they are closed;
+// those of the other query calls, which do not report being closed, keep
+// it until it passes.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.defaultTimeout = d
+	}
+}
+
+// callContext applies the default timeout to ctx if it has no deadline; the
+// cancel func is nil if it did not
+func (r *RateLimitedDB) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.opts.defaultTimeout <= 0 {
+		return ctx, nil
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, r.opts.defaultTimeout)
+}
+
+// execContext returns the context for the underlying call, with the cancel
+// func nil if there is no statement timeout. For Query calls the returned
+// rows outlive the call and keep their contexts, see call.holdRows.
+func (r *RateLimitedDB) execContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.opts.statementTimeout <= 0 {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, r.opts.statementTimeout)
+}
+
+// WithWaitBudgetFraction limits waiting for admission to fraction f of the
+// time left until the context deadline, keeping the rest for the query
+// itself. A call that cannot be admitted in time fails with
+// ErrWaitBudgetExceeded instead of being admitted with too little time left
+// to run. Calls without a deadline are not affected. f outside (0, 1)
+// disables the budget.
+func WithWaitBudgetFraction(f float64) Option {
+	return func(o *options) {
+		o.waitBudget = f
+	}
+}
+
+// admissionContext returns the context to wait for admission with
+func (r *RateLimitedDB) admissionContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	f := r.opts.waitBudget
+	deadline, ok := ctx.Deadline()
+	if f <= 0 || f >= 1 || !ok {
+		return ctx, func() {}
+	}
+	budget := time.Duration(float64(time.Until(deadline)) * f)
+	return context.WithTimeout(ctx, budget)
+}
+
+// admissionError reports err from waiting with admitCtx, attributing it to
+// the wait budget when only the budget, not ctx itself, ran out
+func admissionError(ctx, admitCtx context.Context, err error) error {
+	if err == nil || admitCtx == ctx || ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrWaitBudgetExceeded, err)
+}
+
+// waitTokens is l.WaitN, but reports waits that would outlast the deadline
+// of ctx as context.DeadlineExceeded and adds the reservation to h
+func waitTokens(ctx context.Context, l *rate.Limiter, n int, h *holds) error {
+	if burst := l.Burst(); n > burst && l.Limit() != rate.Inf {
+		return fmt.Errorf("rate: Wait(n=%d) exceeds limiter's burst %d", n, burst)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	res := l.ReserveN(now, n)
+	delay := res.DelayFrom(now)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		res.CancelAt(now)
+		return fmt.Errorf("%w: rate: Wait(n=%d) would exceed context deadline", context.DeadlineExceeded, n)
+	}
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			res.Cancel()
+			return ctx.Err()
+		}
+	}
+	h.add(l, res, n)
+	return nil
+}
+
+// timeout wraps err in a LatencyError if the call ran out of time
+func (c *call) timeout(err error) error {
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	e := &LatencyError{Err: err, Wait: c.admitted.Sub(c.start)}
+	if c.executed {
+		e.Exec = time.Since(c.admitted)
+	} else {
+		e.Wait = time.Since(c.start)
+	}
+	return e
+}
+
+// result is the error to return for a call that was executed: deadline
+// errors become LatencyError and proxy errors ProxyError
+func (c *call) result(err error) error {
+	return proxyError(c.timeout(err))
+}
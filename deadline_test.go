@@ -0,0 +1,170 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestWaitBudgetFraction 测试等待只能占用剩余 deadline 的一部分
+func TestWaitBudgetFraction(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// 第二个 token 约 300ms 后可用
+	rateLimitedDB := Wrap(db, rate.Limit(1.0/0.3), 1, WithWaitBudgetFraction(0.5))
+	defer rateLimitedDB.Close()
+
+	if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+
+	// 500ms 的一半不够等 300ms
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := rateLimitedDB.ExecContext(ctx, "SELECT 1")
+	if !errors.Is(err, ErrWaitBudgetExceeded) {
+		t.Fatalf("Expected ErrWaitBudgetExceeded, got %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("Call should fail without waiting for the budget to run out")
+	}
+
+	// 1s 的一半足够
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Errorf("Expected call within budget to succeed, got %v", err)
+	}
+
+	// 没有 deadline 的调用不受影响
+	if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Errorf("Expected call without deadline to succeed, got %v", err)
+	}
+}
+
+// TestDefaultTimeout 测试没有 deadline 的调用获得默认超时
+func TestDefaultTimeout(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1, WithDefaultTimeout(50*time.Millisecond))
+	defer rateLimitedDB.Close()
+
+	var deadlines []bool
+	rateLimitedDB.opts.hooks.BeforeWait = func(ctx context.Context, query string) {
+		_, ok := ctx.Deadline()
+		deadlines = append(deadlines, ok)
+	}
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+	start := time.Now()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Call should not wait past the default timeout")
+	}
+	if len(deadlines) != 2 || !deadlines[0] || !deadlines[1] {
+		t.Errorf("Expected hooks to see the default deadline, got %v", deadlines)
+	}
+
+}
+
+// TestDefaultTimeoutQueryCanceled 测试 QueryRows 的默认超时在 rows 关闭或查询失败时取消，而不是等到 deadline
+func TestDefaultTimeoutQueryCanceled(t *testing.T) {
+	db, f := setupFakeDB(t)
+	fail := errors.New("query failed")
+	f.handle = func(_ context.Context, _, query string) error {
+		if query == "SELECT fail" {
+			return fail
+		}
+		return nil
+	}
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 10, WithDefaultTimeout(time.Hour))
+	defer rateLimitedDB.Close()
+
+	lastCtx := func() context.Context {
+		calls := f.Calls()
+		return calls[len(calls)-1].Ctx
+	}
+	rows, err := rateLimitedDB.QueryRows(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatalf("QueryRows failed: %v", err)
+	}
+	ctx := lastCtx()
+	if ctx.Err() != nil {
+		t.Fatalf("Expected the query context to stay live while the rows are open, got %v", ctx.Err())
+	}
+	rows.Close()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected the query context to be canceled with the rows, got %v", ctx.Err())
+	}
+
+	// 读完后自动关闭的 rows 同样取消
+	rows, err = rateLimitedDB.QueryRows(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatalf("QueryRows failed: %v", err)
+	}
+	for rows.Next() {
+	}
+	if ctx := lastCtx(); !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected the context of rows read to the end to be canceled, got %v", ctx.Err())
+	}
+
+	if _, err := rateLimitedDB.QueryContext(context.Background(), "SELECT fail"); !errors.Is(err, fail) {
+		t.Fatalf("Expected the query error, got %v", err)
+	}
+	if ctx := lastCtx(); !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Expected the context of a failed query to be canceled, got %v", ctx.Err())
+	}
+
+	// 普通的 *sql.Rows 关闭后，deadline 保留到时间到
+	plain, err := rateLimitedDB.QueryContext(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatalf("QueryContext failed: %v", err)
+	}
+	plain.Close()
+	if ctx := lastCtx(); ctx.Err() != nil {
+		t.Errorf("Expected the context of plain rows to keep its deadline, got %v", ctx.Err())
+	}
+}
+
+// TestLatencyError 测试超时错误报告等待和执行各占用的时间
+func TestLatencyError(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1, WithStatementTimeout(50*time.Millisecond))
+	defer rateLimitedDB.Close()
+
+	// 执行超时
+	ctx := context.Background()
+	_, err := rateLimitedDB.ExecContext(ctx,
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c")
+	var le *LatencyError
+	if !errors.As(err, &le) {
+		t.Fatalf("Expected LatencyError, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || le.Exec < 50*time.Millisecond || le.Wait > le.Exec {
+		t.Errorf("Expected execution timeout, got %+v", le)
+	}
+
+	// 等待超时
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = rateLimitedDB.ExecContext(ctx, "SELECT 1")
+	if !errors.As(err, &le) {
+		t.Fatalf("Expected LatencyError, got %v", err)
+	}
+	if le.Exec != 0 {
+		t.Errorf("Expected no execution time for a call never admitted, got %+v", le)
+	}
+}
@@ -0,0 +1,277 @@
+package dbratelimit
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// debugMaxFingerprints bounds the fingerprints recorded for the debug page;
+// statements beyond it are counted under OverflowFingerprint
+const debugMaxFingerprints = 1000
+
+// DebugPage configures WithDebugPage.
+type DebugPage struct {
+	// Fingerprints is the number of statements listed, those that took the
+	// most tokens first. Default 20.
+	Fingerprints int
+	// Events is the number of recent throttled, rejected and failed calls
+	// kept. Default 50.
+	Events int
+}
+
+// WithDebugPage records the statements and recent events shown by
+// DebugHandler. Without it the page only shows the limits, statistics and
+// queue.
+func WithDebugPage(p DebugPage) Option {
+	if p.Fingerprints <= 0 {
+		p.Fingerprints = 20
+	}
+	if p.Events <= 0 {
+		p.Events = 50
+	}
+	return func(o *options) {
+		o.debugPage = &p
+	}
+}
+
+// debugRecorder collects what the debug page shows beyond Stats
+type debugRecorder struct {
+	page DebugPage
+
+	mu     sync.Mutex
+	byFP   map[string]*debugStatement
+	events []Event // ring of the last page.Events
+	next   int
+}
+
+type debugStatement struct {
+	Fingerprint string
+	Calls       uint64
+	Tokens      uint64
+	Throttled   uint64
+	Rejected    uint64
+	Errors      uint64
+	Wait, Exec  time.Duration // totals
+}
+
+func newDebugRecorder(p DebugPage) *debugRecorder {
+	return &debugRecorder{page: p, byFP: make(map[string]*debugStatement)}
+}
+
+// record adds a finished call
+func (d *debugRecorder) record(c *call, info QueryInfo, now time.Time) {
+	fp := Fingerprint(c.query)
+	throttled := c.executed && info.Wait >= throttledAfter
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.byFP[fp]
+	if s == nil {
+		if len(d.byFP) >= debugMaxFingerprints {
+			fp = OverflowFingerprint
+			s = d.byFP[fp]
+		}
+		if s == nil {
+			s = &debugStatement{Fingerprint: fp}
+			d.byFP[fp] = s
+		}
+	}
+	s.Wait += info.Wait
+	switch {
+	case !c.executed:
+		s.Rejected++
+	default:
+		s.Calls++
+		s.Tokens += uint64(c.cost)
+		s.Exec += info.Exec
+		if throttled {
+			s.Throttled++
+		}
+		if info.Err != nil {
+			s.Errors++
+		}
+	}
+
+	if c.executed && !throttled && info.Err == nil {
+		return
+	}
+	kind := EventAdmitted
+	switch {
+	case !c.executed:
+		kind = EventRejected
+	case throttled:
+		kind = EventThrottled
+	}
+	e := Event{
+		Kind:        kind,
+		Time:        now,
+		Tag:         TagFrom(c.ctx),
+		Priority:    PriorityFrom(c.ctx),
+		Fingerprint: fp,
+		Wait:        info.Wait,
+		Exec:        info.Exec,
+		Err:         info.Err,
+	}
+	if len(d.events) < d.page.Events {
+		d.events = append(d.events, e)
+	} else {
+		d.events[d.next] = e
+	}
+	d.next = (d.next + 1) % d.page.Events
+}
+
+// snapshot returns the top statements and the recent events, newest first
+func (d *debugRecorder) snapshot() ([]debugStatement, []Event) {
+	d.mu.Lock()
+	stmts := make([]debugStatement, 0, len(d.byFP))
+	for _, s := range d.byFP {
+		stmts = append(stmts, *s)
+	}
+	events := make([]Event, 0, len(d.events))
+	for i := range d.events {
+		events = append(events, d.events[(d.next-1-i+2*len(d.events))%len(d.events)])
+	}
+	d.mu.Unlock()
+
+	sort.Slice(stmts, func(i, j int) bool {
+		if stmts[i].Tokens != stmts[j].Tokens {
+			return stmts[i].Tokens > stmts[j].Tokens
+		}
+		return stmts[i].Fingerprint < stmts[j].Fingerprint
+	})
+	if len(stmts) > d.page.Fingerprints {
+		stmts = stmts[:d.page.Fingerprints]
+	}
+	return stmts, events
+}
+
+type debugLimit struct {
+	Name   string
+	Limit  rate.Limit
+	Burst  int
+	Tokens float64
+}
+
+type debugData struct {
+	Now        time.Time
+	Refresh    int
+	Limits     []debugLimit
+	Base       LimitConfig
+	Stats      Stats
+	WaitP99    time.Duration
+	ExecP99    time.Duration
+	Frozen     bool
+	Waiters    []WaiterInfo
+	Recording  bool
+	Statements []debugStatement
+	Events     []Event
+}
+
+// DebugHandler serves a human-readable HTML page with the live limits,
+// statistics, queue and, with WithDebugPage, the statements taking the most
+// tokens and the latest throttled, rejected and failed calls, for incidents
+// in which dashboards lag. Mount it like net/http/pprof, e.g. at
+// /debug/dbratelimit, behind the same protection as other admin endpoints.
+// A refresh query value reloads the page every so many seconds.
+func (r *RateLimitedDB) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data := r.debugData()
+		data.Refresh, _ = strconv.Atoi(req.FormValue("refresh"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		debugTemplate.Execute(w, data)
+	})
+}
+
+// debugData gathers the state shown by DebugHandler and WriteDiagnostics
+func (r *RateLimitedDB) debugData() debugData {
+	data := debugData{Now: time.Now(), Base: r.base, Stats: r.Stats(), Frozen: r.WritesFrozen(), Waiters: r.Waiters()}
+	data.WaitP99 = data.Stats.WaitLatency.Quantile(0.99)
+	data.ExecP99 = data.Stats.ExecLatency.Quantile(0.99)
+	data.Limits = r.debugLimits(data.Now)
+	if r.debug != nil {
+		data.Recording = true
+		data.Statements, data.Events = r.debug.snapshot()
+	}
+	return data
+}
+
+// debugLimits lists the limiters in use
+func (r *RateLimitedDB) debugLimits(now time.Time) []debugLimit {
+	limit := func(name string, l *rate.Limiter) debugLimit {
+		return debugLimit{Name: name, Limit: l.Limit(), Burst: l.Burst(), Tokens: l.TokensAt(now)}
+	}
+	limits := []debugLimit{limit("main", r.limiter)}
+	if r.conns != nil {
+		limits = append(limits, limit("connections", r.conns))
+	}
+	if r.migration != nil {
+		limits = append(limits, limit("migration", r.migration))
+	}
+	for _, name := range sortedKeys(r.reservations) {
+		limits = append(limits, limit("reserved "+name, r.reservations[name]))
+	}
+	for _, name := range sortedKeys(r.tagLimiters) {
+		limits = append(limits, limit("tag "+name, r.tagLimiters[name]))
+	}
+	for i, l := range r.quotas {
+		limits = append(limits, limit("quota "+strconv.Itoa(i), l))
+	}
+	return limits
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{if gt .Refresh 0}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>dbratelimit</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+td.n { text-align: right; }
+code { font-size: 13px; }
+</style>
+</head>
+<body>
+<h1>dbratelimit</h1>
+<p>{{.Now.Format "2006-01-02 15:04:05.000 MST"}}{{if .Frozen}} &middot; <b>writes frozen</b>{{end}}</p>
+
+<h2>Limits</h2>
+<p>Created with limit {{.Base.Limit}}/s, burst {{.Base.Burst}}.</p>
+<table>
+<tr><th>limiter</th><th>limit/s</th><th>burst</th><th>tokens</th></tr>
+{{range .Limits}}<tr><td>{{.Name}}</td><td class="n">{{.Limit}}</td><td class="n">{{.Burst}}</td><td class="n">{{printf "%.1f" .Tokens}}</td></tr>
+{{end}}</table>
+
+<h2>Calls</h2>
+<table>
+<tr><th>admitted</th><th>throttled</th><th>rejected</th><th>errors</th><th>waiting</th><th>in flight</th><th>p99 wait</th><th>p99 exec</th></tr>
+<tr><td class="n">{{.Stats.Calls}}</td><td class="n">{{.Stats.Throttled}}</td><td class="n">{{.Stats.Rejected}}</td><td class="n">{{.Stats.Errors}}</td><td class="n">{{.Stats.Waiting}}</td><td class="n">{{.Stats.InFlight}}</td><td class="n">{{.WaitP99}}</td><td class="n">{{.ExecP99}}</td></tr>
+</table>
+
+<h2>Queue ({{len .Waiters}})</h2>
+{{if .Waiters}}<table>
+<tr><th>waiting</th><th>priority</th><th>tag</th><th>key</th><th>statement</th></tr>
+{{range .Waiters}}<tr><td class="n">{{.Waiting}}</td><td>{{.Priority}}</td><td>{{.Tag}}</td><td>{{.Key}}</td><td><code>{{.Fingerprint}}</code></td></tr>
+{{end}}</table>{{else}}<p>No calls waiting.</p>{{end}}
+
+<h2>Top statements</h2>
+{{if not .Recording}}<p>Enable WithDebugPage to record statements and events.</p>{{else}}<table>
+<tr><th>tokens</th><th>calls</th><th>throttled</th><th>rejected</th><th>errors</th><th>wait</th><th>exec</th><th>statement</th></tr>
+{{range .Statements}}<tr><td class="n">{{.Tokens}}</td><td class="n">{{.Calls}}</td><td class="n">{{.Throttled}}</td><td class="n">{{.Rejected}}</td><td class="n">{{.Errors}}</td><td class="n">{{.Wait}}</td><td class="n">{{.Exec}}</td><td><code>{{.Fingerprint}}</code></td></tr>
+{{end}}</table>
+
+<h2>Recent events</h2>
+{{if .Events}}<table>
+<tr><th>time</th><th>kind</th><th>priority</th><th>tag</th><th>wait</th><th>exec</th><th>error</th><th>statement</th></tr>
+{{range .Events}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Kind}}</td><td>{{.Priority}}</td><td>{{.Tag}}</td><td class="n">{{.Wait}}</td><td class="n">{{.Exec}}</td><td>{{if .Err}}{{.Err}}{{end}}</td><td><code>{{.Fingerprint}}</code></td></tr>
+{{end}}</table>{{else}}<p>No throttled, rejected or failed calls yet.</p>{{end}}{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,72 @@
+package dbratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestDebugHandler 测试调试页面显示限额、热门语句和最近事件
+func TestDebugHandler(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 5, WithDebugPage(DebugPage{Events: 2}), WithTagLimits(map[string]LimitConfig{"report": {Limit: 10, Burst: 1}}))
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		rows, err := rateLimitedDB.QueryContext(ctx, "SELECT name FROM users WHERE id = ?", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+	rateLimitedDB.ExecContext(ctx, "INSERT INTO missing_table VALUES (1)")
+	expired, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	<-expired.Done()
+	rateLimitedDB.ExecContext(WithTag(expired, "report"), "DELETE FROM users WHERE id = 9")
+
+	stmts, events := rateLimitedDB.debug.snapshot()
+	if len(stmts) != 3 || stmts[0].Fingerprint != "select name from users where id = ?" || stmts[0].Calls != 3 {
+		t.Errorf("statements = %+v, want the select first with 3 calls", stmts)
+	}
+	if len(events) != 2 || events[0].Kind != EventRejected || events[0].Tag != "report" || events[1].Err == nil {
+		t.Errorf("events = %+v, want the rejected delete before the failed insert", events)
+	}
+
+	rec := httptest.NewRecorder()
+	rateLimitedDB.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/dbratelimit?refresh=5", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<meta http-equiv="refresh" content="5">`,
+		"tag report",
+		"select name from users where id = ?",
+		"missing_table",
+		"rejected",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+}
+
+// TestDebugHandlerWithoutRecording 测试未启用 WithDebugPage 时页面仍显示限额
+func TestDebugHandlerWithoutRecording(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 5)
+	defer rateLimitedDB.Close()
+
+	rec := httptest.NewRecorder()
+	rateLimitedDB.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "Enable WithDebugPage") || !strings.Contains(body, "<td>main</td>") {
+		t.Errorf("page = %s", body)
+	}
+}
@@ -0,0 +1,123 @@
+package dbratelimit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// DiagnosticsDump configures WithDiagnosticsDump.
+type DiagnosticsDump struct {
+	// Signals trigger a dump. Default SIGQUIT. Note that handling SIGQUIT
+	// keeps Go from printing its goroutine dump and exiting; use e.g.
+	// SIGUSR1 to keep both.
+	Signals []os.Signal
+	// Path is the file dumps are appended to. Default standard error.
+	Path string
+}
+
+// WithDiagnosticsDump writes the diagnostics of WriteDiagnostics whenever
+// the process receives one of the configured signals, like the goroutine
+// dump Go prints on SIGQUIT, until Close.
+func WithDiagnosticsDump(d DiagnosticsDump) Option {
+	if len(d.Signals) == 0 {
+		d.Signals = []os.Signal{syscall.SIGQUIT}
+	}
+	return func(o *options) {
+		o.diagnostics = &d
+	}
+}
+
+// startDiagnostics subscribes to the signals of d before returning, so that
+// none sent after Wrap is missed
+func (r *RateLimitedDB) startDiagnostics(d DiagnosticsDump) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, d.Signals...)
+	r.background(func() { r.dumpLoop(d, sigs) })
+}
+
+// dumpLoop writes diagnostics on each signal until Close
+func (r *RateLimitedDB) dumpLoop(d DiagnosticsDump, sigs chan os.Signal) {
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case <-sigs:
+			if err := r.dumpDiagnostics(d.Path); err != nil {
+				log.Printf("dbratelimit: dumping diagnostics: %v", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *RateLimitedDB) dumpDiagnostics(path string) error {
+	if path == "" {
+		return r.WriteDiagnostics(os.Stderr)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteDiagnostics(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteDiagnostics writes the state shown by DebugHandler to w as plain
+// text: the limiters, call statistics, waiting calls and, with
+// WithDebugPage, the top statements and recent events.
+func (r *RateLimitedDB) WriteDiagnostics(w io.Writer) error {
+	data := r.debugData()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "dbratelimit diagnostics at %s\n", data.Now.Format(time.RFC3339Nano))
+	fmt.Fprintf(bw, "created with limit %v/s, burst %d; writes frozen: %t\n\n", data.Base.Limit, data.Base.Burst, data.Frozen)
+
+	tw := tabwriter.NewWriter(bw, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "limiter\tlimit/s\tburst\ttokens")
+	for _, l := range data.Limits {
+		fmt.Fprintf(tw, "%s\t%v\t%d\t%.1f\n", l.Name, l.Limit, l.Burst, l.Tokens)
+	}
+	tw.Flush()
+
+	s := data.Stats
+	fmt.Fprintf(bw, "\ncalls: %d admitted, %d throttled, %d rejected, %d errors\n", s.Calls, s.Throttled, s.Rejected, s.Errors)
+	fmt.Fprintf(bw, "now: %d waiting, %d in flight; p99 wait %v, p99 exec %v\n", s.Waiting, s.InFlight, data.WaitP99, data.ExecP99)
+
+	fmt.Fprintf(bw, "\nqueue: %d waiting\n", len(data.Waiters))
+	if len(data.Waiters) > 0 {
+		fmt.Fprintln(tw, "waiting\tpriority\ttag\tkey\tstatement")
+		for _, wi := range data.Waiters {
+			fmt.Fprintf(tw, "%v\t%v\t%s\t%s\t%s\n", wi.Waiting, wi.Priority, wi.Tag, wi.Key, wi.Fingerprint)
+		}
+		tw.Flush()
+	}
+
+	if data.Recording {
+		fmt.Fprintln(bw, "\ntop statements:")
+		fmt.Fprintln(tw, "tokens\tcalls\tthrottled\trejected\terrors\twait\texec\tstatement")
+		for _, st := range data.Statements {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%v\t%v\t%s\n", st.Tokens, st.Calls, st.Throttled, st.Rejected, st.Errors, st.Wait, st.Exec, st.Fingerprint)
+		}
+		tw.Flush()
+
+		fmt.Fprintln(bw, "\nrecent events:")
+		for _, e := range data.Events {
+			fmt.Fprintf(bw, "%s %s priority=%v tag=%q wait=%v exec=%v %s", e.Time.Format("15:04:05.000"), e.Kind, e.Priority, e.Tag, e.Wait, e.Exec, e.Fingerprint)
+			if e.Err != nil {
+				fmt.Fprintf(bw, ": %v", e.Err)
+			}
+			fmt.Fprintln(bw)
+		}
+	}
+	fmt.Fprintln(bw)
+	return bw.Flush()
+}
@@ -0,0 +1,68 @@
+package dbratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestWriteDiagnostics 测试诊断输出包含限额、统计和热门语句
+func TestWriteDiagnostics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 5, WithDebugPage(DebugPage{}))
+	defer rateLimitedDB.Close()
+	rows, err := rateLimitedDB.QueryContext(context.Background(), "SELECT name FROM users WHERE id = ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	var b strings.Builder
+	if err := rateLimitedDB.WriteDiagnostics(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"dbratelimit diagnostics at", "main ", "calls: 1 admitted", "queue: 0 waiting", "select name from users where id = ?"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("diagnostics lack %q:\n%s", want, b.String())
+		}
+	}
+}
+
+// TestDiagnosticsDump 测试收到信号时将诊断追加到文件
+func TestDiagnosticsDump(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "dbratelimit.dump")
+	rateLimitedDB := Wrap(db, rate.Limit(100), 5)
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		rateLimitedDB.dumpLoop(DiagnosticsDump{Path: path}, sigs)
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		sigs <- syscall.SIGQUIT
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if strings.Count(string(data), "dbratelimit diagnostics at") == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dump file = %q, want two dumps", data)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	rateLimitedDB.Close()
+	<-done
+}
@@ -0,0 +1,129 @@
+package dbratelimit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// directivePrefix starts a comment holding directives
+const directivePrefix = "dbrl:"
+
+// WithCommentDirectives lets statements set their own policy in a comment,
+// so handwritten queries such as reports can be tuned without code
+// changes:
+//
+//	SELECT /* dbrl:priority=low cost=5 */ ...
+//
+// The directives are priority (low, normal, high or critical), cost (a
+// number of tokens), tag, key and bypass (true to exempt the statement). They
+// take precedence over the policy of the context. Since anyone able to write
+// SQL could otherwise lift the limits, unless allowBypass is set bypass,
+// priority=critical, tag and key, which move the statement to another
+// bucket, and a cost below the one the statement would be charged anyway
+// are ignored; unknown or malformed directives are ignored too.
+func WithCommentDirectives(allowBypass bool) Option {
+	return func(o *options) {
+		o.directives = true
+		o.directiveBypass = allowBypass
+	}
+}
+
+// directiveContext applies the directives in query's comments to ctx
+func (r *RateLimitedDB) directiveContext(ctx context.Context, query string) context.Context {
+	if !r.opts.directives || !strings.Contains(query, directivePrefix) {
+		return ctx
+	}
+	p := policyOf(ctx)
+	found := false
+	minCost := -1 // the cost charged without directives, once computed
+	costOf := func() int {
+		if minCost < 0 {
+			minCost = r.cost(ctx, query)
+		}
+		return minCost
+	}
+	for i := 0; i < len(query); {
+		switch {
+		case query[i] == '\'' || query[i] == '"' || query[i] == '`':
+			// comment markers inside literals are text
+			i = skipQuoted(query, i)
+		case strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				i = len(query)
+				break
+			}
+			body := strings.TrimSpace(query[i+2 : i+2+j])
+			i += j + 4
+			body, ok := strings.CutPrefix(body, directivePrefix)
+			if !ok {
+				continue
+			}
+			for _, field := range strings.Fields(body) {
+				k, v, _ := strings.Cut(field, "=")
+				if r.directive(&p, k, v, costOf) {
+					found = true
+				}
+			}
+		default:
+			i++
+		}
+	}
+	if !found {
+		return ctx
+	}
+	return context.WithValue(ctx, policyKey, p)
+}
+
+// directive applies one key=value directive to p and reports whether it
+// was valid and allowed. cost returns the cost of the statement without
+// directives.
+func (r *RateLimitedDB) directive(p *ctxPolicy, k, v string, cost func() int) bool {
+	trusted := r.opts.directiveBypass
+	switch k {
+	case "priority":
+		pr, ok := parsePriority(v)
+		if !ok || pr == PriorityCritical && !trusted {
+			return false
+		}
+		p.Priority = pr
+	case "cost":
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || !trusted && n < cost() {
+			return false
+		}
+		p.Cost, p.costSet = n, true
+	case "tag":
+		if !trusted {
+			return false
+		}
+		p.Tag = v
+	case "key":
+		if !trusted {
+			return false
+		}
+		p.Key = v
+	case "bypass":
+		// bypass=false may always clear an exemption made in code
+		b, err := strconv.ParseBool(v)
+		if err != nil || b && !trusted {
+			return false
+		}
+		p.Exempt = b
+	default:
+		return false
+	}
+	return true
+}
+
+// parsePriority parses the name of a priority as returned by its String
+// method
+func parsePriority(s string) (Priority, bool) {
+	for p := PriorityLow; p <= PriorityCritical; p++ {
+		if p.String() == s {
+			return p, true
+		}
+	}
+	return PriorityNormal, false
+}
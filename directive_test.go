@@ -0,0 +1,106 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestCommentDirectives 测试 SQL 注释中的 dbrl: 指令覆盖上下文策略
+func TestCommentDirectives(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithCommentDirectives(false))
+	defer rateLimitedDB.Close()
+
+	ctx := WithTag(WithPriority(context.Background(), PriorityHigh), "api")
+	p := PolicyFrom(rateLimitedDB.directiveContext(ctx,
+		"SELECT /* dbrl:priority=low cost=5 */ name FROM users /* dbrl:tag=report key=t2 */"))
+	if p.Priority != PriorityLow || p.Cost != 5 {
+		t.Errorf("policy = %+v, want low priority and cost 5", p)
+	}
+	// 未允许时 tag 和 key 会把语句移到别的 bucket，被忽略
+	if p.Tag != "api" || p.Key != "" {
+		t.Errorf("policy = %+v, want the context's tag and no key", p)
+	}
+
+	p = PolicyFrom(rateLimitedDB.directiveContext(WithExempt(ctx),
+		"SELECT 1 /* dbrl:bypass=false */"))
+	if p.Exempt {
+		t.Error("bypass=false should clear the exemption")
+	}
+
+	for _, query := range []string{
+		"SELECT 1 /* dbrl:bypass=true priority=critical */",
+		"SELECT 1 /* dbrl:cost=-1 priority=urgent size=9 */",
+		"SELECT '/* dbrl:priority=low */'",
+		"SELECT 1 /* priority=low */",
+	} {
+		p := PolicyFrom(rateLimitedDB.directiveContext(ctx, query))
+		if p.Exempt || p.Priority != PriorityHigh || p.Cost != 0 {
+			t.Errorf("%q: policy = %+v, want the context's", query, p)
+		}
+	}
+}
+
+// TestCommentDirectiveTrust 测试未允许时只接受不低于计算成本的 cost，允许时 tag、key 和更低的 cost 生效
+func TestCommentDirectiveTrust(t *testing.T) {
+	const query = "SELECT /* dbrl:cost=1 tag=report key=t2 */ * FROM users"
+	costFunc := WithCostFunc(func(string) int { return 3 })
+	for _, trusted := range []bool{false, true} {
+		db := setupTestDB(t)
+		rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithCommentDirectives(trusted), costFunc)
+		ctx := WithKey(context.Background(), "t1")
+		p := PolicyFrom(rateLimitedDB.directiveContext(ctx, query))
+		if trusted && (p.Cost != 1 || p.Tag != "report" || p.Key != "t2") {
+			t.Errorf("trusted: policy = %+v, want cost 1, tag report and key t2", p)
+		}
+		if !trusted && (p.Cost != 0 || p.Tag != "" || p.Key != "t1") {
+			t.Errorf("untrusted: policy = %+v, want the context's", p)
+		}
+		if got := rateLimitedDB.cost(ctx, "SELECT /* dbrl:cost=4 */ 1"); got != 3 {
+			t.Errorf("cost without directives applied = %d, want 3", got)
+		}
+		p = PolicyFrom(rateLimitedDB.directiveContext(ctx, "SELECT /* dbrl:cost=4 */ 1"))
+		if p.Cost != 4 {
+			t.Errorf("cost=4 above the computed 3 should apply, policy = %+v", p)
+		}
+		rateLimitedDB.Close()
+	}
+}
+
+// TestCommentDirectiveBypass 测试允许时 bypass 指令跳过限流，未启用时注释无效
+func TestCommentDirectiveBypass(t *testing.T) {
+	const query = "SELECT /* dbrl:bypass=true */ COUNT(*) FROM users"
+	for _, allowed := range []bool{true, false} {
+		db := setupTestDB(t)
+		rateLimitedDB := Wrap(db, rate.Limit(0.01), 1, WithCommentDirectives(allowed))
+		if err := rateLimitedDB.QueryRowContext(context.Background(), "SELECT 1").Scan(new(int)); err != nil {
+			t.Fatalf("first query: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		rows, err := rateLimitedDB.QueryContext(ctx, query)
+		if err == nil {
+			rows.Close()
+		}
+		cancel()
+		if allowed && err != nil {
+			t.Errorf("bypassed query: %v", err)
+		}
+		if !allowed && err == nil {
+			t.Error("bypass should be ignored unless allowed")
+		}
+		rateLimitedDB.Close()
+	}
+
+	db := setupTestDB(t)
+	defer db.Close()
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10)
+	defer rateLimitedDB.Close()
+	if p := PolicyFrom(rateLimitedDB.directiveContext(context.Background(), query)); p.Exempt {
+		t.Error("directives should be ignored without WithCommentDirectives")
+	}
+}
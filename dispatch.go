@@ -0,0 +1,409 @@
+package dbratelimit
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrClosed is returned to calls still waiting when the RateLimitedDB is
+// closed.
+var ErrClosed error = newError(CodeRejected, "dbratelimit: closed")
+
+// Queue decides the order in which calls waiting for the main limiter are
+// admitted. Without one, waiting calls are admitted in arrival order, each
+// holding a reservation from the moment it arrives. With one, calls wait in
+// the queue and are admitted one at a time, as soon as the limiter has
+// tokens for the call the queue returns next.
+//
+// Calls to a Queue are serialized, so implementations need not be safe for
+// concurrent use.
+type Queue interface {
+	// Push adds a waiting call.
+	Push(w *Waiter)
+	// Pop removes and returns the call to consider next, or nil if the
+	// queue is empty. If drop is true the call is rejected with
+	// ErrRejected instead of admitted.
+	Pop(now time.Time) (w *Waiter, drop bool)
+	// Remove removes w, which stopped waiting before it was popped.
+	Remove(w *Waiter)
+	// Len returns the number of waiting calls.
+	Len() int
+}
+
+// Waiter is a call waiting in a Queue.
+type Waiter struct {
+	Tag      string
+	Priority Priority
+	Key      string
+	Caller   string // see WithCallerFairness
+	Cost     int
+	Enqueued time.Time
+
+	seq       uint64 // arrival order, for ties
+	index     int    // in priorityQueue
+	elem      *list.Element
+	state     int
+	ready     chan error // receives the outcome once popped
+	abandoned chan struct{}
+	res       *rate.Reservation // the tokens granted by the dispatcher
+}
+
+const (
+	waiterQueued = iota
+	waiterPopped
+	waiterDone
+)
+
+// WithQueue admits waiting calls in the order decided by q, see Queue.
+func WithQueue(q Queue) Option {
+	return func(o *options) {
+		o.queue = q
+	}
+}
+
+// dispatcher admits calls waiting in a Queue
+type dispatcher struct {
+	mu    sync.Mutex
+	queue Queue
+	seq   uint64
+	busy  bool // a popped call is waiting for its tokens
+	wake  chan struct{}
+}
+
+func newDispatcher(q Queue) *dispatcher {
+	return &dispatcher{queue: q, wake: make(chan struct{}, 1)}
+}
+
+// waitDispatched is waitQueued for a configured Queue
+func (r *RateLimitedDB) waitDispatched(ctx context.Context, n int, policy OverflowPolicy, class string, h *holds) error {
+	d := r.dispatch
+	d.mu.Lock()
+	select {
+	case <-r.stop:
+		d.mu.Unlock()
+		return ErrClosed
+	default:
+	}
+	now := time.Now()
+	if d.queue.Len() == 0 && !d.busy {
+		res := r.limiter.ReserveN(now, n)
+		if res.DelayFrom(now) == 0 {
+			d.mu.Unlock()
+			h.add(r.limiter, res, n)
+			return nil
+		}
+		res.CancelAt(now)
+	}
+	if policy.Mode == OverflowReject {
+		d.mu.Unlock()
+		return rejected(r.retryAfter(n), "no tokens available")
+	}
+	d.seq++
+	w := &Waiter{
+		Tag:       TagFrom(ctx),
+		Priority:  PriorityFrom(ctx),
+		Key:       KeyFrom(ctx),
+		Caller:    r.callerOf(ctx),
+		Cost:      n,
+		Enqueued:  now,
+		seq:       d.seq,
+		ready:     make(chan error, 1),
+		abandoned: make(chan struct{}),
+	}
+	d.queue.Push(w)
+	d.mu.Unlock()
+	d.signal()
+
+	reg := r.enqueue(ctx, policy, class, now)
+	defer r.queue.remove(reg)
+
+	var timeout <-chan time.Time
+	if policy.MaxWait > 0 {
+		t := time.NewTimer(policy.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case err = <-w.ready:
+		if err == nil {
+			h.add(r.limiter, w.res, n)
+		}
+		return err
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-reg.shed:
+		err = rejected(r.retryAfter(n), "shed to make room for newer calls")
+	case <-timeout:
+		err = rejected(r.retryAfter(n), "waited longer than %v", policy.MaxWait)
+	}
+	d.abandon(w)
+	return err
+}
+
+func (d *dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// abandon takes w, which stopped waiting, out of the queue
+func (d *dispatcher) abandon(w *Waiter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch w.state {
+	case waiterQueued:
+		d.queue.Remove(w)
+	case waiterPopped:
+		close(w.abandoned)
+	}
+	w.state = waiterDone
+}
+
+// finish reports err to w unless it stopped waiting
+func (d *dispatcher) finish(w *Waiter, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if w.state == waiterPopped {
+		w.state = waiterDone
+		w.ready <- err
+	}
+}
+
+// closeAll fails every waiting call with ErrClosed
+func (d *dispatcher) closeAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		w, _ := d.queue.Pop(time.Now())
+		if w == nil {
+			return
+		}
+		w.state = waiterDone
+		w.ready <- ErrClosed
+	}
+}
+
+// dispatchLoop pops waiting calls and admits each once the limiter has its
+// tokens
+func (r *RateLimitedDB) dispatchLoop() {
+	d := r.dispatch
+	for {
+		d.mu.Lock()
+		now := time.Now()
+		w, drop := d.queue.Pop(now)
+		d.busy = w != nil
+		if w != nil {
+			w.state = waiterPopped
+		}
+		d.mu.Unlock()
+
+		if w == nil {
+			select {
+			case <-d.wake:
+				continue
+			case <-r.stop:
+				d.closeAll()
+				return
+			}
+		}
+		if drop {
+			d.finish(w, rejected(r.retryAfter(w.Cost), "dropped by queue"))
+			continue
+		}
+		res := r.limiter.ReserveN(now, w.Cost)
+		w.res = res
+		t := time.NewTimer(res.DelayFrom(now))
+		select {
+		case <-t.C:
+			d.finish(w, nil)
+		case <-w.abandoned:
+			t.Stop()
+			res.Cancel()
+		case <-r.stop:
+			t.Stop()
+			res.Cancel()
+			d.finish(w, ErrClosed)
+			d.closeAll()
+			return
+		}
+	}
+}
+
+// NewFIFOQueue returns a Queue admitting calls in arrival order.
+func NewFIFOQueue() Queue {
+	return &fifoQueue{}
+}
+
+type fifoQueue struct {
+	waiting list.List
+}
+
+func (q *fifoQueue) Push(w *Waiter) {
+	w.elem = q.waiting.PushBack(w)
+}
+
+func (q *fifoQueue) Pop(time.Time) (*Waiter, bool) {
+	e := q.waiting.Front()
+	if e == nil {
+		return nil, false
+	}
+	return q.waiting.Remove(e).(*Waiter), false
+}
+
+func (q *fifoQueue) Remove(w *Waiter) {
+	q.waiting.Remove(w.elem)
+}
+
+func (q *fifoQueue) Len() int {
+	return q.waiting.Len()
+}
+
+// NewPriorityQueue returns a Queue admitting calls with a higher Priority
+// first, and calls of equal priority in arrival order. Low priority calls
+// can starve while higher priority ones keep arriving.
+func NewPriorityQueue() Queue {
+	return &priorityQueue{}
+}
+
+type priorityQueue []*Waiter
+
+func (q priorityQueue) Len() int { return len(q) }
+
+func (q priorityQueue) Less(i, j int) bool {
+	if q[i].Priority != q[j].Priority {
+		return q[i].Priority > q[j].Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q priorityQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+// push and pop implement heap.Interface; Push and Pop implement Queue
+type priorityHeap struct{ *priorityQueue }
+
+func (h priorityHeap) Push(x any) {
+	w := x.(*Waiter)
+	w.index = len(*h.priorityQueue)
+	*h.priorityQueue = append(*h.priorityQueue, w)
+}
+
+func (h priorityHeap) Pop() any {
+	old := *h.priorityQueue
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h.priorityQueue = old[:len(old)-1]
+	return w
+}
+
+func (q *priorityQueue) Push(w *Waiter) {
+	heap.Push(priorityHeap{q}, w)
+}
+
+func (q *priorityQueue) Pop(time.Time) (*Waiter, bool) {
+	if len(*q) == 0 {
+		return nil, false
+	}
+	return heap.Pop(priorityHeap{q}).(*Waiter), false
+}
+
+func (q *priorityQueue) Remove(w *Waiter) {
+	heap.Remove(priorityHeap{q}, w.index)
+}
+
+// NewFairQueue returns a Queue sharing admission between tags in proportion
+// to weights, so a busy tag cannot crowd out the others. Tags missing from
+// weights, including "", have weight 1. Within a tag calls are admitted in
+// arrival order.
+func NewFairQueue(weights map[string]float64) Queue {
+	return &fairQueue{weights: weights, flowOf: waiterTag, flows: make(map[string]*fairFlow)}
+}
+
+// NewCallerQueue returns a Queue taking turns between the callers set on
+// Waiter.Caller, see WithCallerFairness, so a caller with many waiting
+// calls, such as a tight retry loop, gets no more than the others. Calls
+// costing more tokens take proportionally longer turns. Within a caller
+// calls are admitted in arrival order.
+func NewCallerQueue() Queue {
+	return &fairQueue{flowOf: waiterCaller, flows: make(map[string]*fairFlow)}
+}
+
+func waiterTag(w *Waiter) string    { return w.Tag }
+func waiterCaller(w *Waiter) string { return w.Caller }
+
+// fairQueue is stride scheduling over per-flow FIFOs, a flow being a tag or
+// a caller: each flow's pass advances by cost/weight per admitted call, and
+// the flow with the lowest pass goes next
+type fairQueue struct {
+	weights map[string]float64
+	flowOf  func(*Waiter) string
+	flows   map[string]*fairFlow
+	vtime   float64 // pass of the last admitted call
+	n       int
+}
+
+type fairFlow struct {
+	waiting list.List
+	pass    float64
+}
+
+func (q *fairQueue) Push(w *Waiter) {
+	flow := q.flowOf(w)
+	f := q.flows[flow]
+	if f == nil {
+		f = &fairFlow{pass: q.vtime}
+		q.flows[flow] = f
+	}
+	w.elem = f.waiting.PushBack(w)
+	q.n++
+}
+
+func (q *fairQueue) Pop(time.Time) (*Waiter, bool) {
+	var next *fairFlow
+	var nextFlow string
+	for flow, f := range q.flows {
+		if next == nil || f.pass < next.pass ||
+			f.pass == next.pass && f.waiting.Front().Value.(*Waiter).seq < next.waiting.Front().Value.(*Waiter).seq {
+			next, nextFlow = f, flow
+		}
+	}
+	if next == nil {
+		return nil, false
+	}
+	w := next.waiting.Remove(next.waiting.Front()).(*Waiter)
+	q.n--
+	q.vtime = next.pass
+	weight := q.weights[nextFlow]
+	if weight <= 0 {
+		weight = 1
+	}
+	next.pass += float64(w.Cost) / weight
+	if next.waiting.Len() == 0 {
+		delete(q.flows, nextFlow)
+	}
+	return w, false
+}
+
+func (q *fairQueue) Remove(w *Waiter) {
+	flow := q.flowOf(w)
+	f := q.flows[flow]
+	f.waiting.Remove(w.elem)
+	q.n--
+	if f.waiting.Len() == 0 {
+		delete(q.flows, flow)
+	}
+}
+
+func (q *fairQueue) Len() int {
+	return q.n
+}
@@ -0,0 +1,147 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// popAll 依次弹出队列中所有调用的 tag
+func popAll(q Queue) []string {
+	var tags []string
+	for {
+		w, _ := q.Pop(time.Now())
+		if w == nil {
+			return tags
+		}
+		tags = append(tags, w.Tag)
+	}
+}
+
+// TestPriorityQueue 测试优先级高的先出队，同优先级按到达顺序
+func TestPriorityQueue(t *testing.T) {
+	q := NewPriorityQueue()
+	waiters := []*Waiter{
+		{Tag: "low", Priority: PriorityLow, seq: 1},
+		{Tag: "normal1", Priority: PriorityNormal, seq: 2},
+		{Tag: "high", Priority: PriorityHigh, seq: 3},
+		{Tag: "normal2", Priority: PriorityNormal, seq: 4},
+		{Tag: "removed", Priority: PriorityHigh, seq: 5},
+	}
+	for _, w := range waiters {
+		q.Push(w)
+	}
+	q.Remove(waiters[4])
+	if q.Len() != 4 {
+		t.Fatalf("Expected 4 waiters, got %d", q.Len())
+	}
+	want := []string{"high", "normal1", "normal2", "low"}
+	if got := popAll(q); !equalStrings(got, want) {
+		t.Errorf("Pop order = %v, want %v", got, want)
+	}
+}
+
+// TestFairQueue 测试按权重在 tag 之间分配
+func TestFairQueue(t *testing.T) {
+	q := NewFairQueue(map[string]float64{"a": 2})
+	seq := uint64(0)
+	push := func(tag string, n int) {
+		for i := 0; i < n; i++ {
+			seq++
+			q.Push(&Waiter{Tag: tag, Cost: 1, seq: seq})
+		}
+	}
+	push("b", 3)
+	push("a", 6)
+	removed := &Waiter{Tag: "c", Cost: 1, seq: 100}
+	q.Push(removed)
+	q.Remove(removed)
+
+	// a 的权重是 b 的两倍
+	want := []string{"b", "a", "a", "b", "a", "a", "b", "a", "a"}
+	if got := popAll(q); !equalStrings(got, want) {
+		t.Errorf("Pop order = %v, want %v", got, want)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected empty queue, got %d", q.Len())
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestWithQueue 测试按队列决定的顺序放行，关闭时等待的调用返回 ErrClosed
+func TestWithQueue(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(10), 1, WithQueue(NewPriorityQueue()))
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	run := func(p Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rateLimitedDB.ExecContext(WithPriority(ctx, p), "SELECT 1"); err != nil {
+				t.Errorf("Call failed: %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+	run(PriorityNormal) // 第一个调用立即出队，等待 token
+	run(PriorityLow)
+	run(PriorityHigh)
+	wg.Wait()
+	want := []Priority{PriorityNormal, PriorityHigh, PriorityLow}
+	if len(order) != len(want) || order[0] != want[0] || order[1] != want[1] || order[2] != want[2] {
+		t.Errorf("Admission order = %v, want %v", order, want)
+	}
+
+	// 取消的调用离开队列
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	rateLimitedDB.Limiter().SetLimit(rate.Limit(0.01))
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := rateLimitedDB.ExecContext(ctx, "SELECT 1")
+		errs <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	rateLimitedDB.Close()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Waiting call not released by Close")
+	}
+}
@@ -0,0 +1,122 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrBackendUnavailable is returned under FallbackClosed when the
+// distributed backend cannot be reached.
+var ErrBackendUnavailable error = newError(CodeCircuitOpen, "dbratelimit: distributed limiter backend unavailable")
+
+// Backend is a token store shared between processes, typically backed by
+// Redis or etcd, so a limit can be enforced across a whole fleet.
+type Backend interface {
+	// Take tries to take n tokens from bucket. If they are not available it
+	// returns ok == false and how long to wait before trying again.
+	Take(ctx context.Context, bucket string, n int) (ok bool, retryAfter time.Duration, err error)
+}
+
+// WithBackend charges every call to bucket in b as well as to the local
+// limiter.
+func WithBackend(b Backend, bucket string) Option {
+	return func(o *options) {
+		o.backend = b
+		o.backendBucket = bucket
+	}
+}
+
+// FallbackPolicy decides what happens to calls while the backend is down.
+type FallbackPolicy int
+
+const (
+	// FallbackLocal admits calls through a local limiter instead.
+	FallbackLocal FallbackPolicy = iota
+	// FallbackOpen admits calls without distributed limiting.
+	FallbackOpen
+	// FallbackClosed fails calls with ErrBackendUnavailable.
+	FallbackClosed
+)
+
+// BackendFallback configures degradation when the backend is unreachable.
+type BackendFallback struct {
+	Policy FallbackPolicy
+	// Limit and Burst size the local limiter used by FallbackLocal. Pick a
+	// per-process share of the global limit.
+	Limit rate.Limit
+	Burst int
+	// Timeout bounds each backend call, so a hung coordinator cannot stall
+	// queries. Default 100ms.
+	Timeout time.Duration
+}
+
+// WithBackendFallback degrades to f when the backend returns an error
+// instead of failing every call.
+func WithBackendFallback(f BackendFallback) Option {
+	return func(o *options) {
+		if f.Timeout <= 0 {
+			f.Timeout = 100 * time.Millisecond
+		}
+		o.fallback = &f
+	}
+}
+
+// BackendFailures returns how many backend calls have failed; each one was
+// handled by the fallback policy if configured.
+func (r *RateLimitedDB) BackendFailures() uint64 {
+	return atomic.LoadUint64(&r.backendFailures)
+}
+
+// take calls the backend, bounded by the fallback timeout
+func (r *RateLimitedDB) take(ctx context.Context, n int) (bool, time.Duration, error) {
+	if r.opts.fallback == nil {
+		return r.opts.backend.Take(ctx, r.opts.backendBucket, n)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.opts.fallback.Timeout)
+	defer cancel()
+	return r.opts.backend.Take(ctx, r.opts.backendBucket, n)
+}
+
+// fallbackWait applies the fallback policy after the backend failed with err
+func (r *RateLimitedDB) fallbackWait(ctx context.Context, n int, err error) error {
+	atomic.AddUint64(&r.backendFailures, 1)
+	f := r.opts.fallback
+	if f == nil || ctx.Err() != nil {
+		return err
+	}
+	switch f.Policy {
+	case FallbackOpen:
+		return nil
+	case FallbackClosed:
+		return fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+	return r.waitLimiter(ctx, r.fallback, n, nil)
+}
+
+// waitBackend takes n tokens from the distributed backend, retrying until
+// they are granted or ctx is done
+func (r *RateLimitedDB) waitBackend(ctx context.Context, n int) error {
+	for {
+		ok, retryAfter, err := r.take(ctx, n)
+		if err != nil {
+			return r.fallbackWait(ctx, n, err)
+		}
+		if ok {
+			return nil
+		}
+		if retryAfter <= 0 {
+			retryAfter = time.Millisecond
+		}
+		t := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// memoryBackend 是基于进程内 limiter 的 Backend，用于测试
+type memoryBackend struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	buckets map[string]*rate.Limiter
+	calls   int
+}
+
+func newMemoryBackend(limit rate.Limit, burst int) *memoryBackend {
+	return &memoryBackend{limit: limit, burst: burst, buckets: map[string]*rate.Limiter{}}
+}
+
+func (m *memoryBackend) Take(_ context.Context, bucket string, n int) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	l, ok := m.buckets[bucket]
+	if !ok {
+		l = rate.NewLimiter(m.limit, m.burst)
+		m.buckets[bucket] = l
+	}
+	if l.AllowN(time.Now(), n) {
+		return true, 0, nil
+	}
+	return false, 10 * time.Millisecond, nil
+}
+
+// TestBackend 测试分布式 backend 与本地 limiter 同时生效
+func TestBackend(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	backend := newMemoryBackend(rate.Limit(0.01), 2)
+	first := Wrap(db, rate.Limit(1000), 100, WithBackend(backend, "orders"))
+	second := Wrap(db, rate.Limit(1000), 100, WithBackend(backend, "orders"))
+
+	ctx := context.Background()
+	if _, err := first.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("first failed: %v", err)
+	}
+	if _, err := second.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("second failed: %v", err)
+	}
+
+	// 全局预算已被两个实例用完
+	short, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if _, err := first.ExecContext(short, "SELECT 1"); err == nil {
+		t.Error("Expected shared backend budget to be exhausted")
+	}
+	if backend.calls < 3 {
+		t.Errorf("Expected backend to be retried, got %d calls", backend.calls)
+	}
+}
+
+// memoryRegionStore 是进程内的 RegionStore，用于测试
+type memoryRegionStore struct {
+	mu     sync.Mutex
+	demand map[string]float64
+}
+
+func (m *memoryRegionStore) Report(_ context.Context, region string, demand float64) (map[string]float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.demand[region] = demand
+	out := make(map[string]float64, len(m.demand))
+	for k, v := range m.demand {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// TestRegionShare 测试按需求比例划分全局预算
+func TestRegionShare(t *testing.T) {
+	s := newRegionState(RegionalBudget{Region: "eu", GlobalLimit: 100, MinShare: 0.1})
+
+	cases := []struct {
+		all  map[string]float64
+		want rate.Limit
+	}{
+		{map[string]float64{"eu": 0, "us": 0}, 50},
+		{map[string]float64{"eu": 30, "us": 10}, 70}, // 0.1 + 0.8*0.75
+		{map[string]float64{"eu": 0, "us": 50}, 10},  // 只保留最小份额
+		{map[string]float64{"eu": 10, "us": 10}, 50}, // 平分
+		{map[string]float64{"eu": 10}, 100},          // 单一区域
+	}
+	for _, c := range cases {
+		if got := s.share(c.all); got < c.want-0.001 || got > c.want+0.001 {
+			t.Errorf("share(%v) = %v, want %v", c.all, got, c.want)
+		}
+	}
+}
+
+// TestRegionalBudget 测试重新平衡后本区域的份额生效
+func TestRegionalBudget(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := &memoryRegionStore{demand: map[string]float64{"us": 1000}}
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithRegionalBudget(RegionalBudget{
+		Region:      "eu",
+		GlobalLimit: 100,
+		Burst:       10,
+		Store:       store,
+		Interval:    time.Hour,
+	}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatalf("ExecContext failed: %v", err)
+		}
+	}
+	// 5 个 token 摊到 1 秒，需求远低于 us 的 1000
+	rateLimitedDB.region.last = time.Now().Add(-time.Second)
+	if err := rateLimitedDB.region.rebalance(ctx); err != nil {
+		t.Fatalf("rebalance failed: %v", err)
+	}
+	got := rateLimitedDB.region.limiter.Limit()
+	if got <= 0 || got >= 10 {
+		t.Errorf("Expected eu to get a small share of 100, got %v", got)
+	}
+	if store.demand["eu"] <= 0 {
+		t.Error("Expected eu demand to be reported")
+	}
+}
+
+// downBackend 模拟不可用的 backend：返回错误或一直阻塞到超时
+type downBackend struct{ hang bool }
+
+func (d downBackend) Take(ctx context.Context, _ string, _ int) (bool, time.Duration, error) {
+	if d.hang {
+		<-ctx.Done()
+		return false, 0, ctx.Err()
+	}
+	return false, 0, errors.New("connection refused")
+}
+
+// TestBackendFallback 测试 backend 不可用时的降级策略
+func TestBackendFallback(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	// 没有配置 fallback 时直接返回 backend 错误
+	plain := Wrap(db, rate.Limit(1000), 100, WithBackend(downBackend{}, "b"))
+	if _, err := plain.ExecContext(ctx, "SELECT 1"); err == nil {
+		t.Error("Expected backend error without fallback")
+	}
+
+	open := Wrap(db, rate.Limit(1000), 100, WithBackend(downBackend{hang: true}, "b"),
+		WithBackendFallback(BackendFallback{Policy: FallbackOpen, Timeout: 10 * time.Millisecond}))
+	if _, err := open.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Errorf("FallbackOpen should admit: %v", err)
+	}
+	if open.BackendFailures() != 1 {
+		t.Errorf("Expected 1 backend failure, got %d", open.BackendFailures())
+	}
+
+	closed := Wrap(db, rate.Limit(1000), 100, WithBackend(downBackend{}, "b"),
+		WithBackendFallback(BackendFallback{Policy: FallbackClosed}))
+	if _, err := closed.ExecContext(ctx, "SELECT 1"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Expected ErrBackendUnavailable, got %v", err)
+	}
+
+	local := Wrap(db, rate.Limit(1000), 100, WithBackend(downBackend{}, "b"),
+		WithBackendFallback(BackendFallback{Policy: FallbackLocal, Limit: rate.Limit(0.01), Burst: 1}))
+	if _, err := local.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("FallbackLocal should admit within local budget: %v", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := local.ExecContext(short, "SELECT 1"); err == nil {
+		t.Error("Expected local fallback limiter to throttle")
+	}
+}
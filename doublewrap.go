@@ -0,0 +1,59 @@
+package dbratelimit
+
+import (
+	"log"
+	"sync"
+)
+
+// DoubleWrapPolicy is what a constructor does when the database it wraps
+// is already rate limited, typically by accident, e.g. through Raw, which
+// silently limits calls twice and halves throughput.
+type DoubleWrapPolicy int
+
+const (
+	// DoubleWrapWarn logs a warning and otherwise goes ahead.
+	DoubleWrapWarn DoubleWrapPolicy = iota
+	// DoubleWrapMerge makes the new wrapper use the limiter of the one
+	// already wrapping the database, ignoring its own limit and burst, so
+	// calls through either share one budget. A database opened with
+	// DriverName cannot be merged with and is warned about.
+	DoubleWrapMerge
+	// DoubleWrapAllow goes ahead silently, for databases wrapped twice on
+	// purpose, e.g. with different budgets for different subsystems.
+	DoubleWrapAllow
+)
+
+// WithDoubleWrap sets what happens when the database is already wrapped
+// by an open RateLimitedDB or was opened with DriverName. Default
+// DoubleWrapWarn.
+func WithDoubleWrap(p DoubleWrapPolicy) Option {
+	return func(o *options) {
+		o.doubleWrap = p
+	}
+}
+
+// wrapped maps each wrapped *sql.DB to the first open RateLimitedDB
+// wrapping it
+var wrapped sync.Map
+
+// checkDoubleWrap registers r as wrapping its database and applies the
+// double wrap policy if it is already limited
+func (r *RateLimitedDB) checkDoubleWrap() {
+	if _, ok := r.db.Driver().(limitDriver); ok {
+		if r.opts.doubleWrap != DoubleWrapAllow {
+			log.Printf("dbratelimit: WARNING: wrapping a database opened with the %s driver limits every statement twice; see WithDoubleWrap", DriverName)
+		}
+	}
+	prev, loaded := wrapped.LoadOrStore(r.db, r)
+	if !loaded {
+		return
+	}
+	switch r.opts.doubleWrap {
+	case DoubleWrapWarn:
+		log.Printf("dbratelimit: WARNING: the database is already wrapped by another RateLimitedDB, so calls through both are limited twice; see WithDoubleWrap")
+	case DoubleWrapMerge:
+		first := prev.(*RateLimitedDB)
+		r.limiter = first.limiter
+		r.base = LimitConfig{Limit: first.limiter.Limit(), Burst: first.limiter.Burst()}
+	}
+}
@@ -0,0 +1,53 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestDoubleWrap 测试重复包装同一个数据库时告警或合并限流器
+func TestDoubleWrap(t *testing.T) {
+	db := setupTestDB(t)
+
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	first := Wrap(db, rate.Limit(10), 5)
+	defer first.Close()
+	Wrap(first.Raw(), rate.Limit(10), 5)
+	if !strings.Contains(buf.String(), "already wrapped") {
+		t.Errorf("log = %q, want a double wrap warning", buf.String())
+	}
+
+	buf.Reset()
+	merged := Wrap(db, rate.Limit(1), 1, WithDoubleWrap(DoubleWrapMerge))
+	if merged.Limiter() != first.Limiter() {
+		t.Error("expected the merged wrapper to share the first wrapper's limiter")
+	}
+	Wrap(db, rate.Limit(1), 1, WithDoubleWrap(DoubleWrapAllow))
+	if buf.Len() != 0 {
+		t.Errorf("log = %q, want no warning when merging or allowed", buf.String())
+	}
+}
+
+// TestDoubleWrapAfterClose 测试关闭后的包装不再计入重复包装
+func TestDoubleWrapAfterClose(t *testing.T) {
+	db := setupTestDB(t)
+
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	Wrap(db, rate.Limit(10), 5).Close()
+	Wrap(db, rate.Limit(10), 5)
+	if buf.Len() != 0 {
+		t.Errorf("log = %q, want no warning once the first wrapper is closed", buf.String())
+	}
+}
@@ -0,0 +1,257 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// DriverName is the database/sql driver that rate limits another driver,
+// configured entirely through the DSN, for tools that only accept a driver
+// name and DSN. The DSN is the wrapped driver's name, a colon, and its DSN,
+// with limiter settings added as dbrl_ parameters:
+//
+//	sql.Open(dbratelimit.DriverName, "mysql:user:pass@tcp(db)/app?parseTime=true&dbrl_limit=100&dbrl_burst=20")
+//
+// dbrl_limit is in statements per second ("inf" for no limit) and dbrl_burst
+// defaults to 1. The parameters are removed before the DSN is passed on. Each
+// sql.DB opened gets its own limiter, shared by all its connections; only
+// statements are limited, as with Wrap, and none of the Wrap options apply.
+// The connections are wrapped, see UnwrapConn.
+const DriverName = "dbratelimit"
+
+func init() {
+	sql.Register(DriverName, limitDriver{})
+}
+
+type limitDriver struct{}
+
+var _ driver.DriverContext = limitDriver{}
+
+func (d limitDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (limitDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	name, inner, ok := strings.Cut(dsn, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("dbratelimit: DSN %q does not start with a driver name", dsn)
+	}
+	inner, limit, burst, err := parseDSNLimits(inner)
+	if err != nil {
+		return nil, err
+	}
+	c, err := connectorFor(name, inner)
+	if err != nil {
+		return nil, err
+	}
+	return &statementConnector{Connector: c, limiter: rate.NewLimiter(limit, burst)}, nil
+}
+
+// parseDSNLimits removes the dbrl_ parameters from dsn and returns them,
+// checked like the limits of Config
+func parseDSNLimits(dsn string) (string, rate.Limit, int, error) {
+	limit, burst := rate.Inf, 1
+	i := strings.LastIndexByte(dsn, '?')
+	if i < 0 {
+		return dsn, limit, burst, nil
+	}
+	var kept []string
+	for _, param := range strings.Split(dsn[i+1:], "&") {
+		key, value, _ := strings.Cut(param, "=")
+		var err error
+		switch key {
+		case "dbrl_limit":
+			if value == "inf" {
+				limit = rate.Inf
+				break
+			}
+			var f float64
+			f, err = strconv.ParseFloat(value, 64)
+			limit = rate.Limit(f)
+		case "dbrl_burst":
+			burst, err = strconv.Atoi(value)
+		default:
+			if strings.HasPrefix(key, "dbrl_") {
+				err = errors.New("unknown parameter")
+			} else if param != "" {
+				kept = append(kept, param)
+			}
+		}
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("dbratelimit: DSN parameter %s: %v", key, err)
+		}
+	}
+	var errs configErrors
+	errs.bucket("DSN", LimitConfig{Limit: limit, Burst: burst})
+	if len(errs) > 0 {
+		return "", 0, 0, errors.Join(errs...)
+	}
+	dsn = dsn[:i]
+	if len(kept) > 0 {
+		dsn += "?" + strings.Join(kept, "&")
+	}
+	return dsn, limit, burst, nil
+}
+
+// statementConnector opens connections whose statements wait for limiter
+type statementConnector struct {
+	driver.Connector
+	limiter *rate.Limiter
+}
+
+func (c *statementConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedConn{wrappedConn: wrappedConn{conn}, limiter: c.limiter}, nil
+}
+
+func (c *statementConnector) Driver() driver.Driver {
+	return limitDriver{}
+}
+
+type limitedConn struct {
+	wrappedConn
+	limiter *rate.Limiter
+	// prepaid is set when the driver declined a statement it was already
+	// charged for, which database/sql then runs as a prepared statement on
+	// the same connection; database/sql uses a connection from one
+	// goroutine at a time
+	prepaid bool
+}
+
+// wait waits for the limiter unless the statement was already charged
+func (c *limitedConn) wait(ctx context.Context) error {
+	if c.prepaid {
+		c.prepaid = false
+		return nil
+	}
+	return c.limiter.Wait(ctx)
+}
+
+func (c *limitedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, ok := c.Conn.(driver.ExecerContext); !ok {
+		return nil, driver.ErrSkip // executed through PrepareContext instead
+	}
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	res, err := c.wrappedConn.ExecContext(ctx, query, args)
+	c.prepaid = err == driver.ErrSkip
+	return res, err
+}
+
+func (c *limitedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if _, ok := c.Conn.(driver.QueryerContext); !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := c.wrappedConn.QueryContext(ctx, query, args)
+	c.prepaid = err == driver.ErrSkip
+	return rows, err
+}
+
+func (c *limitedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.wrappedConn.PrepareContext(ctx, query)
+	if err != nil {
+		// the declined statement will not run, so the next one pays again
+		c.prepaid = false
+		return nil, err
+	}
+	ls := &limitedStmt{Stmt: stmt, conn: c}
+	if _, ok := stmt.(driver.ColumnConverter); ok {
+		return limitedConverterStmt{ls}, nil
+	}
+	return ls, nil
+}
+
+func (c *limitedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// limitedStmt waits for the limiter before each execution
+type limitedStmt struct {
+	driver.Stmt
+	conn *limitedConn
+}
+
+var (
+	_ driver.StmtExecContext   = (*limitedStmt)(nil)
+	_ driver.StmtQueryContext  = (*limitedStmt)(nil)
+	_ driver.NamedValueChecker = (*limitedStmt)(nil)
+)
+
+// CheckNamedValue leaves arguments to the driver's own checks, so that
+// types it accepts beyond driver.Value, such as sql.Out or array and range
+// types, still reach it. database/sql asks the statement first and only
+// then the connection, so the statement passes on to the connection.
+func (s *limitedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+// limitedConverterStmt is a limitedStmt for statements converting their
+// arguments with the deprecated driver.ColumnConverter
+type limitedConverterStmt struct {
+	*limitedStmt
+}
+
+func (s limitedConverterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.Stmt.(driver.ColumnConverter).ColumnConverter(idx)
+}
+
+func (s *limitedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.conn.wait(ctx); err != nil {
+		return nil, err
+	}
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Exec(values) // deprecated, but all the driver offers
+}
+
+func (s *limitedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.conn.wait(ctx); err != nil {
+		return nil, err
+	}
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Query(values) // deprecated, but all the driver offers
+}
+
+// namedValues converts args for drivers predating named parameters
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("dbratelimit: driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,105 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestParseDSNLimits 测试从 DSN 中提取并移除 dbrl_ 参数
+func TestParseDSNLimits(t *testing.T) {
+	tests := []struct {
+		dsn   string
+		want  string
+		limit rate.Limit
+		burst int
+	}{
+		{"file:test.db", "file:test.db", rate.Inf, 1},
+		{"file:test.db?cache=shared&dbrl_limit=100&dbrl_burst=20", "file:test.db?cache=shared", 100, 20},
+		{"user:pass@tcp(db)/app?dbrl_limit=0.5&parseTime=true", "user:pass@tcp(db)/app?parseTime=true", 0.5, 1},
+		{"postgres://u@h/db?dbrl_limit=inf", "postgres://u@h/db", rate.Inf, 1},
+	}
+	for _, tt := range tests {
+		got, limit, burst, err := parseDSNLimits(tt.dsn)
+		if err != nil || got != tt.want || limit != tt.limit || burst != tt.burst {
+			t.Errorf("parseDSNLimits(%q) = %q, %v, %d, %v", tt.dsn, got, limit, burst, err)
+		}
+	}
+	for _, dsn := range []string{
+		"x?dbrl_limit=fast", "x?dbrl_bust=1",
+		"x?dbrl_limit=10&dbrl_burst=0", "x?dbrl_burst=-1", "x?dbrl_limit=-5", "x?dbrl_limit=NaN",
+	} {
+		if _, _, _, err := parseDSNLimits(dsn); err == nil {
+			t.Errorf("Expected error for %q", dsn)
+		}
+	}
+}
+
+// TestDriver 测试通过 DSN 配置的驱动对语句限流
+func TestDriver(t *testing.T) {
+	db, err := sql.Open(DriverName, "sqlite3:file:"+t.Name()+"?mode=memory&cache=shared&dbrl_limit=0.1&dbrl_burst=3")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	stmt, err := db.PrepareContext(ctx, "INSERT INTO t VALUES (?)")
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.ExecContext(ctx, 1); err != nil {
+		t.Fatalf("Stmt exec failed: %v", err)
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM t").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("Query = %d, %v", n, err)
+	}
+
+	// 3 个 token 已用完
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := stmt.ExecContext(short, 2); err == nil {
+		t.Error("Expected statement to be limited")
+	}
+	if _, err := db.ExecContext(short, "SELECT 1"); err == nil {
+		t.Error("Expected exec to be limited")
+	}
+}
+
+// skipConn 拒绝直接执行语句，且预处理总是失败
+type skipConn struct{}
+
+func (skipConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("prepare failed") }
+func (skipConn) Close() error                        { return nil }
+func (skipConn) Begin() (driver.Tx, error)           { return nil, errors.New("no transactions") }
+func (skipConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+// TestDriverPrepaidClearedOnPrepareError 测试预处理失败后下一条语句重新等待 limiter
+func TestDriverPrepaidClearedOnPrepareError(t *testing.T) {
+	c := &limitedConn{wrappedConn: wrappedConn{skipConn{}}, limiter: rate.NewLimiter(rate.Limit(0.1), 1)}
+	ctx := context.Background()
+	if _, err := c.ExecContext(ctx, "SELECT 1", nil); err != driver.ErrSkip {
+		t.Fatalf("Expected driver.ErrSkip, got %v", err)
+	}
+	if _, err := c.PrepareContext(ctx, "SELECT 1"); err == nil {
+		t.Fatal("Expected prepare to fail")
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.ExecContext(short, "SELECT 2", nil); err == driver.ErrSkip {
+		t.Error("Expected the next statement to wait for the limiter instead of running prepaid")
+	}
+}
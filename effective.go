@@ -0,0 +1,52 @@
+package dbratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// EffectivePolicy is the outcome of resolving a call's policy, see
+// RateLimitedDB.EffectivePolicy.
+type EffectivePolicy struct {
+	// Policy is the call's policy after comment directives, its context
+	// and the view's defaults, in that order of precedence.
+	Policy
+	Verb Verb
+	// Tokens is the cost charged to the limiters, from Policy.Cost,
+	// WithProcedures or WithCostFunc.
+	Tokens int
+	// Limited is false for calls that take no tokens: exempt calls, long
+	// polls and exempt verbs.
+	Limited bool
+	// MigrationLimiter is true for calls using the migration limiter, see
+	// WithMigrationLimit.
+	MigrationLimiter bool
+	// Overflow is the overflow policy applying to the call and
+	// OverflowSource where it was set: "tag:<tag>" or "priority:<n>", or ""
+	// for the wrapper's default.
+	Overflow       OverflowPolicy
+	OverflowSource string
+	// Boost is the factor of a WithBoost in effect, or 0.
+	Boost float64
+}
+
+// EffectivePolicy resolves the policy a call of query made with ctx would
+// run under, for debugging middleware and logs. It has no effect on the
+// limiters and does not consult the admission policy, which may call out to
+// a service and have a say last.
+func (r *RateLimitedDB) EffectivePolicy(ctx context.Context, query string) EffectivePolicy {
+	ctx = r.directiveContext(r.policyContext(ctx), query)
+	verb := r.verbOf(query)
+	e := EffectivePolicy{
+		Policy:           PolicyFrom(ctx),
+		Verb:             verb,
+		Tokens:           r.cost(ctx, query),
+		MigrationLimiter: r.isMigration(ctx, verb),
+	}
+	e.Limited = !e.Exempt && !e.LongPoll && !IsLongPollStatement(query) && !r.opts.exemptVerbs[verb]
+	e.Overflow, e.OverflowSource = r.overflowFor(ctx)
+	if factor, until, ok := BoostFrom(ctx); ok && time.Now().Before(until) {
+		e.Boost = factor
+	}
+	return e
+}
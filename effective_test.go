@@ -0,0 +1,41 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestEffectivePolicy 测试按注释指令、上下文、视图默认值的优先级解析策略
+func TestEffectivePolicy(t *testing.T) {
+	db := setupTestDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(10), 5,
+		WithCommentDirectives(false),
+		WithTagOverflow("report", OverflowPolicy{Mode: OverflowReject}),
+		WithMigrationLimit(rate.Inf, 1))
+	defer rateLimitedDB.Close()
+	view := rateLimitedDB.WithPolicy(Policy{Tag: "api", Priority: PriorityHigh, Cost: 2})
+
+	ctx := WithTag(context.Background(), "report")
+	e := view.EffectivePolicy(ctx, "SELECT /* dbrl:cost=7 */ * FROM users")
+	if e.Tag != "report" || e.Priority != PriorityHigh || e.Tokens != 7 {
+		t.Errorf("tag %q, priority %v, tokens %d, want report, high and 7", e.Tag, e.Priority, e.Tokens)
+	}
+	if e.Verb != VerbSelect || !e.Limited || e.MigrationLimiter {
+		t.Errorf("verb %v, limited %t, migration %t", e.Verb, e.Limited, e.MigrationLimiter)
+	}
+	if e.Overflow.Mode != OverflowReject || e.OverflowSource != "tag:report" {
+		t.Errorf("overflow %v from %q, want the report tag's", e.Overflow.Mode, e.OverflowSource)
+	}
+
+	ctx = WithBoost(WithMigration(WithExempt(context.Background())), 2, time.Minute)
+	e = rateLimitedDB.EffectivePolicy(ctx, "INSERT INTO users (name) VALUES ('x')")
+	if e.Limited || !e.Migration || !e.MigrationLimiter || e.Boost != 2 || e.Tokens != 1 {
+		t.Errorf("got %+v, want an exempt, boosted migration call of 1 token", e)
+	}
+	if stats := rateLimitedDB.Stats(); stats.Calls != 0 {
+		t.Errorf("EffectivePolicy should not run calls, stats %+v", stats)
+	}
+}
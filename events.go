@@ -0,0 +1,179 @@
+package dbratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// EventKind is the outcome of a call, or a finding about it, reported as
+// an Event.
+type EventKind int
+
+const (
+	EventAdmitted  EventKind = iota // admitted without waiting
+	EventThrottled                  // admitted after waiting
+	EventRejected                   // failed admission
+	// EventLiteralQuery reports a statement with interpolated literals, see
+	// WithPlaceholderCheck.
+	EventLiteralQuery
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventAdmitted:
+		return "admitted"
+	case EventThrottled:
+		return "throttled"
+	case EventRejected:
+		return "rejected"
+	case EventLiteralQuery:
+		return "literal_query"
+	}
+	return "unknown"
+}
+
+// Event is a sampled call, see WithEvents.
+type Event struct {
+	Kind        EventKind
+	Time        time.Time // when the call finished
+	Tag         string
+	Priority    Priority
+	Fingerprint string
+	Wait        time.Duration
+	Exec        time.Duration
+	Err         error
+	// Stack is the stack of the goroutine that made the call, if captured,
+	// see WithStackSampling.
+	Stack []byte
+}
+
+// EventConfig configures WithEvents.
+type EventConfig struct {
+	// Buffer is the capacity of the channel returned by Events. Default 256.
+	Buffer int
+	// SampleRate is the fraction of calls considered, in (0, 1]. Default 1.
+	SampleRate float64
+	// MaxPerSecond caps the events sent per second. Default 100.
+	MaxPerSecond int
+}
+
+// WithEvents enables the event stream returned by Events. Events are
+// sampled, capped per second and dropped when the channel is full, so a
+// slow subscriber never delays calls.
+func WithEvents(c EventConfig) Option {
+	if c.Buffer <= 0 {
+		c.Buffer = 256
+	}
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		c.SampleRate = 1
+	}
+	if c.MaxPerSecond <= 0 {
+		c.MaxPerSecond = 100
+	}
+	return func(o *options) {
+		o.events = &c
+	}
+}
+
+// eventStream delivers events without blocking the caller
+type eventStream struct {
+	dropped uint64 // accessed atomically
+
+	config EventConfig
+	rand   *lockedRand
+	cap    *rate.Limiter
+	ch     chan Event
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newEventStream(c EventConfig, rand *lockedRand) *eventStream {
+	return &eventStream{
+		config: c,
+		rand:   rand,
+		cap:    rate.NewLimiter(rate.Limit(c.MaxPerSecond), c.MaxPerSecond),
+		ch:     make(chan Event, c.Buffer),
+	}
+}
+
+// sample reports whether a call should produce an event
+func (s *eventStream) sample(now time.Time) bool {
+	if s.config.SampleRate < 1 && s.rand.float64() >= s.config.SampleRate {
+		return false
+	}
+	if !s.cap.AllowN(now, 1) {
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+	return true
+}
+
+func (s *eventStream) send(e Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- e:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// Events returns the stream enabled by WithEvents, or nil. The channel is
+// closed by Close.
+func (r *RateLimitedDB) Events() <-chan Event {
+	if r.events == nil {
+		return nil
+	}
+	return r.events.ch
+}
+
+// EventsDropped returns the number of events not delivered because of the
+// per-second cap or a full channel.
+func (r *RateLimitedDB) EventsDropped() uint64 {
+	if r.events == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&r.events.dropped)
+}
+
+// event reports c to the event stream, if enabled and sampled
+func (c *call) event(info QueryInfo, now time.Time) {
+	s := c.r.events
+	if s == nil || !s.sample(now) {
+		return
+	}
+	kind := EventAdmitted
+	switch {
+	case !c.executed:
+		kind = EventRejected
+	case info.Wait >= throttledAfter:
+		kind = EventThrottled
+	}
+	s.send(Event{
+		Kind:        kind,
+		Time:        now,
+		Tag:         TagFrom(c.ctx),
+		Priority:    PriorityFrom(c.ctx),
+		Fingerprint: Fingerprint(c.query),
+		Wait:        info.Wait,
+		Exec:        info.Exec,
+		Err:         info.Err,
+		Stack:       c.stack,
+	})
+}
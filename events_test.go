@@ -0,0 +1,52 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestEvents 测试事件流的类型、指纹和每秒上限
+func TestEvents(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(20), 1,
+		WithEvents(EventConfig{Buffer: 10, MaxPerSecond: 3}),
+		WithPriorityOverflow(PriorityLow, OverflowPolicy{Mode: OverflowReject}))
+
+	ctx := WithTag(context.Background(), "report")
+	for i := 0; i < 2; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctx, "SELECT ?", i); err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+	}
+	rateLimitedDB.ExecContext(WithPriority(ctx, PriorityLow), "SELECT 1")
+	// 超过每秒上限的事件被丢弃
+	rateLimitedDB.ExecContext(ctx, "SELECT 1")
+
+	want := []EventKind{EventAdmitted, EventThrottled, EventRejected}
+	for i, kind := range want {
+		select {
+		case e := <-rateLimitedDB.Events():
+			if e.Kind != kind {
+				t.Errorf("Event %d: kind %v, want %v", i, e.Kind, kind)
+			}
+			if e.Tag != "report" || e.Fingerprint != "select ?" {
+				t.Errorf("Event %d: unexpected %+v", i, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Missing event %d", i)
+		}
+	}
+	if n := rateLimitedDB.EventsDropped(); n != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", n)
+	}
+
+	rateLimitedDB.Close()
+	if _, ok := <-rateLimitedDB.Events(); ok {
+		t.Error("Expected Close to close the event stream")
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
-	"dbratelimit"
+	"github.com/nickxudotme/dbratelimit"
 )
 
 // ExampleWrap_standardSQL 展示如何使用标准 database/sql
@@ -206,3 +206,80 @@ func ExampleWrap_rawAccess() {
 	// Using raw DB (bypassing rate limit)...
 	// Operations completed!
 }
+
+// flagClient 是 OpenFeature Go SDK 中 *openfeature.Client 的一部分方法，
+// 这里单独声明以免引入依赖
+type flagClient interface {
+	FloatValue(ctx context.Context, flag string, defaultValue float64, evalCtx openFeatureEvalContext) (float64, error)
+	IntValue(ctx context.Context, flag string, defaultValue int64, evalCtx openFeatureEvalContext) (int64, error)
+	StringValue(ctx context.Context, flag string, defaultValue string, evalCtx openFeatureEvalContext) (string, error)
+}
+
+// openFeatureEvalContext 对应 openfeature.EvaluationContext
+type openFeatureEvalContext struct{}
+
+// openFeatureFlags 把 OpenFeature 的 flag 映射为 dbratelimit.Config；
+// 取值失败时返回默认值 0，即保持原有配置
+func openFeatureFlags(client flagClient) func() dbratelimit.Config {
+	return func() dbratelimit.Config {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		limit, _ := client.FloatValue(ctx, "db-rate-limit", 0, openFeatureEvalContext{})
+		burst, _ := client.IntValue(ctx, "db-rate-burst", 0, openFeatureEvalContext{})
+		profile, _ := client.StringValue(ctx, "db-rate-profile", "", openFeatureEvalContext{})
+		return dbratelimit.Config{
+			Profile: profile,
+			Limit:   rate.Limit(limit),
+			Burst:   int(burst),
+		}
+	}
+}
+
+// staticFlags 是测试用的 flag 提供方
+type staticFlags map[string]any
+
+func (f staticFlags) FloatValue(_ context.Context, flag string, def float64, _ openFeatureEvalContext) (float64, error) {
+	if v, ok := f[flag].(float64); ok {
+		return v, nil
+	}
+	return def, nil
+}
+
+func (f staticFlags) IntValue(_ context.Context, flag string, def int64, _ openFeatureEvalContext) (int64, error) {
+	if v, ok := f[flag].(int64); ok {
+		return v, nil
+	}
+	return def, nil
+}
+
+func (f staticFlags) StringValue(_ context.Context, flag string, def string, _ openFeatureEvalContext) (string, error) {
+	if v, ok := f[flag].(string); ok {
+		return v, nil
+	}
+	return def, nil
+}
+
+// ExampleWithFlagProvider_openFeature 展示如何通过 OpenFeature 的 flag 驱动限流配置
+func ExampleWithFlagProvider_openFeature() {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// 实际使用时传入 openfeature.NewClient("orders") 的适配
+	client := staticFlags{"db-rate-limit": 25.0, "db-rate-profile": "degraded"}
+	rateLimitedDB := dbratelimit.Wrap(db, rate.Limit(100), 10,
+		dbratelimit.WithProfiles("normal", map[string]dbratelimit.Profile{
+			"normal":   {},
+			"degraded": {Limit: 50, Burst: 5},
+		}),
+		dbratelimit.WithFlagProvider(openFeatureFlags(client)),
+		dbratelimit.WithFlagInterval(time.Minute),
+	)
+	defer rateLimitedDB.Close()
+
+	l := rateLimitedDB.Limiter()
+	fmt.Println(rateLimitedDB.Profile(), l.Limit(), l.Burst())
+	// Output: degraded 25 5
+}
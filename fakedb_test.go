@@ -0,0 +1,176 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeCall is a call that reached the fake driver
+type fakeCall struct {
+	Method string // "Exec", "Query", "Prepare", "StmtExec", "StmtQuery", "Begin", "Commit", "Rollback" or "Ping"
+	Query  string
+	Args   []driver.NamedValue
+	Ctx    context.Context // nil for Commit and Rollback
+}
+
+// fakeRecorder records the calls of one fake database and decides their
+// outcome, so tests can check exactly what the wrapper passed on without
+// depending on SQLite
+type fakeRecorder struct {
+	mu    sync.Mutex
+	calls []fakeCall
+	// handle, if set, runs for every call with a context before it is
+	// answered; its error is returned to the caller
+	handle func(ctx context.Context, method, query string) error
+}
+
+func (f *fakeRecorder) record(ctx context.Context, method, query string, args []driver.NamedValue) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeCall{Method: method, Query: query, Args: args, Ctx: ctx})
+	handle := f.handle
+	f.mu.Unlock()
+	if handle != nil && ctx != nil {
+		return handle(ctx, method, query)
+	}
+	return nil
+}
+
+// Calls returns the calls recorded so far
+func (f *fakeRecorder) Calls() []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeCall(nil), f.calls...)
+}
+
+// Methods returns the methods of the calls recorded so far
+func (f *fakeRecorder) Methods() []string {
+	var methods []string
+	for _, c := range f.Calls() {
+		methods = append(methods, c.Method)
+	}
+	return methods
+}
+
+var fakeRecorders sync.Map // dsn -> *fakeRecorder
+
+// fakeDriver serves the recorder registered under the DSN
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	f, _ := fakeRecorders.Load(dsn)
+	return &fakeConn{f: f.(*fakeRecorder)}, nil
+}
+
+func init() {
+	sql.Register("dbratelimit-fake", fakeDriver{})
+}
+
+// setupFakeDB 创建一个记录所有调用的内存假数据库
+func setupFakeDB(t testing.TB) (*sql.DB, *fakeRecorder) {
+	f := &fakeRecorder{}
+	fakeRecorders.Store(t.Name(), f)
+	t.Cleanup(func() { fakeRecorders.Delete(t.Name()) })
+	db, err := sql.Open("dbratelimit-fake", t.Name())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	return db, f
+}
+
+type fakeConn struct{ f *fakeRecorder }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *fakeConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.f.record(ctx, "Prepare", query, nil); err != nil {
+		return nil, err
+	}
+	return &fakeStmt{f: c.f, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if err := c.f.record(ctx, "Begin", "", nil); err != nil {
+		return nil, err
+	}
+	return fakeTx{c.f}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return c.f.record(ctx, "Ping", "", nil)
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.f.record(ctx, "Exec", query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.f.record(ctx, "Query", query, args); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeTx struct{ f *fakeRecorder }
+
+func (t fakeTx) Commit() error   { return t.f.record(nil, "Commit", "", nil) }
+func (t fakeTx) Rollback() error { return t.f.record(nil, "Rollback", "", nil) }
+
+type fakeStmt struct {
+	f     *fakeRecorder
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.f.record(ctx, "StmtExec", s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.f.record(ctx, "StmtQuery", s.query, args); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+// fakeRows is a single row with the single column n = 1
+type fakeRows struct{ done bool }
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
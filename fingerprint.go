@@ -0,0 +1,197 @@
+package dbratelimit
+
+import (
+	"strings"
+)
+
+// Fingerprint normalizes query so that statements differing only in
+// literal values, whitespace, comments or IN-list length map to the same
+// string: literals and placeholders become "?", lists of them collapse to
+// "(?+)", keywords are lowercased and tokens are separated by single
+// spaces.
+func Fingerprint(query string) string {
+	fp, _ := fingerprint(query)
+	return fp
+}
+
+// fingerprintInfo counts the values replaced while fingerprinting
+type fingerprintInfo struct {
+	literals     int // string and numeric literals, besides LIMIT and OFFSET counts
+	placeholders int // ?, $1 and the like
+}
+
+func fingerprint(query string) (string, fingerprintInfo) {
+	f := fingerprinter{}
+	f.b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				return f.String(), f.info
+			}
+			i += j + 1
+		case strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				return f.String(), f.info
+			}
+			i += j + 4
+		case c == '\'':
+			i = skipQuoted(query, i)
+			f.literal()
+		case c == '"' || c == '`':
+			// quoted identifier: keep as is
+			j := skipQuoted(query, i)
+			f.token(query[i:j], tokWord)
+			i = j
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]),
+			c == '-' && i+1 < len(query) && isDigit(query[i+1]) && f.expectsValue():
+			i = skipNumber(query, i+1)
+			f.literal()
+		case c == '?':
+			i++
+			f.placeholder()
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			i = skipNumber(query, i+1)
+			f.placeholder()
+		case isWordByte(c):
+			j := i
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			f.token(strings.ToLower(query[i:j]), tokWord)
+			i = j
+		case strings.IndexByte("(),.;", c) >= 0:
+			f.token(query[i:i+1], tokPunct)
+			i++
+		default:
+			j := i
+			for j < len(query) && isOperatorByte(query[j]) {
+				// leave the sign of a number as in "x=-1" to the number
+				if j > i && query[j] == '-' && j+1 < len(query) && isDigit(query[j+1]) {
+					break
+				}
+				j++
+			}
+			if j == i {
+				j++
+			}
+			f.token(query[i:j], tokOperator)
+			i = j
+		}
+	}
+	return f.String(), f.info
+}
+
+const (
+	tokWord = iota
+	tokValue
+	tokOperator
+	tokPunct
+)
+
+type fingerprinter struct {
+	b    strings.Builder
+	prev string
+	kind int
+	// state of a list of values being collapsed: 1 after "(?", 2 after
+	// "(?, ?"; the list is only rewritten once it is closed by ")"
+	list    int
+	listPos int
+	info    fingerprintInfo
+}
+
+func (f *fingerprinter) expectsValue() bool {
+	return f.b.Len() == 0 || f.kind == tokOperator || f.prev == "(" || f.prev == ","
+}
+
+func (f *fingerprinter) literal() {
+	if f.prev != "limit" && f.prev != "offset" && f.prev != "top" {
+		f.info.literals++
+	}
+	f.value()
+}
+
+func (f *fingerprinter) placeholder() {
+	f.info.placeholders++
+	f.value()
+}
+
+func (f *fingerprinter) value() {
+	f.token("?", tokValue)
+}
+
+func (f *fingerprinter) token(s string, kind int) {
+	if f.b.Len() > 0 && f.prev != "(" && f.prev != "." && s != ")" && s != "," && s != "." && s != ";" {
+		f.b.WriteByte(' ')
+	}
+
+	// track "(" ? { , ? } ")" so it can be collapsed to "(?+)"
+	switch {
+	case s == "(":
+		f.list, f.listPos = 0, f.b.Len()
+	case kind == tokValue && (f.prev == "(" || f.prev == "," && f.list > 0):
+		if f.prev == "(" {
+			f.list = 1
+		} else {
+			f.list = 2
+		}
+	case s == "," && f.kind == tokValue && f.list > 0:
+	case s == ")" && f.kind == tokValue && f.list > 0:
+		f.b.WriteString(")")
+		out := f.b.String()[:f.listPos]
+		f.b.Reset()
+		f.b.WriteString(out)
+		f.b.WriteString("(?+)")
+		f.prev, f.kind, f.list = ")", tokPunct, 0
+		return
+	default:
+		f.list = 0
+	}
+
+	f.b.WriteString(s)
+	f.prev, f.kind = s, kind
+}
+
+func (f *fingerprinter) String() string {
+	return f.b.String()
+}
+
+// skipQuoted returns the index just past the quoted section starting at i,
+// treating doubled quotes and backslash escapes as part of it
+func skipQuoted(s string, i int) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case q:
+			if j+1 < len(s) && s[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// skipNumber returns the index past the numeric literal continuing at i
+func skipNumber(s string, i int) int {
+	for i < len(s) && (isWordByte(s[i]) || s[i] == '.') {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isOperatorByte(c byte) bool {
+	return strings.IndexByte("<>=!|&+-*/%^~:@#", c) >= 0
+}
@@ -0,0 +1,55 @@
+package dbratelimit
+
+import "testing"
+
+// TestFingerprint 测试字面量、注释、空白和 IN 列表的归一化
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE id = 12 AND name = 'it''s'", "select * from users where id = ? and name = ?"},
+		{"select *  from t1\n where id in (1, 2, 3)", "select * from t1 where id in (?+)"},
+		{"SELECT * FROM t1 WHERE id IN (?,?)", "select * from t1 where id in (?+)"},
+		{"INSERT INTO t (a,b) VALUES (?, ?), ($1, $2)", "insert into t (a, b) values (?+), (?+)"},
+		{"SELECT a.b FROM x -- trailing\n WHERE y = $1 AND z=-3.5e2", "select a.b from x where y = ? and z = ?"},
+		{"UPDATE `Users` SET x = \"Y\" /* note */ WHERE id=1", "update `Users` set x = \"Y\" where id = ?"},
+		{"SELECT x-1 FROM t WHERE a>=0.5", "select x - ? from t where a >= ?"},
+		{"SELECT count(*) FROM t WHERE f(x, 2) AND b IN (SELECT id FROM u)", "select count (*) from t where f (x, ?) and b in (select id from u)"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// FuzzFingerprint 测试任意输入不会导致 panic，结果稳定且不再包含字面量
+func FuzzFingerprint(f *testing.F) {
+	for _, q := range []string{
+		"SELECT * FROM users WHERE id = 12 AND name = 'it''s'",
+		"select * from t1 where id in (1, 2, 3)",
+		"INSERT INTO t (a,b) VALUES (?, ?), ($1, $2)",
+		"SELECT a.b FROM x -- trailing\n WHERE y = $1 AND z=-3.5e2",
+		"UPDATE `Users` SET x = \"Y\" /* note */ WHERE id=1",
+		"SELECT 'unterminated",
+		"SELECT /* unterminated",
+		"x=-1-.5",
+		"((?,",
+	} {
+		f.Add(q)
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		fp, _ := fingerprint(q)
+		if again := Fingerprint(q); again != fp {
+			t.Fatalf("Fingerprint(%q) not stable: %q, then %q", q, fp, again)
+		}
+		if got := Fingerprint(" /* c */\n" + q); got != fp {
+			t.Errorf("Fingerprint(%q) = %q, want %q as without the comment", " /* c */\n"+q, got, fp)
+		}
+		if _, info := fingerprint(fp); info.literals != 0 {
+			t.Errorf("Fingerprint(%q) = %q, which still has %d literals", q, fp, info.literals)
+		}
+	})
+}
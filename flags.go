@@ -0,0 +1,121 @@
+package dbratelimit
+
+import (
+	"reflect"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Config holds the limiter settings, for New and Validate. The first
+// fields can also change at runtime with ApplyConfig or a flag provider,
+// where zero values leave the corresponding setting at its configured
+// baseline: the current profile if WithProfiles is used, otherwise what r
+// was created with.
+type Config struct {
+	// Profile switches to a profile configured with WithProfiles.
+	Profile string
+	Limit   rate.Limit
+	Burst   int
+	// TagLimits overrides the buckets of tags configured with
+	// WithTagLimits.
+	TagLimits map[string]LimitConfig
+
+	// The settings below are fixed once r is created: New applies them
+	// and ApplyConfig ignores them.
+
+	// MaxConcurrency is passed to WithMaxConcurrency if positive.
+	MaxConcurrency int64
+	// Overflow is passed to WithOverflowPolicy if set.
+	Overflow OverflowPolicy
+	// Adaptive is passed to WithAdaptive if not nil.
+	Adaptive *AdaptiveConfig
+}
+
+// WithFlagProvider evaluates fn when r is created and then periodically
+// (see WithFlagInterval), applying the returned Config whenever it changes,
+// so limits can be driven by a feature-flag system. fn should return
+// quickly, e.g. from the flag SDK's local cache.
+func WithFlagProvider(fn func() Config) Option {
+	return func(o *options) {
+		o.flags = fn
+	}
+}
+
+// WithFlagInterval sets how often the flag provider is evaluated. Default
+// 30s.
+func WithFlagInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.flagInterval = d
+	}
+}
+
+// evalFlags applies the provider's Config if it changed since the last
+// evaluation
+func (r *RateLimitedDB) evalFlags() {
+	var c Config
+	if !r.safely("flag provider", func() { c = r.opts.flags() }) {
+		return
+	}
+	if reflect.DeepEqual(c, r.lastFlags) || c.Validate() != nil {
+		// an invalid Config keeps the settings in effect
+		return
+	}
+	r.lastFlags = c
+	r.ApplyConfig(c)
+}
+
+// ApplyConfig resets the limiters to their baseline and applies the
+// non-zero settings of c. A Config naming an unknown profile keeps the
+// current one. For the main limiter the settings of c come first, then
+// the lower of those of the profile and the current role, then the limit
+// of the last calibration and finally the ones r was created with. The
+// limiters change as one switch like SwitchProfile.
+func (r *RateLimitedDB) ApplyConfig(c Config) {
+	r.switchLimits(func() { r.applyConfig(c) })
+}
+
+// applyConfig is ApplyConfig, run by switchLimits
+func (r *RateLimitedDB) applyConfig(c Config) {
+	if r.profiles != nil {
+		if r.switchProfile(c.Profile) != nil {
+			r.switchProfile(r.Profile())
+		}
+	} else {
+		r.applyMainLimits()
+		for tag, l := range r.tagLimiters {
+			l.SetLimit(r.opts.tagLimits[tag].Limit)
+			l.SetBurst(r.opts.tagLimits[tag].Burst)
+		}
+	}
+	if c.Limit != 0 {
+		r.SetLimit(c.Limit)
+	}
+	if c.Burst > 0 {
+		r.limiter.SetBurst(c.Burst)
+	}
+	for tag, lc := range c.TagLimits {
+		if l, ok := r.tagLimiters[tag]; ok {
+			l.SetLimit(lc.Limit)
+			l.SetBurst(lc.Burst)
+		}
+	}
+}
+
+// flagLoop evaluates the flag provider until r is closed
+func (r *RateLimitedDB) flagLoop() {
+	interval := r.opts.flagInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.evalFlags()
+		}
+	}
+}
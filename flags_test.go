@@ -0,0 +1,74 @@
+package dbratelimit
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestFlagProvider 测试定期读取特性开关并在变化时应用配置
+func TestFlagProvider(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var limit atomic.Value
+	limit.Store(rate.Limit(50))
+	provider := func() Config {
+		return Config{Limit: limit.Load().(rate.Limit)}
+	}
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10,
+		WithFlagProvider(provider), WithFlagInterval(10*time.Millisecond))
+	defer rateLimitedDB.Close()
+
+	if got := rateLimitedDB.Limiter().Limit(); got != 50 {
+		t.Fatalf("Expected flag to apply at creation, got %v", got)
+	}
+
+	// 开关关闭后恢复创建时的配置
+	limit.Store(rate.Limit(0))
+	deadline := time.Now().Add(time.Second)
+	for rateLimitedDB.Limiter().Limit() != 100 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected limit to return to 100, got %v", rateLimitedDB.Limiter().Limit())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestApplyConfig 测试配置与命名 profile 叠加
+func TestApplyConfig(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10,
+		WithTagLimits(map[string]LimitConfig{"exports": {Limit: 5, Burst: 5}}),
+		WithProfiles("normal", map[string]Profile{
+			"normal":   {},
+			"degraded": {Limit: 20},
+		}))
+	defer rateLimitedDB.Close()
+
+	rateLimitedDB.ApplyConfig(Config{
+		Profile:   "degraded",
+		Burst:     3,
+		TagLimits: map[string]LimitConfig{"exports": {Limit: 1, Burst: 1}},
+	})
+	l := rateLimitedDB.Limiter()
+	if rateLimitedDB.Profile() != "degraded" || l.Limit() != 20 || l.Burst() != 3 {
+		t.Errorf("Unexpected state %q %v/%d", rateLimitedDB.Profile(), l.Limit(), l.Burst())
+	}
+	if got := rateLimitedDB.tagLimiters["exports"].Limit(); got != 1 {
+		t.Errorf("Expected tag override, got %v", got)
+	}
+
+	// 未知 profile 保留当前 profile，并清除之前的覆盖
+	rateLimitedDB.ApplyConfig(Config{Profile: "missing"})
+	if rateLimitedDB.Profile() != "degraded" || l.Burst() != 10 {
+		t.Errorf("Unexpected state %q burst %d", rateLimitedDB.Profile(), l.Burst())
+	}
+	if got := rateLimitedDB.tagLimiters["exports"].Limit(); got != 5 {
+		t.Errorf("Expected tag limit reset, got %v", got)
+	}
+}
@@ -0,0 +1,150 @@
+package dbratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ErrWritesFrozen is returned for writes while writes are frozen with
+// FreezeReject.
+var ErrWritesFrozen error = newError(CodeRejected, "dbratelimit: writes are frozen")
+
+// FreezeMode is what happens to writes while they are frozen.
+type FreezeMode int
+
+const (
+	// FreezeReject fails writes with ErrWritesFrozen.
+	FreezeReject FreezeMode = iota
+	// FreezeQueue holds writes until ThawWrites or their context is done.
+	FreezeQueue
+)
+
+// WithFreezeMode sets what FreezeWrites does to writes. Default
+// FreezeReject.
+func WithFreezeMode(m FreezeMode) Option {
+	return func(o *options) {
+		o.freezeMode = m
+	}
+}
+
+type freezeState struct {
+	mu       sync.Mutex
+	thawed   chan struct{} // closed by ThawWrites; nil while not frozen
+	buffered []BufferedWrite
+	drained  chan struct{} // closed once the buffer is flushed; nil if not flushing
+}
+
+// FreezeWrites stops INSERT, UPDATE, DELETE and DDL statements until
+// ThawWrites while reads go on, e.g. during a failover window in which the
+// primary is briefly unavailable. Exempt calls are not affected.
+func (r *RateLimitedDB) FreezeWrites() {
+	r.freeze.mu.Lock()
+	defer r.freeze.mu.Unlock()
+	if r.freeze.thawed == nil {
+		r.freeze.thawed = make(chan struct{})
+	}
+}
+
+// ThawWrites lets writes through again, releasing queued ones.
+func (r *RateLimitedDB) ThawWrites() {
+	r.freeze.mu.Lock()
+	defer r.freeze.mu.Unlock()
+	if r.freeze.thawed == nil {
+		return
+	}
+	close(r.freeze.thawed)
+	r.freeze.thawed = nil
+	if len(r.freeze.buffered) > 0 && r.freeze.drained == nil {
+		drained := make(chan struct{})
+		r.freeze.drained = drained
+		r.background(func() { r.flush(drained) })
+	}
+}
+
+// WritesFrozen reports whether writes are frozen.
+func (r *RateLimitedDB) WritesFrozen() bool {
+	r.freeze.mu.Lock()
+	defer r.freeze.mu.Unlock()
+	return r.freeze.thawed != nil
+}
+
+// waitThaw fails or holds a write while writes are frozen
+func (r *RateLimitedDB) waitThaw(ctx context.Context, verb Verb) error {
+	if !verb.IsWrite() && verb != VerbDDL {
+		return nil
+	}
+	flushing := ctx.Value(flushKey) != nil
+	for {
+		r.freeze.mu.Lock()
+		thawed, drained := r.freeze.thawed, r.freeze.drained
+		r.freeze.mu.Unlock()
+
+		var wait chan struct{}
+		switch {
+		case thawed != nil:
+			// a buffered write caught by a new freeze is not dropped
+			if r.opts.freezeMode == FreezeReject && !flushing {
+				return ErrWritesFrozen
+			}
+			wait = thawed
+		case drained != nil && !flushing:
+			// keep buffered writes ahead of this one
+			wait = drained
+		default:
+			return nil
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// FreezeHandler is an admin endpoint for the write freeze. GET returns
+// {"frozen": bool}; POST with a "frozen" form or query value of true or
+// false freezes or thaws writes.
+func (r *RateLimitedDB) FreezeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			frozen, err := strconv.ParseBool(req.FormValue("frozen"))
+			if err != nil {
+				http.Error(w, "frozen must be true or false", http.StatusBadRequest)
+				return
+			}
+			if frozen {
+				r.FreezeWrites()
+			} else {
+				r.ThawWrites()
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Frozen bool `json:"frozen"`
+		}{r.WritesFrozen()})
+	})
+}
+
+// AdminHandler serves the admin endpoints under one handler: /profile (see
+// ProfileHandler), /freeze (see FreezeHandler), /metrics (see
+// MetricsHandler), /usage (see UsageHandler) and /debug (see DebugHandler).
+// Mount it with http.StripPrefix and protect it like any other admin
+// endpoint.
+func (r *RateLimitedDB) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/profile", r.ProfileHandler())
+	mux.Handle("/freeze", r.FreezeHandler())
+	mux.Handle("/metrics", r.MetricsHandler())
+	mux.Handle("/usage", r.UsageHandler())
+	mux.Handle("/debug", r.DebugHandler())
+	return mux
+}
@@ -0,0 +1,119 @@
+package dbratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestFreezeWrites 测试冻结写入时拒绝写、允许读
+func TestFreezeWrites(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	rateLimitedDB.FreezeWrites()
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = name"); !errors.Is(err, ErrWritesFrozen) {
+		t.Errorf("Expected ErrWritesFrozen, got %v", err)
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Errorf("Reads should go on: %v", err)
+	}
+	rateLimitedDB.ThawWrites()
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = name"); err != nil {
+		t.Errorf("Write failed after thaw: %v", err)
+	}
+}
+
+// TestFreezeQueryRow 测试冻结时 QueryRowContext 不执行写入，并从 Scan 返回错误
+func TestFreezeQueryRow(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	rateLimitedDB.FreezeWrites()
+	var id int64
+	row := rateLimitedDB.QueryRowContext(ctx, "INSERT INTO users (name, email) VALUES ('Bob', 'bob@example.com') RETURNING id")
+	if err := row.Scan(&id); !errors.Is(err, ErrWritesFrozen) {
+		t.Fatalf("Expected ErrWritesFrozen from Scan, got %v", err)
+	}
+	if !errors.Is(row.Err(), ErrWritesFrozen) {
+		t.Errorf("Expected ErrWritesFrozen from Err, got %v", row.Err())
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE name = 'Bob'").Scan(&n); err != nil || n != 0 {
+		t.Errorf("Frozen write ran: %d rows, %v", n, err)
+	}
+}
+
+// TestFreezeQueue 测试排队模式下写入等待解冻
+func TestFreezeQueue(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithFreezeMode(FreezeQueue))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	rateLimitedDB.FreezeWrites()
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "DELETE FROM users WHERE id = 0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected queued write to time out, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name, email) VALUES ('Bob', 'bob@example.com')")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if rateLimitedDB.Waiting() != 1 {
+		t.Errorf("Expected queued write to count as waiting, got %d", rateLimitedDB.Waiting())
+	}
+	rateLimitedDB.ThawWrites()
+	if err := <-done; err != nil {
+		t.Errorf("Queued write failed after thaw: %v", err)
+	}
+}
+
+// TestAdminHandler 测试通过管理接口冻结写入
+func TestAdminHandler(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10)
+	defer rateLimitedDB.Close()
+	h := rateLimitedDB.AdminHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/freeze?frozen=true", nil))
+	var got struct{ Frozen bool }
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || !got.Frozen || !rateLimitedDB.WritesFrozen() {
+		t.Fatalf("Expected writes to be frozen, got %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/freeze?frozen=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected metrics to be served, got %d", rec.Code)
+	}
+}
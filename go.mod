@@ -1,11 +1,14 @@
 module github.com/nickxudotme/dbratelimit
 
-go 1.18
+// The code itself needs go 1.23, for range over iter.Seq2. 1.24.0 is the
+// floor set by golang.org/x/time v0.14.0 and golang.org/x/sync v0.18.0.
+go 1.24.0
 
 require golang.org/x/time v0.14.0
 
 require (
 	github.com/mattn/go-sqlite3 v1.14.32
+	golang.org/x/sync v0.18.0
 	gorm.io/driver/sqlite v1.6.0
 	gorm.io/gorm v1.31.1
 )
@@ -0,0 +1,147 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// GormExempt is the GORM setting that marks a session as exempt from rate
+// limiting, as WithExempt does for a context:
+//
+//	db.Set(dbratelimit.GormExempt, true).Find(&users)
+const GormExempt = "dbratelimit:exempt"
+
+// GormMigration is the GORM setting that marks a session's statements as
+// migration calls, as WithMigration does for a context:
+//
+//	db.Set(dbratelimit.GormMigration, true).AutoMigrate(&User{})
+const GormMigration = "dbratelimit:migration"
+
+// GormPlugin passes GORM session signals down to the wrapped connection
+// pool. Dry-run sessions and sessions with the GormExempt setting are
+// exempt from limiting, so building statements that are never sent to the
+// database does not consume or wait for tokens, and sessions with the
+// GormMigration setting are marked as migrations. Register it with
+// gormDB.Use(dbratelimit.GormPlugin{}).
+//
+// The plugin is required with gorm.Config{PrepareStmt: true}, or sessions
+// with PrepareStmt set, over a RateLimitedDB: GORM then runs statements
+// through *sql.Stmt handles it prepared earlier, which RateLimitedDB cannot
+// see, so the plugin charges each execution instead of the PrepareContext
+// call, which is left free.
+type GormPlugin struct{}
+
+var _ gorm.Plugin = GormPlugin{}
+
+func (GormPlugin) Name() string {
+	return "dbratelimit"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, r := range []interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}{
+		cb.Create().Before("*"),
+		cb.Query().Before("*"),
+		cb.Update().Before("*"),
+		cb.Delete().Before("*"),
+		cb.Row().Before("*"),
+		cb.Raw().Before("*"),
+	} {
+		if err := r.Register("dbratelimit:session", gormSession); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gormSession carries the session's settings over to the statement context
+func gormSession(db *gorm.DB) {
+	if db.Statement == nil || db.Statement.Context == nil {
+		return
+	}
+	if db.DryRun || gormSetting(db, GormExempt) {
+		db.Statement.Context = WithExempt(db.Statement.Context)
+	}
+	if gormSetting(db, GormMigration) {
+		db.Statement.Context = WithMigration(db.Statement.Context)
+	}
+	if p, ok := db.Statement.ConnPool.(*gorm.PreparedStmtDB); ok {
+		if r, ok := p.ConnPool.(*RateLimitedDB); ok {
+			db.Statement.ConnPool = gormPreparedPool{PreparedStmtDB: p, r: r}
+		}
+	}
+}
+
+// GetDBConn returns the underlying database to GORM, which needs it for
+// gormDB.DB() and, in PrepareStmt mode, for the ping in gorm.Open. Like
+// Raw it is audited, and it fails with ErrRawDisabled under
+// WithRawDisabled; set gorm.Config{DisableAutomaticPing: true} to use
+// PrepareStmt mode then.
+func (r *RateLimitedDB) GetDBConn() (*sql.DB, error) {
+	if r.opts.rawDisabled {
+		return nil, ErrRawDisabled
+	}
+	r.auditCall(context.Background(), AuditRaw, "", nil)
+	return r.db, nil
+}
+
+// gormPreparedPool admits the statements GORM runs through its prepared
+// statement cache, which then prepares with the admitted call's context
+type gormPreparedPool struct {
+	*gorm.PreparedStmtDB
+	r *RateLimitedDB
+}
+
+func (p gormPreparedPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	c, err := p.r.wait(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	res, err := p.PreparedStmtDB.ExecContext(context.WithValue(c.ctx, preparedKey, true), query, args...)
+	if err == nil {
+		c.rows, _ = res.RowsAffected()
+	}
+	err = c.result(err)
+	c.done(err)
+	return res, err
+}
+
+func (p gormPreparedPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	c, err := p.r.wait(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.ctx = context.WithValue(c.ctx, preparedKey, true)
+	hold := c.holdRows()
+	rows, err := p.PreparedStmtDB.QueryContext(c.ctx, query, args...)
+	err = c.result(err)
+	c.done(err)
+	c.free()
+	hold.returned(err)
+	return rows, err
+}
+
+func (p gormPreparedPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	c, err := p.r.wait(ctx, query)
+	if err != nil {
+		return p.r.failedRow(ctx, err)
+	}
+	c.ctx = context.WithValue(c.ctx, preparedKey, true)
+	hold := c.holdRows()
+	row := p.PreparedStmtDB.QueryRowContext(c.ctx, query, args...)
+	c.done(row.Err())
+	c.free()
+	hold.returned(row.Err())
+	return row
+}
+
+func gormSetting(db *gorm.DB, key string) bool {
+	v, _ := db.Get(key)
+	b, _ := v.(bool)
+	return b
+}
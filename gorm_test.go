@@ -0,0 +1,135 @@
+package dbratelimit
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/time/rate"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// TestGormPlugin 测试 dry run 与豁免会话不消耗 token
+func TestGormPlugin(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 100)
+	defer rateLimitedDB.Close()
+
+	gormDB, err := gorm.Open(sqlite.Dialector{Conn: rateLimitedDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to initialize GORM: %v", err)
+	}
+	if err := gormDB.Use(GormPlugin{}); err != nil {
+		t.Fatalf("Failed to register plugin: %v", err)
+	}
+	if err := gormDB.AutoMigrate(&User{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	before := rateLimitedDB.Limiter().Tokens()
+	var users []User
+	if err := gormDB.Session(&gorm.Session{DryRun: true}).Find(&users).Error; err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if err := gormDB.Set(GormExempt, true).Create(&User{Name: "a", Email: "a@example.com"}).Error; err != nil {
+		t.Fatalf("Exempt create failed: %v", err)
+	}
+	users = nil
+	if err := gormDB.Set(GormExempt, true).Find(&users).Error; err != nil {
+		t.Fatalf("Exempt query failed: %v", err)
+	}
+	if len(users) != 2 {
+		t.Errorf("Expected 2 users, got %+v", users)
+	}
+	if used := before - rateLimitedDB.Limiter().Tokens(); used > 0.5 {
+		t.Errorf("Expected exempt sessions not to use tokens, used %v", used)
+	}
+
+	if err := gormDB.Find(&users).Error; err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if used := before - rateLimitedDB.Limiter().Tokens(); used < 0.5 {
+		t.Error("Expected regular sessions to use tokens")
+	}
+}
+
+// TestGormPrepareStmt 测试 PrepareStmt 模式下每次执行预处理语句都计费，而预处理本身不计费
+func TestGormPrepareStmt(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  gorm.Config
+		session bool
+	}{
+		{"default", gorm.Config{}, false},
+		{"config", gorm.Config{PrepareStmt: true}, false},
+		{"session", gorm.Config{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer db.Close()
+
+			rateLimitedDB := Wrap(db, rate.Inf, 1)
+			defer rateLimitedDB.Close()
+
+			gormDB, err := gorm.Open(sqlite.Dialector{Conn: rateLimitedDB}, &tt.config)
+			if err != nil {
+				t.Fatalf("Failed to initialize GORM: %v", err)
+			}
+			if err := gormDB.Use(GormPlugin{}); err != nil {
+				t.Fatalf("Failed to register plugin: %v", err)
+			}
+			if tt.session {
+				gormDB = gormDB.Session(&gorm.Session{PrepareStmt: true})
+			}
+
+			calls := func() uint64 { return rateLimitedDB.Stats().Calls }
+			before := calls()
+			for i := 0; i < 3; i++ {
+				var u User
+				if err := gormDB.First(&u, 1).Error; err != nil {
+					t.Fatalf("First failed: %v", err)
+				}
+				if err := gormDB.Model(&u).Update("name", "b").Error; err != nil {
+					t.Fatalf("Update failed: %v", err)
+				}
+				var n int64
+				if err := gormDB.Raw("SELECT COUNT(*) FROM users").Row().Scan(&n); err != nil {
+					t.Fatalf("Row failed: %v", err)
+				}
+			}
+			if got := calls() - before; got != 9 {
+				t.Errorf("charged %d calls, want one for each of the 9 executions", got)
+			}
+		})
+	}
+}
+
+// TestGormPrepareStmtQueryRowFailedWait 测试 PrepareStmt 模式下等待失败的单行查询不执行语句
+func TestGormPrepareStmtQueryRowFailedWait(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	gormDB, err := gorm.Open(sqlite.Dialector{Conn: rateLimitedDB}, &gorm.Config{PrepareStmt: true})
+	if err != nil {
+		t.Fatalf("Failed to initialize GORM: %v", err)
+	}
+	if err := gormDB.Use(GormPlugin{}); err != nil {
+		t.Fatalf("Failed to register plugin: %v", err)
+	}
+	rateLimitedDB.FreezeWrites()
+	var id int64
+	err = gormDB.Raw("INSERT INTO users (name, email) VALUES ('Bob', 'bob@example.com') RETURNING id").Row().Scan(&id)
+	if !errors.Is(err, ErrWritesFrozen) {
+		t.Fatalf("Expected ErrWritesFrozen, got %v", err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE name = 'Bob'").Scan(&n); err != nil || n != 0 {
+		t.Errorf("Frozen write ran: %d rows, %v", n, err)
+	}
+}
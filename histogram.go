@@ -0,0 +1,93 @@
+package dbratelimit
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Durations are bucketed log-linearly: by power of two, each power split
+// into histSub sub-buckets, giving at most 1/histSub relative error.
+const (
+	histSubBits = 2
+	histSub     = 1 << histSubBits
+	histBuckets = 64 * histSub
+)
+
+// histogram is a lock-free histogram of durations
+type histogram struct {
+	counts [histBuckets]uint64
+}
+
+func histBucket(d time.Duration) int {
+	if d < histSub {
+		if d < 0 {
+			return 0
+		}
+		return int(d)
+	}
+	v := uint64(d)
+	exp := bits.Len64(v) - 1 // v is in [2^exp, 2^(exp+1))
+	sub := (v >> (exp - histSubBits)) & (histSub - 1)
+	return (exp-histSubBits+1)*histSub + int(sub)
+}
+
+// histLower returns the smallest duration in bucket i
+func histLower(i int) time.Duration {
+	if i < histSub {
+		return time.Duration(i)
+	}
+	exp := i/histSub + histSubBits - 1
+	if exp >= 63 {
+		return time.Duration(1<<63 - 1)
+	}
+	sub := uint64(i % histSub)
+	return time.Duration((histSub + sub) << (exp - histSubBits))
+}
+
+func (h *histogram) record(d time.Duration) {
+	atomic.AddUint64(&h.counts[histBucket(d)], 1)
+}
+
+// addTo adds h's counts to dst
+func (h *histogram) addTo(dst *Histogram) {
+	for i := range h.counts {
+		if n := atomic.LoadUint64(&h.counts[i]); n > 0 {
+			dst.counts[i] += n
+			dst.total += n
+		}
+	}
+}
+
+// Histogram is a snapshot of a latency distribution.
+type Histogram struct {
+	counts [histBuckets]uint64
+	total  uint64
+}
+
+// Count returns the number of recorded durations.
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Quantile returns an estimate of the q-th quantile, e.g. 0.99, accurate to
+// within about 12%. It returns 0 for an empty histogram.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.total))
+	if rank >= h.total {
+		rank = h.total - 1
+	}
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen > rank {
+			// midpoint of the bucket
+			lo, hi := histLower(i), histLower(i+1)
+			return lo + (hi-lo)/2
+		}
+	}
+	return histLower(histBuckets - 1)
+}
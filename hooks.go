@@ -0,0 +1,80 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// QueryInfo describes a finished rate-limited call.
+type QueryInfo struct {
+	Query string
+	Verb  Verb
+	Rows  int64         // rows affected, for Exec calls
+	Wait  time.Duration // time spent waiting for tokens
+	Exec  time.Duration // time spent in the underlying database call
+	// Scheduled is the time from the call's intended start, see
+	// WithIntendedStart, to its end: Wait plus Exec if none was set.
+	Scheduled time.Duration
+	Err       error
+	// LongPoll is set for long-lived calls, see WithLongPoll.
+	LongPoll bool
+}
+
+// PanicEvent describes a panic recovered from user-supplied code.
+type PanicEvent struct {
+	Source string // which callback panicked, e.g. "cost func"
+	Value  any
+	Stack  []byte
+}
+
+func (e PanicEvent) Error() string {
+	return fmt.Sprintf("dbratelimit: panic in %s: %v", e.Source, e.Value)
+}
+
+// Hooks are optional callbacks invoked around every rate-limited call.
+// Panics in any hook, cost function or classifier are recovered and
+// reported to OnPanic instead of crashing the caller.
+type Hooks struct {
+	BeforeWait func(ctx context.Context, query string)
+	AfterQuery func(ctx context.Context, info QueryInfo)
+	OnPanic    func(PanicEvent)
+}
+
+// WithHooks installs h.
+func WithHooks(h Hooks) Option {
+	return func(o *options) {
+		o.hooks = h
+	}
+}
+
+// Panics returns how many panics have been recovered from user callbacks.
+func (r *RateLimitedDB) Panics() uint64 {
+	return atomic.LoadUint64(&r.panics)
+}
+
+// safely runs fn, recovering and reporting any panic; it returns false if
+// fn panicked
+func (r *RateLimitedDB) safely(source string, fn func()) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			ok = false
+			atomic.AddUint64(&r.panics, 1)
+			r.reportPanic(PanicEvent{Source: source, Value: v, Stack: debug.Stack()})
+		}
+	}()
+	fn()
+	return true
+}
+
+func (r *RateLimitedDB) reportPanic(ev PanicEvent) {
+	h := r.opts.hooks.OnPanic
+	if h == nil {
+		return
+	}
+	// a panicking OnPanic is counted but otherwise ignored
+	defer func() { _ = recover() }()
+	h(ev)
+}
@@ -0,0 +1,98 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestHooks 测试 BeforeWait / AfterQuery 回调
+func TestHooks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var mu sync.Mutex
+	var before []string
+	var infos []QueryInfo
+	rateLimitedDB := Wrap(db, rate.Limit(100), 5, WithHooks(Hooks{
+		BeforeWait: func(ctx context.Context, query string) {
+			mu.Lock()
+			defer mu.Unlock()
+			before = append(before, query)
+		},
+		AfterQuery: func(ctx context.Context, info QueryInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			infos = append(infos, info)
+		},
+	}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = 'Bob'"); err != nil {
+		t.Fatalf("ExecContext failed: %v", err)
+	}
+	_, err := rateLimitedDB.ExecContext(ctx, "NOT SQL")
+	if err == nil {
+		t.Fatal("Expected syntax error")
+	}
+
+	if len(before) != 2 || len(infos) != 2 {
+		t.Fatalf("Expected 2 hook calls each, got %d/%d", len(before), len(infos))
+	}
+	if infos[0].Err != nil || infos[0].Query != "UPDATE users SET name = 'Bob'" {
+		t.Errorf("Unexpected first info: %+v", infos[0])
+	}
+	if !errors.Is(infos[1].Err, err) {
+		t.Errorf("Expected AfterQuery to receive query error, got %v", infos[1].Err)
+	}
+}
+
+// TestPanicIsolation 测试回调、cost 函数和分类器中的 panic 不会影响调用方
+func TestPanicIsolation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var events []PanicEvent
+	rateLimitedDB := Wrap(db, rate.Limit(100), 5,
+		WithCostFunc(func(string) int { panic("bad cost") }),
+		WithErrorClassifier(ErrorClassifierFunc(func(error) ErrorClass { panic("bad classifier") })),
+		WithHooks(Hooks{
+			BeforeWait: func(context.Context, string) { panic("bad before") },
+			AfterQuery: func(context.Context, QueryInfo) { panic("bad after") },
+			OnPanic: func(ev PanicEvent) {
+				events = append(events, ev)
+				panic("bad OnPanic")
+			},
+		}))
+	defer rateLimitedDB.Close()
+
+	rows, err := rateLimitedDB.QueryContext(context.Background(), "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("QueryContext failed: %v", err)
+	}
+	rows.Close()
+
+	if got := rateLimitedDB.Classify(errors.New("x")); got != ClassPermanent {
+		t.Errorf("Expected permanent when classifier panics, got %v", got)
+	}
+
+	if rateLimitedDB.Panics() != 4 {
+		t.Errorf("Expected 4 panics, got %d", rateLimitedDB.Panics())
+	}
+	sources := map[string]bool{}
+	for _, ev := range events {
+		sources[ev.Source] = true
+		if len(ev.Stack) == 0 {
+			t.Errorf("Missing stack for %s", ev.Source)
+		}
+	}
+	for _, s := range []string{"BeforeWait hook", "cost func", "AfterQuery hook", "error classifier"} {
+		if !sources[s] {
+			t.Errorf("Missing panic event for %s", s)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package dbratelimit
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// IdlePolicy reacts to the wrapped database being idle, so schedulers know
+// when it is safe to run opportunistic background work.
+type IdlePolicy struct {
+	// Threshold is how long no call may be in flight before the database
+	// counts as idle.
+	Threshold time.Duration
+	// OnIdle is called once per idle period, when it exceeds Threshold.
+	OnIdle func(since time.Time)
+	// Prefill refills the whole burst once the idle period exceeds
+	// Threshold, even if the limit is too low to have refilled it naturally.
+	Prefill bool
+}
+
+// WithIdlePolicy installs p.
+func WithIdlePolicy(p IdlePolicy) Option {
+	return func(o *options) {
+		o.idle = &p
+	}
+}
+
+// IdleBurst forgives capacity left unused over a quiet period, so that a
+// service idle for hours does not open with a full burst that spikes the
+// database. Without it unused capacity accumulates up to the burst.
+type IdleBurst struct {
+	// After is how long no call may be in flight before unused tokens are
+	// forgiven.
+	After time.Duration
+	// HalfLife makes the unused tokens decay, halving for every HalfLife
+	// of idle time beyond After. Zero drops them all at once.
+	HalfLife time.Duration
+	// Floor is the number of tokens always kept. Default 1, so the first
+	// call after the quiet period does not wait.
+	Floor int
+}
+
+// WithIdleBurst installs b. Tokens are forgiven when the first call after
+// the quiet period arrives.
+func WithIdleBurst(b IdleBurst) Option {
+	if b.Floor <= 0 {
+		b.Floor = 1
+	}
+	return func(o *options) {
+		o.idleBurst = &b
+	}
+}
+
+// forgiveIdle drops unused tokens of the main limiter if r was idle long
+// enough, at most once per idle period
+func (r *RateLimitedDB) forgiveIdle(now time.Time) {
+	b := r.opts.idleBurst
+	if b == nil || atomic.LoadInt64(&r.inFlight) > 0 {
+		return
+	}
+	last := atomic.LoadInt64(&r.lastActive)
+	idle := now.Sub(time.Unix(0, last))
+	if idle < b.After || atomic.SwapInt64(&r.forgiven, last) == last {
+		return
+	}
+	tokens := r.limiter.TokensAt(now)
+	keep := float64(b.Floor)
+	if b.HalfLife > 0 {
+		keep = math.Max(keep, tokens*math.Pow(0.5, float64(idle-b.After)/float64(b.HalfLife)))
+	}
+	if drop := int(tokens - keep); drop > 0 {
+		r.limiter.ReserveN(now, drop)
+	}
+}
+
+// IdleSince returns when the last call finished, or the zero time if calls
+// are in flight right now.
+func (r *RateLimitedDB) IdleSince() time.Time {
+	if atomic.LoadInt64(&r.inFlight) > 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, atomic.LoadInt64(&r.lastActive))
+}
+
+func (r *RateLimitedDB) callStarted() {
+	atomic.AddUint64(&r.started, 1)
+	atomic.AddInt64(&r.inFlight, 1)
+}
+
+func (r *RateLimitedDB) callFinished() {
+	atomic.StoreInt64(&r.lastActive, time.Now().UnixNano())
+	started := atomic.LoadUint64(&r.started)
+	if atomic.AddInt64(&r.inFlight, -1) == 0 {
+		r.checkIdle(started)
+	}
+}
+
+// idleLoop watches for idle periods until r is closed
+func (r *RateLimitedDB) idleLoop(p IdlePolicy) {
+	tick := p.Threshold / 4
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var reported time.Time
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		since := r.IdleSince()
+		if since.IsZero() || since.Equal(reported) || time.Since(since) < p.Threshold {
+			continue
+		}
+		reported = since
+		if p.Prefill {
+			fillLimiter(r.limiter)
+		}
+		if p.OnIdle != nil {
+			r.safely("OnIdle hook", func() { p.OnIdle(since) })
+		}
+	}
+}
+
+// fillLimiter sets l's tokens to its burst. rate.Limiter has no setter for
+// tokens, so the limit is briefly raised to Inf, which makes any elapsed
+// time refill the bucket completely.
+func fillLimiter(l *rate.Limiter) {
+	now := time.Now()
+	limit := l.Limit()
+	l.SetLimitAt(now, rate.Inf)
+	l.SetLimitAt(now.Add(time.Nanosecond), limit)
+}
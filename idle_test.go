@@ -0,0 +1,106 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestIdleSince 测试空闲时间的记录
+func TestIdleSince(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 5)
+	defer rateLimitedDB.Close()
+
+	c, err := rateLimitedDB.wait(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if !rateLimitedDB.IdleSince().IsZero() {
+		t.Error("Expected zero IdleSince while a call is in flight")
+	}
+	before := time.Now()
+	c.done(nil)
+	if since := rateLimitedDB.IdleSince(); since.Before(before) {
+		t.Errorf("Expected IdleSince after %v, got %v", before, since)
+	}
+}
+
+// TestIdlePolicy 测试空闲事件和空闲后补满 burst
+func TestIdlePolicy(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var notified int32
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 3, WithIdlePolicy(IdlePolicy{
+		Threshold: 30 * time.Millisecond,
+		OnIdle:    func(time.Time) { atomic.AddInt32(&notified, 1) },
+		Prefill:   true,
+	}))
+	defer rateLimitedDB.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+			t.Fatalf("ExecContext failed: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&notified) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Idle event not fired")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if tokens := rateLimitedDB.Limiter().Tokens(); tokens < 2.9 {
+		t.Errorf("Expected burst to be prefilled, got %v tokens", tokens)
+	}
+	if limit := rateLimitedDB.Limiter().Limit(); limit != rate.Limit(0.001) {
+		t.Errorf("Prefill changed the limit to %v", limit)
+	}
+
+	// 同一个空闲期只通知一次
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&notified); n != 1 {
+		t.Errorf("Expected a single idle event, got %d", n)
+	}
+}
+
+// TestIdleBurst 测试长时间空闲后未使用的令牌被清除或衰减
+func TestIdleBurst(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reset := Wrap(db, rate.Limit(1000), 100, WithIdleBurst(IdleBurst{After: time.Minute}))
+	defer reset.Close()
+	decay := Wrap(db, rate.Limit(1000), 100, WithIdleBurst(IdleBurst{After: time.Minute, HalfLife: time.Minute}))
+	defer decay.Close()
+
+	// 模拟空闲了两分钟
+	for _, r := range []*RateLimitedDB{reset, decay} {
+		r.lastActive = time.Now().Add(-2 * time.Minute).UnixNano()
+		if _, err := r.ExecContext(context.Background(), "SELECT 1"); err != nil {
+			t.Fatalf("Exec failed: %v", err)
+		}
+	}
+	// 保留 Floor 个令牌后被第一次调用消耗
+	if got := reset.Limiter().Tokens(); got > 1 {
+		t.Errorf("Expected unused tokens to be reset, got %v", got)
+	}
+	// 超出 After 一个半衰期，剩余一半
+	if got := decay.Limiter().Tokens(); got < 45 || got > 55 {
+		t.Errorf("Expected about half the burst after one half-life, got %v", got)
+	}
+
+	// 刚有调用结束，不算空闲
+	before := decay.Limiter().Tokens()
+	decay.forgiveIdle(time.Now())
+	if got := decay.Limiter().Tokens(); got < before-1 {
+		t.Errorf("Expected no forgiveness right after a call, %v -> %v", before, got)
+	}
+}
@@ -0,0 +1,14 @@
+// Package integration runs the wrapper against real MySQL and PostgreSQL
+// servers started with dockertest, covering the drivers, transactions and
+// concurrency that the SQLite tests of the main package cannot. It is a
+// separate module so that its dependencies stay out of the main one, and
+// its tests only build with the integration tag:
+//
+//	cd integration
+//	go mod tidy
+//	go test -tags integration ./...
+//
+// Tests are skipped when no Docker daemon is reachable. Set
+// DBRATELIMIT_MYSQL_DSN or DBRATELIMIT_POSTGRES_DSN to use an existing
+// server instead of a container.
+package integration
@@ -0,0 +1,44 @@
+package dbratelimit
+
+import (
+	"context"
+	"iter"
+)
+
+// RowScanner copies the columns of the current row into dest, as
+// sql.Rows.Scan does.
+type RowScanner interface {
+	Scan(dest ...any) error
+}
+
+// QueryIter runs query through QueryRows when the loop starts and yields
+// each row. A failed wait, query or iteration is yielded once as an error
+// with a nil RowScanner, after which the sequence ends. The rows are closed
+// when the loop ends, including on break.
+//
+//	for row, err := range db.QueryIter(ctx, "SELECT id, name FROM users") {
+//		if err != nil {
+//			return err
+//		}
+//		if err := row.Scan(&id, &name); err != nil {
+//			return err
+//		}
+//	}
+func (r *RateLimitedDB) QueryIter(ctx context.Context, query string, args ...any) iter.Seq2[RowScanner, error] {
+	return func(yield func(RowScanner, error) bool) {
+		rows, err := r.QueryRows(ctx, query, args...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if !yield(rows, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestQueryIter 测试迭代所有行、提前 break 时关闭结果集以及错误传递
+func TestQueryIter(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1, WithMaxRows(2))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	for _, name := range []string{"Bob", "Carol"} {
+		if _, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", name, name); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	var names []string
+	for row, err := range rateLimitedDB.QueryIter(ctx, "SELECT name FROM users WHERE id <= ? ORDER BY id", 2) {
+		if err != nil {
+			t.Fatalf("QueryIter failed: %v", err)
+		}
+		var name string
+		if err := row.Scan(&name); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		names = append(names, name)
+	}
+	if len(names) != 2 || names[0] != "Alice" || names[1] != "Bob" {
+		t.Errorf("names = %v, want [Alice Bob]", names)
+	}
+
+	// break 之后连接应归还连接池
+	for range rateLimitedDB.QueryIter(ctx, "SELECT name FROM users") {
+		break
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("%d connections in use after break", n)
+	}
+
+	// 超过 WithMaxRows 的上限时最后产出错误
+	var last error
+	rows := 0
+	for row, err := range rateLimitedDB.QueryIter(ctx, "SELECT name FROM users") {
+		if row != nil {
+			rows++
+		}
+		last = err
+	}
+	if rows != 2 || !errors.Is(last, ErrTooManyRows) {
+		t.Errorf("got %d rows and %v, want 2 rows and ErrTooManyRows", rows, last)
+	}
+
+	// 查询失败时只产出一次错误
+	calls := 0
+	for row, err := range rateLimitedDB.QueryIter(ctx, "SELECT nope FROM missing") {
+		calls++
+		if row != nil || err == nil {
+			t.Errorf("got row %v and error %v, want only an error", row, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("yielded %d times for a failed query, want 1", calls)
+	}
+}
@@ -0,0 +1,191 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// BorrowPolicy enables work-conserving borrowing between keyed limiters:
+// a key whose bucket is empty may take tokens from idle keys instead of
+// waiting.
+type BorrowPolicy struct {
+	// MaxRate caps how many tokens per second a single key may borrow.
+	MaxRate rate.Limit
+	// LenderKeep is the fraction of its burst (0..1) a lender never lends,
+	// so idle keys keep their own minimum available.
+	LenderKeep float64
+}
+
+// WithKeyedLimit gives every key set with WithKey its own bucket. Calls
+// must pass both the key bucket and the main limiter. Buckets unused for a
+// minute that have refilled are dropped, so that keys from an unbounded
+// set, such as user IDs, do not grow memory without limit; a key seen
+// again starts with a full bucket, as it would have had anyway. With
+// WithBorrowing, up to 64 of them are kept to lend their tokens.
+func WithKeyedLimit(limit rate.Limit, burst int) Option {
+	return func(o *options) {
+		o.keyed = &LimitConfig{Limit: limit, Burst: burst}
+	}
+}
+
+// WithBorrowing enables token borrowing between keyed limiters.
+func WithBorrowing(p BorrowPolicy) Option {
+	return func(o *options) {
+		o.borrow = &p
+	}
+}
+
+// keyIdle is how long a key's bucket must go unused before it may be
+// dropped
+const keyIdle = time.Minute
+
+const (
+	maxLenders = 64 // idle buckets kept to lend when borrowing
+	lendScan   = 8  // other buckets tryBorrow looks at besides those
+)
+
+type keyedLimiters struct {
+	limit  LimitConfig
+	borrow *BorrowPolicy
+
+	mu        sync.Mutex
+	buckets   map[string]*keyBucket
+	lenders   []string // idle keys kept by evict
+	lastEvict time.Time
+}
+
+type keyBucket struct {
+	limiter *rate.Limiter
+	borrow  *rate.Limiter // caps borrowing, nil if disabled
+	seen    time.Time     // last get, under keyedLimiters.mu
+}
+
+func newKeyedLimiters(limit LimitConfig, borrow *BorrowPolicy) *keyedLimiters {
+	return &keyedLimiters{
+		limit:   limit,
+		borrow:  borrow,
+		buckets: make(map[string]*keyBucket),
+	}
+}
+
+func (k *keyedLimiters) get(key string) *keyBucket {
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	b, ok := k.buckets[key]
+	if !ok {
+		k.evict(now)
+		b = &keyBucket{limiter: rate.NewLimiter(k.limit.Limit, k.limit.Burst)}
+		if k.borrow != nil {
+			b.borrow = rate.NewLimiter(k.borrow.MaxRate, k.limit.Burst)
+		}
+		k.buckets[key] = b
+	}
+	b.seen = now
+	return b
+}
+
+// lookup returns the bucket of key, nil if it has none
+func (k *keyedLimiters) lookup(key string) *keyBucket {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.buckets[key]
+}
+
+// evict drops the buckets idle for keyIdle that are full again, which a
+// new bucket would be too, except for up to maxLenders kept as lenders when
+// borrowing is enabled. It scans at most once per keyIdle; k.mu must be
+// held.
+func (k *keyedLimiters) evict(now time.Time) {
+	if now.Sub(k.lastEvict) < keyIdle {
+		return
+	}
+	k.lastEvict = now
+	k.lenders = k.lenders[:0]
+	for key, b := range k.buckets {
+		if now.Sub(b.seen) < keyIdle || !b.full(now) {
+			continue
+		}
+		if k.borrow != nil && len(k.lenders) < maxLenders {
+			k.lenders = append(k.lenders, key)
+			continue
+		}
+		delete(k.buckets, key)
+	}
+}
+
+// full reports whether b has all its tokens back
+func (b *keyBucket) full(now time.Time) bool {
+	if b.limiter.TokensAt(now) < float64(b.limiter.Burst()) {
+		return false
+	}
+	return b.borrow == nil || b.borrow.TokensAt(now) >= float64(b.borrow.Burst())
+}
+
+// tryBorrow takes n tokens from some other key that can spare them: one
+// of the idle keys evict kept, or one of lendScan others, in map order
+func (k *keyedLimiters) tryBorrow(key string, b *keyBucket, n int, now time.Time, h *holds) bool {
+	if b.borrow == nil || b.borrow.TokensAt(now) < float64(n) {
+		return false
+	}
+	keep := float64(k.limit.Burst) * k.borrow.LenderKeep
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	lend := func(other string, lender *keyBucket) bool {
+		if lender == nil || other == key || lender.limiter.TokensAt(now)-float64(n) < keep {
+			return false
+		}
+		if allowN(lender.limiter, now, n, h) {
+			allowN(b.borrow, now, n, h)
+			return true
+		}
+		return false
+	}
+	for _, other := range k.lenders {
+		if lend(other, k.buckets[other]) {
+			return true
+		}
+	}
+	scanned := 0
+	for other, lender := range k.buckets {
+		if lend(other, lender) {
+			return true
+		}
+		if scanned++; scanned == lendScan {
+			break
+		}
+	}
+	return false
+}
+
+// waitKey acquires n tokens for key, borrowing from idle keys when allowed
+func (r *RateLimitedDB) waitKey(ctx context.Context, key string, n int, h *holds) error {
+	b := r.keyed.get(key)
+	now := time.Now()
+	if allowN(b.limiter, now, n, h) || r.keyed.tryBorrow(key, b, n, now, h) {
+		return nil
+	}
+	return r.waitLimiter(ctx, b.limiter, n, h)
+}
+
+// WithReservation guarantees key at least limit calls per second even when
+// the main limiter is exhausted. Reserved calls are still charged to the
+// main limiter, without waiting, so the guarantee is carved out of the
+// shared budget rather than added to it.
+func WithReservation(key string, limit rate.Limit, burst int) Option {
+	return func(o *options) {
+		if o.reservations == nil {
+			o.reservations = make(map[string]LimitConfig)
+		}
+		o.reservations[key] = LimitConfig{Limit: limit, Burst: burst}
+	}
+}
+
+// reserved takes n tokens from key's reservation if it has them available
+func (r *RateLimitedDB) reserved(key string, n int, h *holds) bool {
+	l, ok := r.reservations[key]
+	return ok && allowN(l, time.Now(), n, h)
+}
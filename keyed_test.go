@@ -0,0 +1,189 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestKeyedLimit 测试每个 key 拥有独立的 bucket
+func TestKeyedLimit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithKeyedLimit(rate.Limit(0.01), 2))
+	defer rateLimitedDB.Close()
+
+	ctxA := WithKey(context.Background(), "tenant-a")
+	for i := 0; i < 2; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctxA, "SELECT 1"); err != nil {
+			t.Fatalf("Call %d failed: %v", i, err)
+		}
+	}
+
+	short, cancel := context.WithTimeout(ctxA, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err == nil {
+		t.Error("Expected tenant-a to be throttled")
+	}
+
+	// 其他 key 和没有 key 的调用不受影响
+	if _, err := rateLimitedDB.ExecContext(WithKey(context.Background(), "tenant-b"), "SELECT 1"); err != nil {
+		t.Errorf("tenant-b should not be throttled: %v", err)
+	}
+	if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Errorf("Unkeyed call should not be throttled: %v", err)
+	}
+}
+
+// TestKeyedEviction 测试空闲且已回满的 key bucket 会被回收，仍在恢复的保留
+func TestKeyedEviction(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithKeyedLimit(rate.Limit(0.01), 2))
+	defer rateLimitedDB.Close()
+
+	if _, err := rateLimitedDB.ExecContext(WithKey(context.Background(), "busy"), "SELECT 1"); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	k := rateLimitedDB.keyed
+	k.get("idle")
+
+	// 模拟两个 key 都一分钟没有使用
+	k.mu.Lock()
+	for _, b := range k.buckets {
+		b.seen = b.seen.Add(-2 * keyIdle)
+	}
+	k.lastEvict = time.Time{}
+	k.mu.Unlock()
+
+	k.get("new")
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.buckets["idle"]; ok {
+		t.Error("Expected the idle, full bucket to be evicted")
+	}
+	if _, ok := k.buckets["busy"]; !ok {
+		t.Error("Expected the bucket still refilling to be kept")
+	}
+	if len(k.buckets) != 2 {
+		t.Errorf("Expected 2 buckets, got %d", len(k.buckets))
+	}
+}
+
+// TestKeyedEvictionLenders 测试开启借用时空闲一分钟的 key 仍保留为出借方，且数量有上限
+func TestKeyedEvictionLenders(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100,
+		WithKeyedLimit(rate.Limit(0.01), 4),
+		WithBorrowing(BorrowPolicy{MaxRate: rate.Limit(0.01), LenderKeep: 0.5}))
+	defer rateLimitedDB.Close()
+
+	k := rateLimitedDB.keyed
+	for i := 0; i < 2*maxLenders; i++ {
+		k.get(fmt.Sprintf("idle-%d", i))
+	}
+	k.mu.Lock()
+	for _, b := range k.buckets {
+		b.seen = b.seen.Add(-2 * keyIdle)
+	}
+	k.lastEvict = time.Time{}
+	k.mu.Unlock()
+
+	ctx := WithKey(context.Background(), "busy")
+	for i := 0; i < 6; i++ {
+		short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		_, err := rateLimitedDB.ExecContext(short, "SELECT 1")
+		cancel()
+		if err != nil {
+			t.Fatalf("busy call %d should succeed (with borrowing): %v", i, err)
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if got := len(k.buckets); got != maxLenders+1 {
+		t.Errorf("Expected %d lenders and the busy key to be kept, got %d buckets", maxLenders, got)
+	}
+}
+
+// TestBorrowing 测试繁忙的 key 可以从空闲 key 借用 token，但不会借走对方的保留量
+func TestBorrowing(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100,
+		WithKeyedLimit(rate.Limit(0.01), 4),
+		WithBorrowing(BorrowPolicy{MaxRate: rate.Limit(0.01), LenderKeep: 0.5}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	ctxA := WithKey(ctx, "busy")
+	ctxB := WithKey(ctx, "idle")
+
+	// idle 使用 1 个 token，剩余 3 个，保留 2 个，可借出 1 个
+	if _, err := rateLimitedDB.ExecContext(ctxB, "SELECT 1"); err != nil {
+		t.Fatalf("idle call failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		short, cancel := context.WithTimeout(ctxA, 20*time.Millisecond)
+		_, err := rateLimitedDB.ExecContext(short, "SELECT 1")
+		cancel()
+		if err != nil {
+			t.Fatalf("busy call %d should succeed (with borrowing): %v", i, err)
+		}
+	}
+
+	short, cancel := context.WithTimeout(ctxA, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err == nil {
+		t.Error("Expected busy to be throttled once lender reached its reserve")
+	}
+
+	// idle 的保留量仍然可用
+	for i := 0; i < 2; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctxB, "SELECT 1"); err != nil {
+			t.Fatalf("idle reserve call %d failed: %v", i, err)
+		}
+	}
+}
+
+// TestReservation 测试共享 limiter 耗尽时预留 key 仍有最低吞吐
+func TestReservation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.01), 1, WithReservation("internal", rate.Limit(0.01), 2))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+
+	// 共享 limiter 已耗尽
+	short, cancel := context.WithTimeout(WithKey(ctx, "other"), 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err == nil {
+		t.Fatal("Expected unreserved key to be throttled")
+	}
+
+	internal := WithKey(ctx, "internal")
+	for i := 0; i < 2; i++ {
+		short, cancel := context.WithTimeout(internal, 20*time.Millisecond)
+		_, err := rateLimitedDB.ExecContext(short, "SELECT 1")
+		cancel()
+		if err != nil {
+			t.Fatalf("Reserved call %d failed: %v", i, err)
+		}
+	}
+
+	// 预留量用完后回退到共享 limiter
+	short2, cancel2 := context.WithTimeout(internal, 20*time.Millisecond)
+	defer cancel2()
+	if _, err := rateLimitedDB.ExecContext(short2, "SELECT 1"); err == nil {
+		t.Error("Expected reserved key to be throttled after reservation is used up")
+	}
+}
@@ -0,0 +1,168 @@
+package dbratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxFingerprints is the default LatencyTracker.MaxFingerprints.
+const DefaultMaxFingerprints = 10000
+
+// OverflowFingerprint is the fingerprint under which a full LatencyTracker
+// aggregates statements it has no room for.
+const OverflowFingerprint = "(other)"
+
+// fingerprintIdle is how long a fingerprint must go unseen before it may be
+// evicted to make room for a new one
+const fingerprintIdle = time.Minute
+
+// LatencyTracker keeps an exponentially weighted moving average of the
+// execution time of each statement, keyed by Fingerprint. Use it in a
+// CostFunc so that historically slow statements cost more tokens, see Cost.
+type LatencyTracker struct {
+	// MaxFingerprints bounds the number of fingerprints tracked, so that an
+	// app sending unique SQL strings cannot grow the tracker without limit.
+	// Once full, fingerprints unseen for a minute are evicted to make room;
+	// if none are, new statements are aggregated under
+	// OverflowFingerprint. Set it before first use.
+	MaxFingerprints int
+
+	alpha     float64
+	byFP      sync.Map // fingerprint -> *latencyEntry
+	n         int64    // entries in byFP, atomic
+	overflow  latencyEntry
+	evictMu   sync.Mutex
+	lastEvict int64 // unix nanos, atomic
+}
+
+type latencyEntry struct {
+	avg  uint64 // float64 nanoseconds
+	seen int64  // unix nanos
+}
+
+// observe folds d into the average
+func (e *latencyEntry) observe(d time.Duration, alpha float64, now int64) {
+	atomic.StoreInt64(&e.seen, now)
+	for {
+		old := atomic.LoadUint64(&e.avg)
+		avg := float64(d)
+		if old != 0 {
+			avg = math.Float64frombits(old)
+			avg += alpha * (float64(d) - avg)
+		}
+		if atomic.CompareAndSwapUint64(&e.avg, old, math.Float64bits(avg)) {
+			return
+		}
+	}
+}
+
+func (e *latencyEntry) latency() time.Duration {
+	return time.Duration(math.Float64frombits(atomic.LoadUint64(&e.avg)))
+}
+
+// NewLatencyTracker returns a tracker giving each new observation weight
+// alpha, 0.2 if alpha is not in (0, 1].
+func NewLatencyTracker(alpha float64) *LatencyTracker {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	return &LatencyTracker{alpha: alpha, MaxFingerprints: DefaultMaxFingerprints}
+}
+
+// WithLatencyTracker feeds the execution time of every executed call into
+// t. For QueryContext this is the time until the rows are returned, not
+// until they are closed.
+func WithLatencyTracker(t *LatencyTracker) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, func(_ context.Context, info QueryInfo) {
+			if info.Exec > 0 && !info.LongPoll {
+				t.Observe(info.Query, info.Exec)
+			}
+		})
+	}
+}
+
+// Observe records one execution of query taking d.
+func (t *LatencyTracker) Observe(query string, d time.Duration) {
+	now := time.Now().UnixNano()
+	t.entry(Fingerprint(query), now).observe(d, t.alpha, now)
+}
+
+// entry returns the entry for fp, adding it if there is room
+func (t *LatencyTracker) entry(fp string, now int64) *latencyEntry {
+	if v, ok := t.byFP.Load(fp); ok {
+		return v.(*latencyEntry)
+	}
+	if t.MaxFingerprints > 0 && atomic.LoadInt64(&t.n) >= int64(t.MaxFingerprints) && !t.evict(now) {
+		return &t.overflow
+	}
+	v, loaded := t.byFP.LoadOrStore(fp, &latencyEntry{})
+	if !loaded {
+		atomic.AddInt64(&t.n, 1)
+	}
+	return v.(*latencyEntry)
+}
+
+// evict removes fingerprints idle for fingerprintIdle and reports whether
+// there is room now. It scans at most once per second.
+func (t *LatencyTracker) evict(now int64) bool {
+	last := atomic.LoadInt64(&t.lastEvict)
+	if now-last < int64(time.Second) || !t.evictMu.TryLock() {
+		return false
+	}
+	defer t.evictMu.Unlock()
+	atomic.StoreInt64(&t.lastEvict, now)
+	cutoff := now - int64(fingerprintIdle)
+	t.byFP.Range(func(fp, v any) bool {
+		if atomic.LoadInt64(&v.(*latencyEntry).seen) < cutoff {
+			t.byFP.Delete(fp)
+			atomic.AddInt64(&t.n, -1)
+		}
+		return true
+	})
+	return atomic.LoadInt64(&t.n) < int64(t.MaxFingerprints)
+}
+
+// Latency returns the average execution time of statements with the same
+// fingerprint as query, and false if none has been observed. Pass
+// OverflowFingerprint for the average of statements the tracker had no room
+// for.
+func (t *LatencyTracker) Latency(query string) (time.Duration, bool) {
+	if query == OverflowFingerprint {
+		d := t.overflow.latency()
+		return d, d > 0
+	}
+	v, ok := t.byFP.Load(Fingerprint(query))
+	if !ok {
+		return 0, false
+	}
+	return v.(*latencyEntry).latency(), true
+}
+
+// Len returns the number of fingerprints tracked, not counting the overflow.
+func (t *LatencyTracker) Len() int {
+	return int(atomic.LoadInt64(&t.n))
+}
+
+// Cost returns a CostFunc charging one token per unit of average execution
+// time, rounded up and capped at maxCost; statements not observed yet cost
+// fallback(query), or 1 if fallback is nil.
+func (t *LatencyTracker) Cost(unit time.Duration, maxCost int, fallback CostFunc) CostFunc {
+	return func(query string) int {
+		d, ok := t.Latency(query)
+		if !ok {
+			if fallback != nil {
+				return fallback(query)
+			}
+			return 1
+		}
+		n := int(math.Ceil(float64(d) / float64(unit)))
+		if maxCost > 0 && n > maxCost {
+			return maxCost
+		}
+		return n
+	}
+}
@@ -0,0 +1,83 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestLatencyTracker 测试按指纹维护执行耗时的 EWMA
+func TestLatencyTracker(t *testing.T) {
+	tr := NewLatencyTracker(0.5)
+	tr.Observe("SELECT * FROM t WHERE id = 1", 100*time.Millisecond)
+	tr.Observe("SELECT * FROM t WHERE id = 2", 300*time.Millisecond)
+
+	// 相同指纹的语句共享一个均值
+	if d, ok := tr.Latency("SELECT * FROM t WHERE id = 3"); !ok || d != 200*time.Millisecond {
+		t.Errorf("Expected 200ms, got %v %v", d, ok)
+	}
+	if _, ok := tr.Latency("SELECT 1"); ok {
+		t.Error("Expected no latency for an unseen statement")
+	}
+
+	cost := tr.Cost(50*time.Millisecond, 3, func(string) int { return 2 })
+	if got := cost("SELECT * FROM t WHERE id = 4"); got != 3 {
+		t.Errorf("Expected cost capped at 3, got %d", got)
+	}
+	if got := cost("SELECT 1"); got != 2 {
+		t.Errorf("Expected fallback cost 2, got %d", got)
+	}
+}
+
+// TestWithLatencyTracker 测试执行过的调用会被记录
+func TestWithLatencyTracker(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	tr := NewLatencyTracker(0)
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10,
+		WithLatencyTracker(tr), WithCostFunc(tr.Cost(time.Millisecond, 10, nil)))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = 'Bob' WHERE id = 1"); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if _, ok := tr.Latency("UPDATE users SET name = 'Carol' WHERE id = 2"); !ok {
+		t.Error("Expected executed call to be tracked")
+	}
+}
+
+// TestLatencyTrackerBounded 测试指纹数量上限、溢出桶与空闲淘汰
+func TestLatencyTrackerBounded(t *testing.T) {
+	tr := NewLatencyTracker(1)
+	tr.MaxFingerprints = 2
+
+	tr.Observe("SELECT a FROM t", time.Millisecond)
+	tr.Observe("SELECT b FROM t", time.Millisecond)
+	// 已满且没有空闲条目，新语句计入溢出桶
+	tr.Observe("SELECT c FROM t", 5*time.Millisecond)
+	if tr.Len() != 2 {
+		t.Errorf("Expected 2 fingerprints, got %d", tr.Len())
+	}
+	if _, ok := tr.Latency("SELECT c FROM t"); ok {
+		t.Error("Expected overflowing statement not to be tracked on its own")
+	}
+	if d, ok := tr.Latency(OverflowFingerprint); !ok || d != 5*time.Millisecond {
+		t.Errorf("Expected overflow latency 5ms, got %v %v", d, ok)
+	}
+
+	// 空闲超过一分钟的条目会被淘汰
+	v, _ := tr.byFP.Load(Fingerprint("SELECT a FROM t"))
+	v.(*latencyEntry).seen = time.Now().Add(-2 * fingerprintIdle).UnixNano()
+	tr.lastEvict = 0
+	tr.Observe("SELECT d FROM t", 3*time.Millisecond)
+	if _, ok := tr.Latency("SELECT a FROM t"); ok {
+		t.Error("Expected idle fingerprint to be evicted")
+	}
+	if d, ok := tr.Latency("SELECT d FROM t"); !ok || d != 3*time.Millisecond {
+		t.Errorf("Expected new fingerprint to take the freed slot, got %v %v", d, ok)
+	}
+}
@@ -0,0 +1,180 @@
+package dbratelimit
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// LatencyPercentiles are percentiles of call latency, admission wait plus
+// execution, over a rolling window.
+type LatencyPercentiles struct {
+	P50, P95, P99 time.Duration
+}
+
+// LatencyAlert reports that a percentile of call latency crossed its
+// threshold, see WithLatencyAlerts.
+type LatencyAlert struct {
+	Quantile  float64       // 0.5, 0.95 or 0.99
+	Threshold time.Duration // the threshold set for Quantile
+	Value     time.Duration // the percentile over the window
+	// Firing is true when Value rose above Threshold and false when it
+	// fell back under it.
+	Firing bool
+	Window time.Duration
+	Time   time.Time
+}
+
+// LatencyNotifier receives latency alerts. Notify is called from a single
+// goroutine, in the order the thresholds were crossed.
+type LatencyNotifier interface {
+	Notify(LatencyAlert)
+}
+
+// LatencyNotifierFunc adapts a function to LatencyNotifier.
+type LatencyNotifierFunc func(LatencyAlert)
+
+func (f LatencyNotifierFunc) Notify(a LatencyAlert) {
+	f(a)
+}
+
+// LatencyAlerts configures WithLatencyAlerts.
+type LatencyAlerts struct {
+	// Notifier receives the alerts. Default logging them with log.Printf.
+	Notifier LatencyNotifier
+	// P50, P95 and P99 are the thresholds alerted on; zero ones are not.
+	P50, P95, P99 time.Duration
+	// Window is the period the percentiles are computed over; they are
+	// recomputed every tenth of it. Default one minute.
+	Window time.Duration
+}
+
+// WithLatencyAlerts computes rolling percentiles of the latency of
+// admitted calls, their admission wait plus execution, exposed in
+// Stats.RecentLatency, and notifies a.Notifier when one crosses its
+// threshold, in either direction. It gives apps without a metrics stack a
+// basic signal of the database slowing down or the limit being too tight.
+// Long polls are left out.
+func WithLatencyAlerts(a LatencyAlerts) Option {
+	return func(o *options) {
+		if a.Window <= 0 {
+			a.Window = time.Minute
+		}
+		o.latencyAlerts = &a
+	}
+}
+
+const (
+	latencySlots       = 10   // parts of the window, recomputed per part
+	latencySlotSamples = 1024 // latencies kept per part
+)
+
+type latencyWindow struct {
+	cfg LatencyAlerts
+
+	mu      sync.Mutex
+	slots   [latencySlots][]time.Duration
+	cur     int
+	scratch []time.Duration
+	recent  LatencyPercentiles
+	firing  [3]bool // per quantile, in the order of quantiles
+}
+
+func newLatencyWindow(cfg LatencyAlerts) *latencyWindow {
+	return &latencyWindow{cfg: cfg}
+}
+
+// observe records the latency of an admitted call
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.slots[w.cur]) < latencySlotSamples {
+		w.slots[w.cur] = append(w.slots[w.cur], d)
+	}
+}
+
+// evaluate recomputes the percentiles over the window, starts the next part
+// of it and returns the alerts for thresholds crossed since the last time
+func (w *latencyWindow) evaluate(now time.Time) []LatencyAlert {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.scratch = w.scratch[:0]
+	for _, s := range w.slots {
+		w.scratch = append(w.scratch, s...)
+	}
+	w.cur = (w.cur + 1) % latencySlots
+	w.slots[w.cur] = w.slots[w.cur][:0]
+
+	p := LatencyPercentiles{
+		P50: percentile(w.scratch, 0.5),
+		P95: percentile(w.scratch, 0.95),
+		P99: percentile(w.scratch, 0.99),
+	}
+	w.recent = p
+	checks := [...]struct {
+		q         float64
+		value     time.Duration
+		threshold time.Duration
+	}{
+		{0.5, p.P50, w.cfg.P50},
+		{0.95, p.P95, w.cfg.P95},
+		{0.99, p.P99, w.cfg.P99},
+	}
+	var alerts []LatencyAlert
+	for i, c := range checks {
+		if c.threshold <= 0 || len(w.scratch) == 0 {
+			continue
+		}
+		firing := c.value > c.threshold
+		if firing == w.firing[i] {
+			continue
+		}
+		w.firing[i] = firing
+		alerts = append(alerts, LatencyAlert{
+			Quantile:  c.q,
+			Threshold: c.threshold,
+			Value:     c.value,
+			Firing:    firing,
+			Window:    w.cfg.Window,
+			Time:      now,
+		})
+	}
+	return alerts
+}
+
+func (w *latencyWindow) percentiles() LatencyPercentiles {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.recent
+}
+
+// latencyLoop evaluates the window every part of it until r is closed
+func (r *RateLimitedDB) latencyLoop() {
+	w := r.latency
+	ticker := time.NewTicker(w.cfg.Window / latencySlots)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			for _, a := range w.evaluate(now) {
+				r.notifyLatency(a)
+			}
+		}
+	}
+}
+
+func (r *RateLimitedDB) notifyLatency(a LatencyAlert) {
+	n := r.latency.cfg.Notifier
+	if n == nil {
+		state := "resolved"
+		if a.Firing {
+			state = "firing"
+		}
+		log.Printf("dbratelimit: p%g latency %v over the last %v, threshold %v: %s",
+			a.Quantile*100, a.Value, a.Window, a.Threshold, state)
+		return
+	}
+	r.safely("latency notifier", func() { n.Notify(a) })
+}
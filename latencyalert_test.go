@@ -0,0 +1,74 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestLatencyWindow 测试滚动百分位数和越过阈值时的告警
+func TestLatencyWindow(t *testing.T) {
+	w := newLatencyWindow(LatencyAlerts{P95: 100 * time.Millisecond, Window: time.Second})
+	now := time.Now()
+	for range 100 {
+		w.observe(10 * time.Millisecond)
+	}
+	if alerts := w.evaluate(now); len(alerts) != 0 {
+		t.Fatalf("unexpected alerts %+v", alerts)
+	}
+	for range 20 {
+		w.observe(time.Second)
+	}
+	alerts := w.evaluate(now)
+	if len(alerts) != 1 || !alerts[0].Firing || alerts[0].Quantile != 0.95 || alerts[0].Value != time.Second {
+		t.Fatalf("alerts = %+v, want p95 firing at 1s", alerts)
+	}
+	if p := w.percentiles(); p.P50 != 10*time.Millisecond || p.P99 != time.Second {
+		t.Errorf("percentiles = %+v", p)
+	}
+	// 仍在阈值之上时不重复告警
+	if alerts := w.evaluate(now); len(alerts) != 0 {
+		t.Errorf("repeated alerts %+v", alerts)
+	}
+
+	// 慢调用移出窗口后恢复
+	for range latencySlots {
+		w.observe(10 * time.Millisecond)
+		alerts = append(alerts, w.evaluate(now)...)
+	}
+	if len(alerts) != 2 || alerts[1].Firing {
+		t.Errorf("alerts = %+v, want a resolved alert", alerts)
+	}
+}
+
+// TestLatencyAlerts 测试通过 Notifier 收到告警并在 Stats 中看到百分位数
+func TestLatencyAlerts(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	alerts := make(chan LatencyAlert, 10)
+	rateLimitedDB := Wrap(db, rate.Limit(20), 1, WithLatencyAlerts(LatencyAlerts{
+		Notifier: LatencyNotifierFunc(func(a LatencyAlert) { alerts <- a }),
+		P50:      20 * time.Millisecond,
+		Window:   100 * time.Millisecond,
+	}))
+	defer rateLimitedDB.Close()
+
+	// 令牌耗尽后每次调用约等待 50ms
+	for range 4 {
+		if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case a := <-alerts:
+		if !a.Firing || a.Quantile != 0.5 || a.Value <= 20*time.Millisecond {
+			t.Errorf("alert = %+v, want p50 firing", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert")
+	}
+	if p := rateLimitedDB.Stats().RecentLatency; p.P50 <= 20*time.Millisecond {
+		t.Errorf("RecentLatency = %+v", p)
+	}
+}
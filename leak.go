@@ -0,0 +1,67 @@
+package dbratelimit
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Leaks returns the number of times r found its bookkeeping inconsistent:
+// a call finished twice, or calls still registered as waiting, queued or
+// holding concurrency slots when none was in flight. It should always be
+// zero; a non-zero value points to a bug in r or in code driving it
+// through internal hooks. In race-enabled builds a call finished twice
+// panics instead.
+func (r *RateLimitedDB) Leaks() uint64 {
+	return atomic.LoadUint64(&r.leaks)
+}
+
+// leaked records an inconsistency
+func (r *RateLimitedDB) leaked(what string) {
+	atomic.AddUint64(&r.leaks, 1)
+	if raceEnabled && what == "call finished twice" {
+		panic("dbratelimit: " + what)
+	}
+}
+
+// checkIdle verifies, once no call is in flight, that nothing is left
+// waiting, queued or holding slots. started is the number of calls started
+// when the last one finished; if another call started meanwhile the check
+// is skipped, as it may legitimately hold resources.
+func (r *RateLimitedDB) checkIdle(started uint64) {
+	var problems []string
+	if n := atomic.LoadInt64(&r.waiting); n != 0 {
+		problems = append(problems, fmt.Sprintf("%d waiting", n))
+	}
+	r.queue.mu.Lock()
+	if n := r.queue.waiting.Len(); n != 0 {
+		problems = append(problems, fmt.Sprintf("%d queued", n))
+	}
+	r.queue.mu.Unlock()
+	if d := r.dispatch; d != nil {
+		d.mu.Lock()
+		if n := d.queue.Len(); n != 0 {
+			problems = append(problems, fmt.Sprintf("%d dispatch waiters", n))
+		}
+		d.mu.Unlock()
+	}
+	if r.sem != nil {
+		if !r.sem.TryAcquire(r.opts.maxConcurrency) {
+			problems = append(problems, "concurrency slots held")
+		} else {
+			r.sem.Release(r.opts.maxConcurrency)
+		}
+	}
+	var audit error
+	if r.ledger != nil {
+		audit = r.ledger.checkIdle()
+	}
+	if atomic.LoadUint64(&r.started) != started {
+		return
+	}
+	if len(problems) > 0 {
+		r.leaked(fmt.Sprint(problems))
+	}
+	if audit != nil {
+		r.ledger.mismatch(audit.Error())
+	}
+}
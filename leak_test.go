@@ -0,0 +1,204 @@
+package dbratelimit
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// cancelStorm 并发发起大量很快被取消的调用
+func cancelStorm(t *testing.T, r *RateLimitedDB, ctx context.Context) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(i%5)*time.Millisecond)
+			defer cancel()
+			r.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", "x", 1)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// checkNoLeaks 检查取消后没有残留的等待者、队列项或协程
+func checkNoLeaks(t *testing.T, r *RateLimitedDB, goroutines int) {
+	t.Helper()
+	if n := r.Leaks(); n != 0 {
+		t.Errorf("Leaks() = %d, want 0", n)
+	}
+	if n := r.Waiting(); n != 0 {
+		t.Errorf("Waiting() = %d, want 0", n)
+	}
+	if w := r.Waiters(); len(w) != 0 {
+		t.Errorf("Waiters() = %v, want none", w)
+	}
+	if tokens := r.limiter.Tokens(); tokens < -1 {
+		t.Errorf("tokens = %v, canceled reservations were not returned", tokens)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines+2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines+2 {
+		t.Errorf("%d goroutines, started with %d", n, goroutines)
+	}
+}
+
+// TestCancelNoLeaks 测试各种等待路径在上下文取消后不泄漏资源
+func TestCancelNoLeaks(t *testing.T) {
+	cases := map[string][]Option{
+		"queue":       nil,
+		"dispatcher":  {WithQueue(NewPriorityQueue())},
+		"concurrency": {WithMaxConcurrency(1)},
+		"keyed":       {WithKeyedLimit(1, 1)},
+		"quotas":      {WithQuotas(Quota{Count: 2, Per: time.Hour})},
+		"freeze":      {WithFreezeMode(FreezeQueue)},
+	}
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer db.Close()
+			goroutines := runtime.NumGoroutine()
+			r := Wrap(db, rate.Limit(1), 1, opts...)
+			if name == "freeze" {
+				r.FreezeWrites()
+			}
+
+			ctx := WithKey(context.Background(), "tenant")
+			cancelStorm(t, r, ctx)
+			r.ThawWrites()
+			r.Close()
+			checkNoLeaks(t, r, goroutines)
+		})
+	}
+}
+
+// TestLeaksCounted 测试空闲时残留的等待计数会被记为泄漏
+func TestLeaksCounted(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	r := Wrap(db, rate.Inf, 1)
+
+	if _, err := r.ExecContext(context.Background(), "UPDATE users SET name = ?", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Leaks(); n != 0 {
+		t.Fatalf("Leaks() = %d after a clean call", n)
+	}
+
+	r.waiting++ // a waiter that was never accounted for
+	r.callStarted()
+	r.callFinished()
+	if n := r.Leaks(); n != 1 {
+		t.Errorf("Leaks() = %d, want 1", n)
+	}
+}
+
+// TestFailedStageRefund 测试后面的阶段失败时，前面阶段拿到的 token 会被退回
+func TestFailedStageRefund(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	r := Wrap(db, rate.Limit(0.1), 1,
+		WithKeyedLimit(rate.Limit(0.1), 1),
+		WithTagLimits(map[string]LimitConfig{"t": {Limit: rate.Limit(0.1), Burst: 1}}),
+		WithQuotas(Quota{Count: 1, Per: time.Hour}))
+	defer r.Close()
+
+	// 耗尽主 limiter，调用只能在最后一个阶段等到超时
+	r.Limiter().AllowN(time.Now(), 1)
+	ctx := WithKey(WithTag(context.Background(), "t"), "tenant")
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.ExecContext(short, "UPDATE users SET name = ?", "x"); err == nil {
+		t.Fatal("Expected the call to time out on the main limiter")
+	}
+
+	now := time.Now()
+	buckets := map[string]*rate.Limiter{
+		"key":   r.keyed.get("tenant").limiter,
+		"tag":   r.tagLimiters["t"],
+		"quota": r.quotas[0],
+	}
+	for name, l := range buckets {
+		if tokens := l.TokensAt(now); tokens < 0.99 {
+			t.Errorf("Expected the %s bucket to get its token back, has %.2f", name, tokens)
+		}
+	}
+}
+
+// TestHoldsCancel 测试归还令牌时不会重复计入已经过去的补充时间
+func TestHoldsCancel(t *testing.T) {
+	t0 := time.Now()
+
+	// 尚未到期的预留：中间有别的预留时只归还它之后腾出的令牌
+	l := rate.NewLimiter(10, 20)
+	l.ReserveN(t0, 20)
+	var h holds
+	h.add(l, l.ReserveN(t0, 20), 20)
+	l.ReserveN(t0.Add(time.Second), 1)
+	h.cancel(t0.Add(time.Second))
+	if tokens := l.TokensAt(t0.Add(time.Second)); math.Abs(tokens-8) > 0.01 {
+		t.Errorf("Expected 8 tokens after canceling a pending reservation, got %.2f", tokens)
+	}
+
+	// 已经放行的预留：按当前时间退还令牌
+	l = rate.NewLimiter(10, 20)
+	l.ReserveN(t0, 20)
+	h = holds{}
+	h.add(l, l.ReserveN(t0.Add(time.Second), 5), 5)
+	l.ReserveN(t0.Add(1500*time.Millisecond), 1)
+	h.cancel(t0.Add(1500 * time.Millisecond))
+	if tokens := l.TokensAt(t0.Add(1500 * time.Millisecond)); math.Abs(tokens-14) > 0.01 {
+		t.Errorf("Expected 14 tokens after refunding a granted reservation, got %.2f", tokens)
+	}
+	if tokens := l.TokensAt(t0.Add(2 * time.Second)); math.Abs(tokens-19) > 0.01 {
+		t.Errorf("Expected refill to count once, got %.2f tokens", tokens)
+	}
+}
+
+// TestLateStageRefund 测试动词限流或并发槽拒绝调用时归还主 limiter 与角色的令牌
+func TestLateStageRefund(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	r := Wrap(db, rate.Limit(0.1), 1,
+		WithRoles(RoleLeader, RoleProfile{WriteLimit: rate.Limit(0.1), WriteBurst: 1}, RoleProfile{}),
+		WithVerbLimit(rate.Limit(0.1), 1, VerbDelete),
+		WithMaxConcurrency(1))
+	defer r.Close()
+
+	check := func(stage string) {
+		t.Helper()
+		now := time.Now()
+		for name, l := range map[string]*rate.Limiter{"main": r.Limiter(), "role": r.role.writes} {
+			if tokens := l.TokensAt(now); tokens < 0.99 {
+				t.Errorf("Expected the %s limiter to get its token back after %s refused the call, has %.2f", name, stage, tokens)
+			}
+		}
+	}
+
+	// 动词 limiter 已耗尽
+	r.opts.verbLimits[VerbDelete].AllowN(time.Now(), 1)
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.ExecContext(short, "DELETE FROM users"); err == nil {
+		t.Fatal("Expected the call to time out on the verb limiter")
+	}
+	check("the verb limit")
+
+	// 并发槽被占满
+	if err := r.sem.Acquire(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer r.sem.Release(1)
+	short, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.ExecContext(short, "UPDATE users SET name = ?", "x"); err == nil {
+		t.Fatal("Expected the call to time out waiting for a slot")
+	}
+	check("the concurrency limit")
+}
@@ -0,0 +1,88 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"math/rand/v2"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ConnLifetime configures LifetimeConnector.
+type ConnLifetime struct {
+	// Max is the average lifetime of a connection.
+	Max time.Duration
+	// Jitter spreads lifetimes uniformly over Max ± Jitter*Max. Default 0.2.
+	Jitter float64
+	// Limiter, if set, paces opening connections, so that replacements for
+	// expired connections, or for all of them after a failover, trickle in
+	// instead of arriving at once.
+	Limiter *rate.Limiter
+	// Rand is the source of the jitter, see WithRand. Default the
+	// package-level functions of math/rand/v2.
+	Rand rand.Source
+}
+
+// LifetimeConnector returns a connector whose connections each expire after
+// their own jittered lifetime. Unlike sql.DB.SetConnMaxLifetime, which gives
+// every connection the same lifetime, connections opened together, such as
+// after a failover, are then not all closed and reopened together. The
+// connections are wrapped, see UnwrapConn.
+func LifetimeConnector(c driver.Connector, l ConnLifetime) driver.Connector {
+	if l.Jitter <= 0 {
+		l.Jitter = 0.2
+	}
+	if l.Jitter > 1 {
+		l.Jitter = 1
+	}
+	if l.Limiter != nil {
+		c = LimitConnector(c, l.Limiter)
+	}
+	return &lifetimeConnector{Connector: c, lifetime: l, rand: newLockedRand(l.Rand)}
+}
+
+// OpenWithLifetime is sql.Open with connections managed by
+// LifetimeConnector. Do not also set ConnMaxLifetime on the returned pool.
+func OpenWithLifetime(driverName, dsn string, l ConnLifetime) (*sql.DB, error) {
+	c, err := connectorFor(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(LifetimeConnector(c, l)), nil
+}
+
+type lifetimeConnector struct {
+	driver.Connector
+	lifetime ConnLifetime
+	rand     *lockedRand
+}
+
+func (c *lifetimeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil || c.lifetime.Max <= 0 {
+		return conn, err
+	}
+	spread := (c.rand.float64()*2 - 1) * c.lifetime.Jitter
+	d := time.Duration(float64(c.lifetime.Max) * (1 + spread))
+	return &expiringConn{wrappedConn: wrappedConn{conn}, expires: time.Now().Add(d)}, nil
+}
+
+// expiringConn reports itself invalid to the pool once expired, so the pool
+// closes it instead of reusing it
+type expiringConn struct {
+	wrappedConn
+	expires time.Time
+}
+
+func (c *expiringConn) IsValid() bool {
+	return !time.Now().After(c.expires) && c.wrappedConn.IsValid()
+}
+
+func (c *expiringConn) ResetSession(ctx context.Context) error {
+	if time.Now().After(c.expires) {
+		return driver.ErrBadConn
+	}
+	return c.wrappedConn.ResetSession(ctx)
+}
@@ -0,0 +1,73 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConnector 统计建立的连接数
+type countingConnector struct {
+	driver.Connector
+	n int64
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	atomic.AddInt64(&c.n, 1)
+	return c.Connector.Connect(ctx)
+}
+
+// TestLifetimeConnector 测试连接按各自带抖动的寿命过期并被替换
+func TestLifetimeConnector(t *testing.T) {
+	base, err := connectorFor("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("connectorFor failed: %v", err)
+	}
+	counting := &countingConnector{Connector: base}
+	lc := LifetimeConnector(counting, ConnLifetime{Max: 100 * time.Millisecond, Jitter: 0.5})
+
+	// 寿命分布在 Max ± 50% 之间且彼此不同
+	ctx := context.Background()
+	seen := make(map[time.Time]bool)
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		conn, err := lc.Connect(ctx)
+		if err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		ec := conn.(*expiringConn)
+		if d := ec.expires.Sub(start); d < 50*time.Millisecond || d > 150*time.Millisecond+time.Millisecond {
+			t.Errorf("Lifetime %v outside jitter bounds", d)
+		}
+		seen[ec.expires] = true
+		conn.Close()
+	}
+	if len(seen) < 2 {
+		t.Error("Expected jittered lifetimes")
+	}
+
+	db := sql.OpenDB(lc)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	before := atomic.LoadInt64(&counting.n)
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT 1").Scan(&n); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if opened := atomic.LoadInt64(&counting.n) - before; opened != 1 {
+		t.Errorf("Expected the connection to be reused, opened %d", opened)
+	}
+	time.Sleep(160 * time.Millisecond)
+	if err := db.QueryRow("SELECT 1").Scan(&n); err != nil {
+		t.Fatalf("Query after expiry failed: %v", err)
+	}
+	if opened := atomic.LoadInt64(&counting.n) - before; opened != 2 {
+		t.Errorf("Expected the expired connection to be replaced, opened %d", opened)
+	}
+}
@@ -0,0 +1,18 @@
+package dbratelimit
+
+import "strings"
+
+// longPollKeywords start statements that block until something happens
+var longPollKeywords = map[string]bool{
+	"LISTEN":  true, // PostgreSQL
+	"WAITFOR": true, // SQL Server, including WAITFOR (RECEIVE ...) on queues
+}
+
+// IsLongPollStatement reports whether query is a long-lived statement that
+// is treated as if its context was marked with WithLongPoll: PostgreSQL
+// LISTEN and SQL Server WAITFOR. Other blocking polls, such as a SELECT
+// on a queue table that waits for rows, need WithLongPoll.
+func IsLongPollStatement(query string) bool {
+	word, _ := nextWord(skipSpaceAndComments(query))
+	return longPollKeywords[strings.ToUpper(word)]
+}
@@ -0,0 +1,59 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestIsLongPollStatement 测试识别 LISTEN 和 WAITFOR 语句
+func TestIsLongPollStatement(t *testing.T) {
+	tests := map[string]bool{
+		"LISTEN orders":                      true,
+		"/* worker */ listen \"jobs\"":       true,
+		"WAITFOR DELAY '00:00:05'":           true,
+		"WAITFOR (RECEIVE TOP (1) * FROM q)": true,
+		"SELECT * FROM listeners":            false,
+		"NOTIFY orders, 'x'":                 false,
+	}
+	for query, want := range tests {
+		if got := IsLongPollStatement(query); got != want {
+			t.Errorf("IsLongPollStatement(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+// TestWithLongPoll 测试长轮询调用不消耗令牌、不受语句超时限制，也不计入统计和延迟跟踪
+func TestWithLongPoll(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	tracker := NewLatencyTracker(0)
+	var seen []QueryInfo
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 1,
+		WithStatementTimeout(time.Nanosecond),
+		WithLatencyTracker(tracker),
+		WithHooks(Hooks{AfterQuery: func(_ context.Context, info QueryInfo) { seen = append(seen, info) }}))
+	defer rateLimitedDB.Close()
+
+	ctx := WithLongPoll(context.Background())
+	for i := 0; i < 3; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatalf("long poll %d failed: %v", i, err)
+		}
+	}
+	if tokens := rateLimitedDB.limiter.Tokens(); tokens < 0.99 {
+		t.Errorf("tokens = %v, long polls took some", tokens)
+	}
+	if s := rateLimitedDB.Stats(); s.Calls != 0 || s.ExecLatency.Count() != 0 {
+		t.Errorf("long polls counted in stats: %d calls, %d latencies", s.Calls, s.ExecLatency.Count())
+	}
+	if n := tracker.Len(); n != 0 {
+		t.Errorf("latency tracker has %d fingerprints, want none", n)
+	}
+	if len(seen) != 3 || !seen[0].LongPoll {
+		t.Errorf("AfterQuery saw %v, want 3 long polls", seen)
+	}
+}
@@ -3,7 +3,12 @@ package dbratelimit
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"golang.org/x/sync/semaphore"
 	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 )
@@ -11,51 +16,615 @@ import (
 var _ gorm.ConnPool = (*RateLimitedDB)(nil)
 
 type RateLimitedDB struct {
+	*dbState
+	policy *Policy // defaults of a view made by WithPolicy, nil otherwise
+}
+
+// dbState is what a RateLimitedDB shares with its views
+type dbState struct {
+	// accessed atomically, keep first for alignment
+	panics     uint64
+	capacity   uint64 // float64 bits
+	calibrated uint64 // limit set by the last Calibrate, float64 bits
+	inFlight   int64
+	waiting    int64 // calls in wait, not yet admitted
+	lastActive int64 // unix nanos
+	forgiven   int64 // lastActive of the idle period forgiven by WithIdleBurst
+
+	backendFailures uint64
+	auditErrors     uint64
+	rawCalls        uint64
+	literalQueries  uint64
+	leaks           uint64
+	started         uint64 // calls started, for the leak checks
+	limitsGen       uint64 // odd while switchLimits runs
+
 	db      *sql.DB
 	limiter *rate.Limiter
+	keyed   *keyedLimiters
+	sem     *semaphore.Weighted
+	region  *regionState
+
+	fallback  *rate.Limiter // local limiter for FallbackLocal
+	migration *rate.Limiter
+	conns     *rate.Limiter // set by WithConnLimit
+	role      *roleState    // set by WithRoles
+	profiles  *profileState // set by WithProfiles
+	lastFlags Config        // last Config from the flag provider
+	limitsMu  sync.Mutex    // serializes switchLimits
+	base      LimitConfig   // main limiter settings at creation
+	adaptive  *adaptiveLimiter
+	ramp      *limitRamp     // set by WithLimitRamp
+	slo       *sloState      // set by WithMaxQueueDelaySLO
+	usage     *usageBook     // set by WithUsageAccounting
+	budgets   *budgetTracker // set by WithBudgetAlerts
+	probed    *ProbeResult   // set by WithStartupProbe
+	stmts     *stmtCache     // set by WithStmtCache
+	pool      poolScale      // used by WithLimitPerConn
+	debug     *debugRecorder // set by WithDebugPage
+	ledger    *tokenLedger   // set by WithTokenAudit
+	latency   *latencyWindow // set by WithLatencyAlerts
+	stacks    *stackSampler  // set by WithStackSampling with WithEvents
+	stats     stats
+	queue     waitQueue
+	freeze    freezeState
+	dispatch  *dispatcher // set by WithQueue
+	events    *eventStream
+	opts      options
+
+	reservations map[string]*rate.Limiter
+	tagLimiters  map[string]*rate.Limiter
+	quotas       []*rate.Limiter // set by WithQuotas
+
+	stop      chan struct{} // closed by Close to stop background work
+	closeOnce sync.Once
+	bg        sync.WaitGroup
 }
 
-func Wrap(db *sql.DB, limit rate.Limit, burst int) *RateLimitedDB {
-	return &RateLimitedDB{
+// Wrap wraps db with a limit of limit calls per second and a burst of
+// burst. It panics with the problems found if the settings are invalid, see
+// New.
+func Wrap(db *sql.DB, limit rate.Limit, burst int, opts ...Option) *RateLimitedDB {
+	return WrapLimiter(db, rate.NewLimiter(limit, burst), opts...)
+}
+
+// WrapLimiter wraps db with an existing limiter, so several databases can
+// share one budget. Like Wrap, it panics if the settings are invalid.
+func WrapLimiter(db *sql.DB, limiter *rate.Limiter, opts ...Option) *RateLimitedDB {
+	r, err := wrap(db, limiter, Config{}, opts)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// wrap validates cfg and opts and then sets r up; it starts no background
+// work before they are found valid
+func wrap(db *sql.DB, limiter *rate.Limiter, cfg Config, opts []Option) (*RateLimitedDB, error) {
+	r := &RateLimitedDB{dbState: &dbState{
 		db:      db,
-		limiter: rate.NewLimiter(limit, burst),
+		limiter: limiter,
+		opts:    defaultOptions(),
+		stats:   newStats(),
+		stop:    make(chan struct{}),
+	}}
+	r.lastActive = time.Now().UnixNano()
+	r.base = LimitConfig{Limit: limiter.Limit(), Burst: limiter.Burst()}
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+	var errs configErrors
+	cfg.check(&errs)
+	r.opts.check(&errs)
+	errs.burst("Burst", r.base)
+	if cfg.Profile != "" && !r.opts.hasProfile(cfg.Profile) {
+		errs.add("Profile", "%q is not configured with WithProfiles", cfg.Profile)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	r.checkDoubleWrap()
+	if r.opts.ramp > 0 {
+		r.ramp = &limitRamp{d: r.opts.ramp, limiter: r.limiter}
+		r.background(r.rampLoop)
+	}
+	if r.opts.keyed != nil {
+		r.keyed = newKeyedLimiters(*r.opts.keyed, r.opts.borrow)
+	}
+	r.sem = semaphoreFor(r.opts.maxConcurrency)
+	r.tagLimiters = newTagLimiters(r.opts.tagLimits)
+	r.quotas = newQuotaLimiters(r.opts.quotas)
+	if r.opts.stmtCache > 0 {
+		r.stmts = newStmtCache(r.opts.stmtCache)
+	}
+	if r.opts.usage {
+		r.usage = newUsageBook()
+	}
+	if r.opts.debugPage != nil {
+		r.debug = newDebugRecorder(*r.opts.debugPage)
+	}
+	if r.opts.tokenAudit {
+		r.ledger = &tokenLedger{strict: r.opts.tokenAuditStrict}
+	}
+	if a := r.opts.budgetAlerts; a != nil && a.Notifier != nil {
+		r.budgets = newBudgetTracker(*a)
+		r.background(r.budgetLoop)
+	}
+	if len(r.opts.reservations) > 0 {
+		r.reservations = make(map[string]*rate.Limiter, len(r.opts.reservations))
+		for key, l := range r.opts.reservations {
+			r.reservations[key] = rate.NewLimiter(l.Limit, l.Burst)
+		}
+	}
+	if r.opts.calibration != nil {
+		r.background(func() { r.calibrateLoop(*r.opts.calibration) })
+	}
+	if r.opts.adaptive != nil {
+		r.adaptive = newAdaptiveLimiter(*r.opts.adaptive, r.limiter, r.SetLimit)
+	}
+	if c := r.opts.connLimit; c != nil {
+		r.conns = rate.NewLimiter(c.Limit, c.Burst)
+	}
+	if p := r.opts.startupProbe; p != nil {
+		r.startupProbe(*p)
+	}
+	if c := r.opts.profiles; c != nil {
+		r.profiles = newProfileState(*c)
+		if cfg.Profile != "" {
+			r.SwitchProfile(cfg.Profile)
+		} else {
+			r.SwitchProfile(c.initial)
+		}
+	}
+	if c := r.opts.roles; c != nil {
+		r.role = &roleState{
+			profiles: c.profiles,
+			writes:   rate.NewLimiter(rate.Inf, 1),
+		}
+		r.SetRole(c.initial)
 	}
+	if r.opts.flags != nil {
+		r.evalFlags()
+		r.background(r.flagLoop)
+	}
+	if r.opts.limitPerConn > 0 {
+		r.scaleToPool()
+		r.background(r.poolLoop)
+	}
+	if r.opts.diagnostics != nil {
+		r.startDiagnostics(*r.opts.diagnostics)
+	}
+	if m := r.opts.migration; m != nil {
+		r.migration = rate.NewLimiter(m.Limit, m.Burst)
+	}
+	if f := r.opts.fallback; f != nil {
+		r.fallback = rate.NewLimiter(f.Limit, f.Burst)
+	}
+	if r.opts.region != nil {
+		r.region = newRegionState(*r.opts.region)
+		r.background(r.regionLoop)
+	}
+	if r.opts.events != nil {
+		r.events = newEventStream(*r.opts.events, r.opts.rand)
+		if r.opts.stackSampling != nil {
+			r.stacks = newStackSampler(*r.opts.stackSampling)
+		}
+	}
+	q := r.opts.queue
+	if q == nil && r.opts.callerFairness {
+		q = NewCallerQueue()
+	}
+	if q != nil {
+		r.dispatch = newDispatcher(q)
+		r.background(r.dispatchLoop)
+	}
+	if r.opts.queueSLO > 0 {
+		r.slo = newSLOState(r.opts.queueSLO)
+		r.background(r.sloLoop)
+	}
+	if r.opts.latencyAlerts != nil {
+		r.latency = newLatencyWindow(*r.opts.latencyAlerts)
+		r.background(r.latencyLoop)
+	}
+	if r.opts.idle != nil {
+		r.background(func() { r.idleLoop(*r.opts.idle) })
+	}
+	return r, nil
+}
+
+// background runs fn in a goroutine that Close waits for
+func (r *RateLimitedDB) background(fn func()) {
+	r.bg.Add(1)
+	go func() {
+		defer r.bg.Done()
+		fn()
+	}()
 }
 
+// call tracks one rate-limited operation from admission to completion.
+// Calls are pooled: once done, and once its contexts are canceled where the
+// caller does that, a call must not be used again.
+type call struct {
+	r          *RateLimitedDB
+	ctx        context.Context // context for the underlying call
+	cancelExec context.CancelFunc
+	cancelCall context.CancelFunc
+	admitCtx   queryContext // context for admission, carrying the query
+	query      string
+	verb       Verb
+	start      time.Time
+	admitted   time.Time
+	slots      int64
+	verbSem    *semaphore.Weighted // verb concurrency slot held, if any
+	cost       int                 // tokens charged
+	granted    int                 // tokens taken at admission, see WithTokenAudit
+	stack      []byte              // see WithStackSampling
+	rows       int64
+	executed   bool // admitted and passed to the database
+	longPoll   bool // see WithLongPoll
+	finished   bool // done was called
+}
+
+var callPool = sync.Pool{New: func() any { return new(call) }}
+
 // wait blocks until limiter allows or ctx cancels
-func (r *RateLimitedDB) wait(ctx context.Context) error {
-	return r.limiter.Wait(ctx)
+func (r *RateLimitedDB) wait(ctx context.Context, query string) (*call, error) {
+	ctx = r.directiveContext(r.policyContext(ctx), query)
+	verb := r.verbOf(query)
+	ctx, denied := r.admissionPolicy(ctx, query, verb)
+	ctx, cancelCall := r.callContext(ctx)
+	c := callPool.Get().(*call)
+	*c = call{r: r, ctx: ctx, cancelCall: cancelCall, query: query, verb: verb, start: time.Now()}
+	c.longPoll = IsLongPoll(ctx) || IsLongPollStatement(query)
+	r.forgiveIdle(c.start)
+	r.callStarted()
+	if h := r.opts.hooks.BeforeWait; h != nil {
+		r.safely("BeforeWait hook", func() { h(ctx, query) })
+	}
+	err := denied
+	if err == nil && IsExempt(ctx) {
+		r.auditCall(ctx, AuditExempt, query, nil)
+	} else if err == nil && !c.longPoll && !r.opts.exemptVerbs[c.verb] {
+		atomic.AddInt64(&r.waiting, 1)
+		cost := r.cost(ctx, query)
+		c.cost = cost
+		admitCtx, cancel := r.admissionContext(ctx)
+		// the tokens of every stage passed, given back if a later one fails
+		var h holds
+		err = r.waitThaw(admitCtx, c.verb)
+		if err == nil && r.isMigration(ctx, c.verb) {
+			err = r.waitLimiter(admitCtx, r.migration, cost, &h)
+			if err == nil {
+				c.grant(cost)
+			}
+		} else if err == nil {
+			c.admitCtx = queryContext{admitCtx, query}
+			err = r.admitTokens(c, cost, &h)
+			if err == nil && PriorityFrom(ctx) != PriorityCritical {
+				c.slots, err = r.acquireSlots(admitCtx, cost)
+				if err == nil {
+					c.verbSem, err = r.acquireVerbSlot(admitCtx, c.verb)
+				}
+			}
+		}
+		if err != nil {
+			h.cancel(time.Now())
+		}
+		cancel()
+		atomic.AddInt64(&r.waiting, -1)
+		err = admissionError(ctx, admitCtx, err)
+	}
+	c.admitted = time.Now()
+	c.sampleStack()
+	if err != nil {
+		err = c.timeout(err)
+		c.done(err)
+		r.auditCall(ctx, AuditRejected, query, err)
+		c.close()
+		return nil, err
+	}
+	if c.longPoll {
+		c.ctx = ctx
+	} else {
+		c.ctx, c.cancelExec = r.execContext(ctx)
+	}
+	c.executed = true
+	return c, nil
+}
+
+// close cancels the call's contexts and returns it to the pool
+func (c *call) close() {
+	if c.cancelExec != nil {
+		c.cancelExec()
+	}
+	if c.cancelCall != nil {
+		c.cancelCall()
+	}
+	c.free()
+}
+
+// free returns the call to the pool without canceling its contexts, for
+// calls whose results keep using them, such as *sql.Rows
+func (c *call) free() {
+	*c = call{}
+	callPool.Put(c)
+}
+
+// admitTokens takes the n tokens of c from the role's write limiter, the
+// stages of acquire and the verb's limiter, adding the reservations to h
+// and granting them to c once the main budget is passed. If switchLimits
+// runs meanwhile, the tokens are given back and taken again under the new
+// limits, so that no call is admitted by a mix of old and new ones.
+func (r *RateLimitedDB) admitTokens(c *call, n int, h *holds) error {
+	ctx, verb := &c.admitCtx, c.verb
+	for {
+		gen := atomic.LoadUint64(&r.limitsGen)
+		if gen&1 != 0 {
+			// wait for the switch in progress
+			r.limitsMu.Lock()
+			r.limitsMu.Unlock()
+			continue
+		}
+		// the role's write limit goes first, so that writes refused there
+		// take nothing from the main budget
+		err := r.waitRole(ctx.Context, verb, n, h)
+		if err == nil {
+			err = r.acquireStages(ctx, n, h)
+		}
+		granted := err == nil
+		if err == nil {
+			err = r.waitVerb(ctx.Context, verb, n, h)
+		}
+		if err != nil || atomic.LoadUint64(&r.limitsGen) == gen {
+			if granted {
+				c.grant(n)
+			}
+			return err
+		}
+		h.cancel(time.Now())
+		*h = holds{}
+	}
+}
+
+// switchLimits runs update, which changes several limiters, as one switch
+// for the calls being admitted (see admitTokens)
+func (r *RateLimitedDB) switchLimits(update func()) {
+	r.limitsMu.Lock()
+	defer r.limitsMu.Unlock()
+	atomic.AddUint64(&r.limitsGen, 1)
+	defer atomic.AddUint64(&r.limitsGen, 1)
+	update()
+}
+
+// acquire takes n tokens from the caller's key and tag buckets and the
+// quotas, if any, and then from the key's reservation or the main limiter,
+// then from the regional share and the distributed backend when configured.
+// If a stage fails, the tokens taken by the earlier ones are given back.
+func (r *RateLimitedDB) acquire(ctx context.Context, n int) error {
+	var h holds
+	if err := r.acquireStages(ctx, n, &h); err != nil {
+		h.cancel(time.Now())
+		return err
+	}
+	return nil
+}
+
+// acquireStages is acquire, adding the reservations of each stage to h
+func (r *RateLimitedDB) acquireStages(ctx context.Context, n int, h *holds) error {
+	critical := PriorityFrom(ctx) == PriorityCritical
+	key := KeyFrom(ctx)
+	if r.keyed != nil && key != "" {
+		if critical {
+			takeN(r.keyed.get(key).limiter, n)
+		} else if err := r.waitKey(ctx, key, n, h); err != nil {
+			return err
+		}
+	}
+	if err := r.waitTag(ctx, n, h); err != nil {
+		return err
+	}
+	if err := r.waitQuotas(ctx, n, h); err != nil {
+		return err
+	}
+	if critical || r.reserved(key, n, h) {
+		takeN(r.limiter, n)
+	} else if r.boosted(ctx, n, h) {
+		// capacity added on top of the shared budget
+	} else if err := r.waitN(ctx, n, h); err != nil {
+		return err
+	}
+	if r.region != nil {
+		if err := r.waitRegion(ctx, n, h); err != nil {
+			return err
+		}
+	}
+	if r.opts.backend != nil && !critical {
+		return r.waitBackend(ctx, n)
+	}
+	return nil
+}
+
+// done reports the outcome of the underlying call
+func (c *call) done(err error) {
+	if c.finished {
+		c.r.leaked("call finished twice")
+		return
+	}
+	c.finished = true
+	c.r.releaseSlots(c.slots)
+	if c.verbSem != nil {
+		c.verbSem.Release(1)
+	}
+	if c.r.ledger != nil {
+		c.r.ledger.settle(c)
+	}
+	c.r.callFinished()
+	now := time.Now()
+	info := QueryInfo{
+		Query:    c.query,
+		Verb:     c.verb,
+		Rows:     c.rows,
+		Wait:     c.admitted.Sub(c.start),
+		Exec:     now.Sub(c.admitted),
+		Err:      err,
+		LongPoll: c.longPoll,
+	}
+	if !c.executed {
+		info.Exec = 0
+	}
+	info.Scheduled = info.Wait + info.Exec
+	if t, ok := IntendedStartFrom(c.ctx); ok && t.Before(c.start) {
+		info.Scheduled += c.start.Sub(t)
+	}
+	// long polls would only distort latencies and rates
+	measured := c.executed && !c.longPoll
+	if !c.longPoll {
+		c.r.stats.record(TagFrom(c.ctx), info, c.executed)
+	}
+	if c.r.usage != nil && c.executed {
+		c.r.usage.record(TagFrom(c.ctx), KeyFrom(c.ctx), c.cost)
+	}
+	if c.r.budgets != nil && c.executed && c.cost > 0 {
+		c.r.chargeBudgets(KeyFrom(c.ctx), c.cost, now)
+	}
+	if c.r.slo != nil && measured {
+		c.r.slo.observe(info.Wait)
+	}
+	if c.r.latency != nil && measured {
+		c.r.latency.observe(info.Wait + info.Exec)
+	}
+	c.event(info, now)
+	if c.r.debug != nil && !c.longPoll {
+		c.r.debug.record(c, info, now)
+	}
+	c.checkPlaceholders(now)
+	// only calls that reached the database say anything about its load
+	if c.r.adaptive != nil && measured {
+		c.r.adaptive.observe(c.r.Classify(err).Overload(), now)
+	}
+	h := c.r.opts.hooks.AfterQuery
+	for _, fn := range c.r.opts.observers {
+		c.r.safely("observer", func() { fn(c.ctx, info) })
+	}
+	if h != nil {
+		c.r.safely("AfterQuery hook", func() { h(c.ctx, info) })
+	}
 }
 
 func (r *RateLimitedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	if err := r.wait(ctx); err != nil {
-		return nil, err
+	rows, hold, err := r.query(ctx, query, args)
+	hold.returned(err)
+	return rows, err
+}
+
+// query is QueryContext, returning what the rows hold too. The hold is nil
+// if there is nothing to keep or the query failed; the caller must end it.
+func (r *RateLimitedDB) query(ctx context.Context, query string, args []any) (*sql.Rows, *rowsHold, error) {
+	c, err := r.wait(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows *sql.Rows
+	hold := c.holdRows()
+	if s := r.stmtFor(c); s != nil {
+		rows, err = s.stmt.QueryContext(c.ctx, args...)
+		r.stmts.release(s)
+	} else {
+		rows, err = r.db.QueryContext(c.ctx, query, args...)
 	}
-	return r.db.QueryContext(ctx, query, args...)
+	err = c.result(err)
+	c.done(err)
+	c.free()
+	if err != nil {
+		hold.end()
+		return rows, nil, err
+	}
+	return rows, hold, nil
 }
 
 func (r *RateLimitedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
-	// Note: QueryRowContext doesn't return error, so we can't check wait() error here
-	// The error will be returned when Scan() is called on the Row
-	_ = r.wait(ctx)
-	return r.db.QueryRowContext(ctx, query, args...)
+	// a failed wait is reported by the row's Scan and Err, the query is not run
+	c, err := r.wait(ctx, query)
+	if err != nil {
+		return r.failedRow(ctx, err)
+	}
+	var row *sql.Row
+	hold := c.holdRows()
+	if s := r.stmtFor(c); s != nil {
+		row = s.stmt.QueryRowContext(c.ctx, args...)
+		r.stmts.release(s)
+	} else {
+		row = r.db.QueryRowContext(c.ctx, query, args...)
+	}
+	c.done(row.Err())
+	c.free()
+	hold.returned(row.Err())
+	return row
 }
 
 func (r *RateLimitedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	if err := r.wait(ctx); err != nil {
-		return nil, err
+	if res, ok, err := r.bufferWrite(ctx, query, args); ok {
+		return res, err
 	}
-	return r.db.ExecContext(ctx, query, args...)
+	res, _, err := r.exec(ctx, query, args...)
+	return res, err
+}
+
+// exec is ExecContext that also reports how long the statement itself ran
+func (r *RateLimitedDB) exec(ctx context.Context, query string, args ...any) (sql.Result, time.Duration, error) {
+	c, err := r.wait(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer c.close()
+	var res sql.Result
+	if s := r.stmtFor(c); s != nil {
+		res, err = s.stmt.ExecContext(c.ctx, args...)
+		r.stmts.release(s)
+	} else {
+		res, err = r.db.ExecContext(c.ctx, query, args...)
+	}
+	elapsed := time.Since(c.admitted)
+	if err == nil {
+		c.rows, _ = res.RowsAffected()
+	}
+	err = c.result(err)
+	c.done(err)
+	return res, elapsed, err
 }
 
 func (r *RateLimitedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	if err := r.wait(ctx); err != nil {
+	if ctx.Value(preparedKey) != nil {
+		return r.db.PrepareContext(ctx, query)
+	}
+	c, err := r.wait(ctx, query)
+	if err != nil {
 		return nil, err
 	}
-	return r.db.PrepareContext(ctx, query)
+	defer c.close()
+	stmt, err := r.db.PrepareContext(c.ctx, query)
+	err = c.result(err)
+	c.done(err)
+	return stmt, err
 }
 
 func (r *RateLimitedDB) Close() error {
+	if r.policy != nil {
+		// views leave closing to the RateLimitedDB they were made from
+		return nil
+	}
+	r.closeOnce.Do(func() { close(r.stop) })
+	r.bg.Wait()
+	if r.opts.writeBuffer != nil {
+		r.dropBuffered()
+	}
+	wrapped.CompareAndDelete(r.db, r)
+	if r.stmts != nil {
+		r.stmts.close()
+	}
+	if r.events != nil {
+		r.events.close()
+	}
 	return r.db.Close()
 }
 
@@ -64,9 +633,26 @@ func (r *RateLimitedDB) Ping() error {
 }
 
 func (r *RateLimitedDB) Conn(ctx context.Context) (*sql.Conn, error) {
+	if r.conns != nil {
+		if err := waitTokens(ctx, r.conns, 1, nil); err != nil {
+			return nil, err
+		}
+	}
 	return r.db.Conn(ctx)
 }
 
+// Limiter returns the limiter shared by all calls through r.
+func (r *RateLimitedDB) Limiter() *rate.Limiter {
+	return r.limiter
+}
+
+// Raw returns the underlying database, bypassing all limits.
+//
+// Deprecated: use RawInstrumented, which observes each call.
 func (r *RateLimitedDB) Raw() *sql.DB {
+	if r.opts.rawDisabled {
+		panic(ErrRawDisabled)
+	}
+	r.auditCall(context.Background(), AuditRaw, "", nil)
 	return r.db
 }
@@ -13,7 +13,7 @@ import (
 )
 
 // setupTestDB 创建一个测试用的 SQLite 数据库
-func setupTestDB(t *testing.T) *sql.DB {
+func setupTestDB(t testing.TB) *sql.DB {
 	// 使用唯一的内存数据库名称，避免测试间干扰
 	dbName := "file:" + t.Name() + "?mode=memory&cache=shared"
 	db, err := sql.Open("sqlite3", dbName)
@@ -0,0 +1,146 @@
+package dbratelimit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// WithMetricLabels adds constant labels to every metric written by
+// WriteMetrics, such as the database name. See GormPrometheusLabels for
+// labels joining with the GORM Prometheus plugin.
+func WithMetricLabels(labels map[string]string) Option {
+	return func(o *options) {
+		if o.metricLabels == nil {
+			o.metricLabels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			o.metricLabels[k] = v
+		}
+	}
+}
+
+// GormPrometheusLabels returns the labels the GORM Prometheus plugin puts on
+// its pool metrics for a plugin configured with DBName dbName and Labels
+// extra, so that limiter and pool metrics join on the same labels.
+func GormPrometheusLabels(dbName string, extra map[string]string) map[string]string {
+	labels := make(map[string]string, len(extra)+1)
+	for k, v := range extra {
+		labels[k] = v
+	}
+	if dbName != "" {
+		labels["db"] = dbName
+	}
+	return labels
+}
+
+// WriteMetrics writes the current statistics to w in the Prometheus text
+// format, under the dbratelimit_ prefix.
+func (r *RateLimitedDB) WriteMetrics(w io.Writer) error {
+	s := r.Stats()
+	bw := bufio.NewWriter(w)
+	m := metricWriter{w: bw, labels: r.opts.metricLabels}
+
+	tags := make([]string, 0, len(s.Tags))
+	for tag := range s.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	counters := []struct {
+		name, help string
+		value      func(Counters) float64
+	}{
+		{"calls_total", "Calls admitted to the database.", func(c Counters) float64 { return float64(c.Calls) }},
+		{"throttled_total", "Admitted calls that waited for tokens.", func(c Counters) float64 { return float64(c.Throttled) }},
+		{"rejected_total", "Calls that failed admission.", func(c Counters) float64 { return float64(c.Rejected) }},
+		{"errors_total", "Admitted calls that returned an error.", func(c Counters) float64 { return float64(c.Errors) }},
+		{"wait_seconds_total", "Time spent waiting for admission.", func(c Counters) float64 { return c.WaitTime.Seconds() }},
+		{"exec_seconds_total", "Time spent in the database.", func(c Counters) float64 { return c.ExecTime.Seconds() }},
+	}
+	for _, c := range counters {
+		m.header(c.name, "counter", c.help)
+		m.sample(c.name, "", c.value(s.Counters))
+		for _, tag := range tags {
+			m.sample(c.name, tag, c.value(s.Tags[tag]))
+		}
+	}
+
+	m.header("literal_queries_total", "counter", "Statements with interpolated literals, see WithPlaceholderCheck.")
+	m.sample("literal_queries_total", "", float64(r.LiteralQueries()))
+
+	m.header("waiting", "gauge", "Calls currently waiting for admission.")
+	m.sample("waiting", "", float64(s.Waiting))
+	m.header("in_flight", "gauge", "Calls waiting or running in the database.")
+	m.sample("in_flight", "", float64(s.InFlight))
+	m.header("tokens", "gauge", "Tokens available in the main limiter.")
+	m.sample("tokens", "", r.limiter.Tokens())
+	m.header("limit", "gauge", "Rate of the main limiter, in tokens per second.")
+	m.sample("limit", "", float64(r.limiter.Limit()))
+
+	if m.err != nil {
+		return m.err
+	}
+	return bw.Flush()
+}
+
+// MetricsHandler serves WriteMetrics over HTTP, for scraping.
+func (r *RateLimitedDB) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteMetrics(w)
+	})
+}
+
+type metricWriter struct {
+	w      *bufio.Writer
+	labels map[string]string
+	err    error
+}
+
+func (m *metricWriter) header(name, kind, help string) {
+	m.printf("# HELP dbratelimit_%s %s\n# TYPE dbratelimit_%s %s\n", name, help, name, kind)
+}
+
+func (m *metricWriter) sample(name, tag string, v float64) {
+	labels := make(map[string]string, len(m.labels)+1)
+	for k, v := range m.labels {
+		labels[k] = v
+	}
+	if tag != "" {
+		labels["tag"] = tag
+	}
+	m.printf("dbratelimit_%s%s %g\n", name, formatLabels(labels), v)
+}
+
+func (m *metricWriter) printf(format string, args ...any) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders labels sorted by name, as {a="1",b="2"}
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", k, labelEscaper.Replace(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
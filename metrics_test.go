@@ -0,0 +1,42 @@
+package dbratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestWriteMetrics 测试 Prometheus 文本格式输出与常量 label
+func TestWriteMetrics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(10), 5,
+		WithMetricLabels(GormPrometheusLabels("orders", map[string]string{"instance": "a\"1"})))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	rateLimitedDB.ExecContext(ctx, "SELECT 1")
+	rateLimitedDB.ExecContext(WithTag(ctx, "report"), "SELECT 1")
+
+	rec := httptest.NewRecorder()
+	rateLimitedDB.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE dbratelimit_calls_total counter\n",
+		`dbratelimit_calls_total{db="orders",instance="a\"1"} 2` + "\n",
+		`dbratelimit_calls_total{db="orders",instance="a\"1",tag="report"} 1` + "\n",
+		`dbratelimit_waiting{db="orders",instance="a\"1"} 0` + "\n",
+		`dbratelimit_limit{db="orders",instance="a\"1"} 10` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %q in:\n%s", want, out)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+}
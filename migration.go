@@ -0,0 +1,100 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// WithMigrationLimit gives DDL statements, and calls made with a context
+// marked by WithMigration, a limiter of their own. They neither consume nor
+// wait for the main, key, tag or concurrency budgets, so a burst of
+// AutoMigrate statements cannot starve the application or be rejected by
+// it. See GormMigration for marking GORM sessions.
+func WithMigrationLimit(limit rate.Limit, burst int) Option {
+	return func(o *options) {
+		o.migration = &LimitConfig{Limit: limit, Burst: burst}
+	}
+}
+
+// isMigration reports whether the call uses the migration limiter
+func (r *RateLimitedDB) isMigration(ctx context.Context, verb Verb) bool {
+	return r.migration != nil && (verb == VerbDDL || IsMigration(ctx))
+}
+
+// MigrationConfig tunes MigrationModeWith. Zero fields use the defaults
+// listed below.
+type MigrationConfig struct {
+	// DMLLimit and DMLBurst bound INSERT/UPDATE/DELETE statements, which in
+	// a migration are usually backfills. Defaults: 5 per second, burst 1.
+	DMLLimit rate.Limit
+	DMLBurst int
+	// StatementTimeout bounds each statement. Default 30s.
+	StatementTimeout time.Duration
+	// OnProgress is called after each DDL or DML statement.
+	OnProgress func(MigrationProgress)
+}
+
+// MigrationProgress is reported after each migration statement.
+type MigrationProgress struct {
+	Verb       Verb
+	Query      string
+	Statements int64 // DDL and DML statements executed so far
+	Rows       int64 // rows affected by DML so far, when known
+	Elapsed    time.Duration
+	Err        error
+}
+
+// MigrationMode is MigrationModeWith using the defaults.
+func MigrationMode() Option {
+	return MigrationModeWith(MigrationConfig{})
+}
+
+// MigrationModeWith bundles the options for online schema migrations and
+// large backfills: DDL is exempt from limiting, DML gets its own low limit,
+// every statement has a timeout and progress is reported through
+// c.OnProgress.
+func MigrationModeWith(c MigrationConfig) Option {
+	if c.DMLLimit <= 0 {
+		c.DMLLimit = 5
+	}
+	if c.DMLBurst <= 0 {
+		c.DMLBurst = 1
+	}
+	if c.StatementTimeout <= 0 {
+		c.StatementTimeout = 30 * time.Second
+	}
+	exempt := WithExemptVerbs(VerbDDL)
+	dml := WithVerbLimit(c.DMLLimit, c.DMLBurst, VerbInsert, VerbUpdate, VerbDelete)
+	timeout := WithStatementTimeout(c.StatementTimeout)
+
+	return func(o *options) {
+		exempt(o)
+		dml(o)
+		timeout(o)
+		if c.OnProgress == nil {
+			return
+		}
+		var statements, rows int64
+		start := time.Now()
+		o.observers = append(o.observers, func(_ context.Context, info QueryInfo) {
+			if info.Verb != VerbDDL && !info.Verb.IsWrite() {
+				return
+			}
+			n := atomic.LoadInt64(&rows)
+			if info.Verb.IsWrite() {
+				n = atomic.AddInt64(&rows, info.Rows)
+			}
+			c.OnProgress(MigrationProgress{
+				Verb:       info.Verb,
+				Query:      info.Query,
+				Statements: atomic.AddInt64(&statements, 1),
+				Rows:       n,
+				Elapsed:    time.Since(start),
+				Err:        info.Err,
+			})
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// TestMigrationMode 测试迁移模式：DDL 豁免、DML 低速、进度事件
+func TestMigrationMode(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var progress []MigrationProgress
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, MigrationModeWith(MigrationConfig{
+		DMLLimit:   rate.Limit(0.01),
+		DMLBurst:   2,
+		OnProgress: func(p MigrationProgress) { progress = append(progress, p) },
+	}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	steps := []string{
+		"ALTER TABLE users ADD COLUMN age INTEGER",
+		"UPDATE users SET age = 1",
+		"CREATE INDEX idx_users_age ON users (age)",
+		"INSERT INTO users (name, email, age) VALUES ('Bob', 'bob@example.com', 2)",
+	}
+	for _, q := range steps {
+		if _, err := rateLimitedDB.ExecContext(ctx, q); err != nil {
+			t.Fatalf("%s failed: %v", q, err)
+		}
+	}
+
+	// DML 预算已用完，DDL 仍可执行
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "DELETE FROM users WHERE age = 2"); err == nil {
+		t.Error("Expected backfill DML to be throttled")
+	}
+	if _, err := rateLimitedDB.ExecContext(short, "DROP INDEX idx_users_age"); err != nil {
+		t.Errorf("DDL should be exempt: %v", err)
+	}
+
+	// 被限流的 DELETE 也会带着错误上报
+	if len(progress) != 6 {
+		t.Fatalf("Expected 6 progress events, got %d", len(progress))
+	}
+	if progress[4].Err == nil || progress[4].Verb != VerbDelete {
+		t.Errorf("Expected throttled delete to report an error: %+v", progress[4])
+	}
+	last := progress[len(progress)-1]
+	if last.Statements != 6 || last.Rows != 2 || last.Verb != VerbDDL {
+		t.Errorf("Unexpected final progress: %+v", last)
+	}
+}
+
+// TestMigrationLimit 测试 DDL 与迁移调用走独立的限流器
+func TestMigrationLimit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 5, WithMigrationLimit(rate.Inf, 1))
+	defer rateLimitedDB.Close()
+
+	gormDB, err := gorm.Open(sqlite.Dialector{Conn: rateLimitedDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to initialize GORM: %v", err)
+	}
+	if err := gormDB.Use(GormPlugin{}); err != nil {
+		t.Fatalf("Failed to register plugin: %v", err)
+	}
+	// 耗尽主限流器
+	takeN(rateLimitedDB.Limiter(), 5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(ctx, "CREATE TABLE m (id INTEGER)"); err != nil {
+		t.Errorf("Expected DDL to use the migration limiter, got %v", err)
+	}
+	if _, err := rateLimitedDB.ExecContext(WithMigration(ctx), "INSERT INTO m VALUES (1)"); err != nil {
+		t.Errorf("Expected migration call to use the migration limiter, got %v", err)
+	}
+
+	// GORM 会话通过 GormMigration 标记
+	type Account struct {
+		ID   uint
+		Name string
+	}
+	if err := gormDB.WithContext(ctx).Set(GormMigration, true).AutoMigrate(&Account{}); err != nil {
+		t.Errorf("Expected AutoMigrate to use the migration limiter, got %v", err)
+	}
+
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err == nil {
+		t.Error("Expected regular call to be limited")
+	}
+}
@@ -0,0 +1,169 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// BindStyle is the placeholder syntax BindNamed rewrites :name parameters
+// to.
+type BindStyle int
+
+const (
+	// BindQuestion uses ?, for MySQL and SQLite.
+	BindQuestion BindStyle = iota
+	// BindDollar uses $1, $2 and so on, for PostgreSQL.
+	BindDollar
+)
+
+// WithBindStyle sets the placeholder syntax used by NamedExecContext and
+// NamedQueryContext. Default BindQuestion.
+func WithBindStyle(s BindStyle) Option {
+	return func(o *options) {
+		o.bindStyle = s
+	}
+}
+
+// BindNamed rewrites the :name parameters in query to positional
+// placeholders of the given style and returns the matching arguments, as
+// sqlx named queries do. arg is a map[string]any or a struct, or a pointer
+// to one, whose fields are matched by their db tag or else by their
+// lowercased name. Parameters in quotes and comments are left alone, as are
+// PostgreSQL casts such as ::text.
+func BindNamed(style BindStyle, query string, arg any) (string, []any, error) {
+	lookup, err := namedLookup(arg)
+	if err != nil {
+		return "", nil, err
+	}
+	var b strings.Builder
+	b.Grow(len(query))
+	var args []any
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := skipQuoted(query, i)
+			b.WriteString(query[i:j])
+			i = j
+		case strings.HasPrefix(query[i:], "--"), strings.HasPrefix(query[i:], "/*"):
+			end := "\n"
+			if c == '/' {
+				end = "*/"
+			}
+			j := len(query)
+			if k := strings.Index(query[i+2:], end); k >= 0 {
+				j = i + 2 + k + len(end)
+			}
+			b.WriteString(query[i:j])
+			i = j
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			b.WriteString("::")
+			i += 2
+		case c == ':' && i+1 < len(query) && isWordByte(query[i+1]) && (i == 0 || !isWordByte(query[i-1])):
+			j := i + 1
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			v, ok := lookup(name)
+			if !ok {
+				return "", nil, fmt.Errorf("dbratelimit: no value for :%s", name)
+			}
+			args = append(args, v)
+			b.WriteString(bindVar(style, len(args)))
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), args, nil
+}
+
+// bindVar returns the n-th placeholder, counting from 1, in style
+func bindVar(style BindStyle, n int) string {
+	if style == BindDollar {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// namedLookup returns a function finding the value of a named parameter in
+// arg
+func namedLookup(arg any) (func(string) (any, bool), error) {
+	if m, ok := arg.(map[string]any); ok {
+		return func(name string) (any, bool) {
+			v, ok := m[name]
+			return v, ok
+		}, nil
+	}
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dbratelimit: named arguments must be a map[string]any or a struct, not %T", arg)
+	}
+	fields := make(map[string]any)
+	collectFields(v, fields)
+	return func(name string) (any, bool) {
+		v, ok := fields[name]
+		return v, ok
+	}, nil
+}
+
+// collectFields adds the exported fields of the struct v to fields by
+// parameter name, then those of embedded structs, which fields of v shadow
+func collectFields(v reflect.Value, fields map[string]any) {
+	t := v.Type()
+	var embedded []reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("db")
+		switch {
+		case name == "-":
+			continue
+		case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+			embedded = append(embedded, v.Field(i))
+			continue
+		case !f.IsExported():
+			continue
+		case name == "":
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = v.Field(i).Interface()
+	}
+	for _, e := range embedded {
+		inner := make(map[string]any)
+		collectFields(e, inner)
+		for name, value := range inner {
+			if _, ok := fields[name]; !ok {
+				fields[name] = value
+			}
+		}
+	}
+}
+
+// NamedExecContext is ExecContext for a query with :name parameters bound
+// from arg, see BindNamed and WithBindStyle.
+func (r *RateLimitedDB) NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error) {
+	q, args, err := BindNamed(r.opts.bindStyle, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return r.ExecContext(ctx, q, args...)
+}
+
+// NamedQueryContext is QueryContext for a query with :name parameters bound
+// from arg, see BindNamed and WithBindStyle.
+func (r *RateLimitedDB) NamedQueryContext(ctx context.Context, query string, arg any) (*sql.Rows, error) {
+	q, args, err := BindNamed(r.opts.bindStyle, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return r.QueryContext(ctx, q, args...)
+}
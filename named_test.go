@@ -0,0 +1,87 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestBindNamed 测试 :name 参数改写、占位符风格以及引号、注释和类型转换的跳过
+func TestBindNamed(t *testing.T) {
+	type base struct {
+		ID int `db:"id"`
+	}
+	type user struct {
+		base
+		Name   string
+		Email  string `db:"mail"`
+		Secret string `db:"-"`
+	}
+	args := map[string]any{"id": 1, "name": "Bob"}
+	tests := []struct {
+		style BindStyle
+		query string
+		arg   any
+		want  string
+		args  []any
+	}{
+		{BindQuestion, "UPDATE users SET name = :name WHERE id = :id", args, "UPDATE users SET name = ? WHERE id = ?", []any{"Bob", 1}},
+		{BindDollar, "SELECT * FROM users WHERE id = :id OR id = :id", args, "SELECT * FROM users WHERE id = $1 OR id = $2", []any{1, 1}},
+		{BindQuestion, "SELECT ':id', id::text, '12:30' -- :name\nFROM t WHERE x = :id /* :name */", args, "SELECT ':id', id::text, '12:30' -- :name\nFROM t WHERE x = ? /* :name */", []any{1}},
+		{BindQuestion, "INSERT INTO users (id, name, email) VALUES (:id, :name, :mail)", &user{base{7}, "Carol", "c@example.com", "x"}, "INSERT INTO users (id, name, email) VALUES (?, ?, ?)", []any{7, "Carol", "c@example.com"}},
+	}
+	for _, tt := range tests {
+		got, gotArgs, err := BindNamed(tt.style, tt.query, tt.arg)
+		if err != nil {
+			t.Errorf("BindNamed(%q) failed: %v", tt.query, err)
+			continue
+		}
+		if got != tt.want || !reflect.DeepEqual(gotArgs, tt.args) {
+			t.Errorf("BindNamed(%q) = %q, %v, want %q, %v", tt.query, got, gotArgs, tt.want, tt.args)
+		}
+	}
+
+	if _, _, err := BindNamed(BindQuestion, "SELECT :secret", user{}); err == nil {
+		t.Error("BindNamed with a field tagged db:\"-\" succeeded")
+	}
+	if _, _, err := BindNamed(BindQuestion, "SELECT :id", 42); err == nil {
+		t.Error("BindNamed with a non-struct argument succeeded")
+	}
+}
+
+// TestNamedExecContext 测试命名参数查询以及 sql.Named 参数经过限流包装后正常执行
+func TestNamedExecContext(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.NamedExecContext(ctx, "INSERT INTO users (name, email) VALUES (:name, :email)",
+		map[string]any{"name": "Bob", "email": "bob@example.com"}); err != nil {
+		t.Fatalf("NamedExecContext failed: %v", err)
+	}
+
+	rows, err := rateLimitedDB.NamedQueryContext(ctx, "SELECT email FROM users WHERE name = :name", map[string]any{"name": "Bob"})
+	if err != nil {
+		t.Fatalf("NamedQueryContext failed: %v", err)
+	}
+	var email string
+	if !rows.Next() || rows.Scan(&email) != nil || email != "bob@example.com" {
+		t.Errorf("NamedQueryContext returned %q, want bob@example.com", email)
+	}
+	rows.Close()
+
+	var name string
+	if err := rateLimitedDB.QueryRowContext(ctx, "SELECT name FROM users WHERE email = :email", sql.Named("email", "bob@example.com")).Scan(&name); err != nil || name != "Bob" {
+		t.Errorf("query with sql.Named = %q, %v, want Bob", name, err)
+	}
+
+	if n := rateLimitedDB.Stats().Calls; n != 3 {
+		t.Errorf("Calls = %d, want 3", n)
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package dbratelimit
+
+const raceEnabled = false
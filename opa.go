@@ -0,0 +1,163 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OPAPolicy is an AdmissionPolicy evaluated by an Open Policy Agent server
+// through its data API, so that database admission rules live in the same
+// Rego bundles as the rest of the infrastructure's policy. Each call posts
+//
+//	{"input": {"query": ..., "fingerprint": ..., "verb": "select",
+//	           "priority": "normal", "cost": 0, "tag": ..., "key": ...}}
+//
+// to URL/v1/data/Path and reads a result of the form
+//
+//	{"deny": bool, "reason": string, "cost": int, "priority": "low", "bypass": bool}
+//
+// where every field is optional and an undefined result admits the call
+// unchanged. The input carries the fingerprint so that rules can match
+// statements without regular expressions over the raw query.
+type OPAPolicy struct {
+	URL    string // of the OPA server, e.g. "http://localhost:8181"
+	Path   string // of the decision, e.g. "dbratelimit/admission"
+	Client *http.Client
+	// Timeout bounds each evaluation, which otherwise adds to the latency
+	// of every call. Default 50ms.
+	Timeout time.Duration
+	// CacheTTL keeps decisions for calls with the same fingerprint, verb
+	// and policy for this long, sparing the round trip for repeated
+	// statements. 0 evaluates every call.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[opaInput]opaCached
+}
+
+type opaInput struct {
+	Query       string `json:"query"`
+	Fingerprint string `json:"fingerprint"`
+	Verb        string `json:"verb"`
+	Priority    string `json:"priority"`
+	Cost        int    `json:"cost"`
+	Tag         string `json:"tag"`
+	Key         string `json:"key"`
+}
+
+type opaResult struct {
+	Deny     bool   `json:"deny"`
+	Reason   string `json:"reason"`
+	Cost     int    `json:"cost"`
+	Priority string `json:"priority"`
+	Bypass   bool   `json:"bypass"`
+}
+
+type opaCached struct {
+	decision AdmissionDecision
+	expires  time.Time
+}
+
+// Admit evaluates the policy for req.
+func (o *OPAPolicy) Admit(ctx context.Context, req AdmissionRequest) (AdmissionDecision, error) {
+	in := opaInput{
+		Query:       req.Query,
+		Fingerprint: req.Fingerprint,
+		Verb:        req.Verb.String(),
+		Priority:    req.Policy.Priority.String(),
+		Cost:        req.Policy.Cost,
+		Tag:         req.Policy.Tag,
+		Key:         req.Policy.Key,
+	}
+	key := in
+	key.Query = "" // cached by fingerprint
+	if o.CacheTTL > 0 {
+		o.mu.Lock()
+		c, ok := o.cache[key]
+		o.mu.Unlock()
+		if ok && time.Now().Before(c.expires) {
+			return c.decision, nil
+		}
+	}
+
+	d, err := o.evaluate(ctx, in)
+	if err != nil {
+		return AdmissionDecision{}, err
+	}
+	if o.CacheTTL > 0 {
+		now := time.Now()
+		o.mu.Lock()
+		if o.cache == nil {
+			o.cache = make(map[opaInput]opaCached)
+		}
+		for k, c := range o.cache {
+			if now.After(c.expires) {
+				delete(o.cache, k)
+			}
+		}
+		o.cache[key] = opaCached{d, now.Add(o.CacheTTL)}
+		o.mu.Unlock()
+	}
+	return d, nil
+}
+
+func (o *OPAPolicy) evaluate(ctx context.Context, in opaInput) (AdmissionDecision, error) {
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = 50 * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(struct {
+		Input opaInput `json:"input"`
+	}{in})
+	if err != nil {
+		return AdmissionDecision{}, err
+	}
+	url := strings.TrimSuffix(o.URL, "/") + "/v1/data/" + strings.Trim(o.Path, "/")
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return AdmissionDecision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return AdmissionDecision{}, fmt.Errorf("dbratelimit: evaluating OPA policy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return AdmissionDecision{}, fmt.Errorf("dbratelimit: evaluating OPA policy: %s", resp.Status)
+	}
+	var out struct {
+		Result *opaResult `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return AdmissionDecision{}, fmt.Errorf("dbratelimit: decoding OPA decision: %w", err)
+	}
+	if out.Result == nil {
+		return AdmissionDecision{}, nil
+	}
+	res := out.Result
+	d := AdmissionDecision{Deny: res.Deny, Reason: res.Reason}
+	d.Policy.Cost = res.Cost
+	d.Policy.Exempt = res.Bypass
+	if res.Priority != "" {
+		pr, ok := parsePriority(res.Priority)
+		if !ok {
+			return AdmissionDecision{}, fmt.Errorf("dbratelimit: OPA decision has unknown priority %q", res.Priority)
+		}
+		d.Policy.Priority = pr
+	}
+	return d, nil
+}
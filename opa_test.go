@@ -0,0 +1,80 @@
+package dbratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestOPAPolicy 测试通过 OPA 数据 API 评估准入策略并缓存决策
+func TestOPAPolicy(t *testing.T) {
+	var evaluations int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&evaluations, 1)
+		if req.URL.Path != "/v1/data/dbratelimit/admission" {
+			http.NotFound(w, req)
+			return
+		}
+		var body struct {
+			Input opaInput `json:"input"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case body.Input.Verb == "delete":
+			w.Write([]byte(`{"result": {"deny": true, "reason": "deletes go through the batch job"}}`))
+		case body.Input.Tag == "report":
+			w.Write([]byte(`{"result": {"cost": 4, "priority": "low"}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	db := setupTestDB(t)
+	defer db.Close()
+	opa := &OPAPolicy{URL: srv.URL, Path: "dbratelimit/admission", CacheTTL: time.Minute}
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithAdmissionPolicy(opa))
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	if _, err := rateLimitedDB.ExecContext(ctx, "DELETE FROM users WHERE id = 1"); !errors.Is(err, ErrAdmissionDenied) {
+		t.Errorf("delete: err = %v, want ErrAdmissionDenied", err)
+	}
+
+	req := AdmissionRequest{Fingerprint: "select * from users where id = ?", Verb: VerbSelect, Policy: Policy{Tag: "report"}}
+	d, err := opa.Admit(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Deny || d.Policy.Cost != 4 || d.Policy.Priority != PriorityLow {
+		t.Errorf("decision = %+v, want cost 4 at low priority", d)
+	}
+	before := atomic.LoadInt32(&evaluations)
+	if _, err := opa.Admit(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&evaluations) - before; n != 0 {
+		t.Errorf("%d evaluations for a cached decision, want 0", n)
+	}
+
+	rows, err := rateLimitedDB.QueryContext(ctx, "SELECT name FROM users")
+	if err != nil {
+		t.Fatalf("undefined decision should admit: %v", err)
+	}
+	rows.Close()
+
+	bad := &OPAPolicy{URL: srv.URL, Path: "missing"}
+	if _, err := bad.Admit(ctx, req); err == nil {
+		t.Error("want an error for a missing decision document")
+	}
+}
@@ -0,0 +1,101 @@
+package dbratelimit
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+// LimitConfig is a rate and burst for one token bucket.
+type LimitConfig struct {
+	Limit rate.Limit
+	Burst int
+}
+
+// Option configures optional behavior of a RateLimitedDB.
+type Option func(*options)
+
+type options struct {
+	costFunc    CostFunc
+	burstPolicy BurstPolicy
+	classifier  ErrorClassifier
+	hooks       Hooks
+	keyed       *LimitConfig
+	borrow      *BorrowPolicy
+
+	reservations map[string]LimitConfig
+	tagLimits    map[string]LimitConfig
+	calibration  *Calibration
+	migration    *LimitConfig
+
+	maxConcurrency int64
+
+	exemptVerbs      map[Verb]bool
+	verbLimits       map[Verb]*rate.Limiter
+	verbConcurrency  map[Verb]*semaphore.Weighted
+	statementTimeout time.Duration
+	waitBudget       float64
+	defaultTimeout   time.Duration
+	maxRows          int64
+	resultSetCost    int
+	observers        []func(context.Context, QueryInfo) // internal AfterQuery listeners
+	idle             *IdlePolicy
+
+	backend       Backend
+	backendBucket string
+	fallback      *BackendFallback
+	region        *RegionalBudget
+	adaptive      *AdaptiveConfig
+
+	overflow         OverflowPolicy
+	tagOverflow      map[string]OverflowPolicy
+	priorityOverflow map[Priority]OverflowPolicy
+	queue            Queue
+	events           *EventConfig
+	audit            AuditSink
+	rawDisabled      bool
+	connLimit        *LimitConfig
+	metricLabels     map[string]string
+	roles            *roleConfig
+	profiles         *profileConfig
+	flags            func() Config
+	flagInterval     time.Duration
+	ramp             time.Duration
+	queueSLO         time.Duration
+	placeholderCheck int // minimum literals, 0 if disabled
+	freezeMode       FreezeMode
+	writeBuffer      *WriteBuffer
+	quotas           []Quota
+	idleBurst        *IdleBurst
+	bindStyle        BindStyle
+	procedures       map[string]Procedure
+	txPolicies       map[txKey]*txPolicy
+	txRetry          TxRetry
+	usage            bool
+	budgetAlerts     *BudgetAlerts
+	startupProbe     *StartupProbe
+	stmtCache        int
+	doubleWrap       DoubleWrapPolicy
+	limitPerConn     rate.Limit
+	directives       bool
+	directiveBypass  bool
+	admission        AdmissionPolicy
+	debugPage        *DebugPage
+	diagnostics      *DiagnosticsDump
+	tokenAudit       bool
+	tokenAuditStrict bool
+	rand             *lockedRand
+	callerFairness   bool
+	callerID         func(context.Context) string
+	latencyAlerts    *LatencyAlerts
+	stackSampling    *StackSampling
+}
+
+func defaultOptions() options {
+	return options{
+		burstPolicy: BurstPolicyError,
+		classifier:  DefaultClassifier,
+	}
+}
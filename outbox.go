@@ -0,0 +1,135 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OutboxMessage is a message stored in an outbox table.
+type OutboxMessage struct {
+	ID      int64 // assigned by the database, in insertion order
+	Topic   string
+	Payload []byte
+}
+
+// Outbox configures a transactional outbox: messages are inserted in the
+// same transaction as the change they announce, so that neither is saved
+// without the other, and a drain loop publishes and deletes them. The
+// table needs an ordered, database-assigned id and topic and payload
+// columns:
+//
+//	CREATE TABLE outbox (id BIGSERIAL PRIMARY KEY, topic TEXT NOT NULL, payload BYTEA)
+//
+// Placeholders follow WithBindStyle.
+type Outbox struct {
+	// Table is the outbox table. Default "outbox".
+	Table string
+	// Batch is how many messages Drain reads at a time. Default 100.
+	Batch int
+	// Interval is how long Drain waits when the outbox is empty or Publish
+	// failed. Default 1s.
+	Interval time.Duration
+	// Publish delivers a message, e.g. to a broker. A message is deleted
+	// once it is published; if Publish fails it stays and is retried
+	// after Interval, so delivery is at least once.
+	Publish func(ctx context.Context, m OutboxMessage) error
+}
+
+func (o Outbox) withDefaults() Outbox {
+	if o.Table == "" {
+		o.Table = "outbox"
+	}
+	if o.Batch <= 0 {
+		o.Batch = 100
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Second
+	}
+	return o
+}
+
+// WriteWithOutbox runs fn and inserts msgs into the outbox table in one
+// transaction, see RunInTx. Each insert is admitted like any other
+// statement.
+func (r *RateLimitedDB) WriteWithOutbox(ctx context.Context, o Outbox, fn func(*Tx) error, msgs ...OutboxMessage) error {
+	o = o.withDefaults()
+	query := fmt.Sprintf("INSERT INTO %s (topic, payload) VALUES (%s, %s)",
+		o.Table, bindVar(r.opts.bindStyle, 1), bindVar(r.opts.bindStyle, 2))
+	return r.RunInTx(ctx, func(tx *Tx) error {
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		for _, m := range msgs {
+			if _, err := tx.ExecContext(ctx, query, m.Topic, m.Payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// DrainOutbox publishes the messages in the outbox table in order and
+// deletes them, until ctx is done, and then returns ctx.Err(). Reads and
+// deletes go through the limiter, so the loop is paced like any other
+// caller; give ctx a low priority or a tag of its own to keep it behind
+// interactive traffic.
+func (r *RateLimitedDB) DrainOutbox(ctx context.Context, o Outbox) error {
+	if o.Publish == nil {
+		return errors.New("dbratelimit: outbox drain needs Publish")
+	}
+	o = o.withDefaults()
+	for {
+		n, err := r.drainOutbox(ctx, o)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil && n == o.Batch {
+			continue // more waiting
+		}
+		t := time.NewTimer(o.Interval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// drainOutbox publishes and deletes one batch, returning how many messages
+// it read
+func (r *RateLimitedDB) drainOutbox(ctx context.Context, o Outbox) (int, error) {
+	rows, err := r.QueryContext(ctx, fmt.Sprintf("SELECT id, topic, payload FROM %s ORDER BY id LIMIT %d", o.Table, o.Batch))
+	if err != nil {
+		return 0, err
+	}
+	var batch []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	del := fmt.Sprintf("DELETE FROM %s WHERE id = %s", o.Table, bindVar(r.opts.bindStyle, 1))
+	for _, m := range batch {
+		// stop at the first failure to keep messages in order
+		if err := o.Publish(ctx, m); err != nil {
+			return len(batch), err
+		}
+		if _, err := r.ExecContext(ctx, del, m.ID); err != nil {
+			return len(batch), err
+		}
+	}
+	return len(batch), nil
+}
@@ -0,0 +1,88 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestOutbox 测试业务写入与消息写入处于同一事务，以及按顺序发布并删除消息的排空循环
+func TestOutbox(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE outbox (id INTEGER PRIMARY KEY AUTOINCREMENT, topic TEXT NOT NULL, payload BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	count := func(table string) int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	insertUser := func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", "Bob", "bob@example.com")
+		return err
+	}
+
+	var published []OutboxMessage
+	failures := 1
+	o := Outbox{Batch: 2, Interval: 10 * time.Millisecond, Publish: func(_ context.Context, m OutboxMessage) error {
+		if failures > 0 {
+			failures--
+			return errors.New("broker unavailable")
+		}
+		published = append(published, m)
+		return nil
+	}}
+
+	err := rateLimitedDB.WriteWithOutbox(ctx, o, insertUser,
+		OutboxMessage{Topic: "user.created", Payload: []byte("1")},
+		OutboxMessage{Topic: "user.created", Payload: []byte("2")},
+		OutboxMessage{Topic: "user.created", Payload: []byte("3")})
+	if err != nil {
+		t.Fatalf("WriteWithOutbox failed: %v", err)
+	}
+	if count("users") != 2 || count("outbox") != 3 {
+		t.Fatalf("got %d users and %d messages, want 2 and 3", count("users"), count("outbox"))
+	}
+
+	// 业务写入失败时消息也不写入
+	failed := errors.New("validation failed")
+	if err := rateLimitedDB.WriteWithOutbox(ctx, o, func(*Tx) error { return failed },
+		OutboxMessage{Topic: "user.created"}); !errors.Is(err, failed) {
+		t.Errorf("WriteWithOutbox = %v, want %v", err, failed)
+	}
+	if n := count("outbox"); n != 3 {
+		t.Errorf("%d messages after a failed write, want 3", n)
+	}
+
+	drainCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- rateLimitedDB.DrainOutbox(drainCtx, o) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for count("outbox") > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("DrainOutbox = %v, want context.Canceled", err)
+	}
+
+	if len(published) != 3 {
+		t.Fatalf("published %d messages, want 3", len(published))
+	}
+	for i, m := range published {
+		if string(m.Payload) != string(rune('1'+i)) {
+			t.Errorf("message %d has payload %q, out of order", i, m.Payload)
+		}
+	}
+}
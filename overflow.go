@@ -0,0 +1,79 @@
+package dbratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// ErrRejected is returned when an overflow policy turns a call away instead
+// of queueing it.
+var ErrRejected error = newError(CodeRejected, "dbratelimit: call rejected by overflow policy")
+
+// OverflowMode is what a call does when no tokens are available.
+type OverflowMode int
+
+const (
+	// OverflowQueue waits for tokens, for at most MaxWait if set.
+	OverflowQueue OverflowMode = iota
+	// OverflowReject fails immediately with ErrRejected.
+	OverflowReject
+	// OverflowShedOldest queues like OverflowQueue, but once MaxQueue calls
+	// with the same policy are waiting the oldest of them is rejected to
+	// make room.
+	OverflowShedOldest
+)
+
+// OverflowPolicy configures OverflowMode for a class of calls.
+type OverflowPolicy struct {
+	Mode OverflowMode
+	// MaxWait rejects calls that would have to wait longer than this.
+	// Zero means no bound besides the context deadline.
+	MaxWait time.Duration
+	// MaxQueue is the number of waiting calls kept by OverflowShedOldest.
+	MaxQueue int
+}
+
+// WithOverflowPolicy sets the policy for calls without a more specific one.
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(o *options) {
+		o.overflow = p
+	}
+}
+
+// WithTagOverflow sets the policy for calls tagged tag. Tag policies take
+// precedence over priority policies.
+func WithTagOverflow(tag string, p OverflowPolicy) Option {
+	return func(o *options) {
+		if o.tagOverflow == nil {
+			o.tagOverflow = make(map[string]OverflowPolicy)
+		}
+		o.tagOverflow[tag] = p
+	}
+}
+
+// WithPriorityOverflow sets the policy for calls of priority prio, e.g.
+// queue interactive traffic briefly and reject low-priority batch traffic.
+func WithPriorityOverflow(prio Priority, p OverflowPolicy) Option {
+	return func(o *options) {
+		if o.priorityOverflow == nil {
+			o.priorityOverflow = make(map[Priority]OverflowPolicy)
+		}
+		o.priorityOverflow[prio] = p
+	}
+}
+
+// overflowFor returns the policy for a call and a class name identifying
+// where it came from, so shedding only affects calls with the same policy
+func (r *RateLimitedDB) overflowFor(ctx context.Context) (OverflowPolicy, string) {
+	if tag := TagFrom(ctx); tag != "" {
+		if p, ok := r.opts.tagOverflow[tag]; ok {
+			return p, "tag:" + tag
+		}
+	}
+	prio := PriorityFrom(ctx)
+	if p, ok := r.opts.priorityOverflow[prio]; ok {
+		return p, "priority:" + strconv.Itoa(int(prio))
+	}
+	return r.opts.overflow, ""
+}
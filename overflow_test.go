@@ -0,0 +1,98 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestOverflowReject 测试 reject 策略立即拒绝，且不消耗 token
+func TestOverflowReject(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1,
+		WithPriorityOverflow(PriorityLow, OverflowPolicy{Mode: OverflowReject}),
+		WithTagOverflow("interactive", OverflowPolicy{Mode: OverflowQueue, MaxWait: 5 * time.Second}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+
+	batch := WithPriority(ctx, PriorityLow)
+	start := time.Now()
+	if _, err := rateLimitedDB.ExecContext(batch, "SELECT 1"); !errors.Is(err, ErrRejected) {
+		t.Fatalf("Expected ErrRejected for low priority, got %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("Reject should not wait")
+	}
+
+	// tag 策略优先于优先级策略：短暂排队后执行
+	if _, err := rateLimitedDB.ExecContext(WithTag(batch, "interactive"), "SELECT 1"); err != nil {
+		t.Errorf("Expected interactive call to queue, got %v", err)
+	}
+}
+
+// TestOverflowMaxWait 测试预计等待超过 MaxWait 时拒绝
+func TestOverflowMaxWait(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1,
+		WithOverflowPolicy(OverflowPolicy{Mode: OverflowQueue, MaxWait: time.Second}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected ErrRejected when wait exceeds MaxWait, got %v", err)
+	}
+	// 被拒绝的调用归还了预留的 token
+	if tokens := rateLimitedDB.Limiter().Tokens(); tokens < -0.01 {
+		t.Errorf("Rejected call leaked a reservation: %v tokens", tokens)
+	}
+}
+
+// TestOverflowShedOldest 测试队列满时最早的等待者被拒绝
+func TestOverflowShedOldest(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.5), 1,
+		WithTagOverflow("batch", OverflowPolicy{Mode: OverflowShedOldest, MaxQueue: 1}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	batch := WithTag(ctx, "batch")
+	if _, err := rateLimitedDB.ExecContext(batch, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+
+	oldest := make(chan error, 1)
+	go func() {
+		_, err := rateLimitedDB.ExecContext(batch, "SELECT 1")
+		oldest <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	newer, cancel := context.WithCancel(batch)
+	defer cancel()
+	go func() { _, _ = rateLimitedDB.ExecContext(newer, "SELECT 1") }()
+
+	select {
+	case err := <-oldest:
+		if !errors.Is(err, ErrRejected) {
+			t.Errorf("Expected oldest waiter to be shed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Oldest waiter was not shed")
+	}
+}
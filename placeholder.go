@@ -0,0 +1,47 @@
+package dbratelimit
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithPlaceholderCheck flags executed statements that use no placeholders
+// but contain at least minLiterals literal values, a sign that values are
+// interpolated into the SQL. Such statements defeat prepared statement
+// reuse and risk SQL injection. Flagged statements are counted by
+// LiteralQueries, exported as dbratelimit_literal_queries_total and sent
+// to the event stream as EventLiteralQuery. minLiterals below 1 means 1.
+// LIMIT and OFFSET counts are not treated as literals.
+func WithPlaceholderCheck(minLiterals int) Option {
+	return func(o *options) {
+		o.placeholderCheck = max(minLiterals, 1)
+	}
+}
+
+// LiteralQueries returns the number of statements flagged by
+// WithPlaceholderCheck.
+func (r *RateLimitedDB) LiteralQueries() uint64 {
+	return atomic.LoadUint64(&r.literalQueries)
+}
+
+// checkPlaceholders flags c's query if it interpolates literals
+func (c *call) checkPlaceholders(now time.Time) {
+	minLiterals := c.r.opts.placeholderCheck
+	if minLiterals == 0 || !c.executed {
+		return
+	}
+	fp, info := fingerprint(c.query)
+	if info.placeholders > 0 || info.literals < minLiterals {
+		return
+	}
+	atomic.AddUint64(&c.r.literalQueries, 1)
+	if s := c.r.events; s != nil && s.sample(now) {
+		s.send(Event{
+			Kind:        EventLiteralQuery,
+			Time:        now,
+			Tag:         TagFrom(c.ctx),
+			Priority:    PriorityFrom(c.ctx),
+			Fingerprint: fp,
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestFingerprintInfo 测试指纹计算时统计字面量与占位符
+func TestFingerprintInfo(t *testing.T) {
+	cases := []struct {
+		query        string
+		literals     int
+		placeholders int
+	}{
+		{"SELECT * FROM users WHERE id = 42", 1, 0},
+		{"SELECT * FROM users WHERE name = 'bob' AND age > -3", 2, 0},
+		{"SELECT * FROM users WHERE id = ? LIMIT 10 OFFSET 20", 0, 1},
+		{"INSERT INTO t (a, b) VALUES ($1, $2)", 0, 2},
+		{"SELECT 1", 1, 0},
+	}
+	for _, c := range cases {
+		_, info := fingerprint(c.query)
+		if info.literals != c.literals || info.placeholders != c.placeholders {
+			t.Errorf("fingerprint(%q) = %+v, want %d literals and %d placeholders",
+				c.query, info, c.literals, c.placeholders)
+		}
+	}
+}
+
+// TestPlaceholderCheck 测试未使用占位符的语句被计数并发出事件
+func TestPlaceholderCheck(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithPlaceholderCheck(2), WithEvents(EventConfig{}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	queries := []string{
+		"SELECT * FROM users WHERE name = 'Alice' AND email = 'alice@example.com'",
+		"SELECT * FROM users WHERE name = ? AND id = 1",
+		"SELECT * FROM users WHERE id = 1",
+	}
+	for _, q := range queries {
+		rows, err := rateLimitedDB.QueryContext(ctx, q, "Alice")
+		if err == nil {
+			rows.Close()
+		}
+	}
+	if got := rateLimitedDB.LiteralQueries(); got != 1 {
+		t.Errorf("Expected 1 flagged statement, got %d", got)
+	}
+
+	var found bool
+	for len(rateLimitedDB.Events()) > 0 {
+		if e := <-rateLimitedDB.Events(); e.Kind == EventLiteralQuery {
+			found = e.Fingerprint == "select * from users where name = ? and email = ?"
+		}
+	}
+	if !found {
+		t.Error("Expected a literal query event")
+	}
+}
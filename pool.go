@@ -0,0 +1,67 @@
+package dbratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// poolInterval is how often WithLimitPerConn checks the pool size
+const poolInterval = time.Second
+
+// WithLimitPerConn sets the main limit to perConn times the pool's
+// MaxOpenConns, and keeps it so as operators resize the pool at runtime:
+// through SetMaxOpenConns at once, and within a second when the *sql.DB is
+// resized directly. The limit is left alone while the pool is unbounded.
+// Like calibration, it sets the limit without changing the baseline that
+// profiles and flag providers reset to.
+func WithLimitPerConn(perConn rate.Limit) Option {
+	return func(o *options) {
+		o.limitPerConn = perConn
+	}
+}
+
+// poolScale tracks the pool size the limit was last scaled for
+type poolScale struct {
+	mu    sync.Mutex
+	conns int
+}
+
+// SetMaxOpenConns resizes the pool of the wrapped database and, with
+// WithLimitPerConn, scales the limit with it.
+func (r *RateLimitedDB) SetMaxOpenConns(n int) {
+	r.db.SetMaxOpenConns(n)
+	r.scaleToPool()
+}
+
+// scaleToPool sets the limit for the current pool size if it changed
+func (r *RateLimitedDB) scaleToPool() {
+	if r.opts.limitPerConn <= 0 {
+		return
+	}
+	n := r.db.Stats().MaxOpenConnections
+	r.pool.mu.Lock()
+	defer r.pool.mu.Unlock()
+	if n == r.pool.conns {
+		return
+	}
+	r.pool.conns = n
+	if n > 0 {
+		r.SetLimit(r.opts.limitPerConn * rate.Limit(n))
+	}
+}
+
+// poolLoop watches the pool size until r is closed
+func (r *RateLimitedDB) poolLoop() {
+	ticker := time.NewTicker(poolInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.scaleToPool()
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package dbratelimit
+
+import (
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestLimitPerConn 测试连接池大小变化时限额按比例缩放
+func TestLimitPerConn(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1, WithLimitPerConn(4))
+	defer rateLimitedDB.Close()
+
+	if got := rateLimitedDB.Limiter().Limit(); got != 100 {
+		t.Errorf("limit = %v, want 4 per connection of 25", got)
+	}
+	rateLimitedDB.SetMaxOpenConns(10)
+	if got := rateLimitedDB.Limiter().Limit(); got != 40 {
+		t.Errorf("limit = %v, want 40 after resizing to 10", got)
+	}
+
+	db.SetMaxOpenConns(0)
+	rateLimitedDB.scaleToPool()
+	if got := rateLimitedDB.Limiter().Limit(); got != 40 {
+		t.Errorf("limit = %v, want it kept for an unbounded pool", got)
+	}
+	db.SetMaxOpenConns(5)
+	rateLimitedDB.scaleToPool()
+	if got := rateLimitedDB.Limiter().Limit(); got != 20 {
+		t.Errorf("limit = %v, want 20 once the pool is resized directly", got)
+	}
+}
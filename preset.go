@@ -0,0 +1,104 @@
+package dbratelimit
+
+import (
+	"database/sql"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Preset is a starting configuration for a class of database, to be tuned
+// from the statistics of the actual workload rather than guessed.
+type Preset struct {
+	Name    string
+	Config  Config
+	Options []Option
+}
+
+// New wraps db with the preset; opts are applied after the preset's own
+// options and take precedence over them.
+func (p Preset) New(db *sql.DB, opts ...Option) (*RateLimitedDB, error) {
+	return New(db, p.Config, append(append([]Option(nil), p.Options...), opts...)...)
+}
+
+// verbCosts prices statements by verb, 1 token for verbs left out
+func verbCosts(costs map[Verb]int) CostFunc {
+	return func(query string) int {
+		if n, ok := costs[ParseVerb(query)]; ok {
+			return n
+		}
+		return 1
+	}
+}
+
+// PresetSmallRDS suits a small managed Postgres or MySQL instance, such as
+// an RDS db.t3.medium with 2 vCPUs and around 150 connections: 200 calls
+// per second with a burst of 50, 20 statements at once, writes costing 2
+// tokens and DDL 20, calls queueing for at most 2s, connections opened at
+// 10 per second and an adaptive limit between 20 and 400 calls per second
+// that backs off on overload errors.
+func PresetSmallRDS() Preset {
+	return Preset{
+		Name: "small-rds",
+		Config: Config{
+			Limit:          200,
+			Burst:          50,
+			MaxConcurrency: 20,
+			Overflow:       OverflowPolicy{Mode: OverflowQueue, MaxWait: 2 * time.Second},
+			Adaptive:       &AdaptiveConfig{Min: 20, Max: 400},
+		},
+		Options: []Option{
+			WithCostFunc(verbCosts(map[Verb]int{
+				VerbInsert: 2,
+				VerbUpdate: 2,
+				VerbDelete: 2,
+				VerbDDL:    20,
+			})),
+			WithConnLimit(10, 5),
+		},
+	}
+}
+
+// PresetSQLiteSingleWriter suits SQLite, where reads run in parallel but a
+// single writer holds the database lock: reads are not rate limited, one
+// write or DDL statement runs at a time and writes queue for at most 5s,
+// in line with a typical busy_timeout, instead of failing with
+// SQLITE_BUSY.
+func PresetSQLiteSingleWriter() Preset {
+	return Preset{
+		Name: "sqlite-single-writer",
+		Config: Config{
+			Limit:    rate.Inf,
+			Burst:    1,
+			Overflow: OverflowPolicy{Mode: OverflowQueue, MaxWait: 5 * time.Second},
+		},
+		Options: []Option{
+			WithVerbConcurrency(1, VerbInsert, VerbUpdate, VerbDelete, VerbDDL),
+		},
+	}
+}
+
+// PresetServerlessPG suits serverless Postgres such as Aurora Serverless
+// or Neon, which scale compute with load and may be scaled to zero: 100
+// calls per second with a burst of 20, 10 statements at once, connections
+// opened at 2 per second since each may wake or scale the database, calls
+// queueing for up to 10s to ride out a cold start, tokens left unused over
+// a quiet minute forgiven so a waking database is not hit with a full
+// burst, and an adaptive limit between 5 and 200 calls per second that
+// follows the capacity as it scales.
+func PresetServerlessPG() Preset {
+	return Preset{
+		Name: "serverless-pg",
+		Config: Config{
+			Limit:          100,
+			Burst:          20,
+			MaxConcurrency: 10,
+			Overflow:       OverflowPolicy{Mode: OverflowQueue, MaxWait: 10 * time.Second},
+			Adaptive:       &AdaptiveConfig{Min: 5, Max: 200},
+		},
+		Options: []Option{
+			WithConnLimit(2, 2),
+			WithIdleBurst(IdleBurst{After: time.Minute}),
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+)
+
+// TestPresets 测试各预设配置有效且可以直接使用
+func TestPresets(t *testing.T) {
+	for _, p := range []Preset{PresetSmallRDS(), PresetSQLiteSingleWriter(), PresetServerlessPG()} {
+		t.Run(p.Name, func(t *testing.T) {
+			db := setupTestDB(t)
+			rateLimitedDB, err := p.New(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rateLimitedDB.Close()
+
+			if _, err := rateLimitedDB.ExecContext(context.Background(), "INSERT INTO users (name, email) VALUES ('a', 'b')"); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := rateLimitedDB.QueryContext(context.Background(), "SELECT 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows.Close()
+		})
+	}
+}
+
+// TestPresetOverride 测试调用方的选项优先于预设
+func TestPresetOverride(t *testing.T) {
+	db := setupTestDB(t)
+	rateLimitedDB, err := PresetSmallRDS().New(db, WithMaxConcurrency(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rateLimitedDB.Close()
+
+	if got := rateLimitedDB.opts.maxConcurrency; got != 3 {
+		t.Errorf("max concurrency = %d, want 3", got)
+	}
+	if got := rateLimitedDB.cost(context.Background(), "UPDATE users SET name = 'x'"); got != 2 {
+		t.Errorf("update cost = %d, want 2", got)
+	}
+}
@@ -0,0 +1,152 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// StartupProbe configures WithStartupProbe.
+type StartupProbe struct {
+	// Query is the statement timed, which must be harmless to repeat.
+	// Default "SELECT 1".
+	Query string
+	// Samples is the number of round trips timed, one after the other.
+	// Default 20.
+	Samples int
+	// MaxDuration bounds the whole probe, which then uses the samples it
+	// has. Default 2s.
+	MaxDuration time.Duration
+	// Connections is the number of statements expected to run at once.
+	// Default the limit of WithMaxConcurrency, otherwise the pool's
+	// MaxOpenConns, otherwise 10.
+	Connections int
+	// Fraction is the share of the estimated capacity, Connections per
+	// median round trip, suggested as the limit. Default 0.5.
+	Fraction float64
+	// Apply sets the suggested limit and burst, which then also become the
+	// baseline that profiles and flag providers start from. Without it
+	// the suggestion is only logged.
+	Apply bool
+	// Logf reports the result, or why the probe failed. Default log.Printf.
+	Logf func(format string, args ...any)
+}
+
+// ProbeResult is what a startup probe measured and suggests.
+type ProbeResult struct {
+	Samples int
+	Median  time.Duration
+	P95     time.Duration
+	Limit   rate.Limit
+	Burst   int
+	Applied bool
+}
+
+// WithStartupProbe times a few round trips of a harmless query when r is
+// created, before any call is admitted, and suggests or sets the limit and
+// burst from the latency measured. The probe bypasses the limiter. If it
+// fails the configured limits are kept.
+func WithStartupProbe(p StartupProbe) Option {
+	return func(o *options) {
+		o.startupProbe = &p
+	}
+}
+
+func (p StartupProbe) withDefaults() StartupProbe {
+	if p.Query == "" {
+		p.Query = "SELECT 1"
+	}
+	if p.Samples <= 0 {
+		p.Samples = 20
+	}
+	if p.MaxDuration <= 0 {
+		p.MaxDuration = 2 * time.Second
+	}
+	if p.Fraction <= 0 {
+		p.Fraction = 0.5
+	}
+	if p.Logf == nil {
+		p.Logf = log.Printf
+	}
+	return p
+}
+
+// ProbeResult returns the result of the startup probe, or false if there
+// was none or it failed.
+func (r *RateLimitedDB) ProbeResult() (ProbeResult, bool) {
+	if r.probed == nil {
+		return ProbeResult{}, false
+	}
+	return *r.probed, true
+}
+
+// startupProbe runs the probe configured with WithStartupProbe
+func (r *RateLimitedDB) startupProbe(p StartupProbe) {
+	p = p.withDefaults()
+	if p.Connections <= 0 {
+		p.Connections = int(r.opts.maxConcurrency)
+	}
+	if p.Connections <= 0 {
+		p.Connections = r.db.Stats().MaxOpenConnections
+	}
+	if p.Connections <= 0 {
+		p.Connections = 10
+	}
+
+	configured := r.base
+	res, err := r.probeLatency(p)
+	if err != nil {
+		p.Logf("dbratelimit: startup probe failed, keeping limit %v and burst %d: %v", r.base.Limit, r.base.Burst, err)
+		return
+	}
+	if p.Apply {
+		r.SetLimit(res.Limit)
+		r.limiter.SetBurst(res.Burst)
+		r.base = LimitConfig{Limit: res.Limit, Burst: res.Burst}
+		res.Applied = true
+	}
+	r.probed = &res
+	verb := "suggests"
+	if res.Applied {
+		verb = "set"
+	}
+	p.Logf("dbratelimit: startup probe: median round trip %v, p95 %v over %d samples; %s limit %.1f and burst %d (configured %v and %d)",
+		res.Median, res.P95, res.Samples, verb, float64(res.Limit), res.Burst, configured.Limit, configured.Burst)
+}
+
+// probeLatency times p.Query and derives a limit and burst from the median
+func (r *RateLimitedDB) probeLatency(p StartupProbe) (ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.MaxDuration)
+	defer cancel()
+
+	var rtts []time.Duration
+	for len(rtts) < p.Samples && ctx.Err() == nil {
+		start := time.Now()
+		rows, err := r.db.QueryContext(ctx, p.Query)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return ProbeResult{}, err
+		}
+		rows.Close()
+		rtts = append(rtts, time.Since(start))
+	}
+	if len(rtts) == 0 {
+		return ProbeResult{}, errors.New("no round trip completed within " + p.MaxDuration.String())
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	res := ProbeResult{
+		Samples: len(rtts),
+		Median:  rtts[len(rtts)/2],
+		P95:     rtts[(len(rtts)*95-1)/100],
+		Burst:   p.Connections,
+	}
+	median := max(res.Median, time.Microsecond)
+	res.Limit = rate.Limit(p.Fraction * float64(p.Connections) / median.Seconds())
+	return res, nil
+}
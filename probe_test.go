@@ -0,0 +1,63 @@
+package dbratelimit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestStartupProbe 测试启动探测根据往返延迟设置初始限额并记录日志
+func TestStartupProbe(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var logs []string
+	logf := func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1, WithStartupProbe(StartupProbe{
+		Samples:     5,
+		Connections: 4,
+		Apply:       true,
+		Logf:        logf,
+	}))
+	defer rateLimitedDB.Close()
+
+	res, ok := rateLimitedDB.ProbeResult()
+	if !ok || res.Samples != 5 || !res.Applied {
+		t.Fatalf("probe result = %+v, %v; want 5 applied samples", res, ok)
+	}
+	want := rate.Limit(0.5 * 4 / res.Median.Seconds())
+	if got := rateLimitedDB.Limiter().Limit(); got != want || rateLimitedDB.Limiter().Burst() != 4 {
+		t.Errorf("limit = %v burst %d, want %v and 4", got, rateLimitedDB.Limiter().Burst(), want)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "set limit") {
+		t.Errorf("logs = %q, want one line reporting the limit set", logs)
+	}
+}
+
+// TestStartupProbeFailure 测试探测失败时保留配置的限额
+func TestStartupProbeFailure(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var logs []string
+	rateLimitedDB := Wrap(db, rate.Limit(3), 2, WithStartupProbe(StartupProbe{
+		Query:       "SELECT * FROM missing",
+		MaxDuration: time.Second,
+		Apply:       true,
+		Logf:        func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) },
+	}))
+	defer rateLimitedDB.Close()
+
+	if _, ok := rateLimitedDB.ProbeResult(); ok {
+		t.Error("expected no probe result")
+	}
+	if got := rateLimitedDB.Limiter().Limit(); got != 3 {
+		t.Errorf("limit = %v, want the configured 3", got)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "probe failed") {
+		t.Errorf("logs = %q, want the failure logged", logs)
+	}
+}
@@ -0,0 +1,107 @@
+package dbratelimit
+
+import (
+	"strings"
+)
+
+// Procedure describes what a stored procedure does, since a CALL or EXEC
+// statement does not show whether it reads or writes.
+type Procedure struct {
+	Verb Verb // treated as a statement of this verb, e.g. VerbUpdate
+	Cost int  // tokens charged per call; 0 leaves the cost to WithCostFunc
+}
+
+// WithProcedures classifies CALL, EXEC and EXECUTE statements by the
+// procedure they run. Names are matched case-insensitively, first in full,
+// as in "billing.close_month", then without the schema. Their verb then
+// counts for WithExemptVerbs, WithVerbLimit, write freezes, follower roles
+// and the like, where an unmapped procedure is VerbCall. A cost set with
+// WithCost still takes precedence.
+func WithProcedures(procs map[string]Procedure) Option {
+	return func(o *options) {
+		if o.procedures == nil {
+			o.procedures = make(map[string]Procedure)
+		}
+		for name, p := range procs {
+			o.procedures[strings.ToLower(name)] = p
+		}
+	}
+}
+
+// verbOf is ParseVerb mapping calls of configured procedures to their verb
+func (r *RateLimitedDB) verbOf(query string) Verb {
+	v := ParseVerb(query)
+	if v == VerbCall && r.opts.procedures != nil {
+		if p, ok := r.procedure(query); ok {
+			return p.Verb
+		}
+	}
+	return v
+}
+
+// procedure returns the configuration of the procedure called by query
+func (r *RateLimitedDB) procedure(query string) (Procedure, bool) {
+	name := ProcedureName(query)
+	if name == "" {
+		return Procedure{}, false
+	}
+	if p, ok := r.opts.procedures[name]; ok {
+		return p, true
+	}
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		p, ok := r.opts.procedures[name[i+1:]]
+		return p, ok
+	}
+	return Procedure{}, false
+}
+
+// ProcedureName returns the lowercased name of the procedure called by a
+// CALL, EXEC or EXECUTE statement, including its schema if given, or ""
+// for other statements. Quotes and T-SQL brackets around name parts are
+// dropped, as is a T-SQL return value assignment, as in
+// "EXEC @rc = dbo.proc".
+func ProcedureName(query string) string {
+	word, rest := nextWord(skipSpaceAndComments(query))
+	switch strings.ToUpper(word) {
+	case "CALL", "EXEC", "EXECUTE":
+	default:
+		return ""
+	}
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	if strings.HasPrefix(rest, "@") {
+		// return value assignment
+		i := strings.IndexByte(rest, '=')
+		if i < 0 {
+			return ""
+		}
+		rest = strings.TrimLeft(rest[i+1:], " \t\r\n")
+	}
+	var b strings.Builder
+	for len(rest) > 0 {
+		switch c := rest[0]; {
+		case c == '"' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			i := strings.IndexByte(rest[1:], end)
+			if i < 0 {
+				return ""
+			}
+			b.WriteString(strings.ToLower(rest[1 : i+1]))
+			rest = rest[i+2:]
+		case isWordByte(c):
+			w, r := nextWord(rest)
+			b.WriteString(strings.ToLower(w))
+			rest = r
+		default:
+			return ""
+		}
+		if !strings.HasPrefix(rest, ".") {
+			break
+		}
+		b.WriteByte('.')
+		rest = rest[1:]
+	}
+	return b.String()
+}
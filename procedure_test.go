@@ -0,0 +1,71 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestProcedureName 测试从 CALL/EXEC 语句中提取存储过程名
+func TestProcedureName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"CALL refresh_report(1, 2)", "refresh_report"},
+		{"/* job */ call Billing.Close_Month()", "billing.close_month"},
+		{"EXEC [dbo].[Purge Old] @days = 30", "dbo.purge old"},
+		{"EXECUTE @rc = dbo.archive", "dbo.archive"},
+		{"exec \"sales\".\"sync\"", "sales.sync"},
+		{"SELECT * FROM users", ""},
+		{"CALL (", ""},
+	}
+	for _, tt := range tests {
+		if got := ProcedureName(tt.query); got != tt.want {
+			t.Errorf("ProcedureName(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestWithProcedures 测试按存储过程映射语句类型和成本
+func TestWithProcedures(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 100, WithProcedures(map[string]Procedure{
+		"Billing.Close_Month": {Verb: VerbUpdate, Cost: 20},
+		"report":              {Verb: VerbSelect},
+	}), WithCostFunc(func(string) int { return 3 }))
+	defer rateLimitedDB.Close()
+
+	tests := []struct {
+		query string
+		verb  Verb
+		cost  int
+	}{
+		{"CALL billing.close_month()", VerbUpdate, 20},
+		{"EXEC dbo.report", VerbSelect, 3},
+		{"CALL other()", VerbCall, 3},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		if got := rateLimitedDB.verbOf(tt.query); got != tt.verb {
+			t.Errorf("verb of %q = %v, want %v", tt.query, got, tt.verb)
+		}
+		if got := rateLimitedDB.cost(ctx, tt.query); got != tt.cost {
+			t.Errorf("cost of %q = %d, want %d", tt.query, got, tt.cost)
+		}
+	}
+	if got := rateLimitedDB.cost(WithCost(ctx, 7), "CALL billing.close_month()"); got != 7 {
+		t.Errorf("cost with WithCost = %d, want 7", got)
+	}
+
+	// 映射为写语句的过程在写冻结期间被拒绝
+	rateLimitedDB.FreezeWrites()
+	defer rateLimitedDB.ThawWrites()
+	if _, err := rateLimitedDB.ExecContext(ctx, "CALL billing.close_month()"); !errors.Is(err, ErrWritesFrozen) {
+		t.Errorf("write procedure during a freeze: %v, want ErrWritesFrozen", err)
+	}
+}
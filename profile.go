@@ -0,0 +1,197 @@
+package dbratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrUnknownProfile is returned when switching to a profile that was not
+// configured with WithProfiles.
+var ErrUnknownProfile error = newError(CodeInvalid, "dbratelimit: unknown profile")
+
+// Profile is a named set of limits, such as "normal", "degraded" or
+// "incident", to switch between at runtime.
+type Profile struct {
+	// Limit and Burst cap those of the main limiter, along with those of
+	// the current role (see WithRoles): the lower of the two applies. Zero
+	// values leave them to the role, else the limit of the last
+	// calibration, else the ones r was created with.
+	Limit rate.Limit
+	Burst int
+	// TagLimits overrides the buckets of tags configured with
+	// WithTagLimits. Tags without a bucket cannot be added here; tags left
+	// out get the limits they were configured with.
+	TagLimits map[string]LimitConfig
+}
+
+// WithProfiles configures named profiles and starts with the one named
+// initial. Switch with SwitchProfile or ProfileHandler.
+func WithProfiles(initial string, profiles map[string]Profile) Option {
+	return func(o *options) {
+		o.profiles = &profileConfig{initial: initial, profiles: profiles}
+	}
+}
+
+type profileConfig struct {
+	initial  string
+	profiles map[string]Profile
+}
+
+type profileState struct {
+	mu       sync.Mutex
+	current  string
+	profiles map[string]Profile
+}
+
+func newProfileState(c profileConfig) *profileState {
+	s := &profileState{profiles: make(map[string]Profile, len(c.profiles))}
+	for name, p := range c.profiles {
+		s.profiles[name] = p
+	}
+	return s
+}
+
+// SwitchProfile applies the named profile to the main limiter and the tag
+// limiters as one switch: a call admitted while they are updated gives its
+// tokens back and is admitted again, so that it passes either the old or
+// the new limits, not a mix of both.
+func (r *RateLimitedDB) SwitchProfile(name string) error {
+	var err error
+	r.switchLimits(func() { err = r.switchProfile(name) })
+	return err
+}
+
+// switchProfile is SwitchProfile, run by switchLimits
+func (r *RateLimitedDB) switchProfile(name string) error {
+	s := r.profiles
+	if s == nil {
+		return fmt.Errorf("%w %q: no profiles configured", ErrUnknownProfile, name)
+	}
+	s.mu.Lock()
+	p, ok := s.profiles[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	for tag, l := range r.tagLimiters {
+		c, ok := p.TagLimits[tag]
+		if !ok {
+			c = r.opts.tagLimits[tag]
+		}
+		l.SetLimit(c.Limit)
+		l.SetBurst(c.Burst)
+	}
+	s.current = name
+	s.mu.Unlock()
+	r.applyMainLimits()
+	return nil
+}
+
+// currentProfile returns the current profile, the zero Profile if profiles
+// are not configured
+func (r *RateLimitedDB) currentProfile() Profile {
+	s := r.profiles
+	if s == nil {
+		return Profile{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profiles[s.current]
+}
+
+// mainLimits is the main limiter settings of the current role and profile.
+// Each caps the limit and burst it sets, so the lower of the two applies,
+// and calibratedBase fills in what neither sets.
+func (r *RateLimitedDB) mainLimits() LimitConfig {
+	base := r.calibratedBase()
+	role, p := r.roleProfile(), r.currentProfile()
+	if l := lowerLimit(role.Limit, p.Limit); l != 0 {
+		base.Limit = l
+	}
+	if b := lowerBurst(role.Burst, p.Burst); b > 0 {
+		base.Burst = b
+	}
+	return base
+}
+
+// applyMainLimits sets the main limiter to mainLimits
+func (r *RateLimitedDB) applyMainLimits() {
+	c := r.mainLimits()
+	r.SetLimit(c.Limit)
+	r.limiter.SetBurst(c.Burst)
+}
+
+// lowerLimit returns the lower of a and b, where 0 sets no limit
+func lowerLimit(a, b rate.Limit) rate.Limit {
+	if a == 0 || b != 0 && b < a {
+		return b
+	}
+	return a
+}
+
+// lowerBurst returns the lower of a and b, where a value <= 0 sets no burst
+func lowerBurst(a, b int) int {
+	if a <= 0 || b > 0 && b < a {
+		return b
+	}
+	return a
+}
+
+// Profile returns the name of the current profile, empty if profiles are
+// not configured.
+func (r *RateLimitedDB) Profile() string {
+	s := r.profiles
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Profiles returns the names of the configured profiles, sorted.
+func (r *RateLimitedDB) Profiles() []string {
+	s := r.profiles
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.profiles))
+	for name := range s.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileHandler is an admin endpoint for profiles. GET returns the current
+// and available profiles as JSON; POST with a "profile" form or query value
+// switches to that profile. Protect it like any other admin endpoint.
+func (r *RateLimitedDB) ProfileHandler() http.Handler {
+	type state struct {
+		Profile  string   `json:"profile"`
+		Profiles []string `json:"profiles"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			err := r.SwitchProfile(req.FormValue("profile"))
+			if errors.Is(err, ErrUnknownProfile) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state{Profile: r.Profile(), Profiles: r.Profiles()})
+	})
+}
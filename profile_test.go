@@ -0,0 +1,158 @@
+package dbratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestSwitchProfile 测试命名限流配置的切换
+func TestSwitchProfile(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10,
+		WithTagLimits(map[string]LimitConfig{"exports": {Limit: 5, Burst: 5}}),
+		WithProfiles("normal", map[string]Profile{
+			"normal": {},
+			"incident": {
+				Limit:     10,
+				Burst:     1,
+				TagLimits: map[string]LimitConfig{"exports": {Limit: 0.1, Burst: 1}},
+			},
+		}))
+	defer rateLimitedDB.Close()
+
+	if got := rateLimitedDB.Profile(); got != "normal" {
+		t.Fatalf("Expected normal profile, got %q", got)
+	}
+	if err := rateLimitedDB.SwitchProfile("incident"); err != nil {
+		t.Fatalf("SwitchProfile failed: %v", err)
+	}
+	if l := rateLimitedDB.Limiter(); l.Limit() != 10 || l.Burst() != 1 {
+		t.Errorf("Expected incident limits, got %v/%d", l.Limit(), l.Burst())
+	}
+	if l := rateLimitedDB.tagLimiters["exports"]; l.Limit() != 0.1 {
+		t.Errorf("Expected incident tag limit, got %v", l.Limit())
+	}
+
+	// 切回 normal 恢复创建时的配置
+	if err := rateLimitedDB.SwitchProfile("normal"); err != nil {
+		t.Fatalf("SwitchProfile failed: %v", err)
+	}
+	if l := rateLimitedDB.Limiter(); l.Limit() != 100 || l.Burst() != 10 {
+		t.Errorf("Expected creation limits, got %v/%d", l.Limit(), l.Burst())
+	}
+	if l := rateLimitedDB.tagLimiters["exports"]; l.Limit() != 5 {
+		t.Errorf("Expected creation tag limit, got %v", l.Limit())
+	}
+
+	if err := rateLimitedDB.SwitchProfile("panic"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Expected ErrUnknownProfile, got %v", err)
+	}
+}
+
+// TestProfileHandler 测试管理接口查询与切换配置
+func TestProfileHandler(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithProfiles("normal", map[string]Profile{
+		"normal":   {},
+		"degraded": {Limit: 50},
+	}))
+	defer rateLimitedDB.Close()
+	h := rateLimitedDB.ProfileHandler()
+
+	form := url.Values{"profile": {"degraded"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/profile", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var got struct {
+		Profile  string
+		Profiles []string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Bad response %q: %v", rec.Body.String(), err)
+	}
+	if got.Profile != "degraded" || len(got.Profiles) != 2 || rateLimitedDB.Limiter().Limit() != 50 {
+		t.Errorf("Unexpected state after switch: %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/profile?profile=missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown profile, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/profile", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
+
+// TestSwitchProfileAtomic 测试切换 profile 期间的调用等待切换完成，跨越切换的调用按新配置重新准入
+func TestSwitchProfileAtomic(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	r := Wrap(db, rate.Limit(1000), 100,
+		WithTagLimits(map[string]LimitConfig{"t": {Limit: rate.Limit(10), Burst: 1}}),
+		WithProfiles("normal", map[string]Profile{
+			"normal": {},
+			"strict": {Limit: rate.Limit(1000), Burst: 10},
+		}))
+	defer r.Close()
+	ctx := WithTag(context.Background(), "t")
+
+	// 切换进行中时，调用不会按一半旧一半新的配置准入
+	release := make(chan struct{})
+	switched := make(chan struct{})
+	go func() {
+		r.switchLimits(func() { <-release })
+		close(switched)
+	}()
+	for atomic.LoadUint64(&r.limitsGen)&1 == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.ExecContext(ctx, "UPDATE users SET name = ?", "x")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the call to wait for the switch, returned %v", err)
+	case <-time.After(30 * time.Millisecond):
+	}
+	close(release)
+	<-switched
+	if err := <-done; err != nil {
+		t.Fatalf("Call after the switch failed: %v", err)
+	}
+
+	// 在 tag 上等待时发生切换：令牌归还后按新配置重新获取，只占用一次
+	r.tagLimiters["t"].AllowN(time.Now(), 1)
+	go func() {
+		_, err := r.ExecContext(ctx, "UPDATE users SET name = ?", "x")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := r.SwitchProfile("strict"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Call spanning the switch failed: %v", err)
+	}
+	if tokens := r.Limiter().Tokens(); tokens < 8.9 || tokens > 9.1 {
+		t.Errorf("Expected the call to take one main token under the new burst, %.2f left", tokens)
+	}
+}
@@ -0,0 +1,90 @@
+package dbratelimit
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrProxyOverloaded matches, through errors.Is, errors from a proxy such as
+// Vitess or ProxySQL that is shedding load, so callers can treat them like
+// pushback from this layer.
+var ErrProxyOverloaded error = newError(CodeOverloaded, "dbratelimit: proxy is shedding load")
+
+// ProxyError is returned for calls that failed with a Vitess or ProxySQL
+// pool or throttling error. It wraps the driver error.
+type ProxyError struct {
+	Proxy string // "vitess" or "proxysql"
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ProxyError) Error() string {
+	return e.Proxy + ": " + e.Err.Error()
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports ErrProxyOverloaded for saturation and throttle errors.
+func (e *ProxyError) Is(target error) bool {
+	return target == ErrProxyOverloaded && e.Class.Overload()
+}
+
+// proxyPatterns maps proxy error messages, which arrive wrapped in generic
+// MySQL errors such as 1105, to their class
+var proxyPatterns = []struct {
+	proxy string
+	text  string
+	class ErrorClass
+}{
+	{"vitess", "transaction pool aborting request due to already expired context", ClassSaturation},
+	{"vitess", "transaction pool connection limit exceeded", ClassSaturation},
+	{"vitess", "query pool timeout", ClassSaturation},
+	{"vitess", "resource pool timed out", ClassSaturation},
+	{"vitess", "transaction throttled", ClassThrottle},
+	{"vitess", "code = ResourceExhausted", ClassThrottle},
+	{"vitess", "code = Unavailable", ClassTransient},
+	{"proxysql", "Max connect timeout reached while reaching hostgroup", ClassSaturation},
+	{"proxysql", "Error 9001", ClassSaturation},
+	{"proxysql", "Query processor throttled", ClassThrottle},
+}
+
+// parseProxyError returns the proxy and class of a recognized proxy error
+func parseProxyError(err error) (string, ErrorClass) {
+	msg := strings.ToLower(err.Error())
+	for _, p := range proxyPatterns {
+		if strings.Contains(msg, strings.ToLower(p.text)) {
+			return p.proxy, p.class
+		}
+	}
+	return "", ClassUnknown
+}
+
+// ProxyClassifier recognizes Vitess and ProxySQL errors. It must come before
+// MySQLClassifier, which would report their generic error numbers as
+// permanent.
+var ProxyClassifier ErrorClassifier = ErrorClassifierFunc(func(err error) ErrorClass {
+	var pe *ProxyError
+	if errors.As(err, &pe) {
+		return pe.Class
+	}
+	_, class := parseProxyError(err)
+	return class
+})
+
+// proxyError wraps err in a ProxyError if it comes from Vitess or ProxySQL
+func proxyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pe *ProxyError
+	if errors.As(err, &pe) {
+		return err
+	}
+	proxy, class := parseProxyError(err)
+	if class == ClassUnknown {
+		return err
+	}
+	return &ProxyError{Proxy: proxy, Class: class, Err: err}
+}
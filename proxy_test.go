@@ -0,0 +1,61 @@
+package dbratelimit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestProxyClassifier 测试 Vitess 与 ProxySQL 错误的识别，包括被包装成通用 MySQL 错误的情况
+func TestProxyClassifier(t *testing.T) {
+	cases := []struct {
+		err   error
+		proxy string
+		want  ErrorClass
+	}{
+		{errors.New("Error 1105 (HY000): target: ks.-80.primary: vttablet: rpc error: code = Aborted desc = transaction pool aborting request due to already expired context"), "vitess", ClassSaturation},
+		{errors.New("Error 1105 (HY000): vttablet: rpc error: code = ResourceExhausted desc = transaction pool connection limit exceeded"), "vitess", ClassSaturation},
+		{errors.New("Error 1105 (HY000): vttablet: rpc error: code = ResourceExhausted desc = Transaction throttled"), "vitess", ClassThrottle},
+		{errors.New("Error 9001 (HY000): Max connect timeout reached while reaching hostgroup 10 after 10000ms"), "proxysql", ClassSaturation},
+		{errors.New("Error 1105 (HY000): unknown error"), "", ClassPermanent},
+	}
+	for _, c := range cases {
+		if got := DefaultClassifier.Classify(c.err); got != c.want {
+			t.Errorf("Classify(%v) = %v, want %v", c.err, got, c.want)
+		}
+		err := proxyError(fmt.Errorf("exec: %w", c.err))
+		var pe *ProxyError
+		if errors.As(err, &pe) != (c.proxy != "") {
+			t.Errorf("proxyError(%v) = %v", c.err, err)
+			continue
+		}
+		if pe != nil && (pe.Proxy != c.proxy || !errors.Is(err, ErrProxyOverloaded) || !errors.Is(err, c.err)) {
+			t.Errorf("Unexpected proxy error %+v", pe)
+		}
+	}
+}
+
+// TestProxyErrorFeedback 测试代理错误以 ProxyError 返回并驱动自适应限流
+func TestProxyErrorFeedback(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithAdaptive(AdaptiveConfig{}))
+	defer rateLimitedDB.Close()
+
+	expired := errors.New("Error 1105 (HY000): transaction pool aborting request due to already expired context")
+	c := &call{r: rateLimitedDB, start: time.Now(), admitted: time.Now(), executed: true}
+	err := c.result(expired)
+	if !errors.Is(err, ErrProxyOverloaded) {
+		t.Fatalf("Expected ErrProxyOverloaded, got %v", err)
+	}
+	rateLimitedDB.callStarted()
+	c.ctx = t.Context()
+	c.done(err)
+	if got := rateLimitedDB.Limiter().Limit(); got >= 100 {
+		t.Errorf("Expected proxy pushback to lower the limit, got %v", got)
+	}
+}
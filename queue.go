@@ -0,0 +1,175 @@
+package dbratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// waiter is a call waiting for tokens from the main limiter
+type waiter struct {
+	class    string
+	tag      string
+	priority Priority
+	key      string
+	query    string
+	enqueued time.Time
+	shed     chan struct{} // closed when the waiter is shed
+	elem     *list.Element
+}
+
+// waitQueue tracks waiting calls in arrival order
+type waitQueue struct {
+	mu      sync.Mutex
+	waiting list.List
+}
+
+// add registers w; if limit waiters of w's class are already waiting, the
+// oldest one of them is shed
+func (q *waitQueue) add(w *waiter, limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if limit > 0 {
+		var oldest *waiter
+		n := 0
+		for e := q.waiting.Front(); e != nil; e = e.Next() {
+			if o := e.Value.(*waiter); o.class == w.class {
+				if oldest == nil {
+					oldest = o
+				}
+				n++
+			}
+		}
+		if n >= limit && oldest != nil {
+			q.waiting.Remove(oldest.elem)
+			close(oldest.shed)
+		}
+	}
+	w.elem = q.waiting.PushBack(w)
+}
+
+func (q *waitQueue) remove(w *waiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-w.shed:
+		// already removed when shed
+	default:
+		q.waiting.Remove(w.elem)
+	}
+}
+
+// WaiterInfo describes a call waiting for admission.
+type WaiterInfo struct {
+	Tag         string
+	Priority    Priority
+	Key         string
+	Fingerprint string // see Fingerprint; empty for throttled readers and copies
+	Enqueued    time.Time
+	Waiting     time.Duration // time spent waiting so far
+}
+
+// Waiters returns the calls currently waiting for the main limiter, oldest
+// first.
+func (r *RateLimitedDB) Waiters() []WaiterInfo {
+	r.queue.mu.Lock()
+	waiting := make([]*waiter, 0, r.queue.waiting.Len())
+	for e := r.queue.waiting.Front(); e != nil; e = e.Next() {
+		waiting = append(waiting, e.Value.(*waiter))
+	}
+	r.queue.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]WaiterInfo, len(waiting))
+	for i, w := range waiting {
+		infos[i] = WaiterInfo{
+			Tag:      w.tag,
+			Priority: w.priority,
+			Key:      w.key,
+			Enqueued: w.enqueued,
+			Waiting:  now.Sub(w.enqueued),
+		}
+		if w.query != "" {
+			infos[i].Fingerprint = Fingerprint(w.query)
+		}
+	}
+	return infos
+}
+
+// enqueue registers a waiting call with the queue; the caller removes it
+func (r *RateLimitedDB) enqueue(ctx context.Context, policy OverflowPolicy, class string, now time.Time) *waiter {
+	w := &waiter{
+		class:    class,
+		tag:      TagFrom(ctx),
+		priority: PriorityFrom(ctx),
+		key:      KeyFrom(ctx),
+		enqueued: now,
+		shed:     make(chan struct{}),
+	}
+	w.query, _ = ctx.Value(queryKey).(string)
+	limit := 0
+	if policy.Mode == OverflowShedOldest {
+		limit = policy.MaxQueue
+	}
+	r.queue.add(w, limit)
+	return w
+}
+
+// waitQueued acquires n tokens from the main limiter, applying the overflow
+// policy for the call
+func (r *RateLimitedDB) waitQueued(ctx context.Context, n int, h *holds) error {
+	l := r.limiter
+	if n > l.Burst() {
+		// burst policy decides, see waitLimiter
+		return r.waitLimiter(ctx, l, n, h)
+	}
+	if err := r.shedForSLO(ctx, n); err != nil {
+		return err
+	}
+	policy, class := r.overflowFor(ctx)
+	if r.dispatch != nil {
+		return r.waitDispatched(ctx, n, policy, class, h)
+	}
+
+	now := time.Now()
+	res := l.ReserveN(now, n)
+	if !res.OK() {
+		return r.waitLimiter(ctx, l, n, h)
+	}
+	delay := res.DelayFrom(now)
+	if delay == 0 {
+		h.add(l, res, n)
+		return nil
+	}
+	if policy.Mode == OverflowReject {
+		res.CancelAt(now)
+		return rejected(delay, "no tokens available")
+	}
+	if policy.MaxWait > 0 && delay > policy.MaxWait {
+		res.CancelAt(now)
+		return rejected(delay, "wait of %v exceeds %v", delay, policy.MaxWait)
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		res.CancelAt(now)
+		return fmt.Errorf("dbratelimit: wait of %v would exceed context deadline: %w", delay, context.DeadlineExceeded)
+	}
+
+	w := r.enqueue(ctx, policy, class, now)
+	defer r.queue.remove(w)
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		h.add(l, res, n)
+		return nil
+	case <-ctx.Done():
+		res.Cancel()
+		return ctx.Err()
+	case <-w.shed:
+		res.Cancel()
+		return rejected(r.retryAfter(n), "shed to make room for newer calls")
+	}
+}
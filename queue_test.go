@@ -0,0 +1,58 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestWaiters 测试能查看排队中的调用
+func TestWaiters(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+	if w := rateLimitedDB.Waiters(); len(w) != 0 {
+		t.Fatalf("Expected empty queue, got %v", w)
+	}
+
+	waitCtx, cancel := context.WithCancel(WithTag(WithPriority(ctx, PriorityHigh), "report"))
+	done := make(chan error, 1)
+	go func() {
+		_, err := rateLimitedDB.ExecContext(waitCtx, "SELECT 2 WHERE 1 = 1")
+		done <- err
+	}()
+
+	var waiters []WaiterInfo
+	for i := 0; i < 100 && len(waiters) == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+		waiters = rateLimitedDB.Waiters()
+	}
+	if len(waiters) != 1 {
+		t.Fatalf("Expected 1 waiter, got %v", waiters)
+	}
+	w := waiters[0]
+	if w.Tag != "report" || w.Priority != PriorityHigh {
+		t.Errorf("Unexpected waiter %+v", w)
+	}
+	if w.Fingerprint != "select ? where ? = ?" {
+		t.Errorf("Unexpected fingerprint %q", w.Fingerprint)
+	}
+	if w.Enqueued.IsZero() || w.Waiting <= 0 {
+		t.Errorf("Expected enqueue time and wait, got %+v", w)
+	}
+
+	cancel()
+	<-done
+	if w := rateLimitedDB.Waiters(); len(w) != 0 {
+		t.Errorf("Expected queue to drain after cancel, got %v", w)
+	}
+}
@@ -0,0 +1,94 @@
+package dbratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Quota allows at most Count tokens per Per, e.g. 1000 per minute.
+type Quota struct {
+	Count int
+	Per   time.Duration
+}
+
+// WithQuotas adds quotas at several horizons, e.g. 50 per second and 1000
+// per minute and 20000 per hour, as managed databases often express their
+// limits. Calls must fit every quota as well as the main limiter. Each
+// quota is a token bucket refilling at Count/Per with a burst of Count, so
+// unused capacity of one period carries over into the next, up to Count.
+func WithQuotas(quotas ...Quota) Option {
+	return func(o *options) {
+		o.quotas = append(o.quotas, quotas...)
+	}
+}
+
+// newQuotaLimiters returns a limiter per valid quota
+func newQuotaLimiters(quotas []Quota) []*rate.Limiter {
+	var out []*rate.Limiter
+	for _, q := range quotas {
+		if q.Count <= 0 || q.Per <= 0 {
+			continue
+		}
+		out = append(out, rate.NewLimiter(rate.Limit(float64(q.Count)/q.Per.Seconds()), q.Count))
+	}
+	return out
+}
+
+// waitQuotas acquires n tokens from all quota limiters at once: either all
+// of them are charged or, if the call gives up, none
+func (r *RateLimitedDB) waitQuotas(ctx context.Context, n int, h *holds) error {
+	if len(r.quotas) == 0 {
+		return nil
+	}
+	if PriorityFrom(ctx) == PriorityCritical {
+		for _, l := range r.quotas {
+			takeN(l, n)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	res := make([]*rate.Reservation, 0, len(r.quotas))
+	cancel := func() {
+		for _, rv := range res {
+			rv.CancelAt(now)
+		}
+	}
+	var delay time.Duration
+	for _, l := range r.quotas {
+		rv := l.ReserveN(now, n)
+		if !rv.OK() {
+			cancel()
+			return fmt.Errorf("%w: cost %d, quota of %d", ErrCostExceedsBurst, n, l.Burst())
+		}
+		res = append(res, rv)
+		delay = max(delay, rv.DelayFrom(now))
+	}
+	keep := func() {
+		for i, rv := range res {
+			h.add(r.quotas[i], rv, n)
+		}
+	}
+	if delay == 0 {
+		keep()
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		cancel()
+		return fmt.Errorf("dbratelimit: quota wait of %v would exceed context deadline: %w", delay, context.DeadlineExceeded)
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		keep()
+		return nil
+	case <-ctx.Done():
+		now = time.Now()
+		cancel()
+		return ctx.Err()
+	}
+}
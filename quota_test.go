@@ -0,0 +1,43 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestQuotas 测试多个时间尺度的配额同时生效
+func TestQuotas(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithQuotas(
+		Quota{Count: 50, Per: time.Second},
+		Quota{Count: 3, Per: time.Minute},
+	))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatalf("Call %d failed: %v", i, err)
+		}
+	}
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected per-minute quota to be exhausted, got %v", err)
+	}
+
+	// 被拒绝的调用不消耗其他配额
+	if got := rateLimitedDB.quotas[0].Tokens(); got < 46 {
+		t.Errorf("Expected the per-second quota to be refunded, %v tokens left", got)
+	}
+
+	if _, err := rateLimitedDB.ExecContext(WithCost(ctx, 10), "SELECT 1"); !errors.Is(err, ErrCostExceedsBurst) {
+		t.Errorf("Expected ErrCostExceedsBurst for a cost above a quota, got %v", err)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package dbratelimit
+
+// raceEnabled turns inconsistencies found by the leak checks into panics
+const raceEnabled = true
@@ -0,0 +1,125 @@
+package dbratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// WithLimitRamp makes runtime changes of the main limit, whether through
+// SetLimit, profiles, roles, the flag provider, calibration or adaptive
+// limiting, ramp linearly to the new value over d instead of taking effect
+// at once. This avoids releasing a queue of waiters in one burst when the
+// limit rises, and starving them when it drops. A change during a ramp
+// carries on from where it is over the rest of the ramp, or d/2 if less is
+// left, so frequent changes such as adaptive limiting's neither hold the
+// limit in place nor turn into steps. Changes to and from rate.Inf are
+// never ramped.
+func WithLimitRamp(d time.Duration) Option {
+	return func(o *options) {
+		o.ramp = d
+	}
+}
+
+// limitRamp moves a limiter's limit towards a target
+type limitRamp struct {
+	d       time.Duration
+	limiter *rate.Limiter
+
+	mu     sync.Mutex
+	from   rate.Limit
+	to     rate.Limit
+	start  time.Time
+	dur    time.Duration // of the current ramp
+	active bool
+}
+
+// set starts ramping to l from the current limit, or retargets the
+// running ramp
+func (p *limitRamp) set(l rate.Limit, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active && p.to == l {
+		return
+	}
+	if left := p.dur - now.Sub(p.start); p.active && left > 0 && l != rate.Inf {
+		// restart from where the ramp is now, taking at least half a ramp
+		// so that a change late in one does not become a step
+		p.from, p.to, p.start, p.dur = p.at(now), l, now, max(left, p.d/2)
+		return
+	}
+	cur := p.limiter.Limit()
+	if cur == l || cur == rate.Inf || l == rate.Inf {
+		p.active = false
+		p.limiter.SetLimitAt(now, l)
+		return
+	}
+	p.from, p.to, p.start, p.dur, p.active = cur, l, now, p.d, true
+}
+
+// at returns where the ramp is at now, between from and to
+func (p *limitRamp) at(now time.Time) rate.Limit {
+	frac := min(max(float64(now.Sub(p.start))/float64(p.dur), 0), 1)
+	return p.from + rate.Limit(frac)*(p.to-p.from)
+}
+
+// target returns the limit being ramped to, or the current one
+func (p *limitRamp) target() rate.Limit {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active {
+		return p.to
+	}
+	return p.limiter.Limit()
+}
+
+// step moves the limit to where the ramp is at now
+func (p *limitRamp) step(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return
+	}
+	if now.Sub(p.start) >= p.dur {
+		p.active = false
+		p.limiter.SetLimitAt(now, p.to)
+		return
+	}
+	p.limiter.SetLimitAt(now, p.at(now))
+}
+
+// SetLimit changes the main limit, ramping to it if WithLimitRamp is set.
+// Prefer it over Limiter().SetLimit.
+func (r *RateLimitedDB) SetLimit(l rate.Limit) {
+	if r.ramp == nil {
+		r.limiter.SetLimit(l)
+		return
+	}
+	r.ramp.set(l, time.Now())
+}
+
+// TargetLimit returns the limit SetLimit last asked for, which differs
+// from Limiter().Limit() while ramping.
+func (r *RateLimitedDB) TargetLimit() rate.Limit {
+	if r.ramp == nil {
+		return r.limiter.Limit()
+	}
+	return r.ramp.target()
+}
+
+// rampLoop advances the ramp until r is closed
+func (r *RateLimitedDB) rampLoop() {
+	tick := time.Duration(math.Max(float64(r.ramp.d/50), float64(10*time.Millisecond)))
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.ramp.step(now)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package dbratelimit
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestLimitRamp 测试运行时修改限额时逐步过渡
+func TestLimitRamp(t *testing.T) {
+	limiter := rate.NewLimiter(100, 10)
+	p := &limitRamp{d: time.Second, limiter: limiter}
+	start := time.Now()
+
+	p.set(200, start)
+	if limiter.Limit() != 100 || p.target() != 200 {
+		t.Fatalf("Expected ramp to start at 100 towards 200, got %v -> %v", limiter.Limit(), p.target())
+	}
+	p.step(start.Add(250 * time.Millisecond))
+	if got := limiter.Limit(); got != 125 {
+		t.Errorf("Expected 125 a quarter of the way, got %v", got)
+	}
+	// 中途改变目标时从当前位置在剩余时间内转向
+	p.set(25, start.Add(500*time.Millisecond))
+	p.step(start.Add(750 * time.Millisecond))
+	if got := limiter.Limit(); got != 87.5 {
+		t.Errorf("Expected 87.5 halfway from 150 to 25, got %v", got)
+	}
+	p.step(start.Add(1000 * time.Millisecond))
+	if got := limiter.Limit(); got != 25 || p.target() != 25 {
+		t.Errorf("Expected ramp to finish at 25, got %v", got)
+	}
+
+	// Inf 不做过渡
+	p.set(rate.Inf, start.Add(3*time.Second))
+	if limiter.Limit() != rate.Inf {
+		t.Errorf("Expected Inf to apply at once, got %v", limiter.Limit())
+	}
+}
+
+// TestLimitRampRetarget 测试频繁修改目标时过渡不会一直重新开始
+func TestLimitRampRetarget(t *testing.T) {
+	limiter := rate.NewLimiter(100, 10)
+	p := &limitRamp{d: time.Second, limiter: limiter}
+	start := time.Now()
+
+	for i := 0; i < 10; i++ {
+		now := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		p.set(rate.Limit(200+i), now)
+		p.step(now)
+	}
+	// 剩余时间不足一半时按半个过渡时长继续
+	p.step(start.Add(1400 * time.Millisecond))
+	if got := limiter.Limit(); got != 209 {
+		t.Errorf("Expected ramp to reach 209 by 1.4s, got %v", got)
+	}
+}
+
+// TestLimitRampLateRetarget 测试过渡快结束时改变目标不会变成突变
+func TestLimitRampLateRetarget(t *testing.T) {
+	limiter := rate.NewLimiter(100, 10)
+	p := &limitRamp{d: time.Second, limiter: limiter}
+	start := time.Now()
+
+	p.set(200, start)
+	p.set(300, start.Add(950*time.Millisecond))
+	p.step(start.Add(time.Second))
+	if got := limiter.Limit(); got < 195 || got > 210 {
+		t.Errorf("Expected the limit to keep ramping from 195, got %v", got)
+	}
+	p.step(start.Add(1450 * time.Millisecond))
+	if got := limiter.Limit(); got != 300 || p.target() != 300 {
+		t.Errorf("Expected ramp to finish at 300 half a ramp later, got %v", got)
+	}
+}
+
+// TestSetLimitRamp 测试 SetLimit 与 profile 切换都经过过渡
+func TestSetLimitRamp(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithLimitRamp(100*time.Millisecond),
+		WithProfiles("normal", map[string]Profile{"normal": {}, "incident": {Limit: 10}}))
+	defer rateLimitedDB.Close()
+
+	if err := rateLimitedDB.SwitchProfile("incident"); err != nil {
+		t.Fatalf("SwitchProfile failed: %v", err)
+	}
+	if got := rateLimitedDB.Limiter().Limit(); got <= 10 {
+		t.Errorf("Expected limit to ramp down, got %v immediately", got)
+	}
+	if got := rateLimitedDB.TargetLimit(); got != 10 {
+		t.Errorf("Expected target 10, got %v", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for rateLimitedDB.Limiter().Limit() != 10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Ramp did not finish, limit %v", rateLimitedDB.Limiter().Limit())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,66 @@
+package dbratelimit
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+)
+
+// WithRand sets the random source behind jittered transaction retry
+// backoff and event sampling, e.g. a seeded rand.NewPCG so that tests see
+// the same delays and samples on every run, or CryptoSource where only an
+// approved generator may be used. CacheConfig and ConnLifetime take their
+// own source in their Rand field. By default the package-level functions
+// of math/rand/v2 are used.
+func WithRand(src rand.Source) Option {
+	return func(o *options) {
+		o.rand = newLockedRand(src)
+	}
+}
+
+// CryptoSource returns a source reading crypto/rand.
+func CryptoSource() rand.Source {
+	return cryptoSource{}
+}
+
+type cryptoSource struct{}
+
+func (cryptoSource) Uint64() uint64 {
+	var b [8]byte
+	crand.Read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// lockedRand serializes use of a source set by the caller, which need not
+// be safe for concurrent use. A nil *lockedRand uses the package-level
+// functions.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(src rand.Source) *lockedRand {
+	if src == nil {
+		return nil
+	}
+	return &lockedRand{r: rand.New(src)}
+}
+
+func (l *lockedRand) float64() float64 {
+	if l == nil {
+		return rand.Float64()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+func (l *lockedRand) int64N(n int64) int64 {
+	if l == nil {
+		return rand.Int64N(n)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int64N(n)
+}
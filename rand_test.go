@@ -0,0 +1,70 @@
+package dbratelimit
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestWithRand 测试相同种子的随机源给出相同的事件采样
+func TestWithRand(t *testing.T) {
+	samples := func() []bool {
+		db := setupTestDB(t)
+		rateLimitedDB := Wrap(db, rate.Inf, 1,
+			WithEvents(EventConfig{SampleRate: 0.5, MaxPerSecond: 1000}),
+			WithRand(rand.NewPCG(1, 2)))
+		defer rateLimitedDB.Close()
+		var got []bool
+		now := time.Now()
+		for range 50 {
+			got = append(got, rateLimitedDB.events.sample(now))
+		}
+		return got
+	}
+	a, b := samples(), samples()
+	kept := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("sample %d differs between runs with the same seed", i)
+		}
+		if a[i] {
+			kept++
+		}
+	}
+	if kept == 0 || kept == len(a) {
+		t.Errorf("kept %d of %d samples, want some of them", kept, len(a))
+	}
+}
+
+// TestCacheRand 测试结果缓存的 TTL 抖动使用配置的随机源
+func TestCacheRand(t *testing.T) {
+	cfg := CacheConfig{TTL: time.Minute, Jitter: 0.5}
+	cfg.Rand = rand.NewPCG(3, 4)
+	a := NewResultCache[int](cfg)
+	cfg.Rand = rand.NewPCG(3, 4)
+	b := NewResultCache[int](cfg)
+	for range 10 {
+		ta, tb := a.ttl(), b.ttl()
+		if ta != tb {
+			t.Fatalf("TTLs %v and %v differ with the same seed", ta, tb)
+		}
+		if ta < 30*time.Second || ta > 90*time.Second {
+			t.Fatalf("TTL %v outside the jitter range", ta)
+		}
+	}
+}
+
+// TestCryptoSource 测试基于 crypto/rand 的随机源
+func TestCryptoSource(t *testing.T) {
+	r := newLockedRand(CryptoSource())
+	for range 100 {
+		if f := r.float64(); f < 0 || f >= 1 {
+			t.Fatalf("float64() = %v", f)
+		}
+		if n := r.int64N(10); n < 0 || n >= 10 {
+			t.Fatalf("int64N(10) = %d", n)
+		}
+	}
+}
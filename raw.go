@@ -0,0 +1,94 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+)
+
+// ErrRawDisabled is the panic value of Raw when WithRawDisabled is set.
+var ErrRawDisabled error = newError(CodeDenied, "dbratelimit: Raw is disabled, use RawInstrumented")
+
+// WithRawDisabled makes Raw panic with ErrRawDisabled, closing the unlimited,
+// unobserved escape hatch in production. RawInstrumented keeps working.
+func WithRawDisabled() Option {
+	return func(o *options) {
+		o.rawDisabled = true
+	}
+}
+
+// RawDB is the underlying database with every call counted by RawCalls and
+// recorded by the audit sink, see RawInstrumented. Calls are not rate
+// limited.
+type RawDB struct {
+	r *RateLimitedDB
+}
+
+// RawInstrumented returns the underlying database for calls that must bypass
+// the limiter, observing each of them.
+func (r *RateLimitedDB) RawInstrumented() *RawDB {
+	return &RawDB{r: r}
+}
+
+// RawCalls returns the number of calls made through RawInstrumented.
+func (r *RateLimitedDB) RawCalls() uint64 {
+	return atomic.LoadUint64(&r.rawCalls)
+}
+
+func (d *RawDB) observe(ctx context.Context, query string) *sql.DB {
+	atomic.AddUint64(&d.r.rawCalls, 1)
+	d.r.auditCall(ctx, AuditRaw, query, nil)
+	return d.r.db
+}
+
+func (d *RawDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.observe(ctx, query).QueryContext(ctx, query, args...)
+}
+
+func (d *RawDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.observe(ctx, query).QueryRowContext(ctx, query, args...)
+}
+
+func (d *RawDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.observe(ctx, query).ExecContext(ctx, query, args...)
+}
+
+func (d *RawDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return d.observe(ctx, query).PrepareContext(ctx, query)
+}
+
+func (d *RawDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return d.observe(ctx, "").BeginTx(ctx, opts)
+}
+
+func (d *RawDB) Conn(ctx context.Context) (*sql.Conn, error) {
+	return d.observe(ctx, "").Conn(ctx)
+}
+
+func (d *RawDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return d.QueryContext(context.Background(), query, args...)
+}
+
+func (d *RawDB) QueryRow(query string, args ...any) *sql.Row {
+	return d.QueryRowContext(context.Background(), query, args...)
+}
+
+func (d *RawDB) Exec(query string, args ...any) (sql.Result, error) {
+	return d.ExecContext(context.Background(), query, args...)
+}
+
+func (d *RawDB) Prepare(query string) (*sql.Stmt, error) {
+	return d.PrepareContext(context.Background(), query)
+}
+
+func (d *RawDB) Begin() (*sql.Tx, error) {
+	return d.BeginTx(context.Background(), nil)
+}
+
+func (d *RawDB) PingContext(ctx context.Context) error {
+	return d.r.db.PingContext(ctx)
+}
+
+func (d *RawDB) Stats() sql.DBStats {
+	return d.r.db.Stats()
+}
@@ -0,0 +1,48 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestRawInstrumented 测试绕过限流的调用被计数和审计，不消耗 token
+func TestRawInstrumented(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1, WithAuditSink(NewJSONAuditSink(&buf)), WithRawDisabled())
+	defer rateLimitedDB.Close()
+
+	raw := rateLimitedDB.RawInstrumented()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := raw.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatalf("Raw exec failed: %v", err)
+		}
+	}
+	var name string
+	if err := raw.QueryRow("SELECT name FROM users WHERE id = 1").Scan(&name); err != nil || name != "Alice" {
+		t.Fatalf("Raw query = %q, %v", name, err)
+	}
+	if n := rateLimitedDB.RawCalls(); n != 4 {
+		t.Errorf("Expected 4 raw calls, got %d", n)
+	}
+	if n := strings.Count(buf.String(), `"kind":"raw"`); n != 4 {
+		t.Errorf("Expected 4 audit records, got %s", buf.String())
+	}
+	if tokens := rateLimitedDB.Limiter().Tokens(); tokens < 0.99 {
+		t.Errorf("Raw calls should not consume tokens, %v left", tokens)
+	}
+
+	defer func() {
+		if p := recover(); p != ErrRawDisabled {
+			t.Errorf("Expected Raw to panic with ErrRawDisabled, got %v", p)
+		}
+	}()
+	rateLimitedDB.Raw()
+}
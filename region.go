@@ -0,0 +1,133 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RegionStore shares per-region demand between processes, so each region
+// can size its slice of a global budget without a cross-region round trip
+// per query.
+type RegionStore interface {
+	// Report publishes this region's demand in tokens per second and
+	// returns the latest demand of every region, including this one.
+	Report(ctx context.Context, region string, demand float64) (map[string]float64, error)
+}
+
+// RegionalBudget partitions a global limit between regions. Every region
+// enforces its share locally and rebalances shares from observed demand
+// every Interval.
+type RegionalBudget struct {
+	Region      string
+	GlobalLimit rate.Limit
+	Burst       int
+	Store       RegionStore
+	// Interval between rebalances, 10s by default.
+	Interval time.Duration
+	// MinShare is the fraction of the global limit a region keeps even with
+	// no demand, so traffic can ramp up again. Default 0.05.
+	MinShare float64
+}
+
+// WithRegionalBudget enforces this region's share of b.GlobalLimit. Until
+// the first rebalance the region may use the whole global limit.
+func WithRegionalBudget(b RegionalBudget) Option {
+	return func(o *options) {
+		o.region = &b
+	}
+}
+
+type regionState struct {
+	demand  int64 // tokens requested since the last rebalance, atomic
+	budget  RegionalBudget
+	limiter *rate.Limiter
+	last    time.Time
+}
+
+func newRegionState(b RegionalBudget) *regionState {
+	if b.Interval <= 0 {
+		b.Interval = 10 * time.Second
+	}
+	if b.MinShare <= 0 {
+		b.MinShare = 0.05
+	}
+	if b.Burst <= 0 {
+		b.Burst = 1
+	}
+	return &regionState{
+		budget:  b,
+		limiter: rate.NewLimiter(b.GlobalLimit, b.Burst),
+		last:    time.Now(),
+	}
+}
+
+// waitRegion acquires n tokens from this region's share
+func (r *RateLimitedDB) waitRegion(ctx context.Context, n int, h *holds) error {
+	atomic.AddInt64(&r.region.demand, int64(n))
+	if PriorityFrom(ctx) == PriorityCritical {
+		takeN(r.region.limiter, n)
+		return nil
+	}
+	return r.waitLimiter(ctx, r.region.limiter, n, h)
+}
+
+// rebalance reports demand and resizes this region's share
+func (s *regionState) rebalance(ctx context.Context) error {
+	now := time.Now()
+	elapsed := now.Sub(s.last).Seconds()
+	s.last = now
+	requested := atomic.SwapInt64(&s.demand, 0)
+	demand := 0.0
+	if elapsed > 0 {
+		demand = float64(requested) / elapsed
+	}
+
+	all, err := s.budget.Store.Report(ctx, s.budget.Region, demand)
+	if err != nil {
+		return err
+	}
+	all[s.budget.Region] = demand
+	s.limiter.SetLimit(s.share(all))
+	return nil
+}
+
+// share splits the global limit proportionally to demand, with every region
+// guaranteed MinShare
+func (s *regionState) share(all map[string]float64) rate.Limit {
+	n := float64(len(all))
+	floor := s.budget.MinShare
+	if floor*n > 1 {
+		floor = 1 / n
+	}
+	var total float64
+	for _, d := range all {
+		total += d
+	}
+	var frac float64
+	if total <= 0 {
+		frac = 1 / n
+	} else {
+		frac = floor + (1-floor*n)*all[s.budget.Region]/total
+	}
+	return rate.Limit(float64(s.budget.GlobalLimit) * frac)
+}
+
+// regionLoop rebalances until r is closed
+func (r *RateLimitedDB) regionLoop() {
+	ticker := time.NewTicker(r.region.budget.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.region.budget.Interval)
+			// on error the previous share stays in force
+			_ = r.region.rebalance(ctx)
+			cancel()
+		}
+	}
+}
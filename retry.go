@@ -0,0 +1,61 @@
+package dbratelimit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RetryAfter returns how long until the main limiter has a token for a
+// call of cost 1, counting tokens already promised to waiting calls, so
+// that clients told to back off can retry when a call would pass rather
+// than guess. It is 0 if a token is available now or the limit is 0.
+func (r *RateLimitedDB) RetryAfter() time.Duration {
+	return r.retryAfter(1)
+}
+
+// retryAfter is RetryAfter for a call of cost n
+func (r *RateLimitedDB) retryAfter(n int) time.Duration {
+	return tokenDelay(r.limiter, n, time.Now())
+}
+
+// tokenDelay returns how long until l has n tokens
+func tokenDelay(l *rate.Limiter, n int, now time.Time) time.Duration {
+	missing := float64(n) - l.TokensAt(now)
+	limit := l.Limit()
+	if missing <= 0 || limit == rate.Inf || limit <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(limit) * float64(time.Second))
+}
+
+// RetryAfterOf returns the delay after which the call failing with err may
+// be retried, as computed from the limiter when it was turned away, and
+// false if err carries none. WriteHTTPError uses it for the Retry-After
+// header.
+func RetryAfterOf(err error) (time.Duration, bool) {
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		return e.RetryAfter, true
+	}
+	return 0, false
+}
+
+// rejected returns ErrRejected with detail and the delay after which a
+// retry may pass
+func rejected(retryAfter time.Duration, format string, args ...any) error {
+	return derived(ErrRejected, CodeRejected, retryAfter, format, args...)
+}
+
+// derived returns an error with the given code wrapping sentinel, adding
+// detail to its message
+func derived(sentinel error, code Code, retryAfter time.Duration, format string, args ...any) *Error {
+	return &Error{
+		Code:       code,
+		RetryAfter: retryAfter,
+		msg:        sentinel.Error() + ": " + fmt.Sprintf(format, args...),
+		err:        sentinel,
+	}
+}
@@ -0,0 +1,57 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestRetryAfter 测试 RetryAfter 计算下一个令牌可用的时间
+func TestRetryAfter(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(2), 1, WithOverflowPolicy(OverflowPolicy{Mode: OverflowReject}))
+	defer rateLimitedDB.Close()
+
+	if d := rateLimitedDB.RetryAfter(); d != 0 {
+		t.Errorf("RetryAfter with a token available = %v, want 0", d)
+	}
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if d := rateLimitedDB.RetryAfter(); d <= 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("RetryAfter after taking the burst = %v, want about 500ms", d)
+	}
+
+	_, err := rateLimitedDB.ExecContext(ctx, "SELECT 1")
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("want ErrRejected, got %v", err)
+	}
+	d, ok := RetryAfterOf(err)
+	if !ok || d <= 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("RetryAfterOf = %v, %t, want about 500ms", d, ok)
+	}
+
+	rec := httptest.NewRecorder()
+	WriteHTTPError(rec, err, 0)
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if _, ok := RetryAfterOf(ErrRejected); ok {
+		t.Error("the bare sentinel should carry no delay")
+	}
+}
+
+// TestRetryAfterUnlimited 测试无限速率和零速率时不给出重试时间
+func TestRetryAfterUnlimited(t *testing.T) {
+	for _, limit := range []rate.Limit{rate.Inf, 0} {
+		l := rate.NewLimiter(limit, 0)
+		if d := tokenDelay(l, 1, time.Now()); d != 0 {
+			t.Errorf("tokenDelay with limit %v = %v, want 0", limit, d)
+		}
+	}
+}
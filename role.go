@@ -0,0 +1,122 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Role is the part an instance plays in a high-availability deployment.
+type Role int
+
+const (
+	RoleLeader Role = iota
+	RoleFollower
+)
+
+func (r Role) String() string {
+	if r == RoleFollower {
+		return "follower"
+	}
+	return "leader"
+}
+
+// RoleProfile holds the limits an instance applies in one role.
+type RoleProfile struct {
+	// Limit and Burst cap those of the main limiter, along with those of
+	// the current profile (see Profile). Zero values leave them to the
+	// profile, else the limit of the last calibration, else the ones r was
+	// created with.
+	Limit rate.Limit
+	Burst int
+	// WriteLimit and WriteBurst bound INSERT, UPDATE and DELETE statements
+	// on top of the main limiter. Zero WriteLimit leaves writes to the main
+	// limiter alone.
+	WriteLimit rate.Limit
+	WriteBurst int
+}
+
+// WithRoles gives the instance a leader and a follower profile and starts
+// it in role initial. Switch roles with SetRole, e.g. on leader election, so
+// that a standby that occasionally reads does not use up the budget meant
+// for the active leader.
+func WithRoles(initial Role, leader, follower RoleProfile) Option {
+	return func(o *options) {
+		o.roles = &roleConfig{initial: initial, profiles: [2]RoleProfile{leader, follower}}
+	}
+}
+
+type roleConfig struct {
+	initial  Role
+	profiles [2]RoleProfile
+}
+
+type roleState struct {
+	mu       sync.Mutex
+	role     Role
+	profiles [2]RoleProfile
+	writes   *rate.Limiter
+}
+
+// SetRole switches r to the profile for role, as one switch like
+// SwitchProfile. It does nothing unless r was created with WithRoles.
+func (r *RateLimitedDB) SetRole(role Role) {
+	s := r.role
+	if s == nil || role < RoleLeader || role > RoleFollower {
+		return
+	}
+	r.switchLimits(func() { r.setRole(role) })
+}
+
+// setRole is SetRole, run by switchLimits
+func (r *RateLimitedDB) setRole(role Role) {
+	s := r.role
+	s.mu.Lock()
+	s.role = role
+	p := s.profiles[role]
+	if p.WriteLimit <= 0 {
+		s.writes.SetLimit(rate.Inf)
+	} else {
+		s.writes.SetLimit(p.WriteLimit)
+		s.writes.SetBurst(max(p.WriteBurst, 1))
+	}
+	s.mu.Unlock()
+	r.applyMainLimits()
+}
+
+// roleProfile returns the profile of the current role, the zero
+// RoleProfile if roles are not configured
+func (r *RateLimitedDB) roleProfile() RoleProfile {
+	s := r.role
+	if s == nil {
+		return RoleProfile{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profiles[s.role]
+}
+
+// Role returns the current role, RoleLeader if roles are not configured.
+func (r *RateLimitedDB) Role() Role {
+	s := r.role
+	if s == nil {
+		return RoleLeader
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.role
+}
+
+// waitRole acquires n tokens from the role's write limiter for writes,
+// adding the reservation to h
+func (r *RateLimitedDB) waitRole(ctx context.Context, verb Verb, n int, h *holds) error {
+	if r.role == nil || !verb.IsWrite() {
+		return nil
+	}
+	if PriorityFrom(ctx) == PriorityCritical {
+		takeN(r.role.writes, n)
+		return nil
+	}
+	return r.waitLimiter(ctx, r.role.writes, n, h)
+}
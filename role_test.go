@@ -0,0 +1,122 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestSetRole 测试主备角色切换时应用各自的限流配置
+func TestSetRole(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithRoles(RoleFollower,
+		RoleProfile{},
+		RoleProfile{Limit: 5, Burst: 2, WriteLimit: rate.Limit(0.001), WriteBurst: 1},
+	))
+	defer rateLimitedDB.Close()
+
+	if rateLimitedDB.Role() != RoleFollower || rateLimitedDB.Limiter().Limit() != 5 {
+		t.Fatalf("Expected follower profile, got %v at %v", rateLimitedDB.Role(), rateLimitedDB.Limiter().Limit())
+	}
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = name"); err != nil {
+		t.Fatalf("First write failed: %v", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "UPDATE users SET name = name"); err == nil {
+		t.Error("Expected follower writes to be limited")
+	}
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err != nil {
+		t.Errorf("Follower read failed: %v", err)
+	}
+
+	// 成为 leader 后恢复创建时的限流配置，写入不再额外受限
+	rateLimitedDB.SetRole(RoleLeader)
+	if l := rateLimitedDB.Limiter(); l.Limit() != 100 || l.Burst() != 10 {
+		t.Errorf("Expected leader profile, got %v/%d", l.Limit(), l.Burst())
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = name"); err != nil {
+			t.Errorf("Leader write failed: %v", err)
+		}
+	}
+}
+
+// TestApplyConfigBaseline 测试 ApplyConfig 回退到角色和校准得到的速率
+func TestApplyConfigBaseline(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10, WithRoles(RoleFollower,
+		RoleProfile{},
+		RoleProfile{Limit: 5, Burst: 2},
+	))
+	defer rateLimitedDB.Close()
+
+	rateLimitedDB.ApplyConfig(Config{})
+	if l := rateLimitedDB.Limiter(); l.Limit() != 5 || l.Burst() != 2 {
+		t.Errorf("Expected follower limit 5/2, got %v/%d", l.Limit(), l.Burst())
+	}
+
+	rateLimitedDB.SetRole(RoleLeader)
+	if _, err := rateLimitedDB.Calibrate(context.Background(), Calibration{Fraction: 0.5, Capacity: 80}); err != nil {
+		t.Fatalf("Calibrate failed: %v", err)
+	}
+	rateLimitedDB.ApplyConfig(Config{})
+	if l := rateLimitedDB.Limiter(); l.Limit() != 40 || l.Burst() != 10 {
+		t.Errorf("Expected calibrated limit 40/10, got %v/%d", l.Limit(), l.Burst())
+	}
+
+	rateLimitedDB.ApplyConfig(Config{Limit: 7})
+	if got := rateLimitedDB.Limiter().Limit(); got != 7 {
+		t.Errorf("Expected configured limit 7, got %v", got)
+	}
+}
+
+// TestRoleAndProfile 测试角色与 profile 以任意顺序切换时取两者中较低的限额
+func TestRoleAndProfile(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(100), 10,
+		WithRoles(RoleLeader, RoleProfile{}, RoleProfile{Limit: 20, Burst: 4}),
+		WithProfiles("normal", map[string]Profile{
+			"normal":   {},
+			"incident": {Limit: 5, Burst: 1},
+			"relaxed":  {Limit: 50, Burst: 8},
+		}))
+	defer rateLimitedDB.Close()
+
+	expect := func(step string, limit rate.Limit, burst int) {
+		t.Helper()
+		if l := rateLimitedDB.Limiter(); l.Limit() != limit || l.Burst() != burst {
+			t.Errorf("%s: expected %v/%d, got %v/%d", step, limit, burst, l.Limit(), l.Burst())
+		}
+	}
+
+	// 先切换 profile，再切换角色
+	rateLimitedDB.SwitchProfile("incident")
+	expect("incident", 5, 1)
+	rateLimitedDB.SetRole(RoleFollower)
+	expect("incident follower", 5, 1)
+	rateLimitedDB.SetRole(RoleLeader)
+	expect("incident leader", 5, 1)
+	if got := rateLimitedDB.Profile(); got != "incident" {
+		t.Errorf("Expected profile incident, got %q", got)
+	}
+
+	// 先切换角色，再切换 profile
+	rateLimitedDB.SetRole(RoleFollower)
+	rateLimitedDB.SwitchProfile("relaxed")
+	expect("follower relaxed", 20, 4)
+	rateLimitedDB.SetRole(RoleLeader)
+	expect("leader relaxed", 50, 8)
+	rateLimitedDB.SwitchProfile("normal")
+	expect("leader normal", 100, 10)
+}
@@ -0,0 +1,62 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Row is a lazily executed single-row query, see QueryRowLazy.
+type Row struct {
+	r     *RateLimitedDB
+	ctx   context.Context
+	query string
+	args  []any
+}
+
+// QueryRowLazy is QueryRowContext but waits for the limiter and runs the
+// query only when Scan is called, each time it is called.
+func (r *RateLimitedDB) QueryRowLazy(ctx context.Context, query string, args ...any) *Row {
+	return &Row{r: r, ctx: ctx, query: query, args: args}
+}
+
+// failedRow returns a row whose Scan and Err return err, without running
+// anything: database/sql gives up on an expired context before taking a
+// connection and reports the context's Err, which is err
+func (r *RateLimitedDB) failedRow(ctx context.Context, err error) *sql.Row {
+	return r.db.QueryRowContext(failedContext{ctx, err}, "")
+}
+
+// failedContext is a context that is already done with err
+type failedContext struct {
+	context.Context
+	err error
+}
+
+var closedDone = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func (c failedContext) Done() <-chan struct{} { return closedDone }
+func (c failedContext) Err() error            { return c.err }
+
+// Scan waits for the limiter, runs the query and copies the columns of the
+// first row into dest, as sql.Row.Scan does. Each call runs the query again.
+func (row *Row) Scan(dest ...any) error {
+	c, err := row.r.wait(row.ctx, row.query)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	err = row.r.db.QueryRowContext(c.ctx, row.query, row.args...).Scan(dest...)
+	err = c.result(err)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the query itself succeeded
+		c.done(nil)
+	} else {
+		c.done(err)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestQueryRowLazy 测试延迟执行的单行查询在 Scan 时等待并返回限流错误
+func TestQueryRowLazy(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.1), 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	row := rateLimitedDB.QueryRowLazy(ctx, "SELECT name FROM users WHERE id = ?", 1)
+	if tokens := rateLimitedDB.Limiter().Tokens(); tokens < 0.99 {
+		t.Errorf("Expected no tokens used before Scan, got %v left", tokens)
+	}
+	var name string
+	if err := row.Scan(&name); err != nil || name != "Alice" {
+		t.Fatalf("Scan = %q, %v", name, err)
+	}
+
+	if err := rateLimitedDB.QueryRowLazy(WithExempt(ctx), "SELECT name FROM users WHERE id = ?", 99).Scan(&name); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := rateLimitedDB.QueryRowLazy(short, "SELECT name FROM users WHERE id = ?", 1).Scan(&name); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected limiter error from Scan, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ErrTooManyRows is reported by Rows.Err when a result set exceeds the
+// limit set by WithMaxRows.
+var ErrTooManyRows error = newError(CodeRejected, "dbratelimit: too many rows")
+
+// WithMaxRows stops iteration over result sets returned by QueryRows after
+// n rows, reporting ErrTooManyRows, so an accidental unbounded SELECT cannot
+// stream a whole table into the application. With several result sets the
+// limit applies to each. Only QueryRows and QueryIter enforce it: the plain
+// *sql.Rows of QueryContext and of the Tx and GORM query paths cannot be
+// limited, so read with QueryRows where the limit matters. n <= 0 disables
+// the limit.
+func WithMaxRows(n int64) Option {
+	return func(o *options) {
+		o.maxRows = n
+	}
+}
+
+// WithResultSetCost charges n tokens for each result set after the first
+// one reached through Rows.NextResultSet, for stored procedures and batches
+// whose later sets cost about as much as a query of their own. The first set
+// is paid for by the query. Default 0, charging nothing.
+func WithResultSetCost(n int) Option {
+	return func(o *options) {
+		o.resultSetCost = n
+	}
+}
+
+// Rows is a *sql.Rows that enforces the WithMaxRows limit and
+// WithResultSetCost. Unlike a plain *sql.Rows it keeps the query's verb
+// slot (see WithVerbConcurrency) and timeouts until it is closed.
+type Rows struct {
+	*sql.Rows
+	r    *RateLimitedDB
+	ctx  context.Context
+	hold *rowsHold
+	max  int64
+	seen int64
+	err  error
+}
+
+// QueryRows is QueryContext returning rows that enforce the WithMaxRows
+// limit.
+func (r *RateLimitedDB) QueryRows(ctx context.Context, query string, args ...any) (*Rows, error) {
+	rows, hold, err := r.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	hold.keep()
+	return &Rows{Rows: rows, r: r, ctx: ctx, hold: hold, max: r.opts.maxRows}, nil
+}
+
+// Next is sql.Rows.Next, except that it returns false and closes the rows
+// when there are more rows than allowed.
+func (rs *Rows) Next() bool {
+	if rs.err != nil {
+		return false
+	}
+	if !rs.Rows.Next() {
+		rs.ended()
+		return false
+	}
+	if rs.max > 0 && rs.seen >= rs.max {
+		rs.err = fmt.Errorf("%w: more than %d", ErrTooManyRows, rs.max)
+		rs.Close()
+		return false
+	}
+	rs.seen++
+	return true
+}
+
+// Close is sql.Rows.Close, also releasing what the query holds.
+func (rs *Rows) Close() error {
+	err := rs.Rows.Close()
+	rs.hold.end()
+	return err
+}
+
+// ended releases what the query holds if the rows closed themselves,
+// which sql.Rows does once Next or NextResultSet find nothing more to
+// read; Columns fails on closed rows.
+func (rs *Rows) ended() {
+	if _, err := rs.Rows.Columns(); err != nil {
+		rs.hold.end()
+	}
+}
+
+// NextResultSet is sql.Rows.NextResultSet, except that it waits for the
+// tokens set by WithResultSetCost before moving on, and gives them back if
+// there is no further result set. If the wait fails it closes the rows
+// without moving on and returns false, and Err reports why.
+func (rs *Rows) NextResultSet() bool {
+	if rs.err != nil {
+		return false
+	}
+	var h holds
+	if n := rs.r.opts.resultSetCost; n > 0 {
+		if err := rs.r.acquireStages(rs.ctx, n, &h); err != nil {
+			h.cancel(time.Now())
+			rs.err = err
+			rs.Close()
+			return false
+		}
+	}
+	if !rs.Rows.NextResultSet() {
+		h.cancel(time.Now())
+		rs.ended()
+		return false
+	}
+	rs.seen = 0
+	return true
+}
+
+// Err returns ErrTooManyRows if iteration was stopped by the row limit, and
+// the error from sql.Rows.Err otherwise.
+func (rs *Rows) Err() error {
+	if rs.err != nil {
+		return rs.err
+	}
+	return rs.Rows.Err()
+}
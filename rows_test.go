@@ -0,0 +1,178 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestMaxRows 测试超过行数上限时停止迭代并返回 ErrTooManyRows
+func TestMaxRows(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1, WithMaxRows(2))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	for _, name := range []string{"Bob", "Carol"} {
+		if _, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", name, name); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	count := func(query string) (int, error) {
+		rows, err := rateLimitedDB.QueryRows(ctx, query)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		return n, rows.Err()
+	}
+
+	if n, err := count("SELECT id FROM users LIMIT 2"); err != nil || n != 2 {
+		t.Errorf("Expected 2 rows within the limit, got %d, %v", n, err)
+	}
+	n, err := count("SELECT id FROM users")
+	if !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("Expected ErrTooManyRows, got %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected iteration to stop after 2 rows, got %d", n)
+	}
+}
+
+// multiSetDriver 返回多个结果集的测试驱动，每个查询返回三个各含两行的结果集
+type multiSetDriver struct{}
+
+func (multiSetDriver) Open(string) (driver.Conn, error) { return multiSetConn{}, nil }
+
+type multiSetConn struct{}
+
+func (multiSetConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (multiSetConn) Close() error                        { return nil }
+func (multiSetConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// lastMultiSet 是 multiSetConn 最近一次返回的结果集，用于检查游标的位置
+var lastMultiSet *multiSetRows
+
+func (multiSetConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	lastMultiSet = &multiSetRows{sets: 3}
+	return lastMultiSet, nil
+}
+
+type multiSetRows struct {
+	sets, set, row int
+}
+
+func (r *multiSetRows) Columns() []string { return []string{"n"} }
+func (r *multiSetRows) Close() error      { return nil }
+
+func (r *multiSetRows) Next(dest []driver.Value) error {
+	if r.row == 2 {
+		return io.EOF
+	}
+	r.row++
+	dest[0] = int64(r.set*10 + r.row)
+	return nil
+}
+
+func (r *multiSetRows) HasNextResultSet() bool { return r.set+1 < r.sets }
+
+func (r *multiSetRows) NextResultSet() error {
+	if !r.HasNextResultSet() {
+		return io.EOF
+	}
+	r.set++
+	r.row = 0
+	return nil
+}
+
+func init() {
+	sql.Register("dbratelimit-multiset", multiSetDriver{})
+}
+
+// TestNextResultSet 测试多结果集的遍历、每个结果集单独计算行数上限以及按结果集计费
+func TestNextResultSet(t *testing.T) {
+	db, err := sql.Open("dbratelimit-multiset", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 2, WithMaxRows(2), WithResultSetCost(1))
+	defer rateLimitedDB.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	rows, err := rateLimitedDB.QueryRows(ctx, "CALL report()")
+	if err != nil {
+		t.Fatalf("QueryRows failed: %v", err)
+	}
+	defer rows.Close()
+
+	var got []int64
+	sets := 0
+	for {
+		sets++
+		for rows.Next() {
+			var n int64
+			if err := rows.Scan(&n); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			got = append(got, n)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	// 查询用掉一个令牌，第二个结果集用掉最后一个，第三个等不到令牌
+	if sets != 2 || len(got) != 4 || got[3] != 12 {
+		t.Errorf("read %d sets with rows %v, want 2 sets of 2 rows", sets, got)
+	}
+	if err := rows.Err(); err == nil {
+		t.Error("Expected an error for the result set that could not be paid for")
+	}
+	if lastMultiSet.set != 1 {
+		t.Errorf("Expected the cursor to stay on the second result set, is on set %d", lastMultiSet.set+1)
+	}
+}
+
+// TestNextResultSetRefund 测试没有下一个结果集时退还为它等到的令牌
+func TestNextResultSetRefund(t *testing.T) {
+	db, err := sql.Open("dbratelimit-multiset", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 4, WithResultSetCost(1))
+	defer rateLimitedDB.Close()
+
+	rows, err := rateLimitedDB.QueryRows(context.Background(), "CALL report()")
+	if err != nil {
+		t.Fatalf("QueryRows failed: %v", err)
+	}
+	defer rows.Close()
+	sets := 1
+	for rows.NextResultSet() {
+		sets++
+	}
+	if err := rows.Err(); err != nil || sets != 3 {
+		t.Fatalf("read %d sets, %v, want 3 sets", sets, err)
+	}
+	// 查询和后两个结果集各用掉一个令牌，最后一次没有结果集的调用应当退还
+	if tokens := rateLimitedDB.Limiter().Tokens(); tokens < 0.99 {
+		t.Errorf("Expected the token for the missing result set back, have %.2f", tokens)
+	}
+}
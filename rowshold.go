@@ -0,0 +1,102 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// rowsHold keeps what a query holds, such as its verb concurrency slot and
+// the timeouts of its context, until its rows are done with. *sql.Rows and
+// *sql.Row do not report being closed, so only the Rows of QueryRows keep
+// the hold until Close, or until Next or NextResultSet find them closed;
+// the other query calls give most of it up when they return, see returned.
+type rowsHold struct {
+	ctx    context.Context // the query's
+	sem    *semaphore.Weighted
+	cancel [2]context.CancelFunc // of the call's contexts, nil if none
+
+	mu   sync.Mutex
+	stop func() bool // stops watching the query's context, set by keep
+	done bool
+}
+
+// holdRows hands what the call keeps for its rows to a rowsHold: the verb
+// slot and the cancel funcs of its contexts. It returns nil if there is
+// nothing to keep.
+func (c *call) holdRows() *rowsHold {
+	if c.verbSem == nil && c.cancelExec == nil && c.cancelCall == nil {
+		return nil
+	}
+	h := &rowsHold{ctx: c.ctx, sem: c.verbSem, cancel: [2]context.CancelFunc{c.cancelExec, c.cancelCall}}
+	c.verbSem, c.cancelExec, c.cancelCall = nil, nil, nil
+	return h
+}
+
+// returned is called by the query calls returning a plain *sql.Rows or
+// *sql.Row once the query returned, or failed with err. A failed query
+// ends the hold at once. Otherwise the verb slot is released, and the
+// contexts, which the rows still read from, are left to end at their
+// deadline. A nil h does nothing.
+func (h *rowsHold) returned(err error) {
+	if h == nil {
+		return
+	}
+	if err != nil {
+		h.end()
+		return
+	}
+	h.mu.Lock()
+	sem := h.sem
+	h.sem = nil
+	h.mu.Unlock()
+	if sem != nil {
+		sem.Release(1)
+	}
+}
+
+// keep holds h until end, which also runs once the query's context is
+// done, as that closes the rows. A nil h does nothing.
+func (h *rowsHold) keep() {
+	if h == nil {
+		return
+	}
+	stop := context.AfterFunc(h.ctx, h.end)
+	h.mu.Lock()
+	if h.done {
+		h.mu.Unlock()
+		stop()
+		return
+	}
+	h.stop = stop
+	h.mu.Unlock()
+}
+
+// end releases everything h holds; only the first call does anything. A
+// nil h does nothing.
+func (h *rowsHold) end() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	if h.done {
+		h.mu.Unlock()
+		return
+	}
+	h.done = true
+	stop, sem := h.stop, h.sem
+	h.sem = nil
+	h.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	if sem != nil {
+		sem.Release(1)
+	}
+	for _, cancel := range h.cancel {
+		if cancel != nil {
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package dbratelimit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WithMaxQueueDelaySLO keeps the p95 of admission waits under d by shedding
+// load: while the p95 over the last second exceeds d, calls that would have
+// to wait are rejected with ErrRejected, starting with PriorityLow and
+// moving up one priority per second while the p95 stays too high, up to
+// PriorityHigh. Shedding backs off one priority at a time once the p95 is
+// under d/2. Critical calls are never shed.
+func WithMaxQueueDelaySLO(d time.Duration) Option {
+	return func(o *options) {
+		o.queueSLO = d
+	}
+}
+
+const (
+	sloInterval = time.Second
+	sloSamples  = 4096 // waits kept per interval
+)
+
+type sloState struct {
+	target time.Duration
+
+	mu       sync.Mutex
+	waits    []time.Duration // admission waits in this interval
+	shedding bool
+	level    Priority // highest priority shed while shedding
+}
+
+func newSLOState(d time.Duration) *sloState {
+	return &sloState{target: d, waits: make([]time.Duration, 0, sloSamples)}
+}
+
+// observe records the admission wait of an admitted call
+func (s *sloState) observe(wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waits) < sloSamples {
+		s.waits = append(s.waits, wait)
+	}
+}
+
+// evaluate compares the p95 of this interval with the target and adjusts
+// the shed level
+func (s *sloState) evaluate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p95 := percentile(s.waits, 0.95)
+	s.waits = s.waits[:0]
+	switch {
+	case p95 > s.target:
+		if !s.shedding {
+			s.shedding, s.level = true, PriorityLow
+		} else if s.level < PriorityHigh {
+			s.level++
+		}
+	case s.shedding && p95 < s.target/2:
+		if s.level == PriorityLow {
+			s.shedding = false
+		} else {
+			s.level--
+		}
+	}
+}
+
+// sheds reports whether calls of priority p are currently shed
+func (s *sloState) sheds(p Priority) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shedding && p <= s.level && p != PriorityCritical
+}
+
+// percentile returns the q-th percentile of waits, sorting them in place
+func percentile(waits []time.Duration, q float64) time.Duration {
+	if len(waits) == 0 {
+		return 0
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	return waits[int(q*float64(len(waits)-1))]
+}
+
+// SheddingPriority returns the highest priority currently shed by
+// WithMaxQueueDelaySLO, and false if nothing is shed.
+func (r *RateLimitedDB) SheddingPriority() (Priority, bool) {
+	if r.slo == nil {
+		return 0, false
+	}
+	r.slo.mu.Lock()
+	defer r.slo.mu.Unlock()
+	return r.slo.level, r.slo.shedding
+}
+
+// shedForSLO rejects a call that would have to wait for n tokens while its
+// priority is being shed
+func (r *RateLimitedDB) shedForSLO(ctx context.Context, n int) error {
+	if r.slo == nil || !r.slo.sheds(PriorityFrom(ctx)) {
+		return nil
+	}
+	if r.limiter.Tokens() >= float64(n) {
+		return nil
+	}
+	return derived(ErrRejected, CodeOverloaded, r.retryAfter(n), "shed to keep p95 admission wait under %v", r.slo.target)
+}
+
+// sloLoop evaluates the SLO every interval until r is closed
+func (r *RateLimitedDB) sloLoop() {
+	ticker := time.NewTicker(sloInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.slo.evaluate()
+		}
+	}
+}
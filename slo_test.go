@@ -0,0 +1,63 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestMaxQueueDelaySLO 测试 p95 等待超出目标时按优先级从低到高拒绝请求
+func TestMaxQueueDelaySLO(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1, WithMaxQueueDelaySLO(50*time.Millisecond))
+	defer rateLimitedDB.Close()
+	slo := rateLimitedDB.slo
+
+	for i := 0; i < 20; i++ {
+		slo.observe(200 * time.Millisecond)
+	}
+	slo.evaluate()
+	if p, ok := rateLimitedDB.SheddingPriority(); !ok || p != PriorityLow {
+		t.Fatalf("Expected low priority to be shed, got %v %v", p, ok)
+	}
+
+	ctx := context.Background()
+	low := WithPriority(ctx, PriorityLow)
+	// 有令牌时不拒绝
+	if _, err := rateLimitedDB.ExecContext(low, "SELECT 1"); err != nil {
+		t.Fatalf("Expected call with tokens available to pass: %v", err)
+	}
+	if _, err := rateLimitedDB.ExecContext(low, "SELECT 1"); !errors.Is(err, ErrRejected) || CodeOf(err) != CodeOverloaded {
+		t.Errorf("Expected low priority call to be shed as overloaded, got %v", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); errors.Is(err, ErrRejected) {
+		t.Errorf("Normal priority should not be shed yet: %v", err)
+	}
+
+	// 持续超标时逐级提升，最高到 PriorityHigh
+	for i := 0; i < 4; i++ {
+		slo.observe(time.Second)
+		slo.evaluate()
+	}
+	if p, _ := rateLimitedDB.SheddingPriority(); p != PriorityHigh {
+		t.Errorf("Expected shedding to stop at high priority, got %v", p)
+	}
+	if !slo.sheds(PriorityHigh) || slo.sheds(PriorityCritical) {
+		t.Error("Critical calls must never be shed")
+	}
+
+	// 恢复后逐级回退
+	for i := 0; i < 3; i++ {
+		slo.evaluate()
+	}
+	if _, ok := rateLimitedDB.SheddingPriority(); ok {
+		t.Error("Expected shedding to stop once waits are low")
+	}
+}
@@ -0,0 +1,233 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var soak = flag.Duration("soak", 0, "run TestSoak for this long, e.g. -soak=10m; best combined with -race")
+
+// TestSoak 测试长时间混合负载下的不变量：随机取消、运行时修改限额以及在流量中关闭
+func TestSoak(t *testing.T) {
+	if *soak <= 0 {
+		t.Skip("enable with -soak=<duration>")
+	}
+	db := setupTestDB(t)
+	var panics atomic.Int64
+	rateLimitedDB := Wrap(db, rate.Limit(2000), 50,
+		WithMaxConcurrency(8),
+		WithVerbConcurrency(2, VerbInsert),
+		WithTagLimits(map[string]LimitConfig{"report": {Limit: 1000, Burst: 20}}),
+		WithKeyedLimit(1000, 20),
+		WithStmtCache(16),
+		WithUsageAccounting(),
+		WithDebugPage(DebugPage{}),
+		WithEvents(EventConfig{}),
+		WithHooks(Hooks{OnPanic: func(PanicEvent) { panics.Add(1) }}),
+		WithTokenAudit(false),
+	)
+	go func() {
+		for range rateLimitedDB.Events() {
+		}
+	}()
+
+	var (
+		ops        atomic.Int64
+		mu         sync.Mutex
+		unexpected = map[string]int{}
+	)
+	check := func(err error) {
+		if err == nil || soakExpected(err) {
+			return
+		}
+		mu.Lock()
+		unexpected[err.Error()]++
+		mu.Unlock()
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 32; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				ops.Add(1)
+				check(soakOp(rateLimitedDB, w, i))
+			}
+		}()
+	}
+
+	// change the limits under the traffic
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Duration(rand.IntN(20)) * time.Millisecond):
+			}
+			switch rand.IntN(4) {
+			case 0:
+				rateLimitedDB.SetLimit(rate.Limit(100 + rand.IntN(5000)))
+			case 1:
+				rateLimitedDB.Limiter().SetBurst(1 + rand.IntN(100))
+			case 2:
+				rateLimitedDB.FreezeWrites()
+				time.Sleep(time.Millisecond)
+				rateLimitedDB.ThawWrites()
+			case 3:
+				rateLimitedDB.Stats()
+				rateLimitedDB.Waiters()
+				rateLimitedDB.WriteDiagnostics(discard{})
+			}
+		}
+	}()
+
+	time.Sleep(*soak)
+	// close while the workers are still sending
+	if err := rateLimitedDB.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	t.Logf("%d operations, stats %+v", ops.Load(), rateLimitedDB.Stats().Counters)
+	for msg, n := range unexpected {
+		t.Errorf("unexpected error %dx: %s", n, msg)
+	}
+	if n := rateLimitedDB.Leaks(); n != 0 {
+		t.Errorf("%d leaks", n)
+	}
+	if a := rateLimitedDB.TokenAudit(); a.Mismatches != 0 || a.Granted != a.Charged+a.Forfeited {
+		t.Errorf("token audit = %+v", a)
+	}
+	if n := panics.Load(); n != 0 {
+		t.Errorf("%d panics recovered", n)
+	}
+	s := rateLimitedDB.Stats()
+	if s.Waiting != 0 || s.InFlight != 0 {
+		t.Errorf("%d waiting and %d in flight after the traffic stopped", s.Waiting, s.InFlight)
+	}
+	if w := rateLimitedDB.Waiters(); len(w) != 0 {
+		t.Errorf("%d calls left queued", len(w))
+	}
+}
+
+// soakOp runs one random operation, canceling some of them at random
+func soakOp(r *RateLimitedDB, worker, i int) error {
+	ctx := context.Background()
+	switch rand.IntN(4) {
+	case 0:
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(rand.IntN(2000))*time.Microsecond)
+		defer cancel()
+	case 1:
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		time.AfterFunc(time.Duration(rand.IntN(500))*time.Microsecond, cancel)
+	}
+	switch rand.IntN(3) {
+	case 0:
+		ctx = WithTag(ctx, "report")
+	case 1:
+		ctx = WithKey(ctx, fmt.Sprint("tenant", worker%4))
+	}
+	if rand.IntN(50) == 0 {
+		ctx = WithPriority(ctx, PriorityCritical)
+	}
+
+	switch rand.IntN(7) {
+	case 0:
+		rows, err := r.QueryContext(ctx, "SELECT id, name FROM users WHERE id > ?", rand.IntN(10))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() && rand.IntN(4) != 0 {
+		}
+		return rows.Err()
+	case 1:
+		var n int
+		err := r.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+		return err
+	case 2:
+		_, err := r.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", "soak", fmt.Sprintf("w%d-%d@example.com", worker, i))
+		return err
+	case 3:
+		_, err := r.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", "soaked", rand.IntN(100))
+		return err
+	case 4:
+		tx, err := r.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email = ? WHERE id = ?", "tx@example.com", rand.IntN(100)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if rand.IntN(2) == 0 {
+			return tx.Rollback()
+		}
+		return tx.Commit()
+	case 5:
+		return r.RunInTx(ctx, func(tx *Tx) error {
+			var n int
+			return tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+		}, nil)
+	default:
+		stmt, err := r.PrepareContext(ctx, "SELECT name FROM users WHERE id = ?")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		var name string
+		err = stmt.QueryRowContext(ctx, 1).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+}
+
+// soakExpected reports whether err is one the soak traffic is expected to
+// cause: cancellations, frozen writes, SQLite lock contention and calls made
+// after Close
+func soakExpected(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrWaitBudgetExceeded), errors.Is(err, ErrWritesFrozen),
+		errors.Is(err, sql.ErrConnDone), errors.Is(err, sql.ErrTxDone):
+		return true
+	}
+	msg := err.Error()
+	for _, s := range []string{"database is closed", "locked", "busy", "interrupted", "would exceed context deadline"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,60 @@
+package dbratelimit
+
+import (
+	"runtime"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// StackSampling configures WithStackSampling.
+type StackSampling struct {
+	// Threshold is the admission wait from which a call's stack is
+	// captured. Default 100ms.
+	Threshold time.Duration
+	// PerSecond caps the stacks captured per second. Default 1.
+	PerSecond int
+	// MaxBytes truncates each stack. Default 8 KiB.
+	MaxBytes int
+}
+
+// WithStackSampling captures the stack of the goroutine issuing a call
+// that waited at least s.Threshold for admission, whether it was admitted
+// or rejected, and attaches it to the call's Event as Event.Stack, so that
+// during an incident the event stream shows which code paths were
+// throttled. Capturing is capped per second, as it stops the goroutine for
+// a moment. It has no effect without WithEvents.
+func WithStackSampling(s StackSampling) Option {
+	if s.Threshold <= 0 {
+		s.Threshold = 100 * time.Millisecond
+	}
+	if s.PerSecond <= 0 {
+		s.PerSecond = 1
+	}
+	if s.MaxBytes <= 0 {
+		s.MaxBytes = 8 << 10
+	}
+	return func(o *options) {
+		o.stackSampling = &s
+	}
+}
+
+type stackSampler struct {
+	cfg StackSampling
+	cap *rate.Limiter
+}
+
+func newStackSampler(s StackSampling) *stackSampler {
+	return &stackSampler{cfg: s, cap: rate.NewLimiter(rate.Limit(s.PerSecond), s.PerSecond)}
+}
+
+// sampleStack captures the calling goroutine's stack for c if it waited
+// long enough and the cap allows
+func (c *call) sampleStack() {
+	s := c.r.stacks
+	if s == nil || c.admitted.Sub(c.start) < s.cfg.Threshold || !s.cap.AllowN(c.admitted, 1) {
+		return
+	}
+	buf := make([]byte, s.cfg.MaxBytes)
+	c.stack = buf[:runtime.Stack(buf, false)]
+}
@@ -0,0 +1,41 @@
+package dbratelimit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestStackSampling 测试等待超过阈值的调用在事件中带上调用栈，且有频率上限
+func TestStackSampling(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Limit(20), 1,
+		WithEvents(EventConfig{}),
+		WithStackSampling(StackSampling{Threshold: 20 * time.Millisecond, PerSecond: 1}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	for range 3 {
+		if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stacks int
+	for range 3 {
+		e := <-rateLimitedDB.Events()
+		if e.Stack == nil {
+			continue
+		}
+		stacks++
+		if e.Kind != EventThrottled || !bytes.Contains(e.Stack, []byte("TestStackSampling")) {
+			t.Errorf("%v event with stack %s", e.Kind, e.Stack)
+		}
+	}
+	// 第一次调用不等待；之后两次等待的调用中只有一次在上限内
+	if stacks != 1 {
+		t.Errorf("got %d stacks, want 1", stacks)
+	}
+}
@@ -0,0 +1,188 @@
+package dbratelimit
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throttledAfter is the wait above which a call counts as throttled
+const throttledAfter = time.Millisecond
+
+// Counters are cumulative call statistics.
+type Counters struct {
+	Calls     uint64        // calls admitted to the database
+	Throttled uint64        // admitted calls that waited at least 1ms
+	Rejected  uint64        // calls that failed admission
+	Errors    uint64        // admitted calls that returned an error
+	WaitTime  time.Duration // total time spent waiting for admission
+	ExecTime  time.Duration // total time spent in the database
+}
+
+// Stats is a snapshot of the wrapper's statistics.
+type Stats struct {
+	Counters
+	// Waiting is the number of calls currently waiting for admission, the
+	// most direct sign of saturation. InFlight also counts calls running in
+	// the database.
+	Waiting  int64
+	InFlight int64
+	// WaitLatency is the distribution of admission waits of all calls,
+	// ExecLatency that of execution times of admitted calls.
+	WaitLatency Histogram
+	ExecLatency Histogram
+	// ScheduledLatency is the distribution of QueryInfo.Scheduled of all
+	// calls: what callers saw, including waits behind earlier calls when
+	// they set WithIntendedStart.
+	ScheduledLatency Histogram
+	// RecentLatency holds the rolling percentiles of WithLatencyAlerts as
+	// of their last evaluation, and is zero without it.
+	RecentLatency LatencyPercentiles
+	// Tags holds the same counters per tag set with WithTag.
+	Tags map[string]Counters
+}
+
+// counterShard is one shard of counters, padded to its own cache line
+type counterShard struct {
+	calls, throttled, rejected, errors uint64
+	wait, exec                         int64
+	_                                  [16]byte
+}
+
+// counters is the atomically updated form of Counters. Each call updates a
+// random shard, so concurrent calls rarely touch the same cache line.
+type counters struct {
+	shards []counterShard
+}
+
+func newCounters() *counters {
+	return &counters{shards: make([]counterShard, statShards)}
+}
+
+// statShards is GOMAXPROCS rounded up to a power of two, at most 64
+var statShards = func() int {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) && n < 64 {
+		n <<= 1
+	}
+	return n
+}()
+
+// record adds info to shard i, which must be below statShards
+func (c *counters) record(i uint32, info QueryInfo, admitted bool) {
+	sh := &c.shards[i]
+	atomic.AddInt64(&sh.wait, int64(info.Wait))
+	if !admitted {
+		atomic.AddUint64(&sh.rejected, 1)
+		return
+	}
+	atomic.AddUint64(&sh.calls, 1)
+	atomic.AddInt64(&sh.exec, int64(info.Exec))
+	if info.Wait >= throttledAfter {
+		atomic.AddUint64(&sh.throttled, 1)
+	}
+	if info.Err != nil {
+		atomic.AddUint64(&sh.errors, 1)
+	}
+}
+
+func (c *counters) snapshot() Counters {
+	var out Counters
+	for i := range c.shards {
+		sh := &c.shards[i]
+		out.Calls += atomic.LoadUint64(&sh.calls)
+		out.Throttled += atomic.LoadUint64(&sh.throttled)
+		out.Rejected += atomic.LoadUint64(&sh.rejected)
+		out.Errors += atomic.LoadUint64(&sh.errors)
+		out.WaitTime += time.Duration(atomic.LoadInt64(&sh.wait))
+		out.ExecTime += time.Duration(atomic.LoadInt64(&sh.exec))
+	}
+	return out
+}
+
+// add adds o to c
+func (c *Counters) add(o Counters) {
+	c.Calls += o.Calls
+	c.Throttled += o.Throttled
+	c.Rejected += o.Rejected
+	c.Errors += o.Errors
+	c.WaitTime += o.WaitTime
+	c.ExecTime += o.ExecTime
+}
+
+// stats records each call in the counters of its tag only, or in untagged;
+// the totals are summed up by Stats, which keeps a tagged call from paying
+// for two sets of counters.
+type stats struct {
+	untagged *counters
+	tags     sync.Map // tag -> *counters
+
+	// latency histograms of all calls, sharded like the counters
+	wait, exec, scheduled []histogram
+}
+
+func newStats() stats {
+	return stats{
+		untagged:  newCounters(),
+		wait:      make([]histogram, statShards),
+		exec:      make([]histogram, statShards),
+		scheduled: make([]histogram, statShards),
+	}
+}
+
+func (s *stats) tag(name string) *counters {
+	if c, ok := s.tags.Load(name); ok {
+		return c.(*counters)
+	}
+	c, _ := s.tags.LoadOrStore(name, newCounters())
+	return c.(*counters)
+}
+
+func (s *stats) record(tag string, info QueryInfo, admitted bool) {
+	i := rand.Uint32() & uint32(statShards-1)
+	c := s.untagged
+	if tag != "" {
+		c = s.tag(tag)
+	}
+	c.record(i, info, admitted)
+	s.wait[i].record(info.Wait)
+	s.scheduled[i].record(info.Scheduled)
+	if admitted {
+		s.exec[i].record(info.Exec)
+	}
+}
+
+// Stats returns a snapshot of the statistics collected so far.
+func (r *RateLimitedDB) Stats() Stats {
+	out := Stats{
+		Counters: r.stats.untagged.snapshot(),
+		Waiting:  r.Waiting(),
+		InFlight: atomic.LoadInt64(&r.inFlight),
+	}
+	if r.latency != nil {
+		out.RecentLatency = r.latency.percentiles()
+	}
+	for i := range r.stats.wait {
+		r.stats.wait[i].addTo(&out.WaitLatency)
+		r.stats.exec[i].addTo(&out.ExecLatency)
+		r.stats.scheduled[i].addTo(&out.ScheduledLatency)
+	}
+	r.stats.tags.Range(func(name, c any) bool {
+		if out.Tags == nil {
+			out.Tags = make(map[string]Counters)
+		}
+		tc := c.(*counters).snapshot()
+		out.Tags[name.(string)] = tc
+		out.Counters.add(tc)
+		return true
+	})
+	return out
+}
+
+// Waiting returns the number of calls currently waiting for admission. It is
+// cheaper than Stats for polling as a gauge.
+func (r *RateLimitedDB) Waiting() int64 {
+	return atomic.LoadInt64(&r.waiting)
+}
@@ -0,0 +1,302 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestStats 测试全局和按 tag 统计
+func TestStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(50), 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	checkout := WithTag(ctx, "checkout")
+	for i := 0; i < 2; i++ {
+		if _, err := rateLimitedDB.ExecContext(checkout, "UPDATE users SET name = name"); err != nil {
+			t.Fatalf("ExecContext failed: %v", err)
+		}
+	}
+	if _, err := rateLimitedDB.ExecContext(WithTag(ctx, "reports"), "NOT SQL"); err == nil {
+		t.Fatal("Expected syntax error")
+	}
+	short, cancel := context.WithTimeout(WithTag(ctx, "reports"), time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err == nil {
+		t.Fatal("Expected call to be rejected")
+	}
+
+	stats := rateLimitedDB.Stats()
+	if stats.Calls != 3 || stats.Errors != 1 || stats.Rejected != 1 {
+		t.Errorf("Unexpected totals: %+v", stats.Counters)
+	}
+	if stats.Throttled < 1 || stats.WaitTime <= 0 {
+		t.Errorf("Expected throttled calls with wait time: %+v", stats.Counters)
+	}
+
+	c := stats.Tags["checkout"]
+	if c.Calls != 2 || c.Errors != 0 {
+		t.Errorf("Unexpected checkout stats: %+v", c)
+	}
+	r := stats.Tags["reports"]
+	if r.Calls != 1 || r.Errors != 1 || r.Rejected != 1 {
+		t.Errorf("Unexpected reports stats: %+v", r)
+	}
+	if TagFrom(ctx) != "" || TagFrom(checkout) != "checkout" {
+		t.Error("TagFrom returned unexpected value")
+	}
+}
+
+// TestWaitingGauge 测试等待中的调用数
+func TestWaitingGauge(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rateLimitedDB.ExecContext(waitCtx, "SELECT 1")
+		}()
+	}
+	for i := 0; i < 100 && rateLimitedDB.Waiting() < 3; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	s := rateLimitedDB.Stats()
+	if s.Waiting != 3 || s.InFlight != 3 {
+		t.Errorf("Expected 3 waiting and in flight, got %d, %d", s.Waiting, s.InFlight)
+	}
+
+	cancel()
+	wg.Wait()
+	if s := rateLimitedDB.Stats(); s.Waiting != 0 || s.InFlight != 0 {
+		t.Errorf("Expected gauges back to 0, got %d waiting, %d in flight", s.Waiting, s.InFlight)
+	}
+}
+
+// TestHistogram 测试延迟直方图的分桶与分位数估计
+func TestHistogram(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 3, 4, 7, 8, 1000, time.Millisecond, time.Hour} {
+		i := histBucket(d)
+		if lo, hi := histLower(i), histLower(i+1); d < lo || d >= hi {
+			t.Errorf("%v in bucket %d = [%v, %v)", d, i, lo, hi)
+		}
+	}
+
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	var snap Histogram
+	h.addTo(&snap)
+	if snap.Count() != 100 {
+		t.Fatalf("Expected 100 samples, got %d", snap.Count())
+	}
+	for _, c := range []struct {
+		q    float64
+		want time.Duration
+	}{{0.5, 50 * time.Millisecond}, {0.95, 95 * time.Millisecond}, {0.99, 99 * time.Millisecond}} {
+		got := snap.Quantile(c.q)
+		if diff := float64(got-c.want) / float64(c.want); diff < -0.125 || diff > 0.125 {
+			t.Errorf("Quantile(%v) = %v, want about %v", c.q, got, c.want)
+		}
+	}
+}
+
+// TestStatsLatency 测试 Stats 中的延迟分布
+func TestStatsLatency(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	for i := 0; i < 10; i++ {
+		rateLimitedDB.ExecContext(context.Background(), "SELECT 1")
+	}
+	stats := rateLimitedDB.Stats()
+	if stats.WaitLatency.Count() != 10 || stats.ExecLatency.Count() != 10 {
+		t.Errorf("Expected 10 samples, got %d and %d", stats.WaitLatency.Count(), stats.ExecLatency.Count())
+	}
+	if stats.ExecLatency.Quantile(0.5) <= 0 {
+		t.Error("Expected positive median execution time")
+	}
+}
+
+// BenchmarkStatsRecord 测量并发记录统计的开销
+func BenchmarkStatsRecord(b *testing.B) {
+	s := newStats()
+	info := QueryInfo{Wait: 2 * time.Millisecond, Exec: 5 * time.Millisecond}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.record("checkout", info, true)
+		}
+	})
+}
+
+// BenchmarkCall 测量一次完整调用（不含数据库）的开销，用于和 BenchmarkStatsRecord 对比
+func BenchmarkCall(b *testing.B) {
+	db := setupTestDB(b)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+	ctx := WithTag(context.Background(), "checkout")
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c, err := rateLimitedDB.wait(ctx, "SELECT 1")
+			if err != nil {
+				b.Fatal(err)
+			}
+			c.done(nil)
+			c.close()
+		}
+	})
+}
+
+// TestCallAllocs 测试立即放行的调用在包装层内不分配内存
+func TestCallAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items at random under the race detector")
+	}
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1e9), 1000, WithMaxConcurrency(8))
+	defer rateLimitedDB.Close()
+	ctx := WithTag(context.Background(), "checkout")
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		c, err := rateLimitedDB.wait(ctx, "SELECT 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.done(nil)
+		c.close()
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocs per call, want 0", allocs)
+	}
+}
+
+// BenchmarkExecContext 与 BenchmarkExecRaw 对比，衡量包装层（含统计）相对真实查询的开销
+func BenchmarkExecContext(b *testing.B) {
+	db := setupTestDB(b)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+	ctx := WithTag(context.Background(), "checkout")
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkExecRaw(b *testing.B) {
+	db := setupTestDB(b)
+	defer db.Close()
+	ctx := context.Background()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkStatsOverhead 测量记录统计相对一次真实查询的开销，以 stats-% 报告，
+// 目标是低于 5%。内存中的 SQLite 查询几乎是最快的真实查询，经网络的数据库上占比更低
+func BenchmarkStatsOverhead(b *testing.B) {
+	db := setupTestDB(b)
+	defer db.Close()
+	ctx := context.Background()
+
+	start := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	query := time.Since(start)
+
+	s := newStats()
+	info := QueryInfo{Wait: 2 * time.Millisecond, Exec: 5 * time.Millisecond}
+	start = time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.record("checkout", info, true)
+		}
+	})
+	b.ReportMetric(100*float64(time.Since(start))/float64(query), "stats-%")
+}
+
+// TestScheduledLatency 测试从预定开始时间计算的延迟，避免协调遗漏
+func TestScheduledLatency(t *testing.T) {
+	db, _ := setupFakeDB(t)
+	var mu sync.Mutex
+	var infos []QueryInfo
+	rateLimitedDB := Wrap(db, rate.Limit(20), 1, WithHooks(Hooks{
+		AfterQuery: func(_ context.Context, info QueryInfo) {
+			mu.Lock()
+			infos = append(infos, info)
+			mu.Unlock()
+		},
+	}))
+	defer rateLimitedDB.Close()
+
+	// 按每 10ms 一次的节奏发起调用，但限流器每 50ms 才放行一次
+	start := time.Now()
+	for i := range 5 {
+		ctx := WithIntendedStart(context.Background(), start.Add(time.Duration(i)*10*time.Millisecond))
+		if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := infos[len(infos)-1]
+	if last.Wait > 100*time.Millisecond {
+		t.Errorf("Wait = %v, want at most one token interval", last.Wait)
+	}
+	if last.Scheduled < 150*time.Millisecond {
+		t.Errorf("Scheduled = %v, want it to include the time behind earlier calls", last.Scheduled)
+	}
+	stats := rateLimitedDB.Stats()
+	if q := stats.ScheduledLatency.Quantile(1); q < 150*time.Millisecond {
+		t.Errorf("ScheduledLatency max = %v", q)
+	}
+
+	// 未来的预定时间被忽略
+	ctx := WithIntendedStart(context.Background(), time.Now().Add(time.Hour))
+	if _, err := rateLimitedDB.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if info := infos[len(infos)-1]; info.Scheduled != info.Wait+info.Exec {
+		t.Errorf("Scheduled = %v, want Wait+Exec %v", info.Scheduled, info.Wait+info.Exec)
+	}
+}
@@ -0,0 +1,87 @@
+package dbratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPStatus returns the HTTP status under which a service should surface
+// err, and false if err does not come from the wrapper, see CodeOf:
+// 429 Too Many Requests for throttled and rejected calls, 503 Service
+// Unavailable for an open circuit or overload, 403 Forbidden for denied
+// calls, 202 Accepted for buffered writes and 500 for invalid settings.
+func HTTPStatus(err error) (int, bool) {
+	switch CodeOf(err) {
+	case CodeThrottled, CodeRejected:
+		return http.StatusTooManyRequests, true
+	case CodeCircuitOpen, CodeOverloaded:
+		return http.StatusServiceUnavailable, true
+	case CodeDenied:
+		return http.StatusForbidden, true
+	case CodeBypassed:
+		return http.StatusAccepted, true
+	case CodeInvalid:
+		return http.StatusInternalServerError, true
+	}
+	return 0, false
+}
+
+// WriteHTTPError writes the status of HTTPStatus with err as the body,
+// adding a Retry-After header, in whole seconds rounded up, if retryAfter is
+// positive. A retryAfter of 0 uses the delay carried by err, see
+// RetryAfterOf. It writes nothing and returns false if err does not come
+// from the wrapper.
+func WriteHTTPError(w http.ResponseWriter, err error, retryAfter time.Duration) bool {
+	status, ok := HTTPStatus(err)
+	if !ok {
+		return false
+	}
+	if retryAfter == 0 {
+		retryAfter, _ = RetryAfterOf(err)
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	}
+	http.Error(w, err.Error(), status)
+	return true
+}
+
+// gRPC status codes, as numbered by google.golang.org/grpc/codes
+const (
+	grpcOK                = 0
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+// GRPCCode returns the gRPC status code under which a service should
+// surface err, as the number of a google.golang.org/grpc/codes.Code, and
+// false if err does not come from the wrapper: ResourceExhausted for
+// throttled and rejected calls, Unavailable for an open circuit or
+// overload, PermissionDenied for denied calls, OK for buffered writes and
+// Internal for invalid settings. This package does not depend on gRPC;
+// convert with codes.Code(c).
+func GRPCCode(err error) (uint32, bool) {
+	switch CodeOf(err) {
+	case CodeThrottled, CodeRejected:
+		return grpcResourceExhausted, true
+	case CodeCircuitOpen, CodeOverloaded:
+		return grpcUnavailable, true
+	case CodeDenied:
+		return grpcPermissionDenied, true
+	case CodeBypassed:
+		return grpcOK, true
+	case CodeInvalid:
+		return grpcInternal, true
+	}
+	return 0, false
+}
+
+// GRPCRetryPushback returns the trailer metadata by which a gRPC server
+// tells retrying clients how long to back off, for a status of GRPCCode.
+func GRPCRetryPushback(retryAfter time.Duration) (key, value string) {
+	return "grpc-retry-pushback-ms", strconv.FormatInt(retryAfter.Milliseconds(), 10)
+}
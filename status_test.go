@@ -0,0 +1,60 @@
+package dbratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStatusHelpers 测试错误码到 HTTP 状态和 gRPC 状态码的映射
+func TestStatusHelpers(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		grpc   uint32
+	}{
+		{fmt.Errorf("%w: no tokens available", ErrRejected), http.StatusTooManyRequests, 8},
+		{ErrWaitBudgetExceeded, http.StatusTooManyRequests, 8},
+		{ErrBackendUnavailable, http.StatusServiceUnavailable, 14},
+		{ErrProxyOverloaded, http.StatusServiceUnavailable, 14},
+		{ErrAdmissionDenied, http.StatusForbidden, 7},
+		{ErrWriteBuffered, http.StatusAccepted, 0},
+		{ErrUnknownProfile, http.StatusInternalServerError, 13},
+	}
+	for _, tt := range tests {
+		if status, ok := HTTPStatus(tt.err); !ok || status != tt.status {
+			t.Errorf("HTTPStatus(%v) = %d, %t, want %d", tt.err, status, ok, tt.status)
+		}
+		if code, ok := GRPCCode(tt.err); !ok || code != tt.grpc {
+			t.Errorf("GRPCCode(%v) = %d, %t, want %d", tt.err, code, ok, tt.grpc)
+		}
+	}
+	if _, ok := HTTPStatus(errors.New("no such table")); ok {
+		t.Error("HTTPStatus should not map database errors")
+	}
+	if _, ok := GRPCCode(nil); ok {
+		t.Error("GRPCCode should not map nil")
+	}
+}
+
+// TestWriteHTTPError 测试写入状态码和向上取整的 Retry-After
+func TestWriteHTTPError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if !WriteHTTPError(rec, ErrRejected, 1500*time.Millisecond) {
+		t.Fatal("want a rejection to be written")
+	}
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("status %d, Retry-After %q, want 429 and 2", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	rec = httptest.NewRecorder()
+	if WriteHTTPError(rec, errors.New("no such table"), time.Second) || rec.Body.Len() != 0 {
+		t.Error("database errors should be left to the caller")
+	}
+	if k, v := GRPCRetryPushback(1500 * time.Millisecond); k != "grpc-retry-pushback-ms" || v != "1500" {
+		t.Errorf("pushback = %s: %s", k, v)
+	}
+}
@@ -0,0 +1,153 @@
+package dbratelimit
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// WithStmtCache makes QueryContext, QueryRowContext and ExecContext run
+// statements through prepared statements kept in a cache of up to size
+// entries, evicting the least recently used, so that repeated statements
+// are prepared once rather than on every call, as GORM's PrepareStmt mode
+// or drivers that prepare each parameterized query otherwise do. The cache
+// is keyed by the query text, and only statements whose fingerprint has no
+// literals are cached, so the entries are the application's parameterized
+// statements rather than one per literal value. A cached *sql.Stmt is
+// prepared again on each connection it runs on, by database/sql, so it
+// stays correct across the pool; preparing takes no tokens of its own.
+func WithStmtCache(size int) Option {
+	return func(o *options) {
+		o.stmtCache = size
+	}
+}
+
+// StmtCacheStats counts lookups in the statement cache.
+type StmtCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+// StmtCacheStats returns the statement cache counters; all zero without
+// WithStmtCache.
+func (r *RateLimitedDB) StmtCacheStats() StmtCacheStats {
+	if r.stmts == nil {
+		return StmtCacheStats{}
+	}
+	c := r.stmts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = c.ll.Len()
+	return s
+}
+
+type stmtCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List // *cachedStmt, most recently used first
+	entries map[string]*list.Element
+	stats   StmtCacheStats
+}
+
+// cachedStmt is closed once evicted and no call is using it
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{size: size, ll: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// cacheable reports whether query should go through the cache
+func cacheable(query string, verb Verb) bool {
+	switch verb {
+	case VerbSelect, VerbInsert, VerbUpdate, VerbDelete, VerbCall:
+	default:
+		// transaction control and DDL must not outlive their statement
+		return false
+	}
+	_, info := fingerprint(query)
+	return info.literals == 0
+}
+
+// acquire returns the prepared statement for query, preparing it on a
+// miss, or nil if it cannot be prepared; release it when done
+func (c *stmtCache) acquire(ctx context.Context, db *sql.DB, query string) *cachedStmt {
+	c.mu.Lock()
+	if e, ok := c.entries[query]; ok {
+		c.ll.MoveToFront(e)
+		s := e.Value.(*cachedStmt)
+		s.refs++
+		c.stats.Hits++
+		c.mu.Unlock()
+		return s
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		// the caller runs the query directly and gets the error from there
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[query]; ok {
+		// prepared concurrently by another call
+		stmt.Close()
+		s := e.Value.(*cachedStmt)
+		s.refs++
+		return s
+	}
+	s := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.entries[query] = c.ll.PushFront(s)
+	for c.ll.Len() > c.size {
+		c.evict(c.ll.Back())
+	}
+	return s
+}
+
+func (c *stmtCache) release(s *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.refs--
+	if s.evicted && s.refs == 0 {
+		s.stmt.Close()
+	}
+}
+
+// evict removes e, closing its statement unless a call is using it
+func (c *stmtCache) evict(e *list.Element) {
+	s := c.ll.Remove(e).(*cachedStmt)
+	delete(c.entries, s.query)
+	s.evicted = true
+	c.stats.Evictions++
+	if s.refs == 0 {
+		s.stmt.Close()
+	}
+}
+
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.ll.Len() > 0 {
+		c.evict(c.ll.Back())
+	}
+}
+
+// stmtFor returns the cached statement for a call, or nil to run the query
+// directly
+func (r *RateLimitedDB) stmtFor(c *call) *cachedStmt {
+	if r.stmts == nil || !cacheable(c.query, c.verb) {
+		return nil
+	}
+	return r.stmts.acquire(c.ctx, r.db, c.query)
+}
@@ -0,0 +1,81 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestStmtCache 测试参数化语句复用预处理语句，带字面量的语句不进入缓存
+func TestStmtCache(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1, WithStmtCache(2))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", "a", "a@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int
+	if err := rateLimitedDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE name = ?", "a").Scan(&n); err != nil || n != 3 {
+		t.Fatalf("count = %d, %v; want 3", n, err)
+	}
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = 'b' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rateLimitedDB.StmtCacheStats(); got != (StmtCacheStats{Hits: 2, Misses: 2, Size: 2}) {
+		t.Errorf("stats = %+v, want 2 hits, 2 misses and 2 entries", got)
+	}
+
+	rows, err := rateLimitedDB.QueryContext(ctx, "SELECT name FROM users WHERE id > ?", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the evicted INSERT is closed, the open rows keep their statement
+	if got := rateLimitedDB.StmtCacheStats(); got.Evictions != 1 || got.Size != 2 {
+		t.Errorf("stats = %+v, want 1 eviction", got)
+	}
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	rows.Close()
+	if count != 4 {
+		t.Errorf("rows = %d, want the 3 inserted and the seeded user", count)
+	}
+}
+
+// TestStmtCacheConcurrent 测试并发调用与淘汰时缓存的语句不会被提前关闭
+func TestStmtCacheConcurrent(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1, WithStmtCache(1))
+	defer rateLimitedDB.Close()
+
+	queries := []string{
+		"SELECT COUNT(*) FROM users WHERE id > ?",
+		"SELECT COUNT(*) FROM users WHERE id < ?",
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				var n int
+				if err := rateLimitedDB.QueryRowContext(context.Background(), queries[(i+j)%2], 0).Scan(&n); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,46 @@
+package dbratelimit
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// WithTagLimits gives calls tagged with WithTag their own bucket, e.g.
+// "exports" capped at 2 QPS however much headroom the main limiter has.
+// Tagged calls must pass both their tag bucket and the main limiter;
+// tags without an entry are only limited by the main limiter.
+func WithTagLimits(limits map[string]LimitConfig) Option {
+	return func(o *options) {
+		if o.tagLimits == nil {
+			o.tagLimits = make(map[string]LimitConfig, len(limits))
+		}
+		for tag, l := range limits {
+			o.tagLimits[tag] = l
+		}
+	}
+}
+
+func newTagLimiters(limits map[string]LimitConfig) map[string]*rate.Limiter {
+	if len(limits) == 0 {
+		return nil
+	}
+	out := make(map[string]*rate.Limiter, len(limits))
+	for tag, l := range limits {
+		out[tag] = rate.NewLimiter(l.Limit, l.Burst)
+	}
+	return out
+}
+
+// waitTag acquires n tokens from the bucket of the call's tag, if any
+func (r *RateLimitedDB) waitTag(ctx context.Context, n int, h *holds) error {
+	l, ok := r.tagLimiters[TagFrom(ctx)]
+	if !ok {
+		return nil
+	}
+	if PriorityFrom(ctx) == PriorityCritical {
+		takeN(l, n)
+		return nil
+	}
+	return r.waitLimiter(ctx, l, n, h)
+}
@@ -0,0 +1,41 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestTagLimits 测试带 tag 的调用使用独立 bucket
+func TestTagLimits(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithTagLimits(map[string]LimitConfig{
+		"exports": {Limit: rate.Limit(0.01), Burst: 2},
+	}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	exports := WithTag(ctx, "exports")
+	for i := 0; i < 2; i++ {
+		if _, err := rateLimitedDB.ExecContext(exports, "SELECT 1"); err != nil {
+			t.Fatalf("Export %d failed: %v", i, err)
+		}
+	}
+
+	short, cancel := context.WithTimeout(exports, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "SELECT 1"); err == nil {
+		t.Error("Expected exports to be capped by their tag limit")
+	}
+
+	// 其他 tag 只受全局 limiter 限制
+	for i := 0; i < 5; i++ {
+		if _, err := rateLimitedDB.ExecContext(WithTag(ctx, "checkout"), "SELECT 1"); err != nil {
+			t.Fatalf("Checkout %d failed: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package dbratelimit
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// WithTokenAudit cross-checks the tokens granted at admission against
+// those charged for executed calls, see TokenAudit: every executed call
+// must have been granted exactly its cost, and once no call is in flight
+// everything granted must have been charged or forfeited by calls that
+// failed after taking their tokens. Mismatches are logged, and panic if
+// strict is set, which is meant for tests of changes to the accounting.
+// It is not the audit log of WithAuditSink.
+func WithTokenAudit(strict bool) Option {
+	return func(o *options) {
+		o.tokenAudit = true
+		o.tokenAuditStrict = strict
+	}
+}
+
+// TokenAudit holds the totals kept by WithTokenAudit.
+type TokenAudit struct {
+	Granted    uint64 // tokens taken at admission
+	Charged    uint64 // tokens charged for executed calls
+	Forfeited  uint64 // tokens taken by calls that then failed admission
+	Mismatches uint64 // inconsistencies found
+}
+
+type tokenLedger struct {
+	granted, charged, forfeited, mismatches uint64 // atomic
+	strict                                  bool
+}
+
+// TokenAudit returns the totals of WithTokenAudit, or zeros without it.
+func (r *RateLimitedDB) TokenAudit() TokenAudit {
+	l := r.ledger
+	if l == nil {
+		return TokenAudit{}
+	}
+	return TokenAudit{
+		Granted:    atomic.LoadUint64(&l.granted),
+		Charged:    atomic.LoadUint64(&l.charged),
+		Forfeited:  atomic.LoadUint64(&l.forfeited),
+		Mismatches: atomic.LoadUint64(&l.mismatches),
+	}
+}
+
+// grant records n tokens taken for c at admission
+func (c *call) grant(n int) {
+	if l := c.r.ledger; l != nil {
+		c.granted += n
+		atomic.AddUint64(&l.granted, uint64(n))
+	}
+}
+
+// settle checks the tokens granted to c once it is done
+func (l *tokenLedger) settle(c *call) {
+	if !c.executed {
+		atomic.AddUint64(&l.forfeited, uint64(c.granted))
+		return
+	}
+	atomic.AddUint64(&l.charged, uint64(c.cost))
+	if c.granted != c.cost {
+		l.mismatch(fmt.Sprintf("call %q executed with %d tokens granted for a cost of %d", Fingerprint(c.query), c.granted, c.cost))
+	}
+}
+
+// checkIdle verifies that nothing granted is unaccounted for while no call
+// is in flight
+func (l *tokenLedger) checkIdle() error {
+	granted := atomic.LoadUint64(&l.granted)
+	settled := atomic.LoadUint64(&l.charged) + atomic.LoadUint64(&l.forfeited)
+	if granted != settled {
+		return fmt.Errorf("%d tokens granted but %d charged or forfeited", granted, settled)
+	}
+	return nil
+}
+
+func (l *tokenLedger) mismatch(msg string) {
+	atomic.AddUint64(&l.mismatches, 1)
+	if l.strict {
+		panic("dbratelimit: token audit: " + msg)
+	}
+	log.Printf("dbratelimit: token audit: %s", msg)
+}
@@ -0,0 +1,65 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestTokenAudit 测试令牌审计核对授予、计费和作废的令牌
+func TestTokenAudit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithTokenAudit(true),
+		WithCostFunc(func(query string) int { return 2 }),
+		WithVerbLimit(rate.Limit(0.01), 2, VerbDelete))
+	defer rateLimitedDB.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		rows, err := rateLimitedDB.QueryContext(ctx, "SELECT name FROM users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+	if _, err := rateLimitedDB.ExecContext(WithExempt(ctx), "UPDATE users SET name = 'Bob'"); err != nil {
+		t.Fatal(err)
+	}
+	// the second delete takes its main tokens, then fails on the verb limit
+	rateLimitedDB.ExecContext(ctx, "DELETE FROM users WHERE id = 9")
+	expiring, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(expiring, "DELETE FROM users WHERE id = 9"); err == nil {
+		t.Fatal("want the second delete to fail on the verb limit")
+	}
+
+	want := TokenAudit{Granted: 10, Charged: 8, Forfeited: 2}
+	if got := rateLimitedDB.TokenAudit(); got != want {
+		t.Errorf("audit = %+v, want %+v", got, want)
+	}
+}
+
+// TestTokenAuditMismatch 测试严格模式下计费与授予不符时 panic
+func TestTokenAuditMismatch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100, WithTokenAudit(true))
+	defer rateLimitedDB.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("want a panic for an executed call charged more than it was granted")
+		}
+		if n := rateLimitedDB.TokenAudit().Mismatches; n != 1 {
+			t.Errorf("mismatches = %d, want 1", n)
+		}
+	}()
+	c := &call{r: rateLimitedDB, query: "SELECT 1", executed: true, cost: 3}
+	c.grant(2)
+	rateLimitedDB.ledger.settle(c)
+}
@@ -0,0 +1,209 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Tx is a transaction whose statements are admitted like those of the
+// RateLimitedDB that began it. Commit and Rollback are never limited, so
+// that a transaction holding locks is not kept open waiting for tokens.
+type Tx struct {
+	tx    *sql.Tx
+	r     *RateLimitedDB
+	sem   *semaphore.Weighted // open transaction slot held, if any
+	done  int32
+	wrote int32 // a statement that may write was run
+}
+
+// TxPolicy applies to transactions begun with given sql.TxOptions, see
+// WithTxPolicy.
+type TxPolicy struct {
+	// MaxOpen limits how many such transactions may be open at once; BeginTx
+	// waits for one to finish. 0 for no limit.
+	MaxOpen int64
+	// Cost is charged for BEGIN; 0 leaves it to WithCostFunc.
+	Cost int
+	// DB, if set, runs the transactions on this database instead, e.g. a
+	// read replica for read-only transactions. Their statements are still
+	// admitted by the RateLimitedDB.
+	DB *sql.DB
+}
+
+type txKey struct {
+	isolation sql.IsolationLevel
+	readOnly  bool
+}
+
+type txPolicy struct {
+	TxPolicy
+	sem *semaphore.Weighted
+}
+
+// WithTxPolicy applies p to transactions begun with the given isolation
+// level and read-only flag, since both predict load and contention well:
+// SERIALIZABLE transactions might get a low MaxOpen and read-only ones a
+// replica. A policy for sql.LevelDefault also covers transactions with
+// the same read-only flag and a level without a policy of its own.
+func WithTxPolicy(isolation sql.IsolationLevel, readOnly bool, p TxPolicy) Option {
+	return func(o *options) {
+		if o.txPolicies == nil {
+			o.txPolicies = make(map[txKey]*txPolicy)
+		}
+		o.txPolicies[txKey{isolation, readOnly}] = &txPolicy{TxPolicy: p, sem: semaphoreFor(p.MaxOpen)}
+	}
+}
+
+// txPolicy returns the policy for transactions begun with opts, or nil
+func (r *RateLimitedDB) txPolicy(opts *sql.TxOptions) *txPolicy {
+	var k txKey
+	if opts != nil {
+		k = txKey{opts.Isolation, opts.ReadOnly}
+	}
+	if p := r.opts.txPolicies[k]; p != nil {
+		return p
+	}
+	return r.opts.txPolicies[txKey{sql.LevelDefault, k.readOnly}]
+}
+
+// BeginTx admits a BEGIN statement and starts a transaction, applying the
+// WithTxPolicy policy for opts. As with sql.DB.BeginTx, the transaction is
+// rolled back if ctx is done before it is committed.
+func (r *RateLimitedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	db := r.db
+	p := r.txPolicy(opts)
+	if p != nil {
+		if p.DB != nil {
+			db = p.DB
+		}
+		if p.sem != nil {
+			if err := p.sem.Acquire(ctx, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	t, err := r.beginTx(ctx, db, p, opts)
+	if err != nil {
+		if p != nil && p.sem != nil {
+			p.sem.Release(1)
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *RateLimitedDB) beginTx(ctx context.Context, db *sql.DB, p *txPolicy, opts *sql.TxOptions) (*Tx, error) {
+	admitCtx := r.policyContext(ctx)
+	if p != nil && p.Cost > 0 {
+		if _, ok := CostFrom(admitCtx); !ok {
+			admitCtx = WithCost(admitCtx, p.Cost)
+		}
+	}
+	c, err := r.wait(admitCtx, "BEGIN")
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	// the transaction lives on ctx, not on the statement's context
+	tx, err := db.BeginTx(ctx, opts)
+	err = c.result(err)
+	c.done(err)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tx{tx: tx, r: r}
+	if p != nil {
+		t.sem = p.sem
+	}
+	return t, nil
+}
+
+// Commit commits the transaction.
+func (t *Tx) Commit() error {
+	defer t.finish()
+	return t.tx.Commit()
+}
+
+// Rollback aborts the transaction.
+func (t *Tx) Rollback() error {
+	defer t.finish()
+	return t.tx.Rollback()
+}
+
+// finish releases the open transaction slot once
+func (t *Tx) finish() {
+	if atomic.CompareAndSwapInt32(&t.done, 0, 1) && t.sem != nil {
+		t.sem.Release(1)
+	}
+}
+
+// track notes statements that may write, such as INSERT ... RETURNING run
+// with QueryContext, for RunInTx
+func (t *Tx) track(c *call) {
+	if c.verb != VerbSelect && c.verb != VerbTx {
+		atomic.StoreInt32(&t.wrote, 1)
+	}
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	c, err := t.r.wait(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	t.track(c)
+	res, err := t.tx.ExecContext(c.ctx, query, args...)
+	if err == nil {
+		c.rows, _ = res.RowsAffected()
+	}
+	err = c.result(err)
+	c.done(err)
+	return res, err
+}
+
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	c, err := t.r.wait(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	t.track(c)
+	hold := c.holdRows()
+	rows, err := t.tx.QueryContext(c.ctx, query, args...)
+	err = c.result(err)
+	c.done(err)
+	c.free()
+	hold.returned(err)
+	return rows, err
+}
+
+// QueryRowContext is QueryContext for a single row. Like
+// RateLimitedDB.QueryRowContext it reports a failed wait through the row's
+// Scan and Err without running the query.
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	c, err := t.r.wait(ctx, query)
+	if err != nil {
+		return t.r.failedRow(ctx, err)
+	}
+	t.track(c)
+	hold := c.holdRows()
+	row := t.tx.QueryRowContext(c.ctx, query, args...)
+	c.done(row.Err())
+	c.free()
+	hold.returned(row.Err())
+	return row
+}
+
+func (t *Tx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	c, err := t.r.wait(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	stmt, err := t.tx.PrepareContext(c.ctx, query)
+	err = c.result(err)
+	c.done(err)
+	return stmt, err
+}
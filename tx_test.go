@@ -0,0 +1,116 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestBeginTx 测试事务内语句同样经过限流，提交后数据可见
+func TestBeginTx(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	tx, err := rateLimitedDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", "Bob", "bob@example.com"); err != nil {
+		t.Fatalf("Exec in tx failed: %v", err)
+	}
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n); err != nil || n != 2 {
+		t.Errorf("count in tx = %d, %v, want 2", n, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	// BEGIN、INSERT 和 SELECT 各算一次调用，COMMIT 不计
+	if calls := rateLimitedDB.Stats().Calls; calls != 3 {
+		t.Errorf("Calls = %d, want 3", calls)
+	}
+}
+
+// TestTxPolicy 测试按隔离级别限制并发事务数、按只读标志路由到副本以及 BEGIN 的成本
+func TestTxPolicy(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	replica, err := sql.Open("sqlite3", "file:"+t.Name()+"_replica?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	if _, err := replica.Exec("CREATE TABLE replica_only (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	rateLimitedDB := Wrap(db, rate.Limit(0.001), 12,
+		WithTxPolicy(sql.LevelSerializable, false, TxPolicy{MaxOpen: 1, Cost: 5}),
+		WithTxPolicy(sql.LevelDefault, true, TxPolicy{DB: replica}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	first, err := rateLimitedDB.BeginTx(ctx, serializable)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if tokens := rateLimitedDB.limiter.Tokens(); tokens > 7.1 {
+		t.Errorf("tokens = %v after a BEGIN costing 5", tokens)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.BeginTx(short, serializable); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second serializable BeginTx = %v, want context.DeadlineExceeded", err)
+	}
+	if err := first.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	first.Rollback() // 重复结束事务不会多释放名额
+
+	ro, err := rateLimitedDB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("read-only BeginTx failed: %v", err)
+	}
+	if _, err := ro.QueryContext(ctx, "SELECT id FROM replica_only"); err != nil {
+		t.Errorf("read-only transaction not on the replica: %v", err)
+	}
+	ro.Rollback()
+
+	second, err := rateLimitedDB.BeginTx(ctx, serializable)
+	if err != nil {
+		t.Fatalf("BeginTx after Rollback failed: %v", err)
+	}
+	second.Rollback()
+}
+
+// TestTxQueryRowFailedWait 测试事务内等待失败的 QueryRowContext 不执行语句
+func TestTxQueryRowFailedWait(t *testing.T) {
+	db, f := setupFakeDB(t)
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	tx, err := rateLimitedDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	rateLimitedDB.FreezeWrites()
+	var id int64
+	if err := tx.QueryRowContext(ctx, "INSERT INTO t VALUES (1) RETURNING id").Scan(&id); !errors.Is(err, ErrWritesFrozen) {
+		t.Fatalf("Expected ErrWritesFrozen, got %v", err)
+	}
+	if got := f.Methods(); !equalStrings(got, []string{"Begin"}) {
+		t.Errorf("driver calls = %v, want only Begin", got)
+	}
+}
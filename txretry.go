@@ -0,0 +1,118 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// TxRetry configures how RunInTx retries transactions.
+type TxRetry struct {
+	// Attempts is how often a transaction is tried in all. Default 3.
+	Attempts int
+	// Backoff is the longest wait before the first retry, doubling for
+	// each further one up to MaxBackoff. The actual wait is random up to
+	// that, so that transactions that deadlocked each other do not retry
+	// in lockstep. Defaults 10ms and 1s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// WithTxRetry sets how RunInTx retries transactions.
+func WithTxRetry(c TxRetry) Option {
+	return func(o *options) {
+		o.txRetry = c
+	}
+}
+
+// RunInTx begins a transaction with opts, runs fn in it and commits it. If
+// fn fails or panics the transaction is rolled back. When BEGIN, fn or
+// COMMIT fail with a transient error, such as a deadlock or serialization
+// failure (see ErrorClassifier), the whole transaction is retried after a
+// backoff, each attempt waiting for fresh tokens, up to the attempts set by
+// WithTxRetry. fn may therefore run several times and must not have
+// effects outside the transaction that cannot be repeated. Rejections by
+// the limiter itself are not retried.
+//
+// A failed COMMIT of a transaction that wrote is only retried if ctx marks
+// it as Idempotent, e.g. with WithIdempotencyKey, as the transaction may
+// have committed anyway and repeating it could insert rows twice. A
+// NotIdempotent transaction is only retried if BEGIN failed.
+func (r *RateLimitedDB) RunInTx(ctx context.Context, fn func(*Tx) error, opts *sql.TxOptions) error {
+	c := r.opts.txRetry
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = 10 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Second
+	}
+	backoff := c.Backoff
+	for attempt := 1; ; attempt++ {
+		phase, err := r.runTx(ctx, fn, opts)
+		if err == nil || attempt >= c.Attempts || !r.retryTx(ctx, err, phase) {
+			return err
+		}
+		t := time.NewTimer(time.Duration(r.opts.rand.int64N(int64(backoff)) + 1))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		backoff = min(2*backoff, c.MaxBackoff)
+	}
+}
+
+// txPhase is how far a failed transaction got
+type txPhase int
+
+const (
+	txBegin       txPhase = iota // BEGIN failed, nothing ran
+	txRolledBack                 // fn failed and the transaction was rolled back
+	txCommit                     // COMMIT of a transaction that did not write failed
+	txCommitWrite                // COMMIT of a transaction that wrote failed
+)
+
+// retryTx reports whether a transaction that failed with err is worth
+// another attempt
+func (r *RateLimitedDB) retryTx(ctx context.Context, err error, phase txPhase) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrRejected) || r.Classify(err) != ClassTransient {
+		return false
+	}
+	switch IdempotencyFrom(r.policyContext(ctx)) {
+	case Idempotent:
+		return true
+	case NotIdempotent:
+		return phase == txBegin
+	}
+	return phase != txCommitWrite
+}
+
+func (r *RateLimitedDB) runTx(ctx context.Context, fn func(*Tx) error, opts *sql.TxOptions) (txPhase, error) {
+	tx, err := r.BeginTx(ctx, opts)
+	if err != nil {
+		return txBegin, err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return txRolledBack, err
+	}
+	if err := tx.Commit(); err != nil {
+		if atomic.LoadInt32(&tx.wrote) != 0 {
+			return txCommitWrite, err
+		}
+		return txCommit, err
+	}
+	return txCommit, nil
+}
@@ -0,0 +1,145 @@
+package dbratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestRunInTx 测试瞬时错误时整个事务重试、永久错误不重试以及失败时回滚
+func TestRunInTx(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1, WithTxRetry(TxRetry{Attempts: 3, Backoff: time.Millisecond}))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	count := func() int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	insert := func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", "Bob", "bob@example.com")
+		return err
+	}
+
+	attempts := 0
+	err := rateLimitedDB.RunInTx(ctx, func(tx *Tx) error {
+		attempts++
+		if err := insert(tx); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return errors.New("database is locked")
+		}
+		return nil
+	}, nil)
+	if err != nil || attempts != 3 {
+		t.Errorf("RunInTx = %v after %d attempts, want success after 3", err, attempts)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("%d users, want 2: failed attempts were not rolled back", n)
+	}
+
+	attempts = 0
+	permanent := errors.New("constraint failed")
+	err = rateLimitedDB.RunInTx(ctx, func(tx *Tx) error {
+		attempts++
+		insert(tx)
+		return permanent
+	}, nil)
+	if !errors.Is(err, permanent) || attempts != 1 {
+		t.Errorf("RunInTx = %v after %d attempts, want the error after 1", err, attempts)
+	}
+
+	attempts = 0
+	err = rateLimitedDB.RunInTx(ctx, func(tx *Tx) error {
+		attempts++
+		return errors.New("database is locked")
+	}, nil)
+	if err == nil || attempts != 3 {
+		t.Errorf("RunInTx = %v after %d attempts, want an error after 3", err, attempts)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic in fn was not passed on")
+			}
+		}()
+		rateLimitedDB.RunInTx(ctx, func(tx *Tx) error {
+			insert(tx)
+			panic("boom")
+		}, nil)
+	}()
+	if n := count(); n != 2 {
+		t.Errorf("%d users, want 2: failed transactions were not rolled back", n)
+	}
+}
+
+// TestRetryTxIdempotency 测试按幂等提示决定是否重试，提交失败且有写入时默认不重试
+func TestRetryTxIdempotency(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	locked := errors.New("database is locked")
+	ctx := context.Background()
+	tests := []struct {
+		ctx   context.Context
+		phase txPhase
+		want  bool
+	}{
+		{ctx, txBegin, true},
+		{ctx, txRolledBack, true},
+		{ctx, txCommit, true},
+		{ctx, txCommitWrite, false},
+		{WithIdempotencyKey(ctx, "order-42"), txCommitWrite, true},
+		{WithIdempotency(ctx, NotIdempotent), txBegin, true},
+		{WithIdempotency(ctx, NotIdempotent), txRolledBack, false},
+	}
+	for _, tt := range tests {
+		if got := rateLimitedDB.retryTx(tt.ctx, locked, tt.phase); got != tt.want {
+			t.Errorf("retryTx(%v, phase %d) = %v, want %v", IdempotencyFrom(tt.ctx), tt.phase, got, tt.want)
+		}
+	}
+	if got := IdempotencyKeyFrom(WithIdempotencyKey(ctx, "order-42")); got != "order-42" {
+		t.Errorf("IdempotencyKeyFrom = %q, want order-42", got)
+	}
+}
+
+// TestTxTracksWrites 测试事务记录是否执行过可能写入的语句
+func TestTxTracksWrites(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	tx, err := rateLimitedDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var n int
+	tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+	if tx.wrote != 0 {
+		t.Error("SELECT counted as a write")
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET name = ?", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if tx.wrote == 0 {
+		t.Error("UPDATE not counted as a write")
+	}
+}
@@ -0,0 +1,40 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+)
+
+// QueryOne runs query through db and returns the first row converted by
+// scan, or sql.ErrNoRows if there is none. Methods cannot have type
+// parameters, hence a function taking db.
+//
+//	user, err := dbratelimit.QueryOne(ctx, db, scanUser, "SELECT id, name FROM users WHERE id = ?", id)
+func QueryOne[T any](ctx context.Context, db *RateLimitedDB, scan func(RowScanner) (T, error), query string, args ...any) (T, error) {
+	for row, err := range db.QueryIter(ctx, query, args...) {
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return scan(row)
+	}
+	var zero T
+	return zero, sql.ErrNoRows
+}
+
+// QueryAll runs query through db and returns all rows converted by scan. It
+// stops at the first error, returning the rows converted so far.
+func QueryAll[T any](ctx context.Context, db *RateLimitedDB, scan func(RowScanner) (T, error), query string, args ...any) ([]T, error) {
+	var all []T
+	for row, err := range db.QueryIter(ctx, query, args...) {
+		if err != nil {
+			return all, err
+		}
+		v, err := scan(row)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, v)
+	}
+	return all, nil
+}
@@ -0,0 +1,78 @@
+package dbratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+type testUser struct {
+	ID   int
+	Name string
+}
+
+func scanTestUser(row RowScanner) (testUser, error) {
+	var u testUser
+	err := row.Scan(&u.ID, &u.Name)
+	return u, err
+}
+
+// TestQueryOne 测试返回第一行、无结果时返回 sql.ErrNoRows 以及限流错误
+func TestQueryOne(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1), 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	u, err := QueryOne(ctx, rateLimitedDB, scanTestUser, "SELECT id, name FROM users WHERE id = ?", 1)
+	if err != nil || u != (testUser{1, "Alice"}) {
+		t.Errorf("QueryOne = %v, %v, want {1 Alice}", u, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := QueryOne(ctx, rateLimitedDB, scanTestUser, "SELECT id, name FROM users"); !errors.Is(err, context.Canceled) {
+		t.Errorf("QueryOne without tokens = %v, want context.Canceled", err)
+	}
+
+	rateLimitedDB.SetLimit(rate.Inf)
+	if _, err := QueryOne(context.Background(), rateLimitedDB, scanTestUser, "SELECT id, name FROM users WHERE id = ?", 42); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("QueryOne for a missing row = %v, want sql.ErrNoRows", err)
+	}
+}
+
+// TestQueryAll 测试返回所有行以及扫描错误
+func TestQueryAll(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "INSERT INTO users (name, email) VALUES (?, ?)", "Bob", "bob@example.com"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	users, err := QueryAll(ctx, rateLimitedDB, scanTestUser, "SELECT id, name FROM users ORDER BY id")
+	if err != nil {
+		t.Fatalf("QueryAll failed: %v", err)
+	}
+	if len(users) != 2 || users[1] != (testUser{2, "Bob"}) {
+		t.Errorf("QueryAll = %v, want Alice and Bob", users)
+	}
+
+	bad := func(row RowScanner) (testUser, error) {
+		var u testUser
+		err := row.Scan(&u.ID) // 列数不匹配
+		return u, err
+	}
+	if users, err := QueryAll(ctx, rateLimitedDB, bad, "SELECT id, name FROM users"); err == nil || len(users) != 0 {
+		t.Errorf("QueryAll with a failing scan = %v, %v, want an error", users, err)
+	}
+}
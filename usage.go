@@ -0,0 +1,131 @@
+package dbratelimit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithUsageAccounting keeps running totals of the tokens consumed per tag
+// and per key (see WithTag and WithKey), for charging teams or tenants for
+// database capacity. Read them with Usage or UsageHandler. Totals only
+// grow; bill a period by the difference between two reports.
+func WithUsageAccounting() Option {
+	return func(o *options) {
+		o.usage = true
+	}
+}
+
+// Usage is what the calls of one tag or key consumed.
+type Usage struct {
+	Calls  uint64 `json:"calls"`  // admitted calls
+	Tokens uint64 `json:"tokens"` // tokens they were charged
+}
+
+// UsageReport holds the usage totals since accounting started. Calls
+// without a tag or key are counted under "".
+type UsageReport struct {
+	Since time.Time        `json:"since"`
+	Until time.Time        `json:"until"`
+	Tags  map[string]Usage `json:"tags"`
+	Keys  map[string]Usage `json:"keys"`
+}
+
+type usageBook struct {
+	since time.Time
+	tags  sync.Map // tag -> *usageEntry
+	keys  sync.Map // key -> *usageEntry
+}
+
+type usageEntry struct {
+	calls, tokens uint64
+}
+
+func newUsageBook() *usageBook {
+	return &usageBook{since: time.Now()}
+}
+
+// record charges an admitted call of the given cost
+func (b *usageBook) record(tag, key string, cost int) {
+	for _, e := range [...]*usageEntry{usageEntryFor(&b.tags, tag), usageEntryFor(&b.keys, key)} {
+		atomic.AddUint64(&e.calls, 1)
+		atomic.AddUint64(&e.tokens, uint64(cost))
+	}
+}
+
+func usageEntryFor(m *sync.Map, name string) *usageEntry {
+	if e, ok := m.Load(name); ok {
+		return e.(*usageEntry)
+	}
+	e, _ := m.LoadOrStore(name, &usageEntry{})
+	return e.(*usageEntry)
+}
+
+func usageOf(m *sync.Map) map[string]Usage {
+	out := make(map[string]Usage)
+	m.Range(func(k, v any) bool {
+		e := v.(*usageEntry)
+		out[k.(string)] = Usage{Calls: atomic.LoadUint64(&e.calls), Tokens: atomic.LoadUint64(&e.tokens)}
+		return true
+	})
+	return out
+}
+
+// Usage returns the usage totals, or an empty report without
+// WithUsageAccounting.
+func (r *RateLimitedDB) Usage() UsageReport {
+	report := UsageReport{Until: time.Now(), Tags: map[string]Usage{}, Keys: map[string]Usage{}}
+	if r.usage != nil {
+		report.Since = r.usage.since
+		report.Tags = usageOf(&r.usage.tags)
+		report.Keys = usageOf(&r.usage.keys)
+	}
+	return report
+}
+
+// WriteCSV writes the report as CSV with a header row and one row per tag
+// and key: kind ("tag" or "key"), name, calls, tokens, since and until in
+// RFC 3339, sorted by kind and name.
+func (u UsageReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"kind", "name", "calls", "tokens", "since", "until"})
+	since, until := u.Since.Format(time.RFC3339), u.Until.Format(time.RFC3339)
+	for _, part := range []struct {
+		kind  string
+		usage map[string]Usage
+	}{{"key", u.Keys}, {"tag", u.Tags}} {
+		names := make([]string, 0, len(part.usage))
+		for name := range part.usage {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v := part.usage[name]
+			cw.Write([]string{part.kind, name,
+				strconv.FormatUint(v.Calls, 10), strconv.FormatUint(v.Tokens, 10), since, until})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// UsageHandler serves the usage report as JSON, or as CSV (see
+// UsageReport.WriteCSV) with format=csv.
+func (r *RateLimitedDB) UsageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Usage()
+		if req.FormValue("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			report.WriteCSV(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,61 @@
+package dbratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestUsageAccounting 测试按标签和键累计调用次数与令牌消耗，并以 JSON 和 CSV 导出
+func TestUsageAccounting(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1, WithUsageAccounting())
+	defer rateLimitedDB.Close()
+
+	acme := WithKey(WithTag(context.Background(), "checkout"), "acme")
+	for i := 0; i < 2; i++ {
+		if _, err := rateLimitedDB.ExecContext(WithCost(acme, 3), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rateLimitedDB.ExecContext(WithKey(context.Background(), "globex"), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rateLimitedDB.ExecContext(WithExempt(acme), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	u := rateLimitedDB.Usage()
+	if got := u.Keys["acme"]; got != (Usage{Calls: 3, Tokens: 6}) {
+		t.Errorf("acme usage = %+v, want 3 calls and 6 tokens", got)
+	}
+	if got := u.Keys["globex"]; got != (Usage{Calls: 1, Tokens: 1}) {
+		t.Errorf("globex usage = %+v, want 1 call and 1 token", got)
+	}
+	if got := u.Tags["checkout"]; got.Tokens != 6 {
+		t.Errorf("checkout usage = %+v, want 6 tokens", got)
+	}
+	if u.Since.IsZero() || u.Until.Before(u.Since) {
+		t.Errorf("report covers %v to %v", u.Since, u.Until)
+	}
+
+	rec := httptest.NewRecorder()
+	rateLimitedDB.UsageHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/usage", nil))
+	var decoded UsageReport
+	if err := json.NewDecoder(rec.Body).Decode(&decoded); err != nil || decoded.Keys["acme"].Tokens != 6 {
+		t.Errorf("JSON report = %+v, %v", decoded, err)
+	}
+
+	rec = httptest.NewRecorder()
+	rateLimitedDB.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/usage?format=csv", nil))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "kind,name,calls,tokens") || !strings.HasPrefix(lines[1], "key,acme,3,6,") {
+		t.Errorf("CSV report:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,319 @@
+package dbratelimit
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// Verb is the kind of SQL statement, as far as admission control cares.
+type Verb int
+
+const (
+	VerbOther Verb = iota
+	VerbSelect
+	VerbInsert
+	VerbUpdate
+	VerbDelete
+	VerbDDL  // CREATE, ALTER, DROP, TRUNCATE, RENAME
+	VerbTx   // BEGIN, COMMIT, ROLLBACK, SAVEPOINT
+	VerbCall // CALL, EXEC, EXECUTE
+)
+
+func (v Verb) String() string {
+	switch v {
+	case VerbSelect:
+		return "select"
+	case VerbInsert:
+		return "insert"
+	case VerbUpdate:
+		return "update"
+	case VerbDelete:
+		return "delete"
+	case VerbDDL:
+		return "ddl"
+	case VerbTx:
+		return "tx"
+	case VerbCall:
+		return "call"
+	}
+	return "other"
+}
+
+// IsWrite reports whether statements of this verb modify data.
+func (v Verb) IsWrite() bool {
+	return v == VerbInsert || v == VerbUpdate || v == VerbDelete
+}
+
+var verbKeywords = map[string]Verb{
+	"SELECT":    VerbSelect,
+	"SHOW":      VerbSelect,
+	"EXPLAIN":   VerbSelect,
+	"DESCRIBE":  VerbSelect,
+	"VALUES":    VerbSelect,
+	"INSERT":    VerbInsert,
+	"REPLACE":   VerbInsert,
+	"UPSERT":    VerbInsert,
+	"UPDATE":    VerbUpdate,
+	"MERGE":     VerbUpdate,
+	"DELETE":    VerbDelete,
+	"CREATE":    VerbDDL,
+	"ALTER":     VerbDDL,
+	"DROP":      VerbDDL,
+	"TRUNCATE":  VerbDDL,
+	"RENAME":    VerbDDL,
+	"BEGIN":     VerbTx,
+	"START":     VerbTx,
+	"COMMIT":    VerbTx,
+	"ROLLBACK":  VerbTx,
+	"SAVEPOINT": VerbTx,
+	"RELEASE":   VerbTx,
+	"CALL":      VerbCall,
+	"EXEC":      VerbCall,
+	"EXECUTE":   VerbCall,
+}
+
+// ParseVerb returns the verb of query, skipping leading comments and
+// parentheses. For WITH queries the verb of the main statement is returned,
+// unless it is a SELECT and a CTE modifies data, as in
+// "WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d", which is
+// classified by the CTE's verb. SELECT ... INTO a table is VerbInsert;
+// SELECT ... INTO variables, OUTFILE or DUMPFILE stays a read. A query of
+// several statements, as in "SELECT 1; DELETE FROM t", is classified by
+// its most restrictive one: DDL first, then DELETE, UPDATE, INSERT, calls,
+// transaction control and SELECT.
+func ParseVerb(query string) Verb {
+	verb := VerbOther
+	for {
+		end := statementEnd(query)
+		if v := statementVerb(query[:end]); verbRank[v] > verbRank[verb] {
+			verb = v
+		}
+		if end == len(query) {
+			return verb
+		}
+		query = query[end+1:]
+	}
+}
+
+// verbRank orders the verbs by how restrictive they are, for ParseVerb
+var verbRank = [...]int{
+	VerbOther:  0,
+	VerbSelect: 1,
+	VerbTx:     2,
+	VerbCall:   3,
+	VerbInsert: 4,
+	VerbUpdate: 5,
+	VerbDelete: 6,
+	VerbDDL:    7,
+}
+
+// statementEnd returns the index of the ';' ending the first statement of
+// s, or len(s) if there is no other
+func statementEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == ';' {
+			return i
+		}
+		i = skipLiteral(s, i)
+	}
+	return len(s)
+}
+
+// statementVerb returns the verb of a single statement
+func statementVerb(query string) Verb {
+	s := skipSpaceAndComments(query)
+	word, rest := nextWord(s)
+	word = strings.ToUpper(word)
+	switch word {
+	case "BEGIN":
+		return beginVerb(rest)
+	case "WITH":
+		return scanVerb(rest, VerbOther)
+	case "SELECT":
+		return scanVerb(rest, VerbSelect)
+	}
+	return verbKeywords[word]
+}
+
+// scanVerb scans the rest of a WITH or SELECT statement: the main verb, if
+// not known yet, is the first one found outside parentheses, and a SELECT
+// still turns into a write if a CTE body or an INTO clause writes
+func scanVerb(rest string, main Verb) Verb {
+	cte := VerbOther // verb of the first data-modifying CTE
+	depth := 0
+	for i := 0; i < len(rest); i++ {
+		switch c := rest[i]; {
+		case c == '(':
+			depth++
+			// a CTE body modifying data starts with its verb
+			w, _ := nextWord(skipSpaceAndComments(rest[i+1:]))
+			if v := verbKeywords[strings.ToUpper(w)]; v.IsWrite() && cte == VerbOther {
+				cte = v
+			}
+		case c == ')':
+			depth--
+		case depth == 0 && isWordByte(c) && (i == 0 || !isWordByte(rest[i-1])):
+			w, _ := nextWord(rest[i:])
+			switch v := verbKeywords[strings.ToUpper(w)]; {
+			case main == VerbOther && (v == VerbSelect || v.IsWrite()):
+				if v.IsWrite() {
+					return v
+				}
+				main = v
+			case main == VerbSelect && strings.EqualFold(w, "INTO") && selectIntoTable(rest[i+len(w):]):
+				return VerbInsert
+			}
+			i += len(w) - 1
+		default:
+			i = skipLiteral(rest, i)
+		}
+	}
+	if main == VerbSelect && cte != VerbOther {
+		return cte
+	}
+	return main
+}
+
+// skipLiteral returns the index of the last byte of the quoted string,
+// identifier or comment starting at s[i], or i if none starts there
+func skipLiteral(s string, i int) int {
+	switch c := s[i]; {
+	case c == '\'' || c == '"' || c == '`' || c == '[':
+		end := c
+		if c == '[' {
+			end = ']' // T-SQL quoted identifier
+		}
+		if j := strings.IndexByte(s[i+1:], end); j >= 0 {
+			return i + j + 1
+		}
+	case strings.HasPrefix(s[i:], "--"):
+		if j := strings.IndexByte(s[i:], '\n'); j >= 0 {
+			return i + j
+		}
+		return len(s)
+	case strings.HasPrefix(s[i:], "/*"):
+		if j := strings.Index(s[i+2:], "*/"); j >= 0 {
+			return i + j + 3
+		}
+		return len(s)
+	}
+	return i
+}
+
+// selectIntoTable reports whether the INTO of a SELECT followed by rest
+// names a table rather than variables or a file
+func selectIntoTable(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	if rest == "" || rest[0] == '@' || rest[0] == ':' {
+		return false
+	}
+	w, _ := nextWord(rest)
+	switch strings.ToUpper(w) {
+	case "OUTFILE", "DUMPFILE":
+		return false
+	}
+	return true
+}
+
+// beginKeywords may follow BEGIN when it starts a transaction
+var beginKeywords = map[string]bool{
+	"":            true,
+	"TRAN":        true,
+	"TRANSACTION": true,
+	"WORK":        true,
+	"ISOLATION":   true,
+	"READ":        true,
+	"DEFERRED":    true,
+	"IMMEDIATE":   true,
+	"EXCLUSIVE":   true,
+	"DISTRIBUTED": true,
+}
+
+// beginVerb tells a transaction start, as in BEGIN TRAN, from a procedural
+// block such as Oracle's BEGIN ... END; given what follows BEGIN
+func beginVerb(rest string) Verb {
+	word, _ := nextWord(skipSpaceAndComments(rest))
+	if beginKeywords[strings.ToUpper(word)] {
+		return VerbTx
+	}
+	return VerbCall
+}
+
+// skipSpaceAndComments drops leading whitespace, "--" and "/* */" comments,
+// opening parentheses and statement separators, as in T-SQL's ";WITH"
+func skipSpaceAndComments(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n(;")
+		switch {
+		case strings.HasPrefix(s, "--"):
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				return ""
+			}
+			s = s[i+1:]
+		case strings.HasPrefix(s, "/*"):
+			i := strings.Index(s[2:], "*/")
+			if i < 0 {
+				return ""
+			}
+			s = s[i+4:]
+		default:
+			return s
+		}
+	}
+}
+
+func nextWord(s string) (word, rest string) {
+	i := 0
+	for i < len(s) && isWordByte(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// WithExemptVerbs exempts statements of the given verbs from rate limiting,
+// e.g. VerbDDL during migrations.
+func WithExemptVerbs(verbs ...Verb) Option {
+	return func(o *options) {
+		if o.exemptVerbs == nil {
+			o.exemptVerbs = make(map[Verb]bool)
+		}
+		for _, v := range verbs {
+			o.exemptVerbs[v] = true
+		}
+	}
+}
+
+// WithVerbLimit adds a separate limiter shared by statements of the given
+// verbs. Those statements must pass both it and the main limiter.
+func WithVerbLimit(limit rate.Limit, burst int, verbs ...Verb) Option {
+	return func(o *options) {
+		if o.verbLimits == nil {
+			o.verbLimits = make(map[Verb]*rate.Limiter)
+		}
+		l := rate.NewLimiter(limit, burst)
+		for _, v := range verbs {
+			o.verbLimits[v] = l
+		}
+	}
+}
+
+// waitVerb acquires n tokens from the limiter configured for verb, if any,
+// adding the reservation to h
+func (r *RateLimitedDB) waitVerb(ctx context.Context, verb Verb, n int, h *holds) error {
+	l, ok := r.opts.verbLimits[verb]
+	if !ok {
+		return nil
+	}
+	if PriorityFrom(ctx) == PriorityCritical {
+		takeN(l, n)
+		return nil
+	}
+	return r.waitLimiter(ctx, l, n, h)
+}
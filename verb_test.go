@@ -0,0 +1,185 @@
+package dbratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestParseVerb 测试 SQL 语句类型识别
+func TestParseVerb(t *testing.T) {
+	cases := []struct {
+		query string
+		want  Verb
+	}{
+		{"SELECT * FROM users", VerbSelect},
+		{"  select 1", VerbSelect},
+		{"(SELECT 1) UNION (SELECT 2)", VerbSelect},
+		{"-- comment\nINSERT INTO users VALUES (1)", VerbInsert},
+		{"/* hint */ UPDATE users SET name = 'x'", VerbUpdate},
+		{"DELETE FROM users", VerbDelete},
+		{"CREATE TABLE t (id INT)", VerbDDL},
+		{"ALTER TABLE t ADD COLUMN x INT", VerbDDL},
+		{"BEGIN", VerbTx},
+		{"CALL refresh_stats()", VerbCall},
+		{"WITH recent AS (SELECT id FROM users) DELETE FROM users WHERE id IN (SELECT id FROM recent)", VerbDelete},
+		{"WITH a AS (SELECT 'UPDATE' AS x) SELECT * FROM a", VerbSelect},
+		{"PRAGMA foreign_keys = ON", VerbOther},
+		{"", VerbOther},
+		{"/* unterminated", VerbOther},
+		{"BEGIN TRAN", VerbTx},
+		{"begin transaction;", VerbTx},
+		{"BEGIN ISOLATION LEVEL SERIALIZABLE", VerbTx},
+		{"BEGIN refresh_stats; END;", VerbCall},
+		{"EXEC sp_who", VerbCall},
+		{";WITH [select] AS (SELECT 1 AS x) UPDATE t SET y = 1", VerbUpdate},
+		{"SELECT TOP 10 * FROM users", VerbSelect},
+		{"MERGE INTO t USING s ON (t.id = s.id) WHEN MATCHED THEN UPDATE SET t.x = s.x", VerbUpdate},
+		{"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d", VerbDelete},
+		{"WITH u AS (UPDATE t SET a = 1 RETURNING *) SELECT * FROM u", VerbUpdate},
+		{"WITH a AS (SELECT 1), i AS ( /* c */ INSERT INTO t SELECT * FROM a RETURNING id) SELECT id FROM i", VerbInsert},
+		{"WITH m AS (MERGE INTO t USING s ON t.id = s.id WHEN MATCHED THEN DELETE) SELECT 1", VerbUpdate},
+		{"WITH a AS (SELECT * FROM t FOR UPDATE) SELECT * FROM a", VerbSelect},
+		{"SELECT * INTO newt FROM t", VerbInsert},
+		{"SELECT a, b INTO TEMP newt FROM t", VerbInsert},
+		{"SELECT a INTO @x FROM t", VerbSelect},
+		{"SELECT a INTO OUTFILE '/tmp/a' FROM t", VerbSelect},
+		{"SELECT 'INTO x' FROM t -- INTO y", VerbSelect},
+		{"SELECT (SELECT 1) /* INTO x */ FROM t", VerbSelect},
+		{"SELECT 1; DELETE FROM t", VerbDelete},
+		{"BEGIN; UPDATE t SET a = 1; COMMIT;", VerbUpdate},
+		{"DELETE FROM t; DROP TABLE t", VerbDDL},
+		{"SELECT 'a;DELETE' FROM t -- ; DELETE\n", VerbSelect},
+		{"SELECT 1 /* ; DROP TABLE t */; SELECT 2", VerbSelect},
+	}
+	for _, c := range cases {
+		if got := ParseVerb(c.query); got != c.want {
+			t.Errorf("ParseVerb(%q) = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+// TestExemptVerbsAndVerbLimit 测试按语句类型豁免和单独限速
+func TestExemptVerbsAndVerbLimit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(1000), 100,
+		WithExemptVerbs(VerbDDL),
+		WithVerbLimit(rate.Limit(0.01), 1, VerbUpdate, VerbDelete))
+	defer rateLimitedDB.Close()
+
+	ctx := context.Background()
+	if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = 'Bob'"); err != nil {
+		t.Fatalf("First update failed: %v", err)
+	}
+
+	// UPDATE 和 DELETE 共享同一个 verb limiter
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rateLimitedDB.ExecContext(short, "DELETE FROM users WHERE id = 0"); err == nil {
+		t.Error("Expected delete to be throttled by the verb limiter")
+	}
+
+	// SELECT 不受 verb limiter 影响
+	rows, err := rateLimitedDB.QueryContext(ctx, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	rows.Close()
+
+	// DDL 豁免，不消耗 token
+	before := rateLimitedDB.Limiter().Tokens()
+	if _, err := rateLimitedDB.ExecContext(ctx, "CREATE TABLE extra (id INTEGER)"); err != nil {
+		t.Fatalf("DDL failed: %v", err)
+	}
+	if after := rateLimitedDB.Limiter().Tokens(); after < before {
+		t.Errorf("DDL should not consume tokens: before %v, after %v", before, after)
+	}
+}
+
+// TestStatementTimeout 测试语句超时不计算等待时间
+func TestStatementTimeout(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Limit(20), 1, WithStatementTimeout(time.Second))
+	defer rateLimitedDB.Close()
+
+	var deadlines []time.Duration
+	rateLimitedDB.opts.observers = append(rateLimitedDB.opts.observers, func(ctx context.Context, _ QueryInfo) {
+		d, ok := ctx.Deadline()
+		if !ok {
+			t.Error("Expected statement deadline on call context")
+			return
+		}
+		deadlines = append(deadlines, time.Until(d))
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := rateLimitedDB.ExecContext(ctx, "UPDATE users SET name = name"); err != nil {
+			t.Fatalf("ExecContext failed: %v", err)
+		}
+	}
+	rows, err := rateLimitedDB.QueryContext(ctx, "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("QueryContext failed: %v", err)
+	}
+	// 行迭代不受 Exec 之后取消的影响
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		t.Errorf("Rows error: %v", err)
+	}
+	rows.Close()
+
+	for _, d := range deadlines {
+		if d < 900*time.Millisecond {
+			t.Errorf("Statement timeout included wait time: %v left", d)
+		}
+	}
+}
+
+// FuzzParseVerb 测试任意输入不会导致 panic，且注释前缀和写语句关键字的识别不受后续内容影响
+func FuzzParseVerb(f *testing.F) {
+	for _, q := range []string{
+		"SELECT 1",
+		"insert into t values (1)",
+		"WITH x AS (SELECT ')' FROM t) DELETE FROM t",
+		"/* c */ UPDATE t SET a = 1",
+		"-- c\nDELETE FROM t",
+		"BEGIN TRANSACTION",
+		"BEGIN NULL; END;",
+		";WITH [a(] AS (SELECT 1) INSERT INTO t SELECT * FROM [a(]",
+		"WITH x AS ('",
+		"(((",
+		"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d",
+		"SELECT * INTO newt FROM t",
+	} {
+		f.Add(q)
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		v := ParseVerb(q)
+		for _, prefix := range []string{"/* c */ ", "-- c\n", " \t\r\n", "(", ";"} {
+			if got := ParseVerb(prefix + q); got != v {
+				t.Errorf("ParseVerb(%q) = %v, want %v as without the prefix", prefix+q, got, v)
+			}
+		}
+		for _, kw := range []string{"INSERT", "UPDATE", "DELETE"} {
+			if got := ParseVerb(kw + " " + q); !got.IsWrite() {
+				t.Errorf("ParseVerb(%q) = %v, want a write", kw+" "+q, got)
+			}
+			if got := ParseVerb("WITH x AS (SELECT 1) " + kw + " " + q); !got.IsWrite() {
+				t.Errorf("ParseVerb(%q) = %v, want a write", "WITH x AS (SELECT 1) "+kw+" "+q, got)
+			}
+			// a data-modifying CTE makes the whole statement a write
+			cte := "WITH x AS (" + kw + " t) SELECT " + q
+			if got := ParseVerb(cte); !got.IsWrite() {
+				t.Errorf("ParseVerb(%q) = %v, want a write", cte, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package dbratelimit
+
+import "context"
+
+// WithPolicy returns a view of r whose calls default to p, e.g. a tag, a
+// priority or a cost, so subsystems can hold differently tuned handles to
+// the same database. Views share everything else with r: the database, the
+// limiters, the statistics and the configuration. Policies carried by a
+// call's context take precedence over p, field by field as in the
+// package-level WithPolicy. A view of a view merges p into its defaults.
+// Views are safe for concurrent use; closing one does nothing, r must be
+// closed instead.
+func (r *RateLimitedDB) WithPolicy(p Policy) *RateLimitedDB {
+	merged := overlay(setFields(r.Policy()), setFields(p)).Policy
+	return &RateLimitedDB{dbState: r.dbState, policy: &merged}
+}
+
+// Policy returns the defaults of a view made by WithPolicy, or the zero
+// Policy for r itself.
+func (r *RateLimitedDB) Policy() Policy {
+	if r.policy == nil {
+		return Policy{}
+	}
+	return *r.policy
+}
+
+// policyContext applies the defaults of a view to ctx, under the policy ctx
+// already carries
+func (r *RateLimitedDB) policyContext(ctx context.Context) context.Context {
+	if r.policy == nil {
+		return ctx
+	}
+	p := setFields(*r.policy)
+	if set, ok := ctx.Value(policyKey).(ctxPolicy); ok {
+		p = overlay(p, set)
+	}
+	return context.WithValue(ctx, policyKey, p)
+}
@@ -0,0 +1,67 @@
+package dbratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// TestWithPolicyView 测试视图共享限流器与统计，并为调用提供默认策略
+func TestWithPolicyView(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rateLimitedDB := Wrap(db, rate.Inf, 1)
+	defer rateLimitedDB.Close()
+
+	reports := rateLimitedDB.WithPolicy(Policy{Tag: "reports", Priority: PriorityLow, Cost: 3})
+	critical := reports.WithPolicy(Policy{Priority: PriorityCritical})
+	if reports.Limiter() != rateLimitedDB.Limiter() {
+		t.Error("expected the view to share the limiter")
+	}
+	if got := critical.Policy(); got.Tag != "reports" || got.Priority != PriorityCritical || got.Cost != 3 {
+		t.Errorf("view of a view policy = %+v, want the tag and cost kept", got)
+	}
+
+	var seen []Policy
+	var mu sync.Mutex
+	rateLimitedDB.opts.observers = append(rateLimitedDB.opts.observers, func(ctx context.Context, info QueryInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, PolicyFrom(ctx))
+	})
+
+	if _, err := reports.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reports.ExecContext(WithTag(context.Background(), "export"), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rateLimitedDB.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 3 {
+		t.Fatalf("observed %d calls, want 3", len(seen))
+	}
+	if seen[0].Tag != "reports" || seen[0].Priority != PriorityLow || seen[0].Cost != 3 {
+		t.Errorf("view call policy = %+v, want the view's defaults", seen[0])
+	}
+	if seen[1].Tag != "export" || seen[1].Cost != 3 {
+		t.Errorf("view call policy = %+v, want the context's tag over the view's", seen[1])
+	}
+	if seen[2] != (Policy{}) {
+		t.Errorf("call policy = %+v, want r itself unaffected", seen[2])
+	}
+	if got := rateLimitedDB.Stats().Tags["reports"].Calls; got != 1 {
+		t.Errorf("reports calls = %d, want 1 in the shared statistics", got)
+	}
+
+	if err := reports.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rateLimitedDB.Ping(); err != nil {
+		t.Errorf("closing a view closed the database: %v", err)
+	}
+}